@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/koupleless/virtual-kubelet/tunnel/http_tunnel"
+	"github.com/sirupsen/logrus"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	logruslogger "github.com/virtual-kubelet/virtual-kubelet/log/logrus"
+)
+
+// base_simulator runs a local base which talks to the http_tunnel.HTTPTunnel of a virtual kubelet.
+func main() {
+	config := http_tunnel.BaseSimulatorConfig{}
+	flag.StringVar(&config.BaseID, "id", "base-simulator", "unique id of the base")
+	flag.StringVar(&config.Name, "name", "", "name of the base, default to the base id")
+	flag.StringVar(&config.Version, "version", "1.0.0", "version of the base")
+	flag.StringVar(&config.ClusterName, "cluster", "base-simulator-cluster", "cluster name of the base")
+	flag.StringVar(&config.LocalIP, "ip", "127.0.0.1", "ip the tunnel uses to call the base")
+	flag.IntVar(&config.HTTPPort, "port", 8888, "port of the base http server")
+	flag.StringVar(&config.TunnelAddress, "tunnel", "http://127.0.0.1:7777", "address of the http tunnel")
+	flag.DurationVar(&config.HeartBeatInterval, "heartbeat", 5*time.Second, "interval of heartbeat")
+	flag.DurationVar(&config.BizActivateDelay, "activate-delay", time.Second, "delay of biz activation after install")
+	flag.Int64Var(&config.CPUMilliCores, "cpu", 4000, "cpu capacity of the base in milli cores")
+	flag.Int64Var(&config.MemoryBytes, "memory", 8*1024*1024*1024, "memory capacity of the base in bytes")
+	flag.Parse()
+
+	log.L = logruslogger.FromLogrus(logrus.NewEntry(logrus.StandardLogger()))
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	if err := http_tunnel.NewBaseSimulator(config).Run(ctx); err != nil {
+		log.G(ctx).WithError(err).Error("base simulator exit")
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Summary:
+// This file defines the prometheus metrics of vnode, vpod and tunnel activities.
+// All metrics are registered on the controller-runtime metrics registry, so they are served by the metrics server of the manager.
+
+const (
+	namespace = "koupleless"
+	subsystem = "virtual_kubelet"
+)
+
+// Values of the state label of VNodeNum
+const (
+	VNodeStateAll         = "all"
+	VNodeStateUnReachable = "unreachable"
+	VNodeStateDead        = "dead"
+)
+
+// Values of the result label of BizOperationLatency
+const (
+	ResultSuccess = "success"
+	ResultFailed  = "failed"
+)
+
+// Values of the callback label of TunnelCallbackTotal
+const (
+	CallbackBaseDiscovered              = "base_discovered"
+	CallbackBaseStatusArrived           = "base_status_arrived"
+	CallbackAllBizStatusArrived         = "all_biz_status_arrived"
+	CallbackSingleBizStatusArrived      = "single_biz_status_arrived"
+	CallbackBizOperationResponseArrived = "biz_operation_response_arrived"
+	CallbackBizStatusDeltaArrived       = "biz_status_delta_arrived"
+)
+
+// Values of the result label of PodStatusUpdateTotal
+const (
+	PodStatusUpdateWritten = "written"
+	PodStatusUpdateMerged  = "merged"
+	PodStatusUpdateDropped = "dropped"
+)
+
+var (
+	// VNodeNum is the number of vnodes in the store by liveness state
+	VNodeNum = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "vnodes",
+		Help:      "Number of vnodes in the store by liveness state.",
+	}, []string{"state"})
+
+	// VNodeLeaseNum is the number of vnodes whose lease is held by the client
+	VNodeLeaseNum = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "vnode_leases",
+		Help:      "Number of vnodes whose lease is held by the client.",
+	}, []string{"client_id"})
+
+	// QueueDepth is the number of items waiting for processing in the queue of the node
+	QueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "queue_depth",
+		Help:      "Number of items waiting for processing in the queue of the node.",
+	}, []string{"queue", "node"})
+
+	// QueueRetryTotal is the number of items requeued after failed processing in the queue of the node
+	QueueRetryTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "queue_retries_total",
+		Help:      "Number of items requeued after failed processing in the queue of the node.",
+	}, []string{"queue", "node"})
+
+	// BizOperationLatency is the latency between a biz operation sent and its response arrived
+	BizOperationLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "biz_operation_duration_seconds",
+		Help:      "Latency between a biz operation sent and its response arrived.",
+		Buckets:   []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+	}, []string{"operation", "result"})
+
+	// TunnelCallbackTotal is the number of callbacks invoked by the tunnel
+	TunnelCallbackTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "tunnel_callbacks_total",
+		Help:      "Number of callbacks invoked by the tunnel.",
+	}, []string{"tunnel", "callback"})
+
+	// PodStatusUpdateTotal is the number of pod status updates from the provider by result, the merged updates are written by a later write
+	PodStatusUpdateTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "pod_status_updates_total",
+		Help:      "Number of pod status updates from the provider by result.",
+	}, []string{"result"})
+)
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(
+		VNodeNum,
+		VNodeLeaseNum,
+		QueueDepth,
+		QueueRetryTotal,
+		BizOperationLatency,
+		TunnelCallbackTotal,
+		PodStatusUpdateTotal,
+	)
+}
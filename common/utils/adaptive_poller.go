@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// AdaptivePoller polls with a jittered interval between the min and the max interval. The interval doubles each time a poll
+// observes no change, and resets to the min interval once a change is observed, so that the idle bases are polled less often
+// and the pollers of many bases spread over time instead of firing in bursts.
+type AdaptivePoller struct {
+	sync.Mutex
+
+	minInterval time.Duration // Interval after a change
+	maxInterval time.Duration // Interval after a long time without change
+	jitter      float64       // Max fraction of the interval randomly added or subtracted
+	interval    time.Duration // Current interval
+
+	wake chan struct{} // Channel for polling at once
+}
+
+// NewAdaptivePoller creates a new AdaptivePoller, the max interval is at least the min interval.
+func NewAdaptivePoller(minInterval time.Duration, maxIntervalMultiplier int, jitter float64) *AdaptivePoller {
+	if maxIntervalMultiplier < 1 {
+		maxIntervalMultiplier = 1
+	}
+	return &AdaptivePoller{
+		minInterval: minInterval,
+		maxInterval: minInterval * time.Duration(maxIntervalMultiplier),
+		jitter:      jitter,
+		interval:    minInterval,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// Run polls until the context is cancelled, the first poll is delayed randomly in the min interval.
+func (p *AdaptivePoller) Run(ctx context.Context, poll func(context.Context)) {
+	timer := time.NewTimer(time.Duration(rand.Int63n(int64(p.minInterval) + 1)))
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		case <-p.wake:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		}
+		poll(ctx)
+		timer.Reset(p.nextInterval())
+	}
+}
+
+// Observe records the result of a poll, the interval resets on change and backs off otherwise.
+func (p *AdaptivePoller) Observe(changed bool) {
+	p.Lock()
+	defer p.Unlock()
+	if changed {
+		p.interval = p.minInterval
+		return
+	}
+	p.interval *= 2
+	if p.interval > p.maxInterval {
+		p.interval = p.maxInterval
+	}
+}
+
+// SpeedUp resets the interval and polls at once, e.g. after a deployment.
+func (p *AdaptivePoller) SpeedUp() {
+	p.Observe(true)
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Interval returns the current interval without jitter.
+func (p *AdaptivePoller) Interval() time.Duration {
+	p.Lock()
+	defer p.Unlock()
+	return p.interval
+}
+
+// nextInterval returns the current interval with jitter
+func (p *AdaptivePoller) nextInterval() time.Duration {
+	interval := p.Interval()
+	if p.jitter <= 0 {
+		return interval
+	}
+	return interval + time.Duration((rand.Float64()*2-1)*p.jitter*float64(interval))
+}
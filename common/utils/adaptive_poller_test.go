@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdaptivePoller_Observe(t *testing.T) {
+	poller := NewAdaptivePoller(time.Second, 4, 0)
+	assert.Equal(t, time.Second, poller.Interval())
+
+	poller.Observe(false)
+	assert.Equal(t, 2*time.Second, poller.Interval())
+	poller.Observe(false)
+	poller.Observe(false)
+	assert.Equal(t, 4*time.Second, poller.Interval())
+
+	poller.Observe(true)
+	assert.Equal(t, time.Second, poller.Interval())
+
+	// no backoff
+	poller = NewAdaptivePoller(time.Second, 0, 0)
+	poller.Observe(false)
+	assert.Equal(t, time.Second, poller.Interval())
+}
+
+func TestAdaptivePoller_Jitter(t *testing.T) {
+	poller := NewAdaptivePoller(time.Second, 1, 0.2)
+	for i := 0; i < 100; i++ {
+		interval := poller.nextInterval()
+		assert.GreaterOrEqual(t, interval, 800*time.Millisecond)
+		assert.LessOrEqual(t, interval, 1200*time.Millisecond)
+	}
+}
+
+func TestAdaptivePoller_RunAndSpeedUp(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	poller := NewAdaptivePoller(time.Hour, 1, 0)
+	polled := atomic.Int32{}
+	go poller.Run(ctx, func(context.Context) {
+		polled.Add(1)
+	})
+
+	poller.SpeedUp()
+	assert.Eventually(t, func() bool {
+		return polled.Load() == 1
+	}, time.Second, 10*time.Millisecond)
+
+	poller.SpeedUp()
+	assert.Eventually(t, func() bool {
+		return polled.Load() == 2
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"sort"
+	"strconv"
+)
+
+// HashRing is a consistent hash ring of members, each member is placed on the ring by a number of virtual nodes,
+// so that only the keys of the joined or left member move when the members change.
+type HashRing struct {
+	members      []string          // Sorted members of the ring
+	hashes       []uint32          // Sorted hashes of the virtual nodes
+	hashToMember map[uint32]string // Member of each virtual node hash
+}
+
+// NewHashRing creates a new HashRing of the members, duplicated and empty members are ignored.
+func NewHashRing(members []string, virtualNodeNum int) *HashRing {
+	if virtualNodeNum <= 0 {
+		virtualNodeNum = 1
+	}
+	memberSet := make(map[string]bool, len(members))
+	sortedMembers := make([]string, 0, len(members))
+	for _, member := range members {
+		if member == "" || memberSet[member] {
+			continue
+		}
+		memberSet[member] = true
+		sortedMembers = append(sortedMembers, member)
+	}
+	sort.Strings(sortedMembers)
+
+	ring := &HashRing{
+		members:      sortedMembers,
+		hashes:       make([]uint32, 0, len(sortedMembers)*virtualNodeNum),
+		hashToMember: make(map[uint32]string, len(sortedMembers)*virtualNodeNum),
+	}
+	for _, member := range sortedMembers {
+		for i := 0; i < virtualNodeNum; i++ {
+			hash := hashKey(member + "#" + strconv.Itoa(i))
+			// the smaller member keeps the colliding virtual node, so that every replica builds the same ring
+			if _, has := ring.hashToMember[hash]; has {
+				continue
+			}
+			ring.hashToMember[hash] = member
+			ring.hashes = append(ring.hashes, hash)
+		}
+	}
+	sort.Slice(ring.hashes, func(i, j int) bool {
+		return ring.hashes[i] < ring.hashes[j]
+	})
+	return ring
+}
+
+// Get returns the member owning the key, empty if the ring has no member.
+func (r *HashRing) Get(key string) string {
+	if len(r.hashes) == 0 {
+		return ""
+	}
+	hash := hashKey(key)
+	index := sort.Search(len(r.hashes), func(i int) bool {
+		return r.hashes[i] >= hash
+	})
+	if index == len(r.hashes) {
+		index = 0
+	}
+	return r.hashToMember[r.hashes[index]]
+}
+
+// Members returns the sorted members of the ring.
+func (r *HashRing) Members() []string {
+	return r.members
+}
+
+// SameMembers returns whether the ring has the same members as the other one.
+func (r *HashRing) SameMembers(other *HashRing) bool {
+	if other == nil || len(r.members) != len(other.members) {
+		return false
+	}
+	for i, member := range r.members {
+		if other.members[i] != member {
+			return false
+		}
+	}
+	return true
+}
+
+// hashKey returns the first 32 bits of the SHA-1 of the key, which spreads the similar keys evenly over the ring
+func hashKey(key string) uint32 {
+	sum := sha1.Sum([]byte(key))
+	return binary.BigEndian.Uint32(sum[:4])
+}
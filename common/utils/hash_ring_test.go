@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashRing_Empty(t *testing.T) {
+	ring := NewHashRing(nil, 100)
+	assert.Equal(t, "", ring.Get("vnode.test"))
+	assert.Empty(t, ring.Members())
+}
+
+func TestHashRing_Deterministic(t *testing.T) {
+	ring1 := NewHashRing([]string{"vk-a", "vk-b", "vk-c", "vk-a", ""}, 100)
+	ring2 := NewHashRing([]string{"vk-c", "vk-b", "vk-a"}, 100)
+	assert.Equal(t, []string{"vk-a", "vk-b", "vk-c"}, ring1.Members())
+	assert.True(t, ring1.SameMembers(ring2))
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("vnode.%d", i)
+		assert.Equal(t, ring1.Get(key), ring2.Get(key))
+	}
+}
+
+func TestHashRing_BoundedRebalance(t *testing.T) {
+	before := NewHashRing([]string{"vk-a", "vk-b", "vk-c"}, 100)
+	after := NewHashRing([]string{"vk-a", "vk-b", "vk-c", "vk-d"}, 100)
+	assert.False(t, before.SameMembers(after))
+
+	moved := 0
+	owned := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("vnode.%d", i)
+		owned[after.Get(key)]++
+		if before.Get(key) != after.Get(key) {
+			// keys only move to the joined member
+			assert.Equal(t, "vk-d", after.Get(key))
+			moved++
+		}
+	}
+	assert.Equal(t, owned["vk-d"], moved)
+	assert.Less(t, moved, 500)
+	for _, member := range after.Members() {
+		assert.Greater(t, owned[member], 100)
+	}
+}
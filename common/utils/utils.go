@@ -2,8 +2,10 @@ package utils
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 	"time"
 
@@ -11,6 +13,7 @@ import (
 	"github.com/koupleless/virtual-kubelet/model"
 	"github.com/sirupsen/logrus"
 	"github.com/virtual-kubelet/virtual-kubelet/log"
+	coordinationv1 "k8s.io/api/coordination/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -146,12 +149,30 @@ func PodsEqual(pod1, pod2 *corev1.Pod) bool {
 		cmp.Equal(pod1.Spec.ActiveDeadlineSeconds, pod2.Spec.ActiveDeadlineSeconds) &&
 		cmp.Equal(pod1.Spec.Tolerations, pod2.Spec.Tolerations) &&
 		cmp.Equal(pod1.ObjectMeta.Labels, pod2.Labels) &&
-		cmp.Equal(pod1.ObjectMeta.Annotations, pod2.Annotations) &&
+		cmp.Equal(withoutVPodAnnotations(pod1.ObjectMeta.Annotations), withoutVPodAnnotations(pod2.Annotations)) &&
 		cmp.Equal(pod1.ObjectMeta.Finalizers, pod2.Finalizers)
 }
 
+// withoutVPodAnnotations returns the annotations without the ones recorded by the vk on the vpod only, nil if none left
+func withoutVPodAnnotations(annotations map[string]string) map[string]string {
+	if _, has := annotations[model.AnnotationKeyOfBizUpgradesState]; !has {
+		return annotations
+	}
+	ret := make(map[string]string, len(annotations))
+	for key, value := range annotations {
+		if key != model.AnnotationKeyOfBizUpgradesState {
+			ret[key] = value
+		}
+	}
+	if len(ret) == 0 {
+		return nil
+	}
+	return ret
+}
+
 func NodeStatusEqual(status1, status2 model.NodeStatusData) bool {
 	return cmp.Equal(status1.Resources, status2.Resources) &&
+		cmp.Equal(status1.BizResourceUsages, status2.BizResourceUsages) &&
 		cmp.Equal(status1.CustomConditions, status2.CustomConditions) &&
 		cmp.Equal(status1.CustomAnnotations, status2.CustomAnnotations) &&
 		cmp.Equal(status1.CustomLabels, status2.CustomLabels)
@@ -210,8 +231,22 @@ func MergeNodeFromProvider(node *corev1.Node, data model.NodeStatusData) *corev1
 	for _, condition := range conditionMap {
 		conditions = append(conditions, condition)
 	}
-	vnodeCopy.Status.Conditions = conditions       // Set the conditions on the vnode copy.
-	vnodeCopy.Annotations = data.CustomAnnotations // Set custom annotations.
+	vnodeCopy.Status.Conditions = conditions // Set the conditions on the vnode copy.
+	// Merge custom annotations, the annotations not set by the base are kept, e.g. the ones set by kubectl annotate.
+	if vnodeCopy.Annotations == nil {
+		vnodeCopy.Annotations = make(map[string]string)
+	}
+	for key, value := range data.CustomAnnotations {
+		vnodeCopy.Annotations[key] = value
+	}
+	// Set the per biz resource usage.
+	delete(vnodeCopy.Annotations, model.AnnotationKeyOfBizResourceUsage)
+	if len(data.BizResourceUsages) > 0 {
+		usage, err := json.Marshal(data.BizResourceUsages)
+		if err == nil {
+			vnodeCopy.Annotations[model.AnnotationKeyOfBizResourceUsage] = string(usage)
+		}
+	}
 	// Set custom labels.
 	for key, value := range data.CustomLabels {
 		vnodeCopy.Labels[key] = value
@@ -230,6 +265,64 @@ func MergeNodeFromProvider(node *corev1.Node, data model.NodeStatusData) *corev1
 	return vnodeCopy // Return the constructed vnode.
 }
 
+// GetPodResourceRequests returns the effective resource requests of the pod like the scheduler,
+// which is the max of the sum of the containers and any init container, plus one pod
+func GetPodResourceRequests(pod *corev1.Pod) corev1.ResourceList {
+	requests := corev1.ResourceList{}
+	for _, container := range pod.Spec.Containers {
+		AddResourceList(requests, container.Resources.Requests)
+	}
+	for _, container := range pod.Spec.InitContainers {
+		for name, quantity := range container.Resources.Requests {
+			if value, has := requests[name]; !has || quantity.Cmp(value) > 0 {
+				requests[name] = quantity.DeepCopy()
+			}
+		}
+	}
+	requests[corev1.ResourcePods] = *resource.NewQuantity(1, resource.DecimalSI)
+	return requests
+}
+
+// AddResourceList adds the quantities of src into dst
+func AddResourceList(dst, src corev1.ResourceList) {
+	for name, quantity := range src {
+		value := dst[name]
+		value.Add(quantity)
+		dst[name] = value
+	}
+}
+
+// SubtractResourceList returns the quantities of total minus used, the result is never negative
+func SubtractResourceList(total, used corev1.ResourceList) corev1.ResourceList {
+	ret := corev1.ResourceList{}
+	for name, quantity := range total {
+		value := quantity.DeepCopy()
+		if usedQuantity, has := used[name]; has {
+			value.Sub(usedQuantity)
+		}
+		if value.Sign() < 0 {
+			value.Set(0)
+		}
+		ret[name] = value
+	}
+	return ret
+}
+
+// GetInsufficientResources returns the names of the requested resources exceeding the available ones,
+// the resources not in available are not limited
+func GetInsufficientResources(available, requests corev1.ResourceList) []corev1.ResourceName {
+	ret := make([]corev1.ResourceName, 0)
+	for name, quantity := range requests {
+		if value, has := available[name]; has && quantity.Cmp(value) > 0 {
+			ret = append(ret, name)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i] < ret[j]
+	})
+	return ret
+}
+
 // ConvertBizStatusToContainerStatus converts tunnel container status to Kubernetes container status, if not the status for the container, then create a empty state container status
 func ConvertBizStatusToContainerStatus(container *corev1.Container, containerStatus *corev1.ContainerStatus, data *model.BizStatusData) (*corev1.ContainerStatus, error) {
 	// this may be a little complex to handle the case that parameters is not nil or for same container name
@@ -324,6 +417,71 @@ func ConvertBizStatusToContainerStatus(container *corev1.Container, containerSta
 	return &ret, nil
 }
 
+// ConvertBizStatusToInitContainerStatus converts the biz status to the status of the init container. An init biz is running once
+// activated, and completed once deactivated after activated as it is stopped then, a completed init biz stays completed, a broken
+// init biz is terminated if the pod never restarts it.
+func ConvertBizStatusToInitContainerStatus(container *corev1.Container, containerStatus *corev1.ContainerStatus, data *model.BizStatusData, restartPolicy corev1.RestartPolicy) (*corev1.ContainerStatus, error) {
+	if containerStatus != nil && IsInitContainerCompleted(containerStatus) {
+		return containerStatus, nil
+	}
+	ret, err := ConvertBizStatusToContainerStatus(container, containerStatus, data)
+	if err != nil || ret == nil || data == nil || container.Name != data.Name {
+		return ret, err
+	}
+
+	if strings.EqualFold(data.State, string(model.BizStateActivated)) {
+		// an init container is not ready until completed
+		ret.Ready = false
+	} else if containerStatus != nil && containerStatus.State.Running != nil && IsBizDeactivated(data.State) {
+		ret.Ready = true
+		ret.State = corev1.ContainerState{
+			Terminated: &corev1.ContainerStateTerminated{
+				ExitCode:   0,
+				Reason:     model.ContainerReasonCompleted,
+				StartedAt:  containerStatus.State.Running.StartedAt,
+				FinishedAt: metav1.Time{Time: data.ChangeTime},
+			},
+		}
+	} else if strings.EqualFold(data.State, string(model.BizStateBroken)) && restartPolicy == corev1.RestartPolicyNever {
+		reason := data.Reason
+		if reason == "" {
+			reason = model.ContainerReasonError
+		}
+		ret.State = corev1.ContainerState{
+			Terminated: &corev1.ContainerStateTerminated{
+				ExitCode:   1,
+				Reason:     reason,
+				Message:    data.Message,
+				StartedAt:  metav1.Time{Time: data.ChangeTime},
+				FinishedAt: metav1.Time{Time: data.ChangeTime},
+			},
+		}
+	}
+	return ret, nil
+}
+
+// IsBizDeactivated returns whether the biz in the state is not running any more after stopped
+func IsBizDeactivated(state string) bool {
+	switch model.BizState(strings.ToUpper(state)) {
+	case model.BizStateDeactivated, model.BizStateStopped, model.BizStateUnResolved:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsInitContainerCompleted returns whether the init container is terminated successfully
+func IsInitContainerCompleted(containerStatus *corev1.ContainerStatus) bool {
+	return containerStatus.State.Terminated != nil && containerStatus.State.Terminated.ExitCode == 0
+}
+
+// GetPodContainers returns the init containers followed by the containers of the pod
+func GetPodContainers(pod *corev1.Pod) []corev1.Container {
+	ret := make([]corev1.Container, 0, len(pod.Spec.InitContainers)+len(pod.Spec.Containers))
+	ret = append(ret, pod.Spec.InitContainers...)
+	return append(ret, pod.Spec.Containers...)
+}
+
 // SplitMetaNamespaceKey splits a key into namespace and name.
 func SplitMetaNamespaceKey(key string) (namespace, name string, err error) {
 	parts := strings.Split(key, "/")
@@ -340,7 +498,7 @@ func SplitMetaNamespaceKey(key string) (namespace, name string, err error) {
 }
 
 // GetBizVersionFromContainer extracts the biz version from a container's env vars
-func getBizVersionFromContainer(container *corev1.Container) string {
+func GetBizVersionFromContainer(container *corev1.Container) string {
 	bizVersion := ""
 	for _, env := range container.Env {
 		if env.Name == "BIZ_VERSION" {
@@ -352,22 +510,134 @@ func getBizVersionFromContainer(container *corev1.Container) string {
 }
 
 // GetBizIdentity creates a unique identifier from biz name and version
-func getBizIdentity(bizName, bizVersion string) string {
+func GetBizIdentity(bizName, bizVersion string) string {
 	return bizName + ":" + bizVersion
 }
 
 // GetBizUniqueKey returns a unique key for the container
 func GetBizUniqueKey(container *corev1.Container) string {
-	return getBizIdentity(container.Name, getBizVersionFromContainer(container))
+	return GetBizIdentity(container.Name, GetBizVersionFromContainer(container))
+}
+
+// DefaultBizClassifier classifies the containers with jar images as bizs and ignores the others
+var DefaultBizClassifier model.BizClassifier = model.BizClassifierFunc(func(container *corev1.Container) model.ContainerType {
+	if strings.Contains(container.Image, ".jar") {
+		return model.ContainerTypeBiz
+	}
+	return model.ContainerTypeIgnored
+})
+
+// ImageSuffixBizClassifier classifies the containers whose image has one of the suffixes as bizs, and the others as sidecars
+func ImageSuffixBizClassifier(suffixes ...string) model.BizClassifier {
+	return model.BizClassifierFunc(func(container *corev1.Container) model.ContainerType {
+		for _, suffix := range suffixes {
+			if strings.HasSuffix(container.Image, suffix) {
+				return model.ContainerTypeBiz
+			}
+		}
+		return model.ContainerTypeSidecar
+	})
+}
+
+// IsSharedBiz returns whether the container of the pod is a shared biz listed in the shared bizs annotation
+func IsSharedBiz(pod *corev1.Pod, containerName string) bool {
+	if containerName == "" {
+		return false
+	}
+	for _, name := range strings.Split(pod.Annotations[model.AnnotationKeyOfSharedBizs], ",") {
+		if strings.TrimSpace(name) == containerName {
+			return true
+		}
+	}
+	return false
+}
+
+// GetBizDependencies returns the dependencies of the biz containers declared in the biz dependencies annotation of the pod,
+// nil if not declared
+func GetBizDependencies(pod *corev1.Pod) (map[string][]string, error) {
+	value, has := pod.Annotations[model.AnnotationKeyOfBizDependencies]
+	if !has || value == "" {
+		return nil, nil
+	}
+	dependencies := make(map[string][]string)
+	if err := json.Unmarshal([]byte(value), &dependencies); err != nil {
+		return nil, fmt.Errorf("invalid biz dependencies %q: %w", value, err)
+	}
+	return dependencies, nil
+}
+
+// GetUpgradeStrategy returns the upgrade strategy declared in the upgrade strategy annotation of the pod,
+// model.UpgradeStrategyStopThenStart if not declared or invalid
+func GetUpgradeStrategy(pod *corev1.Pod) (model.UpgradeStrategy, error) {
+	switch strategy := model.UpgradeStrategy(pod.Annotations[model.AnnotationKeyOfUpgradeStrategy]); strategy {
+	case "":
+		return model.UpgradeStrategyStopThenStart, nil
+	case model.UpgradeStrategyStopThenStart, model.UpgradeStrategyStartThenStop, model.UpgradeStrategyHotReplace:
+		return strategy, nil
+	default:
+		return model.UpgradeStrategyStopThenStart, fmt.Errorf("invalid upgrade strategy %q", strategy)
+	}
+}
+
+// SortContainersByDependencies sorts the containers so that each container comes after the containers it depends on,
+// the independent containers keep their original order, the dependencies out of the containers are ignored
+func SortContainersByDependencies(containers []corev1.Container, dependencies map[string][]string) ([]corev1.Container, error) {
+	indexes := make(map[string]int, len(containers))
+	for i, container := range containers {
+		indexes[container.Name] = i
+	}
+	// count the unsorted dependencies of each container, and record the dependents of each container
+	dependencyNum := make([]int, len(containers))
+	dependents := make([][]int, len(containers))
+	for i, container := range containers {
+		for _, dependency := range dependencies[container.Name] {
+			if j, has := indexes[dependency]; has && j != i {
+				dependencyNum[i]++
+				dependents[j] = append(dependents[j], i)
+			}
+		}
+	}
+
+	sorted := make([]corev1.Container, 0, len(containers))
+	done := make([]bool, len(containers))
+	for len(sorted) < len(containers) {
+		// take the first container with all dependencies sorted
+		next := -1
+		for i := range containers {
+			if !done[i] && dependencyNum[i] == 0 {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			return nil, fmt.Errorf("circular biz dependencies %v", dependencies)
+		}
+		done[next] = true
+		sorted = append(sorted, containers[next])
+		for _, dependent := range dependents[next] {
+			dependencyNum[dependent]--
+		}
+	}
+	return sorted, nil
 }
 
-func FillPodKey(pods []corev1.Pod, bizStatusDatas []model.BizStatusData) (toUpdate []model.BizStatusData, toDelete []model.BizStatusData) {
+// FillPodKey fills the pod key of the biz status datas by the biz and init biz containers of the pods, returns the datas with and without pod key.
+// The pod key of a biz contained by more than one pod is filled with model.PodKeyAll, the status is fanned out to all of them.
+func FillPodKey(pods []corev1.Pod, bizStatusDatas []model.BizStatusData, bizClassifier model.BizClassifier) (toUpdate []model.BizStatusData, toDelete []model.BizStatusData) {
+	if bizClassifier == nil {
+		bizClassifier = DefaultBizClassifier
+	}
 	bizKeyToPodKey := make(map[string]string)
-	// 一个 vnode 上,  所有的 biz container name 是唯一的
+	// 一个 vnode 上, 除共享 biz 外, 所有的 biz container name 是唯一的
 	for _, pod := range pods {
-		for _, container := range pod.Spec.Containers {
-			if strings.Contains(container.Image, ".jar") {
-				bizKeyToPodKey[GetBizUniqueKey(&container)] = GetPodKey(&pod)
+		for _, container := range GetPodContainers(&pod) {
+			if bizClassifier.Classify(&container) == model.ContainerTypeBiz {
+				bizKey := GetBizUniqueKey(&container)
+				if podKey, has := bizKeyToPodKey[bizKey]; has && podKey != GetPodKey(&pod) {
+					bizKeyToPodKey[bizKey] = model.PodKeyAll
+				} else {
+					bizKeyToPodKey[bizKey] = GetPodKey(&pod)
+				}
 			}
 		}
 	}
@@ -383,9 +653,125 @@ func FillPodKey(pods []corev1.Pod, bizStatusDatas []model.BizStatusData) (toUpda
 			bizStatusDatasWithPodKey = append(bizStatusDatasWithPodKey, bizStatusDatas[i])
 		} else {
 			bizStatusDatasWithNoPodKey = append(bizStatusDatasWithNoPodKey, bizStatusDatas[i])
-			log.G(context.Background()).Infof("biz container %s in k8s not found, try to uninstall.", bizStatusDatas[i].Key)
+			log.G(context.Background()).Infof("biz container %s in k8s not found, treated as orphan.", bizStatusDatas[i].Key)
 		}
 	}
 
 	return bizStatusDatasWithPodKey, bizStatusDatasWithNoPodKey
 }
+
+// FillLivenessConfigDefaults returns the liveness config with the zero fields set to the defaults, the unreachable grace
+// not shorter than the heartbeat timeout and the lease renew period not shorter than the lease duration are clamped to
+// the default ratio of them
+func FillLivenessConfigDefaults(config model.LivenessConfig) model.LivenessConfig {
+	if config.HeartBeatTimeout <= 0 {
+		config.HeartBeatTimeout = model.NodeLeaseDurationSeconds * time.Second
+	}
+	if config.UnReachableGrace <= 0 {
+		config.UnReachableGrace = model.NodeLeaseUpdatePeriodSeconds * time.Second
+	}
+	// the lease duration is written in seconds
+	if config.LeaseDuration < time.Second {
+		config.LeaseDuration = model.NodeLeaseDurationSeconds * time.Second
+	}
+	if config.LeaseRenewPeriod <= 0 {
+		config.LeaseRenewPeriod = model.NodeLeaseUpdatePeriodSeconds * time.Second
+	}
+	if config.UnReachableGrace >= config.HeartBeatTimeout {
+		unReachableGrace := config.HeartBeatTimeout * model.NodeLeaseUpdatePeriodSeconds / model.NodeLeaseDurationSeconds
+		log.G(context.Background()).Warnf("unreachable grace %s is not shorter than heartbeat timeout %s, clamped to %s",
+			config.UnReachableGrace, config.HeartBeatTimeout, unReachableGrace)
+		config.UnReachableGrace = unReachableGrace
+	}
+	if config.LeaseRenewPeriod >= config.LeaseDuration {
+		leaseRenewPeriod := config.LeaseDuration * model.NodeLeaseUpdatePeriodSeconds / model.NodeLeaseDurationSeconds
+		log.G(context.Background()).Warnf("lease renew period %s is not shorter than lease duration %s, clamped to %s",
+			config.LeaseRenewPeriod, config.LeaseDuration, leaseRenewPeriod)
+		config.LeaseRenewPeriod = leaseRenewPeriod
+	}
+	if config.UnReachableScanInterval <= 0 {
+		config.UnReachableScanInterval = model.UnReachableScanIntervalSeconds * time.Second
+	}
+	if config.LeaseOutdatedScanInterval <= 0 {
+		config.LeaseOutdatedScanInterval = model.LeaseOutdatedScanIntervalSeconds * time.Second
+	}
+	return config
+}
+
+// FillPollingConfigDefaults fills the zero fields of the polling config with the defaults, a negative jitter means no jitter
+func FillPollingConfigDefaults(config model.PollingConfig) model.PollingConfig {
+	if config.HealthDataInterval <= 0 {
+		config.HealthDataInterval = model.HealthDataPollIntervalSeconds * time.Second
+	}
+	if config.BizStatusInterval <= 0 {
+		config.BizStatusInterval = model.BizStatusPollIntervalSeconds * time.Second
+	}
+	if config.MaxIntervalMultiplier <= 0 {
+		config.MaxIntervalMultiplier = model.PollMaxIntervalMultiplier
+	}
+	if config.Jitter == 0 {
+		config.Jitter = model.PollJitter
+	} else if config.Jitter < 0 {
+		config.Jitter = 0
+	}
+	return config
+}
+
+// FillPodStatusWriterConfigDefaults fills the zero fields of the pod status writer config with the defaults, a negative window means no coalescing
+func FillPodStatusWriterConfigDefaults(config model.PodStatusWriterConfig) model.PodStatusWriterConfig {
+	if config.CoalesceWindow == 0 {
+		config.CoalesceWindow = model.PodStatusCoalesceWindowMilliseconds * time.Millisecond
+	} else if config.CoalesceWindow < 0 {
+		config.CoalesceWindow = 0
+	}
+	if config.MaxConcurrentWrites <= 0 {
+		config.MaxConcurrentWrites = model.PodStatusMaxConcurrentWrites
+	}
+	return config
+}
+
+// FillOrphanBizGCConfigDefaults fills the zero fields of the orphan biz gc config with the defaults
+func FillOrphanBizGCConfigDefaults(config model.OrphanBizGCConfig) model.OrphanBizGCConfig {
+	if config.GracePeriod <= 0 {
+		config.GracePeriod = model.OrphanBizGCGracePeriodSeconds * time.Second
+	}
+	return config
+}
+
+// MergeLivenessConfigFromLabels overrides the vnode level fields of the liveness config with the liveness labels,
+// invalid label values are ignored, the merged config is validated as FillLivenessConfigDefaults does
+func MergeLivenessConfigFromLabels(config model.LivenessConfig, labels map[string]string) model.LivenessConfig {
+	labelKeyToField := map[string]*time.Duration{
+		model.LabelKeyOfHeartBeatTimeout: &config.HeartBeatTimeout,
+		model.LabelKeyOfUnReachableGrace: &config.UnReachableGrace,
+		model.LabelKeyOfLeaseDuration:    &config.LeaseDuration,
+		model.LabelKeyOfLeaseRenewPeriod: &config.LeaseRenewPeriod,
+	}
+	for labelKey, field := range labelKeyToField {
+		value, has := labels[labelKey]
+		if !has {
+			continue
+		}
+		duration, err := time.ParseDuration(value)
+		if err != nil || duration <= 0 {
+			log.G(context.Background()).Warnf("ignore invalid liveness label %s=%s", labelKey, value)
+			continue
+		}
+		*field = duration
+	}
+	return FillLivenessConfigDefaults(config)
+}
+
+// IsLeaseValid returns whether the lease is renewed in the lease duration, the duration is set by the holder
+// so that the holders with different liveness policy agree on the expiry.
+func IsLeaseValid(lease *coordinationv1.Lease) bool {
+	if lease.Spec.HolderIdentity == nil || lease.Spec.RenewTime == nil {
+		return false
+	}
+
+	leaseDurationSeconds := int32(model.NodeLeaseDurationSeconds)
+	if lease.Spec.LeaseDurationSeconds != nil && *lease.Spec.LeaseDurationSeconds > 0 {
+		leaseDurationSeconds = *lease.Spec.LeaseDurationSeconds
+	}
+	return !time.Now().After(lease.Spec.RenewTime.Time.Add(time.Second * time.Duration(leaseDurationSeconds)))
+}
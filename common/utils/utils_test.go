@@ -5,7 +5,9 @@ import (
 	"errors"
 	"github.com/koupleless/virtual-kubelet/model"
 	"github.com/stretchr/testify/assert"
+	coordinationv1 "k8s.io/api/coordination/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/utils/ptr"
 	"os"
@@ -126,6 +128,21 @@ func TestPodsEqual(t *testing.T) {
 		},
 	}))
 	assert.Equal(t, true, PodsEqual(&corev1.Pod{}, &corev1.Pod{}))
+	// the upgrade state recorded on the vpod only is ignored
+	assert.Equal(t, true, PodsEqual(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{model.AnnotationKeyOfBizUpgradesState: "{}"},
+		},
+	}, &corev1.Pod{}))
+	assert.Equal(t, true, PodsEqual(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{"suite": "suite", model.AnnotationKeyOfBizUpgradesState: "{}"},
+		},
+	}, &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{"suite": "suite"},
+		},
+	}))
 }
 
 func TestConvertByteNumToResourceQuantity_LTZero(t *testing.T) {
@@ -217,6 +234,60 @@ func TestConvertBizStatusToContainerStatus_DEACTIVED(t *testing.T) {
 	assert.Equal(t, "deactivated message", status.State.Waiting.Message)
 }
 
+func TestConvertBizStatusToInitContainerStatus(t *testing.T) {
+	container := &corev1.Container{Name: "init", Image: "init.jar"}
+	data := &model.BizStatusData{
+		Key:        "init:1.0.0",
+		Name:       "init",
+		PodKey:     "ns/pod",
+		State:      string(model.BizStateActivated),
+		ChangeTime: time.Now(),
+	}
+	// running once activated
+	running, err := ConvertBizStatusToInitContainerStatus(container, nil, data, corev1.RestartPolicyAlways)
+	assert.NoError(t, err)
+	assert.NotNil(t, running.State.Running)
+	assert.False(t, running.Ready)
+	assert.False(t, IsInitContainerCompleted(running))
+
+	// completed once deactivated after activated
+	startedAt := data.ChangeTime
+	data.State = string(model.BizStateDeactivated)
+	data.ChangeTime = data.ChangeTime.Add(time.Second)
+	status, err := ConvertBizStatusToInitContainerStatus(container, running, data, corev1.RestartPolicyAlways)
+	assert.NoError(t, err)
+	assert.True(t, IsInitContainerCompleted(status))
+	assert.Equal(t, model.ContainerReasonCompleted, status.State.Terminated.Reason)
+	assert.Equal(t, startedAt, status.State.Terminated.StartedAt.Time)
+	assert.Equal(t, data.ChangeTime, status.State.Terminated.FinishedAt.Time)
+	assert.True(t, status.Ready)
+
+	// not completed when deactivated before activated
+	waiting, err := ConvertBizStatusToInitContainerStatus(container, nil, data, corev1.RestartPolicyAlways)
+	assert.NoError(t, err)
+	assert.NotNil(t, waiting.State.Waiting)
+	assert.False(t, IsInitContainerCompleted(waiting))
+
+	// completed init container stays completed
+	data.State = string(model.BizStateStopped)
+	data.ChangeTime = data.ChangeTime.Add(time.Second)
+	stopped, err := ConvertBizStatusToInitContainerStatus(container, status, data, corev1.RestartPolicyAlways)
+	assert.NoError(t, err)
+	assert.Equal(t, status, stopped)
+
+	// broken init container waits for restart unless the pod never restarts
+	data.State = string(model.BizStateBroken)
+	status, err = ConvertBizStatusToInitContainerStatus(container, nil, data, corev1.RestartPolicyAlways)
+	assert.NoError(t, err)
+	assert.NotNil(t, status.State.Waiting)
+	assert.False(t, IsInitContainerCompleted(status))
+	status, err = ConvertBizStatusToInitContainerStatus(container, nil, data, corev1.RestartPolicyNever)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), status.State.Terminated.ExitCode)
+	assert.Equal(t, model.ContainerReasonError, status.State.Terminated.Reason)
+	assert.False(t, IsInitContainerCompleted(status))
+}
+
 func TestSplitMetaNamespaceKey(t *testing.T) {
 	namespace := ""
 	name := ""
@@ -339,8 +410,321 @@ func TestFillPodKey(t *testing.T) {
 		},
 	}
 
-	bizStatusDatasWithPodKey, bizStatusDatasWithNoPodKey := FillPodKey(pods, bizStatusDatas)
+	bizStatusDatasWithPodKey, bizStatusDatasWithNoPodKey := FillPodKey(pods, bizStatusDatas, nil)
 	assert.Equal(t, "ut-ns/ut-pod1", bizStatusDatasWithPodKey[0].PodKey)
 	assert.Equal(t, "ut-ns/ut-pod2", bizStatusDatasWithPodKey[1].PodKey)
 	assert.Equal(t, len(bizStatusDatasWithNoPodKey), 0)
 }
+
+func TestBizClassifier(t *testing.T) {
+	assert.Equal(t, model.ContainerTypeBiz, DefaultBizClassifier.Classify(&corev1.Container{Image: "biz.jar"}))
+	assert.Equal(t, model.ContainerTypeIgnored, DefaultBizClassifier.Classify(&corev1.Container{Image: "sidecar:latest"}))
+
+	classifier := ImageSuffixBizClassifier(".jar", ".zip")
+	assert.Equal(t, model.ContainerTypeBiz, classifier.Classify(&corev1.Container{Image: "biz.jar"}))
+	assert.Equal(t, model.ContainerTypeBiz, classifier.Classify(&corev1.Container{Image: "biz.zip"}))
+	assert.Equal(t, model.ContainerTypeSidecar, classifier.Classify(&corev1.Container{Image: "sidecar:latest"}))
+}
+
+func TestFillPodKey_WithBizClassifier(t *testing.T) {
+	pods := []corev1.Pod{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "ut-pod",
+				Namespace: "ut-ns",
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{Name: "ut-biz", Image: "registry/ut-biz:1.0.0"},
+				},
+			},
+		},
+	}
+	bizStatusDatas := []model.BizStatusData{
+		{
+			Key:  GetBizUniqueKey(&pods[0].Spec.Containers[0]),
+			Name: "ut-biz",
+		},
+	}
+
+	_, bizStatusDatasWithNoPodKey := FillPodKey(pods, bizStatusDatas, nil)
+	assert.Len(t, bizStatusDatasWithNoPodKey, 1)
+
+	ociClassifier := model.BizClassifierFunc(func(container *corev1.Container) model.ContainerType {
+		return model.ContainerTypeBiz
+	})
+	bizStatusDatas[0].PodKey = ""
+	bizStatusDatasWithPodKey, _ := FillPodKey(pods, bizStatusDatas, ociClassifier)
+	assert.Len(t, bizStatusDatasWithPodKey, 1)
+	assert.Equal(t, "ut-ns/ut-pod", bizStatusDatasWithPodKey[0].PodKey)
+}
+
+func TestFillPodKey_SharedBiz(t *testing.T) {
+	sharedBiz := corev1.Container{Name: "ut-shared", Image: "ut-shared.jar"}
+	pods := []corev1.Pod{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "ut-pod1", Namespace: "ut-ns"},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{sharedBiz}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "ut-pod2", Namespace: "ut-ns"},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{sharedBiz}},
+		},
+	}
+	bizStatusDatas := []model.BizStatusData{
+		{Key: GetBizUniqueKey(&sharedBiz), Name: "ut-shared"},
+	}
+
+	bizStatusDatasWithPodKey, bizStatusDatasWithNoPodKey := FillPodKey(pods, bizStatusDatas, nil)
+	assert.Len(t, bizStatusDatasWithNoPodKey, 0)
+	assert.Len(t, bizStatusDatasWithPodKey, 1)
+	assert.Equal(t, model.PodKeyAll, bizStatusDatasWithPodKey[0].PodKey)
+}
+
+func TestIsSharedBiz(t *testing.T) {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+		model.AnnotationKeyOfSharedBizs: "ut-shared1, ut-shared2",
+	}}}
+	assert.True(t, IsSharedBiz(pod, "ut-shared1"))
+	assert.True(t, IsSharedBiz(pod, "ut-shared2"))
+	assert.False(t, IsSharedBiz(pod, "ut-biz"))
+	assert.False(t, IsSharedBiz(&corev1.Pod{}, "ut-biz"))
+}
+
+func TestFillLivenessConfigDefaults(t *testing.T) {
+	config := FillLivenessConfigDefaults(model.LivenessConfig{
+		HeartBeatTimeout: time.Minute,
+	})
+	assert.Equal(t, time.Minute, config.HeartBeatTimeout)
+	assert.Equal(t, model.NodeLeaseUpdatePeriodSeconds*time.Second, config.UnReachableGrace)
+	assert.Equal(t, model.NodeLeaseDurationSeconds*time.Second, config.LeaseDuration)
+	assert.Equal(t, model.NodeLeaseUpdatePeriodSeconds*time.Second, config.LeaseRenewPeriod)
+	assert.Equal(t, model.UnReachableScanIntervalSeconds*time.Second, config.UnReachableScanInterval)
+	assert.Equal(t, model.LeaseOutdatedScanIntervalSeconds*time.Second, config.LeaseOutdatedScanInterval)
+}
+
+func TestFillLivenessConfigDefaults_Clamp(t *testing.T) {
+	config := FillLivenessConfigDefaults(model.LivenessConfig{
+		HeartBeatTimeout: 20 * time.Second,
+		UnReachableGrace: time.Minute,
+		LeaseDuration:    500 * time.Millisecond,
+		LeaseRenewPeriod: 2 * time.Minute,
+	})
+	assert.Equal(t, 5*time.Second, config.UnReachableGrace)
+	assert.Equal(t, model.NodeLeaseDurationSeconds*time.Second, config.LeaseDuration)
+	assert.Equal(t, model.NodeLeaseUpdatePeriodSeconds*time.Second, config.LeaseRenewPeriod)
+}
+
+func TestMergeLivenessConfigFromLabels(t *testing.T) {
+	config := MergeLivenessConfigFromLabels(FillLivenessConfigDefaults(model.LivenessConfig{}), map[string]string{
+		model.LabelKeyOfHeartBeatTimeout: "2m",
+		model.LabelKeyOfUnReachableGrace: "invalid",
+		model.LabelKeyOfLeaseDuration:    "-1s",
+		model.LabelKeyOfLeaseRenewPeriod: "1m",
+	})
+	assert.Equal(t, 2*time.Minute, config.HeartBeatTimeout)
+	assert.Equal(t, model.NodeLeaseUpdatePeriodSeconds*time.Second, config.UnReachableGrace)
+	assert.Equal(t, model.NodeLeaseDurationSeconds*time.Second, config.LeaseDuration)
+	assert.Equal(t, model.NodeLeaseUpdatePeriodSeconds*time.Second, config.LeaseRenewPeriod)
+}
+
+func TestGetPodResourceRequests(t *testing.T) {
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{
+				{
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{
+							corev1.ResourceCPU: resource.MustParse("2"),
+						},
+					},
+				},
+			},
+			Containers: []corev1.Container{
+				{
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{
+							corev1.ResourceCPU:    resource.MustParse("500m"),
+							corev1.ResourceMemory: resource.MustParse("1Gi"),
+						},
+					},
+				},
+				{
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{
+							corev1.ResourceMemory: resource.MustParse("1Gi"),
+						},
+					},
+				},
+			},
+		},
+	}
+	requests := GetPodResourceRequests(pod)
+	assert.True(t, resource.MustParse("2").Equal(requests[corev1.ResourceCPU]))
+	assert.True(t, resource.MustParse("2Gi").Equal(requests[corev1.ResourceMemory]))
+	assert.True(t, resource.MustParse("1").Equal(requests[corev1.ResourcePods]))
+}
+
+func TestGetInsufficientResources(t *testing.T) {
+	available := SubtractResourceList(corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse("1"),
+		corev1.ResourceMemory: resource.MustParse("1Gi"),
+	}, corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse("2"),
+		corev1.ResourceMemory: resource.MustParse("512Mi"),
+	})
+	assert.True(t, resource.MustParse("0").Equal(available[corev1.ResourceCPU]))
+	assert.True(t, resource.MustParse("512Mi").Equal(available[corev1.ResourceMemory]))
+
+	insufficient := GetInsufficientResources(available, corev1.ResourceList{
+		corev1.ResourceCPU:     resource.MustParse("100m"),
+		corev1.ResourceMemory:  resource.MustParse("256Mi"),
+		corev1.ResourceStorage: resource.MustParse("1Gi"), // not reported by the base
+	})
+	assert.Equal(t, []corev1.ResourceName{corev1.ResourceCPU}, insufficient)
+}
+
+func TestMergeNodeFromProvider_BizResourceUsages(t *testing.T) {
+	annotations := map[string]string{"custom": "value"}
+	node := MergeNodeFromProvider(&corev1.Node{}, model.NodeStatusData{
+		CustomAnnotations: annotations,
+		BizResourceUsages: map[string]corev1.ResourceList{
+			"biz:1.0.0": {
+				corev1.ResourceMemory: resource.MustParse("1Gi"),
+			},
+		},
+	})
+	assert.Equal(t, "value", node.Annotations["custom"])
+	assert.Equal(t, `{"biz:1.0.0":{"memory":"1Gi"}}`, node.Annotations[model.AnnotationKeyOfBizResourceUsage])
+	assert.Len(t, annotations, 1)
+
+	// the usage is removed when no longer reported
+	node = MergeNodeFromProvider(node, model.NodeStatusData{CustomAnnotations: annotations})
+	assert.Equal(t, "value", node.Annotations["custom"])
+	assert.NotContains(t, node.Annotations, model.AnnotationKeyOfBizResourceUsage)
+}
+
+func TestMergeNodeFromProvider_KeepAnnotations(t *testing.T) {
+	node := MergeNodeFromProvider(&corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				model.AnnotationKeyOfUnmanagedBizs: "biz1",
+				"custom":                           "old",
+			},
+		},
+	}, model.NodeStatusData{
+		CustomAnnotations: map[string]string{"custom": "new"},
+	})
+	assert.Equal(t, "biz1", node.Annotations[model.AnnotationKeyOfUnmanagedBizs])
+	assert.Equal(t, "new", node.Annotations["custom"])
+}
+
+func TestIsLeaseValid(t *testing.T) {
+	lease := &coordinationv1.Lease{}
+	assert.False(t, IsLeaseValid(lease))
+
+	lease.Spec.HolderIdentity = ptr.To("vk")
+	lease.Spec.RenewTime = &metav1.MicroTime{Time: time.Now()}
+	assert.True(t, IsLeaseValid(lease))
+
+	lease.Spec.RenewTime = &metav1.MicroTime{Time: time.Now().Add(-time.Second * (model.NodeLeaseDurationSeconds + 1))}
+	assert.False(t, IsLeaseValid(lease))
+
+	lease.Spec.LeaseDurationSeconds = ptr.To(int32(model.NodeLeaseDurationSeconds * 2))
+	assert.True(t, IsLeaseValid(lease))
+}
+
+func TestFillPollingConfigDefaults(t *testing.T) {
+	config := FillPollingConfigDefaults(model.PollingConfig{})
+	assert.Equal(t, model.HealthDataPollIntervalSeconds*time.Second, config.HealthDataInterval)
+	assert.Equal(t, model.BizStatusPollIntervalSeconds*time.Second, config.BizStatusInterval)
+	assert.Equal(t, model.PollMaxIntervalMultiplier, config.MaxIntervalMultiplier)
+	assert.Equal(t, model.PollJitter, config.Jitter)
+
+	config = FillPollingConfigDefaults(model.PollingConfig{BizStatusInterval: time.Minute, MaxIntervalMultiplier: 1, Jitter: -1})
+	assert.Equal(t, time.Minute, config.BizStatusInterval)
+	assert.Equal(t, 1, config.MaxIntervalMultiplier)
+	assert.Equal(t, float64(0), config.Jitter)
+}
+
+func TestFillPodStatusWriterConfigDefaults(t *testing.T) {
+	config := FillPodStatusWriterConfigDefaults(model.PodStatusWriterConfig{})
+	assert.Equal(t, model.PodStatusCoalesceWindowMilliseconds*time.Millisecond, config.CoalesceWindow)
+	assert.Equal(t, model.PodStatusMaxConcurrentWrites, config.MaxConcurrentWrites)
+
+	config = FillPodStatusWriterConfigDefaults(model.PodStatusWriterConfig{CoalesceWindow: -1, MaxConcurrentWrites: 1})
+	assert.Equal(t, time.Duration(0), config.CoalesceWindow)
+	assert.Equal(t, 1, config.MaxConcurrentWrites)
+}
+
+func TestFillOrphanBizGCConfigDefaults(t *testing.T) {
+	config := FillOrphanBizGCConfigDefaults(model.OrphanBizGCConfig{Enabled: true})
+	assert.True(t, config.Enabled)
+	assert.Equal(t, model.OrphanBizGCGracePeriodSeconds*time.Second, config.GracePeriod)
+
+	config = FillOrphanBizGCConfigDefaults(model.OrphanBizGCConfig{GracePeriod: time.Minute})
+	assert.Equal(t, time.Minute, config.GracePeriod)
+}
+
+func TestSortContainersByDependencies(t *testing.T) {
+	containers := []corev1.Container{{Name: "web"}, {Name: "core"}, {Name: "lib"}, {Name: "base"}}
+	names := func(containers []corev1.Container) []string {
+		ret := make([]string, 0, len(containers))
+		for _, container := range containers {
+			ret = append(ret, container.Name)
+		}
+		return ret
+	}
+
+	sorted, err := SortContainersByDependencies(containers, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"web", "core", "lib", "base"}, names(sorted))
+
+	sorted, err = SortContainersByDependencies(containers, map[string][]string{
+		"web":  {"core", "lib"},
+		"core": {"base", "missing"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"lib", "base", "core", "web"}, names(sorted))
+
+	_, err = SortContainersByDependencies(containers, map[string][]string{
+		"web":  {"core"},
+		"core": {"web"},
+	})
+	assert.Error(t, err)
+}
+
+func TestGetUpgradeStrategy(t *testing.T) {
+	strategy, err := GetUpgradeStrategy(&corev1.Pod{})
+	assert.NoError(t, err)
+	assert.Equal(t, model.UpgradeStrategyStopThenStart, strategy)
+
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+		model.AnnotationKeyOfUpgradeStrategy: string(model.UpgradeStrategyStartThenStop),
+	}}}
+	strategy, err = GetUpgradeStrategy(pod)
+	assert.NoError(t, err)
+	assert.Equal(t, model.UpgradeStrategyStartThenStop, strategy)
+
+	pod.Annotations[model.AnnotationKeyOfUpgradeStrategy] = "Recreate"
+	strategy, err = GetUpgradeStrategy(pod)
+	assert.Error(t, err)
+	assert.Equal(t, model.UpgradeStrategyStopThenStart, strategy)
+}
+
+func TestGetBizDependencies(t *testing.T) {
+	dependencies, err := GetBizDependencies(&corev1.Pod{})
+	assert.NoError(t, err)
+	assert.Nil(t, dependencies)
+
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+		model.AnnotationKeyOfBizDependencies: `{"web":["core"]}`,
+	}}}
+	dependencies, err = GetBizDependencies(pod)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{"web": {"core"}}, dependencies)
+
+	pod.Annotations[model.AnnotationKeyOfBizDependencies] = "web:core"
+	_, err = GetBizDependencies(pod)
+	assert.Error(t, err)
+}
@@ -22,6 +22,8 @@ const (
 // TrackSceneVPodDeploy is a constant string used to track the deployment of a vPod.
 const (
 	TrackSceneVPodDeploy = "vpod_deploy"
+	// TrackSceneOrphanBizGC is a constant string used to track the garbage collection of the orphan bizs on the bases.
+	TrackSceneOrphanBizGC = "orphan_biz_gc"
 )
 
 // These constants are used to identify specific events in the system, allowing for better monitoring and logging capabilities.
@@ -30,6 +32,8 @@ const (
 	TrackEventContainerShutdown = "ContainerShutdown" // Represents the event of a container shutting down.
 	TrackEventVPodDelete        = "PodDelete"         // Represents the event of a vPod being deleted.
 	TrackEventVPodUpdate        = "PodUpdate"         // Represents the event of a vPod being updated.
+	TrackEventOrphanBizStop     = "OrphanBizStop"     // Represents the event of an orphan biz being stopped.
+	TrackEventContainerUpgrade  = "ContainerUpgrade"  // Represents the event of a container being upgraded in place.
 )
 
 const (
@@ -45,6 +49,106 @@ const (
 	LabelKeyOfBaseVersion = "base.koupleless.io/version"
 	// LabelKeyOfBaseClusterName is the constant string used as a key for base cluster name.
 	LabelKeyOfBaseClusterName = "base.koupleless.io/cluster-name"
+	// LabelKeyOfVNodeTunnel is a constant string used as a key for the key of the tunnel which discovered the base.
+	LabelKeyOfVNodeTunnel = "vnode.koupleless.io/tunnel"
+	// LabelKeyOfHeartBeatTimeout is a constant string used as a key for the per vnode heartbeat timeout, e.g. 2m.
+	LabelKeyOfHeartBeatTimeout = "liveness.koupleless.io/heartbeat-timeout"
+	// LabelKeyOfUnReachableGrace is a constant string used as a key for the per vnode unreachable grace, e.g. 30s.
+	LabelKeyOfUnReachableGrace = "liveness.koupleless.io/unreachable-grace"
+	// LabelKeyOfLeaseDuration is a constant string used as a key for the per vnode lease duration, e.g. 40s.
+	LabelKeyOfLeaseDuration = "liveness.koupleless.io/lease-duration"
+	// LabelKeyOfLeaseRenewPeriod is a constant string used as a key for the per vnode lease renew period, e.g. 10s.
+	LabelKeyOfLeaseRenewPeriod = "liveness.koupleless.io/lease-renew-period"
+)
+
+const (
+	// PodKeyAll is the pod key of the status of a shared biz, which is fanned out to all the pods referencing the biz.
+	PodKeyAll = "all"
+	// AnnotationKeyOfSharedBizs is a constant string used as a key for the comma separated names of the biz containers of the pod
+	// shared with the other pods on the vnode, a shared biz is installed on first use and uninstalled on last release.
+	AnnotationKeyOfSharedBizs = "vpod.koupleless.io/shared-bizs"
+	// AnnotationKeyOfBizDependencies is a constant string used as a key for the json of the dependencies of the biz containers of the pod,
+	// mapping a container name to the names of the containers it depends on, e.g. {"web":["core"]}. The bizs are started one by one in
+	// dependency order, each after the previous one activated, and stopped one by one in reverse order, each after the previous one deactivated.
+	AnnotationKeyOfBizDependencies = "vpod.koupleless.io/biz-dependencies"
+	// AnnotationKeyOfUpgradeStrategy is a constant string used as a key for the UpgradeStrategy of the changed biz containers of the pod,
+	// UpgradeStrategyStopThenStart by default. The changed bizs are upgraded one by one, each after the previous one activated.
+	AnnotationKeyOfUpgradeStrategy = "vpod.koupleless.io/upgrade-strategy"
+	// AnnotationKeyOfBizUpgradesState is a constant string used as a key for the json of the PodBizUpgradesState of the pod, recorded by
+	// the vk on the vpod only, so the snapshot persists the upgrades to resume. It is ignored when comparing the vpod with the pod in kube.
+	AnnotationKeyOfBizUpgradesState = "vpod.koupleless.io/biz-upgrades-state"
+)
+
+// UpgradeStrategy is the strategy of upgrading a changed biz container of a pod in place
+type UpgradeStrategy string
+
+const (
+	// UpgradeStrategyStopThenStart stops the old biz, and starts the new biz once the old one stopped
+	UpgradeStrategyStopThenStart UpgradeStrategy = "StopThenStart"
+	// UpgradeStrategyStartThenStop starts the new biz beside the old one on the same base, and stops the old biz once the new one activated
+	UpgradeStrategyStartThenStop UpgradeStrategy = "StartThenStop"
+	// UpgradeStrategyHotReplace replaces the old biz with the new one natively by the tunnel implementing BizReplacer,
+	// falls back to UpgradeStrategyStopThenStart if not implemented
+	UpgradeStrategyHotReplace UpgradeStrategy = "HotReplace"
+)
+
+const (
+	// PodReasonNodeDrained is the reason of the pods terminated by the vnode drain.
+	PodReasonNodeDrained = "NodeDrained"
+	// PodConditionBizUpgraded is the type of the pod condition surfacing the progress of the in place biz upgrades of the pod,
+	// false while upgrading or once failed, true once all upgrades completed.
+	PodConditionBizUpgraded = "BizUpgraded"
+	// PodReasonContainersNotInitialized is the reason of the Initialized condition of the pods with init bizs not completed.
+	PodReasonContainersNotInitialized = "ContainersNotInitialized"
+	// ContainerReasonCompleted is the reason of the terminated init container whose biz completed.
+	ContainerReasonCompleted = "Completed"
+	// ContainerReasonError is the reason of the terminated init container whose biz failed without reason.
+	ContainerReasonError = "Error"
+	// ContainerReasonPodInitializing is the reason of the waiting containers of the pods still initializing.
+	ContainerReasonPodInitializing = "PodInitializing"
+)
+
+// The reasons of the node events of the vnode lifecycle transitions.
+const (
+	// NodeEventReasonDiscovered is the reason of the event when the base is discovered and the vnode is started.
+	NodeEventReasonDiscovered = "VNodeDiscovered"
+	// NodeEventReasonReady is the reason of the event when the vnode becomes ready.
+	NodeEventReasonReady = "VNodeReady"
+	// NodeEventReasonUnreachable is the reason of the event when the base misses its heartbeats and the vnode is marked not ready.
+	NodeEventReasonUnreachable = "VNodeUnreachable"
+	// NodeEventReasonDead is the reason of the event when the base is dead and the vnode is shut down.
+	NodeEventReasonDead = "VNodeDead"
+	// NodeEventReasonDraining is the reason of the event when the base is deactivated and the vnode starts draining.
+	NodeEventReasonDraining = "VNodeDraining"
+	// NodeEventReasonShutdown is the reason of the event when the vnode is shut down and deleted.
+	NodeEventReasonShutdown = "VNodeShutdown"
+	// NodeEventReasonLeaderAcquired is the reason of the event when the lease of the vnode is acquired by a vk.
+	NodeEventReasonLeaderAcquired = "LeaderAcquired"
+	// NodeEventReasonLeaderLost is the reason of the event when the lease of the vnode is acquired by another vk.
+	NodeEventReasonLeaderLost = "LeaderLost"
+	// NodeEventReasonLeaderHandedOff is the reason of the event when the leader hands off the lease of the vnode.
+	NodeEventReasonLeaderHandedOff = "LeaderHandedOff"
+	// NodeEventReasonOrphanBizFound is the reason of the event when an orphan biz is found by the garbage collection in dry run.
+	NodeEventReasonOrphanBizFound = "OrphanBizFound"
+	// NodeEventReasonOrphanBizStopped is the reason of the event when an orphan biz is stopped by the garbage collection.
+	NodeEventReasonOrphanBizStopped = "OrphanBizStopped"
+	// NodeEventReasonOrphanBizStopFailed is the reason of the event when an orphan biz failed to be stopped by the garbage collection.
+	NodeEventReasonOrphanBizStopFailed = "OrphanBizStopFailed"
+)
+
+const (
+	// LabelKeyOfVNodeName is a constant string used as a key for the name of the vnode which the object belongs to.
+	LabelKeyOfVNodeName = "vnode.koupleless.io/name"
+	// AnnotationKeyOfLeaseHandoff is a constant string used as a key for the json of the LeaseHandoff on the vnode lease.
+	AnnotationKeyOfLeaseHandoff = "vnode.koupleless.io/handoff"
+	// AnnotationKeyOfBizResourceUsage is a constant string used as a key for the json of the per biz resource usage reported by the base.
+	AnnotationKeyOfBizResourceUsage = "vnode.koupleless.io/biz-resource-usage"
+	// AnnotationKeyOfBaseIP is a constant string used as a key for the ip of the base of the vnode, the internal ip of the vnode
+	// is the address of its kubelet api when served.
+	AnnotationKeyOfBaseIP = "vnode.koupleless.io/base-ip"
+	// AnnotationKeyOfUnmanagedBizs is a constant string used as a key for the comma separated names or keys of the bizs on the vnode
+	// which are intentionally not managed by pods, and never stopped by the orphan biz garbage collection.
+	AnnotationKeyOfUnmanagedBizs = "vnode.koupleless.io/unmanaged-bizs"
 )
 
 const (
@@ -59,17 +163,20 @@ const (
 	ComponentVNode = "vnode"
 	// ComponentVNodeLease is a constant string used to identify the vnode lease component in the system.
 	ComponentVNodeLease = "vnode-lease"
+	// ComponentVKReplica is a constant string used to identify the lease of a vk replica in the system.
+	ComponentVKReplica = "vk-replica"
 )
 
 type ErrorCode string
 
-// CodeSuccess, CodeTimeout, CodeContainerStartTimeout, CodeContainerStartFailed, and CodeContainerStopFailed are constant ErrorCode values representing different error scenarios.
+// CodeSuccess, CodeTimeout, CodeContainerStartTimeout, CodeContainerStartFailed, CodeContainerStopFailed, and CodeContainerUpgradeFailed are constant ErrorCode values representing different error scenarios.
 const (
-	CodeSuccess               ErrorCode = "00000"
-	CodeTimeout               ErrorCode = "00001"
-	CodeContainerStartTimeout ErrorCode = "00002"
-	CodeContainerStartFailed  ErrorCode = "01002"
-	CodeContainerStopFailed   ErrorCode = "01003"
+	CodeSuccess                ErrorCode = "00000"
+	CodeTimeout                ErrorCode = "00001"
+	CodeContainerStartTimeout  ErrorCode = "00002"
+	CodeContainerStartFailed   ErrorCode = "01002"
+	CodeContainerStopFailed    ErrorCode = "01003"
+	CodeContainerUpgradeFailed ErrorCode = "01004"
 )
 
 // NodeState is the node curr status
@@ -103,11 +210,51 @@ const (
 	BizStateStopped BizState = "STOPPED" // Terminated
 )
 
+// ContainerType is the type of a container in a vpod, decided by the BizClassifier
+type ContainerType string
+
+const (
+	// ContainerTypeBiz means the container is a biz managed by the tunnel
+	ContainerTypeBiz ContainerType = "biz"
+	// ContainerTypeSidecar means the container is not managed by the tunnel, its status is reported as running
+	ContainerTypeSidecar ContainerType = "sidecar"
+	// ContainerTypeIgnored means the container is not managed by the tunnel, its status is not reported
+	ContainerTypeIgnored ContainerType = "ignored"
+)
+
 const (
+	// DefaultNodePodCapacity is the pod capacity of the node when the base reports no pod capacity.
+	DefaultNodePodCapacity = 65535
 	// NodeLeaseDurationSeconds is the duration of a node lease in seconds.
 	NodeLeaseDurationSeconds = 40
 	// NodeLeaseUpdatePeriodSeconds is the period of updating a node lease in seconds.
 	NodeLeaseUpdatePeriodSeconds = 10
 	// NodeLeaseMaxRetryTimes is the maximum number of times to retry updating a node lease.
 	NodeLeaseMaxRetryTimes = 5
+	// UnReachableScanIntervalSeconds is the default interval of scanning unreachable and dead vnodes in seconds.
+	UnReachableScanIntervalSeconds = 3
+	// LeaseOutdatedScanIntervalSeconds is the default interval of scanning lease outdated vnodes in seconds.
+	LeaseOutdatedScanIntervalSeconds = 5
+	// VNodeHandoffTimeoutSeconds is the max time a vnode leader waits for the in-flight pod syncs before handing off in seconds.
+	VNodeHandoffTimeoutSeconds = 10
+	// VPodStoreSnapshotIntervalSeconds is the interval of saving the changed vpods of a vnode in seconds.
+	VPodStoreSnapshotIntervalSeconds = 5
+	// HealthDataPollIntervalSeconds is the default min interval of fetching the health data of a base in seconds.
+	HealthDataPollIntervalSeconds = 10
+	// BizStatusPollIntervalSeconds is the default min interval of querying all biz status of a base in seconds.
+	BizStatusPollIntervalSeconds = 15
+	// PollMaxIntervalMultiplier is the default max interval of the polling backoff in multiples of the min interval.
+	PollMaxIntervalMultiplier = 4
+	// PollJitter is the default max fraction of the polling interval randomly added or subtracted.
+	PollJitter = 0.2
+	// ShardVirtualNodeNum is the number of virtual nodes of each vk replica on the consistent hash ring of the vnodes.
+	ShardVirtualNodeNum = 100
+	// ShardRebalanceMaxVNodeNum is the max number of vnodes a vk replica hands off in each shard rebalancing.
+	ShardRebalanceMaxVNodeNum = 10
+	// OrphanBizGCGracePeriodSeconds is the default duration a biz stays orphan before stopped by the garbage collection in seconds.
+	OrphanBizGCGracePeriodSeconds = 120
+	// PodStatusCoalesceWindowMilliseconds is the default window in which the successive status updates of a pod are merged into one write in milliseconds.
+	PodStatusCoalesceWindowMilliseconds = 500
+	// PodStatusMaxConcurrentWrites is the default max number of concurrent pod status writes to the api server of each vnode.
+	PodStatusMaxConcurrentWrites = 5
 )
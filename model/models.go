@@ -1,10 +1,14 @@
 package model
 
 import (
+	"context"
+	"crypto/tls"
 	"time"
 
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -44,19 +48,129 @@ type NodeStatusData struct {
 	CustomLabels      map[string]string                // Custom labels set by the tunnel
 	CustomAnnotations map[string]string                // Custom annotations set by the tunnel
 	CustomConditions  []v1.NodeCondition               // Custom conditions set by the tunnel
+	BizResourceUsages map[string]v1.ResourceList       // Resource usage of the bizs keyed by biz key, published in the node annotation
 }
 
 // BizStatusData is the status data of a container
 type BizStatusData struct {
 	Key        string    // Key generated by tunnel, must be the same as Tunnel GetBizUniqueKey of same container
 	Name       string    // Container name
-	PodKey     string    // Key of pod which contains this container ,you can set it to PodKeyAll to present a shared container
+	PodKey     string    // Key of pod which contains this container, you can set it to PodKeyAll to present a shared container
 	State      string    // State of the biz
 	ChangeTime time.Time // Time of state change
 	Reason     string    // Reason for state change
 	Message    string    // Message for state change
 }
 
+// BizStatusDelta is the biz status changes of a base between two revisions, reported by the tunnel implementing BizStatusDeltaReporter.
+// The revision of a base increases monotonically on every biz status change.
+type BizStatusDelta struct {
+	Revision         int64           // Revision of the base after the changes
+	PreviousRevision int64           // Revision of the base which the changes are based on, ignored by a full delta
+	Full             bool            // Whether the delta carries the status of all bizs, the bizs not carried are not installed
+	Bizs             []BizStatusData // Status of the changed bizs, or all bizs for a full delta
+}
+
+// BizStatsData is the resource usage sample of a biz, reported by the tunnel implementing BizStatsProvider
+type BizStatsData struct {
+	Key                     string    // Key generated by tunnel, must be the same as Tunnel GetBizUniqueKey of same container
+	Name                    string    // Container name
+	PodKey                  string    // Key of pod which contains this container
+	StartTime               time.Time // Time the biz started
+	Time                    time.Time // Time of the sample
+	CPUUsageNanoCores       uint64    // CPU usage of the biz averaged over the sample window, in nano cores
+	CPUUsageCoreNanoSeconds uint64    // Cumulative CPU usage of the biz since it started, in core nano seconds
+	MemoryUsageBytes        uint64    // Memory used by the biz
+	MemoryWorkingSetBytes   uint64    // Working set memory of the biz, which is used by metrics-server
+	ThreadCount             uint64    // Number of the live threads of the biz
+}
+
+// BizOperationType is the type of async biz operation
+type BizOperationType string
+
+const (
+	// BizOperationStart is the operation of starting a biz
+	BizOperationStart BizOperationType = "START"
+	// BizOperationStop is the operation of stopping a biz
+	BizOperationStop BizOperationType = "STOP"
+	// BizOperationReplace is the operation of replacing a biz with its new version in place
+	BizOperationReplace BizOperationType = "REPLACE"
+)
+
+// BizOperationResponse is the response of an async biz operation, correlated to the request by OperationID
+type BizOperationResponse struct {
+	OperationID   string           // ID returned by Tunnel StartBiz, StopBiz or BizReplacer ReplaceBiz
+	Type          BizOperationType // Type of the operation
+	PodKey        string           // Key of pod which contains the biz
+	BizKey        string           // Key of the biz, must be the same as Tunnel GetBizUniqueKey of same container
+	ContainerName string           // Container name
+	Success       bool             // Whether the operation succeeded
+	Reason        string           // Reason of failure
+	Message       string           // Message of the operation result
+	FinishTime    time.Time        // Time of the operation finished
+}
+
+// LeaseHandoff is the record of the in-flight work of a vnode, written on the lease by the leader handing off the vnode
+// The next leader resumes the work from the record instead of starting cold
+type LeaseHandoff struct {
+	Holder            string                `json:"holder"`            // Client id of the leader handing off
+	Time              time.Time             `json:"time"`              // Time of the handoff
+	PendingPodKeys    []string              `json:"pendingPodKeys"`    // Keys of the pods not synced from kubernetes yet
+	PendingOperations []HandoffBizOperation `json:"pendingOperations"` // Async biz operations waiting for the responses
+	PendingUpgrades   []PodBizUpgradesState `json:"pendingUpgrades"`   // In place biz upgrades of the pods to resume
+}
+
+// HandoffBizOperation is a pending async biz operation in the LeaseHandoff
+type HandoffBizOperation struct {
+	OperationID   string           `json:"operationID"`   // ID returned by Tunnel StartBiz or StopBiz
+	Type          BizOperationType `json:"type"`          // Type of the operation
+	PodKey        string           `json:"podKey"`        // Key of pod which contains the biz
+	ContainerName string           `json:"containerName"` // Container name
+}
+
+// BizUpgradeState is the state of an in place upgrade of a changed biz container of a pod
+type BizUpgradeState struct {
+	Strategy     UpgradeStrategy `json:"strategy"`     // Strategy of the upgrade
+	OldContainer v1.Container    `json:"oldContainer"` // Container of the old biz
+	NewContainer v1.Container    `json:"newContainer"` // Container of the new biz
+	NewStarted   bool            `json:"newStarted"`   // Whether the new biz is started
+}
+
+// PodBizUpgradesState is the state of the in place biz upgrades of a pod, recorded on the vpod and in the LeaseHandoff,
+// so the vk restarted or the next leader resumes the upgrades
+type PodBizUpgradesState struct {
+	PodKey          string            `json:"podKey"`                    // Key of the pod
+	Upgrades        []BizUpgradeState `json:"upgrades"`                  // Upgrades to run in order, the first one is running
+	Completed       int               `json:"completed"`                 // Number of the completed upgrades
+	Total           int               `json:"total"`                     // Number of all upgrades
+	Retained        []v1.Container    `json:"retained,omitempty"`        // Old bizs of the aborted start-then-stop upgrades still running
+	ReplacedBizKeys []string          `json:"replacedBizKeys,omitempty"` // Keys of the old bizs replaced by the upgrades
+}
+
+// BizClassifier decides which containers of a vpod are bizs managed by the tunnel, a tunnel can implement it to classify its own containers
+type BizClassifier interface {
+	// Classify returns the type of the container
+	Classify(container *v1.Container) ContainerType
+}
+
+// BizClassifierFunc is an adapter to use an ordinary function as a BizClassifier
+type BizClassifierFunc func(container *v1.Container) ContainerType
+
+// Classify calls f(container)
+func (f BizClassifierFunc) Classify(container *v1.Container) ContainerType {
+	return f(container)
+}
+
+// VPodStorePersister persists the snapshots of the vpods of the vnodes, so a restarted vk resumes the vpods without rediscovery
+type VPodStorePersister interface {
+	// Load returns the pods of the last snapshot of the vnode, nil if no snapshot
+	Load(ctx context.Context, nodeName string) ([]*v1.Pod, error)
+	// Save replaces the snapshot of the vnode with the pods
+	Save(ctx context.Context, nodeName string, pods []*v1.Pod) error
+	// Delete removes the snapshot of the vnode
+	Delete(ctx context.Context, nodeName string) error
+}
+
 type BuildVNodeConfig struct {
 	Client            client.Client     // Runtime client instance
 	KubeCache         cache.Cache       // Cache of kube resources
@@ -71,6 +185,19 @@ type BuildVNodeConfig struct {
 	CustomLabels      map[string]string // Custom labels set by the tunnel
 	CustomAnnotations map[string]string // Custom annotations set by the tunnel
 	WorkerNum         int               // Worker num, if num is 1, means execute Container events serially
+
+	EventRecorder record.EventRecorder // Recorder of kubernetes events
+
+	Liveness LivenessConfig // Liveness policy of the node
+
+	BizClassifier BizClassifier // Classifier of the containers, nil means utils.DefaultBizClassifier
+
+	KubeletAddress string // Address the kubelet api of the node is served on, advertised as the internal ip of the node instead of the node ip, empty means no kubelet api
+	KubeletPort    int32  // Port of the kubelet api registered in the node daemon endpoints, 0 means no kubelet api
+
+	VPodStorePersister VPodStorePersister // Persister of the vpods of the node, nil means the vpods are only kept in memory
+
+	PodStatusWriter PodStatusWriterConfig // Policy of writing the pod status to the api server
 }
 
 type BuildVNodeControllerConfig struct {
@@ -82,6 +209,73 @@ type BuildVNodeControllerConfig struct {
 	IsCluster        bool          // Whether the deployment is in a cluster
 	WorkloadMaxLevel int           // Maximum workload level
 	VNodeWorkerNum   int           // VNode container event processor worker num, default 1, means execute Container events serially
+
+	Liveness LivenessConfig // Liveness policy of the vnodes, zero fields fall back to the defaults
+
+	Polling PollingConfig // Polling policy of the bases, zero fields fall back to the defaults
+
+	DrainTimeout time.Duration // Max time waiting for bizs stopped when the base deactivates, 0 means shutting down the vnode without drain
+
+	BizClassifier BizClassifier // Classifier of the containers, nil means the tunnel if it implements BizClassifier, otherwise utils.DefaultBizClassifier
+
+	KubeletServer *KubeletServerConfig // Kubelet api server serving logs, exec, attach and port-forward of the vpods, nil means no kubelet api
+
+	VPodStorePersister VPodStorePersister // Persister of the vpods of the vnodes, nil means the vpods are only kept in memory
+
+	PodStatusWriter PodStatusWriterConfig // Policy of writing the pod status to the api server, zero fields fall back to the defaults
+
+	OrphanBizGC OrphanBizGCConfig // Policy of stopping the bizs running on the bases without pods
+}
+
+// KubeletServerConfig is the config of the kubelet api servers of the vnodes of the controller
+// Each vnode is served on its own port of the controller, and advertises the controller address and its port, so that
+// the apiserver and the metrics-server connect to the controller instead of the base, and the port tells the vnode
+// Exec, attach and port-forward are only served with the webhook auth or the client certificates required by ClientCAFile
+type KubeletServerConfig struct {
+	Address               string               // IP of the controller reachable from the apiserver, e.g. the pod ip from the downward api
+	MinPort               int32                // Min port of the servers of the vnodes
+	MaxPort               int32                // Max port of the servers of the vnodes, 0 means the ports are picked by the system
+	TLSConfig             *tls.Config          // TLS config of the server, nil means plain HTTP which is only for testing
+	ClientCAFile          string               // CA bundle verifying the client certificates, e.g. the kubelet client CA of the apiserver
+	AuthClient            kubernetes.Interface // Client of the TokenReview and SubjectAccessReview auth like the kubelet webhook auth, nil means no webhook auth
+	StreamIdleTimeout     time.Duration        // Max time an exec, attach or port-forward stream can be idle, default 30s
+	StreamCreationTimeout time.Duration        // Max time waiting for the streams created, default 30s
+}
+
+// LivenessConfig is the liveness policy of vnodes
+// The vnode level fields can be overridden per vnode by the liveness.koupleless.io labels set by the tunnel
+type LivenessConfig struct {
+	HeartBeatTimeout          time.Duration // Duration without heartbeat after which the vnode is dead, default NodeLeaseDurationSeconds
+	UnReachableGrace          time.Duration // Duration without heartbeat after which the vnode is unreachable, default NodeLeaseUpdatePeriodSeconds
+	LeaseDuration             time.Duration // Duration of the vnode lease, default NodeLeaseDurationSeconds
+	LeaseRenewPeriod          time.Duration // Period of renewing the vnode lease, default NodeLeaseUpdatePeriodSeconds
+	UnReachableScanInterval   time.Duration // Interval of scanning unreachable and dead vnodes, controller level only, default UnReachableScanIntervalSeconds
+	LeaseOutdatedScanInterval time.Duration // Interval of scanning lease outdated vnodes, controller level only, default LeaseOutdatedScanIntervalSeconds
+}
+
+// PollingConfig is the policy of polling the health data and the biz status of the bases
+// Each vnode polls with a jittered interval, which backs off while nothing changes and resets after a change or a deployment
+type PollingConfig struct {
+	Disabled              bool          // Whether the polling is disabled, the tunnel must push the base status and the biz status then
+	HealthDataInterval    time.Duration // Min interval of fetching the health data of a base, default HealthDataPollIntervalSeconds
+	BizStatusInterval     time.Duration // Min interval of querying all biz status of a base, default BizStatusPollIntervalSeconds
+	MaxIntervalMultiplier int           // Max interval of the backoff in multiples of the min interval, 1 means no backoff, default PollMaxIntervalMultiplier
+	Jitter                float64       // Max fraction of the interval randomly added or subtracted, negative means no jitter, default PollJitter
+}
+
+// PodStatusWriterConfig is the policy of writing the pod status of a vnode to the api server
+// The status updates of a pod arriving within the coalesce window are merged into one write of the latest status
+type PodStatusWriterConfig struct {
+	CoalesceWindow      time.Duration // Window in which the status updates of a pod are merged, negative means no coalescing, default PodStatusCoalesceWindowMilliseconds
+	MaxConcurrentWrites int           // Max number of concurrent status writes of a vnode, default PodStatusMaxConcurrentWrites
+}
+
+// OrphanBizGCConfig is the policy of the garbage collection of the orphan bizs, which run on a base without a pod in kubernetes
+// The bizs listed in the AnnotationKeyOfUnmanagedBizs annotation of the vnode are never collected
+type OrphanBizGCConfig struct {
+	Enabled     bool          // Whether the orphan bizs are collected
+	DryRun      bool          // Whether the orphan bizs are only reported by events instead of stopped
+	GracePeriod time.Duration // Duration a biz stays orphan before collected, default OrphanBizGCGracePeriodSeconds
 }
 
 // QueryBaselineRequest is the request parameters of query baseline func
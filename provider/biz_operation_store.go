@@ -0,0 +1,165 @@
+/**
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package provider
+
+import (
+	"sync"
+	"time"
+
+	"github.com/koupleless/virtual-kubelet/model"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Summary:
+// This file defines the BizOperationStore structure, which correlates the async biz operations sent through the tunnel
+// with the responses arrived later by operation id.
+// The responses arrived before their operations recorded are kept for the retention only, and the ids of the completed operations
+// are remembered for the retention, so the late responses of the timed out operations are dropped instead of kept forever.
+
+// BizOperation is an async biz operation waiting for its response
+type BizOperation struct {
+	Type      model.BizOperationType // Type of the operation
+	Pod       *corev1.Pod            // Pod which contains the biz
+	Container corev1.Container       // Container of the biz
+	StartTime time.Time              // Time of the operation sent
+}
+
+// earlyResponse is a response arrived before its operation recorded
+type earlyResponse struct {
+	response   model.BizOperationResponse // The response
+	arriveTime time.Time                  // Time of the response arrived
+}
+
+// BizOperationStore provides the in memory pending biz operations.
+type BizOperationStore struct {
+	sync.Mutex
+
+	retention time.Duration // How long the early responses and the completed operation ids are kept
+
+	operationIDToOperation    map[string]*BizOperation // Maps operation id to the pending operation
+	operationIDToResponse     map[string]earlyResponse // Maps operation id to the response arrived before the operation recorded
+	operationIDToCompleteTime map[string]time.Time     // Maps operation id to the complete time of the completed operation
+	lastExpireTime            time.Time                // Time of the last expiration of the kept entries
+}
+
+// NewBizOperationStore creates a new instance of BizOperationStore with the retention of the early responses and completed operation ids.
+func NewBizOperationStore(retention time.Duration) *BizOperationStore {
+	return &BizOperationStore{
+		retention:                 retention,
+		operationIDToOperation:    make(map[string]*BizOperation),
+		operationIDToResponse:     make(map[string]earlyResponse),
+		operationIDToCompleteTime: make(map[string]time.Time),
+	}
+}
+
+// PutOperation records a pending operation, if the response of the operation already arrived,
+// the operation is not recorded and the response is returned.
+func (r *BizOperationStore) PutOperation(operationID string, operation *BizOperation) (model.BizOperationResponse, bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	now := time.Now()
+	r.expire(now)
+	if early, has := r.operationIDToResponse[operationID]; has {
+		delete(r.operationIDToResponse, operationID)
+		r.operationIDToCompleteTime[operationID] = now
+		return early.response, true
+	}
+	r.operationIDToOperation[operationID] = operation
+	return model.BizOperationResponse{}, false
+}
+
+// CompleteOperation removes and returns the pending operation of the response. If the operation is not recorded yet,
+// the response is kept until the operation recorded or the retention passed. The response of a completed operation is dropped.
+func (r *BizOperationStore) CompleteOperation(response model.BizOperationResponse) (*BizOperation, bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	now := time.Now()
+	r.expire(now)
+	if operation, has := r.operationIDToOperation[response.OperationID]; has {
+		delete(r.operationIDToOperation, response.OperationID)
+		r.operationIDToCompleteTime[response.OperationID] = now
+		return operation, true
+	}
+	if _, completed := r.operationIDToCompleteTime[response.OperationID]; completed {
+		// a late response of the operation timed out or a duplicated response
+		return nil, false
+	}
+	r.operationIDToResponse[response.OperationID] = earlyResponse{
+		response:   response,
+		arriveTime: now,
+	}
+	return nil, false
+}
+
+// DropOperation completes the operation not waited for, so its response is dropped instead of kept as an early response.
+func (r *BizOperationStore) DropOperation(operationID string) {
+	r.Lock()
+	defer r.Unlock()
+
+	now := time.Now()
+	r.expire(now)
+	delete(r.operationIDToOperation, operationID)
+	delete(r.operationIDToResponse, operationID)
+	r.operationIDToCompleteTime[operationID] = now
+}
+
+// expire removes the early responses and completed operation ids kept longer than the retention, at most once per retention
+func (r *BizOperationStore) expire(now time.Time) {
+	if now.Sub(r.lastExpireTime) < r.retention {
+		return
+	}
+	r.lastExpireTime = now
+	for operationID, early := range r.operationIDToResponse {
+		if now.Sub(early.arriveTime) >= r.retention {
+			delete(r.operationIDToResponse, operationID)
+		}
+	}
+	for operationID, completeTime := range r.operationIDToCompleteTime {
+		if now.Sub(completeTime) >= r.retention {
+			delete(r.operationIDToCompleteTime, operationID)
+		}
+	}
+}
+
+// PendingNum returns the number of operations waiting for their responses.
+func (r *BizOperationStore) PendingNum() int {
+	r.Lock()
+	defer r.Unlock()
+
+	return len(r.operationIDToOperation)
+}
+
+// GetPendingOperations returns a copy of the pending operations keyed by operation id.
+func (r *BizOperationStore) GetPendingOperations() map[string]BizOperation {
+	r.Lock()
+	defer r.Unlock()
+
+	ret := make(map[string]BizOperation, len(r.operationIDToOperation))
+	for operationID, operation := range r.operationIDToOperation {
+		ret[operationID] = *operation
+	}
+	return ret
+}
+
+// IsPending checks whether the operation is still waiting for its response.
+func (r *BizOperationStore) IsPending(operationID string) bool {
+	r.Lock()
+	defer r.Unlock()
+
+	_, has := r.operationIDToOperation[operationID]
+	return has
+}
@@ -0,0 +1,93 @@
+package provider
+
+import (
+	"testing"
+	"time"
+
+	"github.com/koupleless/virtual-kubelet/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBizOperationStore_ResponseAfterOperation(t *testing.T) {
+	store := NewBizOperationStore(time.Minute)
+	_, arrived := store.PutOperation("op1", &BizOperation{Type: model.BizOperationStart})
+	assert.False(t, arrived)
+	assert.True(t, store.IsPending("op1"))
+
+	operation, has := store.CompleteOperation(model.BizOperationResponse{OperationID: "op1"})
+	assert.True(t, has)
+	assert.Equal(t, model.BizOperationStart, operation.Type)
+	assert.False(t, store.IsPending("op1"))
+}
+
+func TestBizOperationStore_ResponseBeforeOperation(t *testing.T) {
+	store := NewBizOperationStore(time.Minute)
+	operation, has := store.CompleteOperation(model.BizOperationResponse{OperationID: "op1", Success: true})
+	assert.False(t, has)
+	assert.Nil(t, operation)
+
+	response, arrived := store.PutOperation("op1", &BizOperation{Type: model.BizOperationStop})
+	assert.True(t, arrived)
+	assert.True(t, response.Success)
+	assert.False(t, store.IsPending("op1"))
+	assert.Empty(t, store.operationIDToResponse)
+}
+
+func TestBizOperationStore_GetPendingOperations(t *testing.T) {
+	store := NewBizOperationStore(time.Minute)
+	store.PutOperation("op1", &BizOperation{Type: model.BizOperationStart})
+	store.PutOperation("op2", &BizOperation{Type: model.BizOperationStop})
+	store.CompleteOperation(model.BizOperationResponse{OperationID: "op2"})
+
+	operations := store.GetPendingOperations()
+	assert.Len(t, operations, 1)
+	assert.Equal(t, model.BizOperationStart, operations["op1"].Type)
+}
+
+func TestBizOperationStore_LateResponseDropped(t *testing.T) {
+	store := NewBizOperationStore(time.Minute)
+	store.PutOperation("op1", &BizOperation{Type: model.BizOperationStart})
+	// completed by the timeout
+	_, has := store.CompleteOperation(model.BizOperationResponse{OperationID: "op1", Reason: "Timeout"})
+	assert.True(t, has)
+
+	_, has = store.CompleteOperation(model.BizOperationResponse{OperationID: "op1", Success: true})
+	assert.False(t, has)
+	assert.Empty(t, store.operationIDToResponse)
+}
+
+func TestBizOperationStore_DropOperation(t *testing.T) {
+	store := NewBizOperationStore(time.Minute)
+	store.PutOperation("op1", &BizOperation{Type: model.BizOperationStop})
+	store.DropOperation("op1")
+	assert.False(t, store.IsPending("op1"))
+
+	// the response after dropped is not kept
+	_, has := store.CompleteOperation(model.BizOperationResponse{OperationID: "op1"})
+	assert.False(t, has)
+	store.DropOperation("op2")
+	_, has = store.CompleteOperation(model.BizOperationResponse{OperationID: "op2"})
+	assert.False(t, has)
+	assert.Empty(t, store.operationIDToResponse)
+
+	// the response arrived before dropped is removed
+	store.CompleteOperation(model.BizOperationResponse{OperationID: "op3"})
+	store.DropOperation("op3")
+	assert.Empty(t, store.operationIDToResponse)
+}
+
+func TestBizOperationStore_Retention(t *testing.T) {
+	store := NewBizOperationStore(50 * time.Millisecond)
+	store.PutOperation("op1", &BizOperation{Type: model.BizOperationStart})
+	store.CompleteOperation(model.BizOperationResponse{OperationID: "op1"})
+	// the response of an operation never recorded
+	store.CompleteOperation(model.BizOperationResponse{OperationID: "unknown"})
+	assert.Len(t, store.operationIDToResponse, 1)
+	assert.Len(t, store.operationIDToCompleteTime, 1)
+
+	time.Sleep(100 * time.Millisecond)
+	store.CompleteOperation(model.BizOperationResponse{OperationID: "op2"})
+	assert.Len(t, store.operationIDToResponse, 1)
+	assert.Contains(t, store.operationIDToResponse, "op2")
+	assert.Empty(t, store.operationIDToCompleteTime)
+}
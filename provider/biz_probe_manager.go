@@ -0,0 +1,332 @@
+/**
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/koupleless/virtual-kubelet/common/utils"
+	"github.com/koupleless/virtual-kubelet/tunnel"
+	pkgerrors "github.com/pkg/errors"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Summary:
+// This file defines the BizProbeManager structure, which runs the liveness, readiness and startup probes of the activated bizs.
+// HTTP and TCP probes are sent to the base directly, exec probes are sent through the tunnel if it implements tunnel.BizExecProber.
+// Like the kubelet, liveness and readiness probes start after the startup probe succeeded.
+
+// ProbeType is the type of biz probe
+type ProbeType string
+
+const (
+	ProbeTypeLiveness  ProbeType = "Liveness"
+	ProbeTypeReadiness ProbeType = "Readiness"
+	ProbeTypeStartup   ProbeType = "Startup"
+)
+
+// Defaults of the probe fields, same as kubernetes
+const (
+	defaultProbePeriodSeconds    = 10
+	defaultProbeTimeoutSeconds   = 1
+	defaultProbeSuccessThreshold = 1
+	defaultProbeFailureThreshold = 3
+)
+
+// OnProbeResultChanged is the callback when the readiness or startup of a biz changed
+type OnProbeResultChanged func(podKey string)
+
+// OnProbeFailed is the callback when the liveness or startup probe of a biz failed, the biz should be restarted
+type OnProbeFailed func(podKey, containerName string, probeType ProbeType, message string)
+
+// BizProbeManager runs the probes of the bizs, keyed by container key
+type BizProbeManager struct {
+	sync.Mutex
+
+	nodeName string
+	localIP  string
+	tunnel   tunnel.Tunnel
+
+	onProbeResultChanged OnProbeResultChanged
+	onProbeFailed        OnProbeFailed
+
+	containerKeyToCancel  map[string]context.CancelFunc // Maps container key to the cancel func of its probe workers
+	containerKeyToReady   map[string]bool               // Maps container key to the readiness probe result
+	containerKeyToStarted map[string]bool               // Maps container key to the startup probe result
+}
+
+// NewBizProbeManager creates a new instance of BizProbeManager.
+func NewBizProbeManager(nodeName, localIP string, t tunnel.Tunnel, onProbeResultChanged OnProbeResultChanged, onProbeFailed OnProbeFailed) *BizProbeManager {
+	return &BizProbeManager{
+		nodeName:              nodeName,
+		localIP:               localIP,
+		tunnel:                t,
+		onProbeResultChanged:  onProbeResultChanged,
+		onProbeFailed:         onProbeFailed,
+		containerKeyToCancel:  make(map[string]context.CancelFunc),
+		containerKeyToReady:   make(map[string]bool),
+		containerKeyToStarted: make(map[string]bool),
+	}
+}
+
+// AddBiz starts the probe workers of the activated biz, nothing happens if the workers already started.
+func (m *BizProbeManager) AddBiz(pod *corev1.Pod, container *corev1.Container) {
+	if container.LivenessProbe == nil && container.ReadinessProbe == nil && container.StartupProbe == nil {
+		return
+	}
+
+	podKey := utils.GetPodKey(pod)
+	containerKey := utils.GetContainerKey(podKey, container.Name)
+
+	m.Lock()
+	defer m.Unlock()
+	if _, has := m.containerKeyToCancel[containerKey]; has {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.containerKeyToCancel[containerKey] = cancel
+
+	containerCopy := container.DeepCopy()
+	if container.StartupProbe != nil {
+		go m.runProbeWorker(ctx, podKey, containerCopy, ProbeTypeStartup, container.StartupProbe)
+	}
+	if container.ReadinessProbe != nil {
+		go m.runProbeWorker(ctx, podKey, containerCopy, ProbeTypeReadiness, container.ReadinessProbe)
+	}
+	if container.LivenessProbe != nil {
+		go m.runProbeWorker(ctx, podKey, containerCopy, ProbeTypeLiveness, container.LivenessProbe)
+	}
+}
+
+// RemoveBiz stops the probe workers and removes the probe results of the biz.
+func (m *BizProbeManager) RemoveBiz(containerKey string) {
+	m.Lock()
+	defer m.Unlock()
+
+	if cancel, has := m.containerKeyToCancel[containerKey]; has {
+		cancel()
+		delete(m.containerKeyToCancel, containerKey)
+	}
+	delete(m.containerKeyToReady, containerKey)
+	delete(m.containerKeyToStarted, containerKey)
+}
+
+// IsStarted checks whether the startup probe of the biz succeeded, always true without startup probe.
+func (m *BizProbeManager) IsStarted(containerKey string, container *corev1.Container) bool {
+	if container.StartupProbe == nil {
+		return true
+	}
+	m.Lock()
+	defer m.Unlock()
+	return m.containerKeyToStarted[containerKey]
+}
+
+// IsReady checks whether the readiness probe of the biz succeeded, always true without readiness probe.
+func (m *BizProbeManager) IsReady(containerKey string, container *corev1.Container) bool {
+	if container.ReadinessProbe == nil {
+		return true
+	}
+	m.Lock()
+	defer m.Unlock()
+	return m.containerKeyToReady[containerKey]
+}
+
+// setResult updates the probe result of the biz, returns whether the result changed.
+func (m *BizProbeManager) setResult(ctx context.Context, containerKey string, probeType ProbeType, success bool) bool {
+	m.Lock()
+	defer m.Unlock()
+
+	// the biz may be removed during probing
+	if ctx.Err() != nil {
+		return false
+	}
+
+	results := m.containerKeyToReady
+	if probeType == ProbeTypeStartup {
+		results = m.containerKeyToStarted
+	}
+	old, has := results[containerKey]
+	results[containerKey] = success
+	return !has || old != success
+}
+
+// runProbeWorker probes the biz periodically until the context is done.
+func (m *BizProbeManager) runProbeWorker(ctx context.Context, podKey string, container *corev1.Container, probeType ProbeType, probe *corev1.Probe) {
+	containerKey := utils.GetContainerKey(podKey, container.Name)
+	logger := log.G(ctx).WithField("containerKey", containerKey).WithField("probeType", probeType)
+
+	periodSeconds := probe.PeriodSeconds
+	if periodSeconds <= 0 {
+		periodSeconds = defaultProbePeriodSeconds
+	}
+	successThreshold := probe.SuccessThreshold
+	if successThreshold <= 0 {
+		successThreshold = defaultProbeSuccessThreshold
+	}
+	failureThreshold := probe.FailureThreshold
+	if failureThreshold <= 0 {
+		failureThreshold = defaultProbeFailureThreshold
+	}
+
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(time.Duration(probe.InitialDelaySeconds) * time.Second):
+	}
+
+	ticker := time.NewTicker(time.Duration(periodSeconds) * time.Second)
+	defer ticker.Stop()
+
+	var successes, failures int32
+	for {
+		started := m.IsStarted(containerKey, container)
+		if probeType == ProbeTypeStartup && started {
+			// startup probe is not needed after started
+			return
+		}
+
+		// liveness and readiness probes are disabled until the biz started
+		if probeType == ProbeTypeStartup || started {
+			err := m.runProbe(ctx, podKey, container, probe)
+			if err == nil {
+				successes++
+				failures = 0
+			} else {
+				logger.WithError(err).Debug("probe failed")
+				failures++
+				successes = 0
+			}
+
+			if successes >= successThreshold && probeType != ProbeTypeLiveness {
+				if m.setResult(ctx, containerKey, probeType, true) {
+					m.onProbeResultChanged(podKey)
+				}
+			}
+			if failures >= failureThreshold {
+				message := fmt.Sprintf("%s probe failed %d times: %v", probeType, failures, err)
+				if probeType == ProbeTypeReadiness {
+					if m.setResult(ctx, containerKey, probeType, false) {
+						m.onProbeResultChanged(podKey)
+					}
+				} else if ctx.Err() == nil {
+					// liveness or startup failure, the biz will be restarted and probed again after activated
+					logger.Info(message)
+					m.onProbeFailed(podKey, container.Name, probeType, message)
+					return
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runProbe runs the probe once, returns nil if the probe succeeded.
+func (m *BizProbeManager) runProbe(ctx context.Context, podKey string, container *corev1.Container, probe *corev1.Probe) error {
+	timeoutSeconds := probe.TimeoutSeconds
+	if timeoutSeconds <= 0 {
+		timeoutSeconds = defaultProbeTimeoutSeconds
+	}
+	timeout := time.Duration(timeoutSeconds) * time.Second
+
+	switch {
+	case probe.Exec != nil:
+		prober, ok := m.tunnel.(tunnel.BizExecProber)
+		if !ok {
+			return pkgerrors.Errorf("exec probe is not supported by tunnel %s", m.tunnel.Key())
+		}
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return prober.ExecProbe(ctx, m.nodeName, podKey, container, probe.Exec.Command)
+	case probe.HTTPGet != nil:
+		port, err := resolveProbePort(probe.HTTPGet.Port, container)
+		if err != nil {
+			return err
+		}
+		host := probe.HTTPGet.Host
+		if host == "" {
+			host = m.localIP
+		}
+		scheme := "http"
+		if probe.HTTPGet.Scheme == corev1.URISchemeHTTPS {
+			scheme = "https"
+		}
+		probeURL := url.URL{
+			Scheme: scheme,
+			Host:   net.JoinHostPort(host, strconv.Itoa(port)),
+			Path:   probe.HTTPGet.Path,
+		}
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, probeURL.String(), nil)
+		if err != nil {
+			return err
+		}
+		for _, header := range probe.HTTPGet.HTTPHeaders {
+			req.Header.Add(header.Name, header.Value)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+			return pkgerrors.Errorf("http probe failed with status %d", resp.StatusCode)
+		}
+		return nil
+	case probe.TCPSocket != nil:
+		port, err := resolveProbePort(probe.TCPSocket.Port, container)
+		if err != nil {
+			return err
+		}
+		host := probe.TCPSocket.Host
+		if host == "" {
+			host = m.localIP
+		}
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(port)), timeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	default:
+		return pkgerrors.New("probe handler is not supported")
+	}
+}
+
+// resolveProbePort resolves the probe port, the named port is looked up in the container ports.
+func resolveProbePort(port intstr.IntOrString, container *corev1.Container) (int, error) {
+	if port.Type == intstr.Int {
+		return port.IntValue(), nil
+	}
+	for _, containerPort := range container.Ports {
+		if containerPort.Name == port.StrVal {
+			return int(containerPort.ContainerPort), nil
+		}
+	}
+	return strconv.Atoi(port.StrVal)
+}
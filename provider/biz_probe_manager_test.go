@@ -0,0 +1,132 @@
+package provider
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/koupleless/virtual-kubelet/tunnel"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestBizProbeManager_Readiness(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ready" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(serverURL.Port())
+
+	changed := make(chan string, 10)
+	manager := NewBizProbeManager("node", "127.0.0.1", &tunnel.MockTunnel{}, func(podKey string) {
+		changed <- podKey
+	}, nil)
+
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "ns"}}
+	container := &corev1.Container{
+		Name:  "biz",
+		Image: "biz.jar",
+		Ports: []corev1.ContainerPort{{Name: "http", ContainerPort: int32(port)}},
+		ReadinessProbe: &corev1.Probe{
+			ProbeHandler: corev1.ProbeHandler{
+				HTTPGet: &corev1.HTTPGetAction{Path: "/ready", Port: intstr.FromString("http")},
+			},
+		},
+	}
+	assert.False(t, manager.IsReady("ns/pod/biz", container))
+	manager.AddBiz(pod, container)
+	// add again should not start new workers
+	manager.AddBiz(pod, container)
+
+	select {
+	case podKey := <-changed:
+		assert.Equal(t, "ns/pod", podKey)
+	case <-time.After(5 * time.Second):
+		t.Fatal("readiness probe result not changed")
+	}
+	assert.True(t, manager.IsReady("ns/pod/biz", container))
+
+	manager.RemoveBiz("ns/pod/biz")
+	assert.False(t, manager.IsReady("ns/pod/biz", container))
+	assert.True(t, manager.IsReady("ns/pod/biz", &corev1.Container{Name: "biz"}))
+}
+
+func TestBizProbeManager_LivenessFailed(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	port := listener.Addr().(*net.TCPAddr).Port
+	// close the listener so the tcp probe fails
+	listener.Close()
+
+	failed := make(chan ProbeType, 10)
+	manager := NewBizProbeManager("node", "127.0.0.1", &tunnel.MockTunnel{}, nil, func(podKey, containerName string, probeType ProbeType, message string) {
+		assert.Equal(t, "ns/pod", podKey)
+		assert.Equal(t, "biz", containerName)
+		failed <- probeType
+	})
+
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "ns"}}
+	container := &corev1.Container{
+		Name:  "biz",
+		Image: "biz.jar",
+		LivenessProbe: &corev1.Probe{
+			ProbeHandler: corev1.ProbeHandler{
+				TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt32(int32(port))},
+			},
+			FailureThreshold: 1,
+		},
+	}
+	manager.AddBiz(pod, container)
+
+	select {
+	case probeType := <-failed:
+		assert.Equal(t, ProbeTypeLiveness, probeType)
+	case <-time.After(5 * time.Second):
+		t.Fatal("liveness probe not failed")
+	}
+	manager.RemoveBiz("ns/pod/biz")
+}
+
+func TestBizProbeManager_ExecNotSupported(t *testing.T) {
+	manager := NewBizProbeManager("node", "127.0.0.1", &tunnel.MockTunnel{}, nil, nil)
+	err := manager.runProbe(context.TODO(), "ns/pod", &corev1.Container{Name: "biz"}, &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			Exec: &corev1.ExecAction{Command: []string{"true"}},
+		},
+	})
+	assert.Error(t, err)
+}
+
+type execProbeMockTunnel struct {
+	tunnel.MockTunnel
+}
+
+func (t *execProbeMockTunnel) ExecProbe(ctx context.Context, _, _ string, _ *corev1.Container, _ []string) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestBizProbeManager_ExecTimeout(t *testing.T) {
+	manager := NewBizProbeManager("node", "127.0.0.1", &execProbeMockTunnel{}, nil, nil)
+	start := time.Now()
+	err := manager.runProbe(context.TODO(), "ns/pod", &corev1.Container{Name: "biz"}, &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			Exec: &corev1.ExecAction{Command: []string{"sleep", "10"}},
+		},
+		TimeoutSeconds: 1,
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
@@ -0,0 +1,110 @@
+/**
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package provider
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// Summary:
+// This file defines the BizRestartStore structure, which keeps the restart count and the back-off of the failed bizs,
+// the back-off doubles from the initial duration up to the max duration like the kubelet container restart.
+
+const (
+	// DefaultBizRestartBackOff is the initial back-off of restarting a failed biz
+	DefaultBizRestartBackOff = 10 * time.Second
+	// MaxBizRestartBackOff is the max back-off of restarting a failed biz
+	MaxBizRestartBackOff = 5 * time.Minute
+)
+
+// BizRestartStore provides the in memory restart states of bizs, keyed by container key.
+type BizRestartStore struct {
+	sync.Mutex
+
+	backOff *flowcontrol.Backoff // Back-off of the containers
+
+	containerKeyToRestartCount map[string]int32       // Maps container key to the restart count
+	containerKeyToTimer        map[string]*time.Timer // Maps container key to the pending restart
+}
+
+// NewBizRestartStore creates a new instance of BizRestartStore.
+func NewBizRestartStore(initialBackOff, maxBackOff time.Duration) *BizRestartStore {
+	return &BizRestartStore{
+		backOff:                    flowcontrol.NewBackOff(initialBackOff, maxBackOff),
+		containerKeyToRestartCount: make(map[string]int32),
+		containerKeyToTimer:        make(map[string]*time.Timer),
+	}
+}
+
+// ScheduleRestart schedules the restart of the container after the back-off, the restart count is increased before restart.
+// No restart is scheduled if there is a pending one.
+func (r *BizRestartStore) ScheduleRestart(containerKey string, restart func()) (time.Duration, bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	if _, has := r.containerKeyToTimer[containerKey]; has {
+		return 0, false
+	}
+
+	r.backOff.Next(containerKey, r.backOff.Clock.Now())
+	delay := r.backOff.Get(containerKey)
+	r.containerKeyToTimer[containerKey] = time.AfterFunc(delay, func() {
+		r.Lock()
+		if _, has := r.containerKeyToTimer[containerKey]; !has {
+			// deleted before restart
+			r.Unlock()
+			return
+		}
+		delete(r.containerKeyToTimer, containerKey)
+		r.containerKeyToRestartCount[containerKey]++
+		r.Unlock()
+
+		restart()
+	})
+	return delay, true
+}
+
+// IsBackingOff checks whether the container is waiting for the restart.
+func (r *BizRestartStore) IsBackingOff(containerKey string) bool {
+	r.Lock()
+	defer r.Unlock()
+
+	_, has := r.containerKeyToTimer[containerKey]
+	return has
+}
+
+// GetRestartCount returns the restart count of the container.
+func (r *BizRestartStore) GetRestartCount(containerKey string) int32 {
+	r.Lock()
+	defer r.Unlock()
+
+	return r.containerKeyToRestartCount[containerKey]
+}
+
+// Delete cancels the pending restart and removes the restart state of the container.
+func (r *BizRestartStore) Delete(containerKey string) {
+	r.Lock()
+	defer r.Unlock()
+
+	if timer, has := r.containerKeyToTimer[containerKey]; has {
+		timer.Stop()
+		delete(r.containerKeyToTimer, containerKey)
+	}
+	delete(r.containerKeyToRestartCount, containerKey)
+	r.backOff.Reset(containerKey)
+}
@@ -0,0 +1,48 @@
+package provider
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBizRestartStore_ScheduleRestart(t *testing.T) {
+	store := NewBizRestartStore(10*time.Millisecond, 40*time.Millisecond)
+	restarted := make(chan struct{}, 1)
+	restart := func() {
+		restarted <- struct{}{}
+	}
+
+	delay, scheduled := store.ScheduleRestart("ns/pod/biz", restart)
+	assert.True(t, scheduled)
+	assert.Equal(t, 10*time.Millisecond, delay)
+	assert.True(t, store.IsBackingOff("ns/pod/biz"))
+	_, scheduled = store.ScheduleRestart("ns/pod/biz", restart)
+	assert.False(t, scheduled)
+
+	<-restarted
+	assert.False(t, store.IsBackingOff("ns/pod/biz"))
+	assert.Equal(t, int32(1), store.GetRestartCount("ns/pod/biz"))
+
+	delay, scheduled = store.ScheduleRestart("ns/pod/biz", restart)
+	assert.True(t, scheduled)
+	assert.Equal(t, 20*time.Millisecond, delay)
+	<-restarted
+	assert.Equal(t, int32(2), store.GetRestartCount("ns/pod/biz"))
+}
+
+func TestBizRestartStore_Delete(t *testing.T) {
+	store := NewBizRestartStore(10*time.Millisecond, 40*time.Millisecond)
+	restarted := false
+	_, scheduled := store.ScheduleRestart("ns/pod/biz", func() {
+		restarted = true
+	})
+	assert.True(t, scheduled)
+	store.Delete("ns/pod/biz")
+	assert.False(t, store.IsBackingOff("ns/pod/biz"))
+
+	time.Sleep(30 * time.Millisecond)
+	assert.False(t, restarted)
+	assert.Equal(t, int32(0), store.GetRestartCount("ns/pod/biz"))
+}
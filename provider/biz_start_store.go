@@ -0,0 +1,298 @@
+/**
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package provider
+
+import (
+	"sync"
+	"time"
+
+	"github.com/koupleless/virtual-kubelet/common/utils"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Summary:
+// This file defines the BizStartStore structure, which keeps the bizs of the pods waiting to be started in dependency order.
+// Each pod starts one biz at a time, the next biz is started once the biz waited for is activated. The init bizs of a pod are
+// started the same way, each after the previous one completed, followed by the batch of the bizs of the pod. The bizs declaring
+// dependencies are stopped in reverse order the same way, the next biz is stopped once the biz waited for is deactivated.
+// A chain waiting for a biz longer than the timeout is dropped for a start, and continues with the next biz for a stop.
+
+// pendingBizStart is the bizs of a pod waiting to be started
+type pendingBizStart struct {
+	waitingFor string             // Name of the started container waited for activation, or completion for an init container
+	containers []corev1.Container // Containers to start in order after the one waited for
+	then       []corev1.Container // Containers to start as a batch after the last one of containers ready
+	timer      *time.Timer        // Timer of the chain timeout waiting for the container
+}
+
+// pendingBizStop is the bizs of a pod waiting to be stopped
+type pendingBizStop struct {
+	pod        *corev1.Pod        // Pod of the bizs, kept as the pod may be deleted before its bizs stopped
+	waitingFor string             // Unique key of the stopped biz waited for deactivation
+	containers []corev1.Container // Containers to stop in order after the one waited for
+	timer      *time.Timer        // Timer of the chain timeout waiting for the biz
+}
+
+// BizStop is the next biz of a pod to stop in a stop chain
+type BizStop struct {
+	Pod       *corev1.Pod
+	Container corev1.Container
+}
+
+// BizStartTimeoutFunc is called once the container waited for by the start chain of the pod timed out, the chain is dropped
+type BizStartTimeoutFunc func(podKey, waitingFor string)
+
+// BizStopTimeoutFunc is called once the biz waited for by the stop chain of the pod timed out, with the next biz to stop if any
+type BizStopTimeoutFunc func(pod *corev1.Pod, waitingFor string, next *corev1.Container)
+
+// BizStartStore provides the in memory pending biz starts and stops, keyed by pod key.
+type BizStartStore struct {
+	sync.Mutex
+
+	timeout        time.Duration       // Max time a chain waits for a biz
+	onStartTimeout BizStartTimeoutFunc // Called once a start chain timed out
+	onStopTimeout  BizStopTimeoutFunc  // Called once a stop chain timed out
+
+	podKeyToPendingStart map[string]*pendingBizStart // Maps pod key to the pending biz starts
+	podKeyToPendingStop  map[string]*pendingBizStop  // Maps pod key to the pending biz stops
+}
+
+// NewBizStartStore creates a new instance of BizStartStore, the chains wait for a biz at most the timeout.
+func NewBizStartStore(timeout time.Duration, onStartTimeout BizStartTimeoutFunc, onStopTimeout BizStopTimeoutFunc) *BizStartStore {
+	return &BizStartStore{
+		timeout:              timeout,
+		onStartTimeout:       onStartTimeout,
+		onStopTimeout:        onStopTimeout,
+		podKeyToPendingStart: make(map[string]*pendingBizStart),
+		podKeyToPendingStop:  make(map[string]*pendingBizStop),
+	}
+}
+
+// PutPendingStart records the containers to start in order after the container waited for is activated, and the containers
+// to start as a batch after them, the previous pending starts of the pod are replaced.
+func (r *BizStartStore) PutPendingStart(podKey, waitingFor string, containers, then []corev1.Container) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.deleteStart(podKey)
+	if len(containers) == 0 && len(then) == 0 {
+		return
+	}
+	pending := &pendingBizStart{
+		waitingFor: waitingFor,
+		containers: containers,
+		then:       then,
+	}
+	r.podKeyToPendingStart[podKey] = pending
+	r.timeoutStart(podKey, pending)
+}
+
+// NextStart returns the next containers to start if the container activated is the one waited for, which is the next
+// container in order becoming the one waited for, or the batch once no container left in order.
+func (r *BizStartStore) NextStart(podKey, activated string) ([]corev1.Container, bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	pending, has := r.podKeyToPendingStart[podKey]
+	if !has || pending.waitingFor != activated {
+		return nil, false
+	}
+	if len(pending.containers) == 0 {
+		r.deleteStart(podKey)
+		return pending.then, true
+	}
+	next := pending.containers[0]
+	pending.waitingFor = next.Name
+	pending.containers = pending.containers[1:]
+	if len(pending.containers) == 0 && len(pending.then) == 0 {
+		r.deleteStart(podKey)
+	} else {
+		r.timeoutStart(podKey, pending)
+	}
+	return []corev1.Container{next}, true
+}
+
+// GetWaitingFor returns the name of the container waited for activation of the pod, empty if no pending starts.
+func (r *BizStartStore) GetWaitingFor(podKey string) string {
+	r.Lock()
+	defer r.Unlock()
+
+	if pending, has := r.podKeyToPendingStart[podKey]; has {
+		return pending.waitingFor
+	}
+	return ""
+}
+
+// IsPendingStart returns whether the container of the pod is waited for activation or waiting to be started by the start chain.
+func (r *BizStartStore) IsPendingStart(podKey, containerName string) bool {
+	r.Lock()
+	defer r.Unlock()
+
+	pending, has := r.podKeyToPendingStart[podKey]
+	if !has {
+		return false
+	}
+	if pending.waitingFor == containerName {
+		return true
+	}
+	for _, containers := range [][]corev1.Container{pending.containers, pending.then} {
+		for _, container := range containers {
+			if container.Name == containerName {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Delete removes the pending starts of the pod, the pending stops are kept as the bizs are still to be stopped.
+func (r *BizStartStore) Delete(podKey string) {
+	r.Lock()
+	defer r.Unlock()
+	r.deleteStart(podKey)
+}
+
+// PutPendingStop records the containers of the pod to stop in order one by one, returns the first container to stop now.
+// The containers are appended to the pending stops of the pod if any, nothing is stopped now then.
+func (r *BizStartStore) PutPendingStop(pod *corev1.Pod, containers []corev1.Container) (corev1.Container, bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	if len(containers) == 0 {
+		return corev1.Container{}, false
+	}
+	podKey := utils.GetPodKey(pod)
+	if pending, has := r.podKeyToPendingStop[podKey]; has {
+		pending.containers = append(pending.containers, containers...)
+		return corev1.Container{}, false
+	}
+	pending := &pendingBizStop{
+		pod:        pod,
+		waitingFor: utils.GetBizUniqueKey(&containers[0]),
+		containers: containers[1:],
+	}
+	r.podKeyToPendingStop[podKey] = pending
+	r.timeoutStop(podKey, pending)
+	return containers[0], true
+}
+
+// NextStop returns the next bizs to stop of the pods waiting for the deactivated biz, each becoming the one waited for.
+func (r *BizStartStore) NextStop(deactivatedBizKey string) []BizStop {
+	r.Lock()
+	defer r.Unlock()
+
+	var next []BizStop
+	for podKey, pending := range r.podKeyToPendingStop {
+		if pending.waitingFor != deactivatedBizKey {
+			continue
+		}
+		if stop, has := r.nextStop(podKey, pending); has {
+			next = append(next, stop)
+		}
+	}
+	return next
+}
+
+// GetStopWaitingFor returns the unique keys of the bizs waited for deactivation of all pods.
+func (r *BizStartStore) GetStopWaitingFor() []string {
+	r.Lock()
+	defer r.Unlock()
+
+	bizKeys := make([]string, 0, len(r.podKeyToPendingStop))
+	for _, pending := range r.podKeyToPendingStop {
+		bizKeys = append(bizKeys, pending.waitingFor)
+	}
+	return bizKeys
+}
+
+// HasPendingStop returns whether any biz is waiting to be stopped.
+func (r *BizStartStore) HasPendingStop() bool {
+	r.Lock()
+	defer r.Unlock()
+	return len(r.podKeyToPendingStop) > 0
+}
+
+// nextStop pops the next container of the pending stops of the pod, the pending stops are removed once no container left.
+func (r *BizStartStore) nextStop(podKey string, pending *pendingBizStop) (BizStop, bool) {
+	if len(pending.containers) == 0 {
+		pending.timer.Stop()
+		delete(r.podKeyToPendingStop, podKey)
+		return BizStop{}, false
+	}
+	next := pending.containers[0]
+	pending.waitingFor = utils.GetBizUniqueKey(&next)
+	pending.containers = pending.containers[1:]
+	r.timeoutStop(podKey, pending)
+	return BizStop{Pod: pending.pod, Container: next}, true
+}
+
+// deleteStart removes the pending starts of the pod and stops its timer.
+func (r *BizStartStore) deleteStart(podKey string) {
+	if pending, has := r.podKeyToPendingStart[podKey]; has {
+		pending.timer.Stop()
+		delete(r.podKeyToPendingStart, podKey)
+	}
+}
+
+// timeoutStart restarts the timeout of the start chain waiting for the next biz, the chain is dropped once timed out.
+func (r *BizStartStore) timeoutStart(podKey string, pending *pendingBizStart) {
+	if pending.timer != nil {
+		pending.timer.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(r.timeout, func() {
+		r.Lock()
+		if r.podKeyToPendingStart[podKey] != pending || pending.timer != timer {
+			// the chain moved on or was removed
+			r.Unlock()
+			return
+		}
+		delete(r.podKeyToPendingStart, podKey)
+		waitingFor := pending.waitingFor
+		r.Unlock()
+
+		if r.onStartTimeout != nil {
+			r.onStartTimeout(podKey, waitingFor)
+		}
+	})
+	pending.timer = timer
+}
+
+// timeoutStop restarts the timeout of the stop chain waiting for the next biz, the chain continues with the next biz once timed out.
+func (r *BizStartStore) timeoutStop(podKey string, pending *pendingBizStop) {
+	if pending.timer != nil {
+		pending.timer.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(r.timeout, func() {
+		r.Lock()
+		if r.podKeyToPendingStop[podKey] != pending || pending.timer != timer {
+			// the chain moved on or was removed
+			r.Unlock()
+			return
+		}
+		waitingFor := pending.waitingFor
+		var next *corev1.Container
+		if stop, has := r.nextStop(podKey, pending); has {
+			next = &stop.Container
+		}
+		r.Unlock()
+
+		if r.onStopTimeout != nil {
+			r.onStopTimeout(pending.pod, waitingFor, next)
+		}
+	})
+	pending.timer = timer
+}
@@ -0,0 +1,127 @@
+package provider
+
+import (
+	"testing"
+	"time"
+
+	"github.com/koupleless/virtual-kubelet/common/utils"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestBizStartStore_NextStart(t *testing.T) {
+	store := NewBizStartStore(BizChainTimeout, nil, nil)
+	store.PutPendingStart("ns/pod", "base", []corev1.Container{{Name: "core"}, {Name: "web"}}, nil)
+	assert.Equal(t, "base", store.GetWaitingFor("ns/pod"))
+
+	_, has := store.NextStart("ns/pod", "web")
+	assert.False(t, has)
+
+	next, has := store.NextStart("ns/pod", "base")
+	assert.True(t, has)
+	assert.Equal(t, []corev1.Container{{Name: "core"}}, next)
+	assert.Equal(t, "core", store.GetWaitingFor("ns/pod"))
+
+	next, has = store.NextStart("ns/pod", "core")
+	assert.True(t, has)
+	assert.Equal(t, []corev1.Container{{Name: "web"}}, next)
+	assert.Equal(t, "", store.GetWaitingFor("ns/pod"))
+
+	_, has = store.NextStart("ns/pod", "web")
+	assert.False(t, has)
+}
+
+func TestBizStartStore_NextStartThenBatch(t *testing.T) {
+	store := NewBizStartStore(BizChainTimeout, nil, nil)
+	store.PutPendingStart("ns/pod", "init-1", []corev1.Container{{Name: "init-2"}}, []corev1.Container{{Name: "core"}, {Name: "web"}})
+	assert.True(t, store.IsPendingStart("ns/pod", "init-1"))
+	assert.True(t, store.IsPendingStart("ns/pod", "web"))
+	assert.False(t, store.IsPendingStart("ns/pod", "api"))
+	assert.False(t, store.IsPendingStart("ns/other", "web"))
+
+	next, has := store.NextStart("ns/pod", "init-1")
+	assert.True(t, has)
+	assert.Equal(t, []corev1.Container{{Name: "init-2"}}, next)
+	assert.Equal(t, "init-2", store.GetWaitingFor("ns/pod"))
+
+	next, has = store.NextStart("ns/pod", "init-2")
+	assert.True(t, has)
+	assert.Equal(t, []corev1.Container{{Name: "core"}, {Name: "web"}}, next)
+	assert.Equal(t, "", store.GetWaitingFor("ns/pod"))
+
+	// only the batch left after the last init biz
+	store.PutPendingStart("ns/pod", "init-1", nil, []corev1.Container{{Name: "core"}})
+	next, has = store.NextStart("ns/pod", "init-1")
+	assert.True(t, has)
+	assert.Equal(t, []corev1.Container{{Name: "core"}}, next)
+	_, has = store.NextStart("ns/pod", "init-1")
+	assert.False(t, has)
+}
+
+func TestBizStartStore_Delete(t *testing.T) {
+	store := NewBizStartStore(BizChainTimeout, nil, nil)
+	store.PutPendingStart("ns/pod", "base", []corev1.Container{{Name: "core"}}, nil)
+	store.Delete("ns/pod")
+	_, has := store.NextStart("ns/pod", "base")
+	assert.False(t, has)
+
+	store.PutPendingStart("ns/pod", "base", nil, nil)
+	assert.Equal(t, "", store.GetWaitingFor("ns/pod"))
+}
+
+func TestBizStartStore_NextStop(t *testing.T) {
+	store := NewBizStartStore(BizChainTimeout, nil, nil)
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "ns"}}
+	first, has := store.PutPendingStop(pod, []corev1.Container{{Name: "web"}, {Name: "core"}})
+	assert.True(t, has)
+	assert.Equal(t, "web", first.Name)
+	assert.Equal(t, []string{utils.GetBizIdentity("web", "")}, store.GetStopWaitingFor())
+
+	// appended to the pending stops of the pod
+	_, has = store.PutPendingStop(pod, []corev1.Container{{Name: "base"}})
+	assert.False(t, has)
+
+	assert.Empty(t, store.NextStop(utils.GetBizIdentity("core", "")))
+	next := store.NextStop(utils.GetBizIdentity("web", ""))
+	assert.Equal(t, []BizStop{{Pod: pod, Container: corev1.Container{Name: "core"}}}, next)
+	next = store.NextStop(utils.GetBizIdentity("core", ""))
+	assert.Equal(t, []BizStop{{Pod: pod, Container: corev1.Container{Name: "base"}}}, next)
+	assert.True(t, store.HasPendingStop())
+	assert.Empty(t, store.NextStop(utils.GetBizIdentity("base", "")))
+	assert.False(t, store.HasPendingStop())
+
+	// the pending stops are kept when the pod is deleted
+	store.PutPendingStop(pod, []corev1.Container{{Name: "web"}, {Name: "core"}})
+	store.Delete("ns/pod")
+	assert.True(t, store.HasPendingStop())
+}
+
+func TestBizStartStore_Timeout(t *testing.T) {
+	startTimeouts := make(chan string, 1)
+	stopTimeouts := make(chan *corev1.Container, 2)
+	store := NewBizStartStore(10*time.Millisecond, func(podKey, waitingFor string) {
+		startTimeouts <- podKey + "/" + waitingFor
+	}, func(_ *corev1.Pod, _ string, next *corev1.Container) {
+		stopTimeouts <- next
+	})
+
+	// the start chain is dropped
+	store.PutPendingStart("ns/pod", "base", []corev1.Container{{Name: "core"}}, nil)
+	assert.Equal(t, "ns/pod/base", <-startTimeouts)
+	assert.Equal(t, "", store.GetWaitingFor("ns/pod"))
+
+	// the stop chain continues with the next biz
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "ns"}}
+	store.PutPendingStop(pod, []corev1.Container{{Name: "web"}, {Name: "core"}})
+	assert.Equal(t, "core", (<-stopTimeouts).Name)
+	assert.Nil(t, <-stopTimeouts)
+	assert.False(t, store.HasPendingStop())
+
+	// no timeout once the chain completed
+	store.PutPendingStart("ns/pod", "base", []corev1.Container{{Name: "core"}}, nil)
+	store.NextStart("ns/pod", "base")
+	store.Delete("ns/pod")
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, startTimeouts)
+}
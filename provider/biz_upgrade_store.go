@@ -0,0 +1,349 @@
+/**
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package provider
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/koupleless/virtual-kubelet/common/utils"
+	"github.com/koupleless/virtual-kubelet/model"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Summary:
+// This file defines the BizUpgradeStore structure, which keeps the rolling in place upgrades of the changed bizs of the pods.
+// Each pod upgrades one biz at a time, the next upgrade runs once the new biz of the current one is activated. The upgrades of
+// a later pod update are queued after the running one, a queued upgrade of a biz changed again upgrades to the latest container.
+// The old bizs of the start-then-stop upgrades aborted before completion keep running, and are retained to be stopped later.
+// The state of the upgrades of a pod is exported to be persisted, and restored by the vk restarted or the next leader.
+
+// BizUpgrade is the in place upgrade of a changed biz container of a pod
+type BizUpgrade struct {
+	Strategy     model.UpgradeStrategy // Strategy of the upgrade
+	OldContainer corev1.Container      // Container of the old biz
+	NewContainer corev1.Container      // Container of the new biz
+	NewStarted   bool                  // Whether the new biz is started
+	Resumed      bool                  // Whether the upgrade was running when restored from the persisted state
+}
+
+// podBizUpgrades is the upgrades of the bizs of a pod
+type podBizUpgrades struct {
+	upgrades        []*BizUpgrade      // Upgrades to run in order, the first one is running
+	completed       int                // Number of the completed upgrades since the queue was empty
+	total           int                // Number of the upgrades put since the queue was empty
+	retained        []corev1.Container // Old bizs of the aborted start-then-stop upgrades still running
+	replacedBizKeys map[string]bool    // Keys of the old bizs replaced by the upgrades
+	toResume        bool               // Whether the running upgrade is restored and not resumed yet
+}
+
+// BizUpgradeStore provides the in memory biz upgrades, keyed by pod key.
+type BizUpgradeStore struct {
+	sync.Mutex
+
+	podKeyToUpgrades map[string]*podBizUpgrades // Maps pod key to the biz upgrades
+}
+
+// NewBizUpgradeStore creates a new instance of BizUpgradeStore.
+func NewBizUpgradeStore() *BizUpgradeStore {
+	return &BizUpgradeStore{
+		podKeyToUpgrades: make(map[string]*podBizUpgrades),
+	}
+}
+
+// PutUpgrades queues the upgrades of the pod after the running one, returns the upgrade to run now if no upgrade was running.
+func (r *BizUpgradeStore) PutUpgrades(podKey string, upgrades []BizUpgrade) (BizUpgrade, bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	if len(upgrades) == 0 {
+		return BizUpgrade{}, false
+	}
+	pod := r.getOrCreate(podKey)
+	running := len(pod.upgrades) > 0
+	if !running {
+		pod.completed, pod.total = 0, 0
+	}
+	for i := range upgrades {
+		upgrade := upgrades[i]
+		pod.replacedBizKeys[utils.GetBizUniqueKey(&upgrade.OldContainer)] = true
+		if queued := r.getQueued(pod, upgrade.NewContainer.Name); queued != nil {
+			// the queued upgrade not started yet upgrades to the latest container
+			queued.NewContainer = upgrade.NewContainer
+			queued.Strategy = getUpgradeStrategy(queued)
+			continue
+		}
+		upgrade.Strategy = getUpgradeStrategy(&upgrade)
+		pod.upgrades = append(pod.upgrades, &upgrade)
+		pod.total++
+	}
+	// a biz upgraded back to an old version is not replaced any more
+	for _, upgrade := range upgrades {
+		delete(pod.replacedBizKeys, utils.GetBizUniqueKey(&upgrade.NewContainer))
+	}
+	if running {
+		return BizUpgrade{}, false
+	}
+	return *pod.upgrades[0], true
+}
+
+// GetUpgrade returns the running upgrade of the pod if any.
+func (r *BizUpgradeStore) GetUpgrade(podKey string) (BizUpgrade, bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	pod, has := r.podKeyToUpgrades[podKey]
+	if !has || len(pod.upgrades) == 0 {
+		return BizUpgrade{}, false
+	}
+	return *pod.upgrades[0], true
+}
+
+// SetNewStarted marks the new biz of the running upgrade of the pod started.
+func (r *BizUpgradeStore) SetNewStarted(podKey string) {
+	r.Lock()
+	defer r.Unlock()
+
+	if pod, has := r.podKeyToUpgrades[podKey]; has && len(pod.upgrades) > 0 {
+		pod.upgrades[0].NewStarted = true
+	}
+}
+
+// CompleteUpgrade completes the running upgrade of the pod, returns the next upgrade to run if any.
+func (r *BizUpgradeStore) CompleteUpgrade(podKey string) (BizUpgrade, bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	pod, has := r.podKeyToUpgrades[podKey]
+	if !has || len(pod.upgrades) == 0 {
+		return BizUpgrade{}, false
+	}
+	pod.upgrades = pod.upgrades[1:]
+	pod.completed++
+	if len(pod.upgrades) == 0 {
+		return BizUpgrade{}, false
+	}
+	return *pod.upgrades[0], true
+}
+
+// GetProgress returns the number of the completed upgrades and the number of all upgrades of the pod.
+func (r *BizUpgradeStore) GetProgress(podKey string) (completed, total int) {
+	r.Lock()
+	defer r.Unlock()
+
+	pod, has := r.podKeyToUpgrades[podKey]
+	if !has {
+		return 0, 0
+	}
+	return pod.completed, pod.total
+}
+
+// Abort aborts the upgrades of the pod not completed, returns the number of the aborted upgrades.
+func (r *BizUpgradeStore) Abort(podKey string) int {
+	r.Lock()
+	defer r.Unlock()
+
+	pod, has := r.podKeyToUpgrades[podKey]
+	if !has {
+		return 0
+	}
+	return r.abort(pod)
+}
+
+// TakeRetained removes and returns the retained old bizs of the container of the pod.
+func (r *BizUpgradeStore) TakeRetained(podKey, containerName string) []corev1.Container {
+	r.Lock()
+	defer r.Unlock()
+
+	pod, has := r.podKeyToUpgrades[podKey]
+	if !has {
+		return nil
+	}
+	var ret []corev1.Container
+	retained := make([]corev1.Container, 0, len(pod.retained))
+	for _, container := range pod.retained {
+		if container.Name == containerName {
+			ret = append(ret, container)
+		} else {
+			retained = append(retained, container)
+		}
+	}
+	pod.retained = retained
+	return ret
+}
+
+// IsReplaced returns whether the biz is an old biz of the pod replaced by an upgrade.
+func (r *BizUpgradeStore) IsReplaced(podKey, bizKey string) bool {
+	r.Lock()
+	defer r.Unlock()
+
+	pod, has := r.podKeyToUpgrades[podKey]
+	return has && pod.replacedBizKeys[bizKey]
+}
+
+// Delete removes the upgrades of the pod, returns the old bizs still running to stop.
+func (r *BizUpgradeStore) Delete(podKey string) []corev1.Container {
+	r.Lock()
+	defer r.Unlock()
+
+	pod, has := r.podKeyToUpgrades[podKey]
+	if !has {
+		return nil
+	}
+	r.abort(pod)
+	delete(r.podKeyToUpgrades, podKey)
+	return pod.retained
+}
+
+// GetState returns the state of the upgrades of the pod, false if no upgrade was put.
+func (r *BizUpgradeStore) GetState(podKey string) (model.PodBizUpgradesState, bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	pod, has := r.podKeyToUpgrades[podKey]
+	if !has {
+		return model.PodBizUpgradesState{}, false
+	}
+	return pod.state(podKey), true
+}
+
+// GetStates returns the states of the upgrades of the pods not completed or retaining old bizs, sorted by pod key.
+func (r *BizUpgradeStore) GetStates() []model.PodBizUpgradesState {
+	r.Lock()
+	defer r.Unlock()
+
+	states := make([]model.PodBizUpgradesState, 0)
+	for podKey, pod := range r.podKeyToUpgrades {
+		if len(pod.upgrades) > 0 || len(pod.retained) > 0 {
+			states = append(states, pod.state(podKey))
+		}
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].PodKey < states[j].PodKey
+	})
+	return states
+}
+
+// Restore restores the upgrades of the pod from the state if the pod has no upgrades, returns the running upgrade to resume.
+func (r *BizUpgradeStore) Restore(state model.PodBizUpgradesState) (BizUpgrade, bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	if _, has := r.podKeyToUpgrades[state.PodKey]; has {
+		// the upgrades put since the vk started are newer
+		return BizUpgrade{}, false
+	}
+	pod := r.getOrCreate(state.PodKey)
+	for i, upgrade := range state.Upgrades {
+		pod.upgrades = append(pod.upgrades, &BizUpgrade{
+			Strategy:     upgrade.Strategy,
+			OldContainer: upgrade.OldContainer,
+			NewContainer: upgrade.NewContainer,
+			NewStarted:   upgrade.NewStarted,
+			// only the running one was run by the previous vk
+			Resumed: i == 0,
+		})
+	}
+	pod.completed, pod.total = state.Completed, state.Total
+	pod.retained = state.Retained
+	for _, bizKey := range state.ReplacedBizKeys {
+		pod.replacedBizKeys[bizKey] = true
+	}
+	pod.toResume = len(pod.upgrades) > 0
+	if len(pod.upgrades) == 0 {
+		return BizUpgrade{}, false
+	}
+	return *pod.upgrades[0], true
+}
+
+// TakeToResume returns the running upgrades restored and not resumed yet, keyed by pod key, each is returned once.
+func (r *BizUpgradeStore) TakeToResume() map[string]BizUpgrade {
+	r.Lock()
+	defer r.Unlock()
+
+	ret := make(map[string]BizUpgrade)
+	for podKey, pod := range r.podKeyToUpgrades {
+		if pod.toResume && len(pod.upgrades) > 0 {
+			ret[podKey] = *pod.upgrades[0]
+		}
+		pod.toResume = false
+	}
+	return ret
+}
+
+// state returns the state of the upgrades of the pod.
+func (pod *podBizUpgrades) state(podKey string) model.PodBizUpgradesState {
+	state := model.PodBizUpgradesState{
+		PodKey:    podKey,
+		Upgrades:  make([]model.BizUpgradeState, 0, len(pod.upgrades)),
+		Completed: pod.completed,
+		Total:     pod.total,
+		Retained:  append([]corev1.Container(nil), pod.retained...),
+	}
+	for _, upgrade := range pod.upgrades {
+		state.Upgrades = append(state.Upgrades, model.BizUpgradeState{
+			Strategy:     upgrade.Strategy,
+			OldContainer: upgrade.OldContainer,
+			NewContainer: upgrade.NewContainer,
+			NewStarted:   upgrade.NewStarted,
+		})
+	}
+	for bizKey := range pod.replacedBizKeys {
+		state.ReplacedBizKeys = append(state.ReplacedBizKeys, bizKey)
+	}
+	sort.Strings(state.ReplacedBizKeys)
+	return state
+}
+
+// getOrCreate returns the upgrades of the pod, creates it if not found.
+func (r *BizUpgradeStore) getOrCreate(podKey string) *podBizUpgrades {
+	pod, has := r.podKeyToUpgrades[podKey]
+	if !has {
+		pod = &podBizUpgrades{
+			replacedBizKeys: make(map[string]bool),
+		}
+		r.podKeyToUpgrades[podKey] = pod
+	}
+	return pod
+}
+
+// getUpgradeStrategy returns the strategy the upgrade runs with, the start-then-stop upgrade of the same biz key is run
+// as stop-then-start, as the same biz can not run twice on the base
+func getUpgradeStrategy(upgrade *BizUpgrade) model.UpgradeStrategy {
+	if upgrade.Strategy == model.UpgradeStrategyStartThenStop && utils.GetBizUniqueKey(&upgrade.OldContainer) == utils.GetBizUniqueKey(&upgrade.NewContainer) {
+		return model.UpgradeStrategyStopThenStart
+	}
+	return upgrade.Strategy
+}
+
+// getQueued returns the queued upgrade of the container of the pod not started yet.
+func (r *BizUpgradeStore) getQueued(pod *podBizUpgrades, containerName string) *BizUpgrade {
+	for i := 1; i < len(pod.upgrades); i++ {
+		if pod.upgrades[i].NewContainer.Name == containerName {
+			return pod.upgrades[i]
+		}
+	}
+	return nil
+}
+
+// abort aborts the upgrades of the pod not completed, the old biz of the running start-then-stop upgrade is retained.
+func (r *BizUpgradeStore) abort(pod *podBizUpgrades) int {
+	aborted := len(pod.upgrades)
+	if aborted > 0 && pod.upgrades[0].Strategy == model.UpgradeStrategyStartThenStop && pod.upgrades[0].NewStarted {
+		pod.retained = append(pod.retained, pod.upgrades[0].OldContainer)
+	}
+	pod.upgrades = nil
+	return aborted
+}
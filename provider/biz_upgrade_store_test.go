@@ -0,0 +1,131 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/koupleless/virtual-kubelet/model"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func newBizUpgrade(strategy model.UpgradeStrategy, name, oldImage, newImage string) BizUpgrade {
+	return BizUpgrade{
+		Strategy:     strategy,
+		OldContainer: corev1.Container{Name: name, Image: oldImage, Env: []corev1.EnvVar{{Name: "BIZ_VERSION", Value: oldImage}}},
+		NewContainer: corev1.Container{Name: name, Image: newImage, Env: []corev1.EnvVar{{Name: "BIZ_VERSION", Value: newImage}}},
+	}
+}
+
+func TestBizUpgradeStore_Rolling(t *testing.T) {
+	store := NewBizUpgradeStore()
+	_, has := store.PutUpgrades("ns/pod", nil)
+	assert.False(t, has)
+
+	upgrade, has := store.PutUpgrades("ns/pod", []BizUpgrade{
+		newBizUpgrade(model.UpgradeStrategyStartThenStop, "core", "1", "2"),
+		newBizUpgrade(model.UpgradeStrategyStartThenStop, "web", "1", "2"),
+	})
+	assert.True(t, has)
+	assert.Equal(t, "core", upgrade.NewContainer.Name)
+	assert.True(t, store.IsReplaced("ns/pod", "core:1"))
+	assert.False(t, store.IsReplaced("ns/pod", "core:2"))
+
+	// queued after the running one, the queued one upgrades to the latest container
+	_, has = store.PutUpgrades("ns/pod", []BizUpgrade{
+		newBizUpgrade(model.UpgradeStrategyStartThenStop, "web", "2", "3"),
+		newBizUpgrade(model.UpgradeStrategyStartThenStop, "api", "1", "2"),
+	})
+	assert.False(t, has)
+	completed, total := store.GetProgress("ns/pod")
+	assert.Equal(t, 0, completed)
+	assert.Equal(t, 3, total)
+
+	next, has := store.CompleteUpgrade("ns/pod")
+	assert.True(t, has)
+	assert.Equal(t, "web", next.NewContainer.Name)
+	assert.Equal(t, "1", next.OldContainer.Image)
+	assert.Equal(t, "3", next.NewContainer.Image)
+	completed, _ = store.GetProgress("ns/pod")
+	assert.Equal(t, 1, completed)
+
+	next, has = store.CompleteUpgrade("ns/pod")
+	assert.True(t, has)
+	assert.Equal(t, "api", next.NewContainer.Name)
+	_, has = store.CompleteUpgrade("ns/pod")
+	assert.False(t, has)
+	_, has = store.GetUpgrade("ns/pod")
+	assert.False(t, has)
+}
+
+func TestBizUpgradeStore_SameBizKey(t *testing.T) {
+	store := NewBizUpgradeStore()
+	upgrade := newBizUpgrade(model.UpgradeStrategyStartThenStop, "core", "1", "1")
+	upgrade.NewContainer.Image = "core-patched"
+	running, has := store.PutUpgrades("ns/pod", []BizUpgrade{upgrade})
+	assert.True(t, has)
+	assert.Equal(t, model.UpgradeStrategyStopThenStart, running.Strategy)
+	assert.False(t, store.IsReplaced("ns/pod", "core:1"))
+}
+
+func TestBizUpgradeStore_AbortRetained(t *testing.T) {
+	store := NewBizUpgradeStore()
+	store.PutUpgrades("ns/pod", []BizUpgrade{
+		newBizUpgrade(model.UpgradeStrategyStartThenStop, "core", "1", "2"),
+		newBizUpgrade(model.UpgradeStrategyStartThenStop, "web", "1", "2"),
+	})
+	// the old biz is retained only when the new one started
+	store.SetNewStarted("ns/pod")
+	assert.Equal(t, 2, store.Abort("ns/pod"))
+	assert.Equal(t, 0, store.Abort("ns/pod"))
+	assert.Empty(t, store.TakeRetained("ns/pod", "web"))
+
+	store.PutUpgrades("ns/pod", []BizUpgrade{newBizUpgrade(model.UpgradeStrategyStartThenStop, "web", "1", "2")})
+	retained := store.Delete("ns/pod")
+	assert.Len(t, retained, 1)
+	assert.Equal(t, "core", retained[0].Name)
+	assert.False(t, store.IsReplaced("ns/pod", "core:1"))
+}
+
+func TestBizUpgradeStore_Restore(t *testing.T) {
+	store := NewBizUpgradeStore()
+	store.PutUpgrades("ns/pod", []BizUpgrade{
+		newBizUpgrade(model.UpgradeStrategyStartThenStop, "core", "1", "2"),
+		newBizUpgrade(model.UpgradeStrategyStartThenStop, "web", "1", "2"),
+	})
+	store.SetNewStarted("ns/pod")
+	store.PutUpgrades("ns/done", []BizUpgrade{newBizUpgrade(model.UpgradeStrategyStopThenStart, "core", "1", "2")})
+	store.CompleteUpgrade("ns/done")
+
+	// the completed upgrades retaining no biz are not handed off
+	states := store.GetStates()
+	assert.Len(t, states, 1)
+	assert.Equal(t, "ns/pod", states[0].PodKey)
+	assert.Len(t, states[0].Upgrades, 2)
+	assert.True(t, states[0].Upgrades[0].NewStarted)
+	assert.Equal(t, []string{"core:1", "web:1"}, states[0].ReplacedBizKeys)
+	state, has := store.GetState("ns/done")
+	assert.True(t, has)
+	assert.Empty(t, state.Upgrades)
+	assert.Equal(t, 1, state.Completed)
+
+	restored := NewBizUpgradeStore()
+	upgrade, has := restored.Restore(states[0])
+	assert.True(t, has)
+	assert.True(t, upgrade.Resumed)
+	assert.True(t, upgrade.NewStarted)
+	assert.True(t, restored.IsReplaced("ns/pod", "web:1"))
+	_, total := restored.GetProgress("ns/pod")
+	assert.Equal(t, 2, total)
+	// the pod with upgrades is not restored again
+	_, has = restored.Restore(states[0])
+	assert.False(t, has)
+
+	toResume := restored.TakeToResume()
+	assert.Len(t, toResume, 1)
+	assert.Equal(t, "core", toResume["ns/pod"].NewContainer.Name)
+	assert.Empty(t, restored.TakeToResume())
+
+	next, has := restored.CompleteUpgrade("ns/pod")
+	assert.True(t, has)
+	assert.False(t, next.Resumed)
+}
@@ -10,6 +10,17 @@ type Liveness struct {
 	// for fast close, we need to close manually, or we need to wait to timeout
 	isClose             bool
 	LatestHeartBeatTime time.Time
+
+	heartBeatTimeout time.Duration // dead after no heartbeat for this duration
+	unReachableGrace time.Duration // unreachable after no heartbeat for this duration
+}
+
+// NewLiveness creates a Liveness with the thresholds of the liveness config, the config is expected filled with the defaults
+func NewLiveness(config model.LivenessConfig) Liveness {
+	return Liveness{
+		heartBeatTimeout: config.HeartBeatTimeout,
+		unReachableGrace: config.UnReachableGrace,
+	}
 }
 
 func (liveness *Liveness) UpdateHeartBeatTime() {
@@ -18,9 +29,9 @@ func (liveness *Liveness) UpdateHeartBeatTime() {
 }
 
 // close by deactive message
-// or timeout for module.NodeLeaseDurationSeconds, this may caused by base offline or leader changed
+// or timeout for heartBeatTimeout, this may caused by base offline or leader changed
 func (liveness *Liveness) IsDead() bool {
-	return liveness.isClose || time.Since(liveness.LatestHeartBeatTime) >= model.NodeLeaseDurationSeconds*time.Second
+	return liveness.isClose || time.Since(liveness.LatestHeartBeatTime) >= liveness.heartBeatTimeout
 }
 
 // close because the base upload the deactive message
@@ -31,5 +42,5 @@ func (liveness *Liveness) Close() {
 
 // unReachable check the node is unreachable
 func (liveness *Liveness) IsReachable() bool {
-	return !liveness.isClose && time.Since(liveness.LatestHeartBeatTime) <= model.NodeLeaseUpdatePeriodSeconds*time.Second
+	return !liveness.isClose && time.Since(liveness.LatestHeartBeatTime) <= liveness.unReachableGrace
 }
@@ -0,0 +1,56 @@
+package provider
+
+import (
+	"testing"
+	"time"
+
+	"github.com/koupleless/virtual-kubelet/common/utils"
+	"github.com/koupleless/virtual-kubelet/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLiveness_DefaultThresholds(t *testing.T) {
+	liveness := NewLiveness(utils.FillLivenessConfigDefaults(model.LivenessConfig{}))
+	assert.True(t, liveness.IsDead())
+	assert.False(t, liveness.IsReachable())
+
+	liveness.UpdateHeartBeatTime()
+	assert.False(t, liveness.IsDead())
+	assert.True(t, liveness.IsReachable())
+
+	liveness.Close()
+	assert.True(t, liveness.IsDead())
+	assert.False(t, liveness.IsReachable())
+}
+
+func TestLiveness_CustomThresholds(t *testing.T) {
+	liveness := NewLiveness(model.LivenessConfig{
+		HeartBeatTimeout: 2 * time.Minute,
+		UnReachableGrace: time.Minute,
+	})
+	liveness.UpdateHeartBeatTime()
+	liveness.LatestHeartBeatTime = time.Now().Add(-model.NodeLeaseDurationSeconds * time.Second)
+	assert.False(t, liveness.IsDead())
+	assert.True(t, liveness.IsReachable())
+
+	liveness.LatestHeartBeatTime = time.Now().Add(-90 * time.Second)
+	assert.False(t, liveness.IsDead())
+	assert.False(t, liveness.IsReachable())
+}
+
+func TestVNode_IsLeaderWithLeaseDuration(t *testing.T) {
+	vNode := &VNode{
+		name:           "test-node-name",
+		env:            "test-env",
+		livenessConfig: model.LivenessConfig{LeaseDuration: 2 * time.Minute},
+	}
+	vNode.lease.Store(vNode.newLease("test-client-id"))
+	assert.Equal(t, int32(120), *vNode.lease.Load().Spec.LeaseDurationSeconds)
+
+	vNode.lease.Load().Spec.RenewTime.Time = time.Now().Add(-time.Minute)
+	assert.True(t, vNode.IsLeader("test-client-id"))
+	assert.False(t, vNode.IsLeader("other-client-id"))
+
+	vNode.lease.Load().Spec.RenewTime.Time = time.Now().Add(-3 * time.Minute)
+	assert.False(t, vNode.IsLeader("test-client-id"))
+}
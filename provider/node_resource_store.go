@@ -0,0 +1,110 @@
+/**
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package provider
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/koupleless/virtual-kubelet/common/utils"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Summary:
+// This file defines the NodeResourceStore structure, which accounts the resources of a vnode.
+// The allocatable resources are the ones reported by the base minus the requests of the running vpods,
+// the vpod provider admits a new vpod only if its requests fit in the allocatable resources.
+
+// NodeResourceStore provides the in memory resource accounting of a vnode.
+type NodeResourceStore struct {
+	sync.Mutex
+
+	baseAllocatable corev1.ResourceList // Allocatable resources reported by the base, nil before the first report
+
+	podKeyToRequests map[string]corev1.ResourceList // Maps pod key to the resource requests of the running pod
+}
+
+// NewNodeResourceStore creates a new instance of NodeResourceStore.
+func NewNodeResourceStore() *NodeResourceStore {
+	return &NodeResourceStore{
+		podKeyToRequests: make(map[string]corev1.ResourceList),
+	}
+}
+
+// SetBaseAllocatable updates the allocatable resources reported by the base.
+func (r *NodeResourceStore) SetBaseAllocatable(allocatable corev1.ResourceList) {
+	r.Lock()
+	defer r.Unlock()
+	r.baseAllocatable = allocatable.DeepCopy()
+}
+
+// PutPod records the resource requests of the running pod.
+func (r *NodeResourceStore) PutPod(pod *corev1.Pod) {
+	r.Lock()
+	defer r.Unlock()
+	r.podKeyToRequests[utils.GetPodKey(pod)] = utils.GetPodResourceRequests(pod)
+}
+
+// DeletePod removes the resource requests of the pod.
+func (r *NodeResourceStore) DeletePod(podKey string) {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.podKeyToRequests, podKey)
+}
+
+// GetRequested returns the sum of the resource requests of the running pods.
+func (r *NodeResourceStore) GetRequested() corev1.ResourceList {
+	r.Lock()
+	defer r.Unlock()
+	return r.getRequested("")
+}
+
+// GetAllocatable returns the base allocatable resources minus the requests of the running pods, nil before the base reports.
+func (r *NodeResourceStore) GetAllocatable() corev1.ResourceList {
+	r.Lock()
+	defer r.Unlock()
+	if r.baseAllocatable == nil {
+		return nil
+	}
+	return utils.SubtractResourceList(r.baseAllocatable, r.getRequested(""))
+}
+
+// CheckFits checks whether the requests of the pod fit in the allocatable resources, the pod itself is not counted as running.
+// All pods fit before the base reports its resources.
+func (r *NodeResourceStore) CheckFits(pod *corev1.Pod) error {
+	r.Lock()
+	defer r.Unlock()
+	if r.baseAllocatable == nil {
+		return nil
+	}
+
+	available := utils.SubtractResourceList(r.baseAllocatable, r.getRequested(utils.GetPodKey(pod)))
+	insufficient := utils.GetInsufficientResources(available, utils.GetPodResourceRequests(pod))
+	if len(insufficient) > 0 {
+		return fmt.Errorf("insufficient %v on node, available: %v", insufficient, available)
+	}
+	return nil
+}
+
+// getRequested returns the sum of the resource requests of the running pods except the excluded one.
+func (r *NodeResourceStore) getRequested(excludedPodKey string) corev1.ResourceList {
+	requested := corev1.ResourceList{}
+	for podKey, requests := range r.podKeyToRequests {
+		if podKey != excludedPodKey {
+			utils.AddResourceList(requested, requests)
+		}
+	}
+	return requested
+}
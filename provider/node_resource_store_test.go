@@ -0,0 +1,88 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/koupleless/virtual-kubelet/model"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newResourcePod(name, cpu, memory string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "ns",
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name: "biz",
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{
+							corev1.ResourceCPU:    resource.MustParse(cpu),
+							corev1.ResourceMemory: resource.MustParse(memory),
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestNodeResourceStore(t *testing.T) {
+	store := NewNodeResourceStore()
+	pod1 := newResourcePod("pod1", "500m", "1Gi")
+	pod2 := newResourcePod("pod2", "1", "1Gi")
+
+	// all pods fit before the base reports
+	assert.NoError(t, store.CheckFits(pod1))
+	assert.Nil(t, store.GetAllocatable())
+
+	store.SetBaseAllocatable(corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse("1"),
+		corev1.ResourceMemory: resource.MustParse("4Gi"),
+		corev1.ResourcePods:   resource.MustParse("10"),
+	})
+	assert.NoError(t, store.CheckFits(pod1))
+	store.PutPod(pod1)
+	// the pod itself is not counted
+	assert.NoError(t, store.CheckFits(pod1))
+	assert.ErrorContains(t, store.CheckFits(pod2), "cpu")
+
+	allocatable := store.GetAllocatable()
+	assert.True(t, resource.MustParse("500m").Equal(allocatable[corev1.ResourceCPU]))
+	assert.True(t, resource.MustParse("3Gi").Equal(allocatable[corev1.ResourceMemory]))
+	assert.True(t, resource.MustParse("9").Equal(allocatable[corev1.ResourcePods]))
+	requested := store.GetRequested()
+	assert.True(t, resource.MustParse("500m").Equal(requested[corev1.ResourceCPU]))
+
+	store.DeletePod("ns/pod1")
+	assert.NoError(t, store.CheckFits(pod2))
+}
+
+func TestGetBaseAllocatable(t *testing.T) {
+	node := &corev1.Node{
+		Status: corev1.NodeStatus{
+			Capacity: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("2"),
+				corev1.ResourceMemory: resource.MustParse("4Gi"),
+			},
+			Allocatable: corev1.ResourceList{
+				corev1.ResourceCPU: resource.MustParse("1"),
+			},
+		},
+	}
+	allocatable := getBaseAllocatable(node, model.NodeStatusData{
+		Resources: map[corev1.ResourceName]model.NodeResource{
+			corev1.ResourceMemory: {
+				Capacity:    resource.MustParse("4Gi"),
+				Allocatable: resource.MustParse("3Gi"),
+			},
+		},
+	})
+	assert.True(t, resource.MustParse("2").Equal(allocatable[corev1.ResourceCPU]))
+	assert.True(t, resource.MustParse("3Gi").Equal(allocatable[corev1.ResourceMemory]))
+}
@@ -0,0 +1,279 @@
+/**
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/koupleless/virtual-kubelet/model"
+	pkgerrors "github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Summary:
+// This file defines the PersistentVPodStore, which keeps the vpods in memory and saves the snapshots by a VPodStorePersister,
+// so a restarted vk restores the vpods of a vnode before the vnode starts and resumes exactly where it left off.
+// Two persisters are provided: ConfigMapVPodStorePersister saves a ConfigMap per vnode, FileVPodStorePersister saves a file per vnode.
+
+var _ VPodStore = &PersistentVPodStore{}
+
+// PersistentVPodStore is a VPodStore whose pods are saved by the persister.
+type PersistentVPodStore struct {
+	*MemoryVPodStore
+
+	nodeName  string                   // Name of the vnode which the pods belong to
+	persister model.VPodStorePersister // Persister of the snapshots
+
+	dirtyLock sync.Mutex
+	dirty     bool // Whether the pods changed since the last snapshot
+}
+
+// NewPersistentVPodStore creates a new PersistentVPodStore of the vnode.
+func NewPersistentVPodStore(nodeName string, persister model.VPodStorePersister) *PersistentVPodStore {
+	return &PersistentVPodStore{
+		MemoryVPodStore: NewVPodStore(),
+		nodeName:        nodeName,
+		persister:       persister,
+	}
+}
+
+// PutPod updates or adds a pod, and marks the store changed.
+func (r *PersistentVPodStore) PutPod(pod *corev1.Pod) {
+	r.MemoryVPodStore.PutPod(pod)
+	r.markDirty(true)
+}
+
+// DeletePod removes a pod, and marks the store changed.
+func (r *PersistentVPodStore) DeletePod(podKey string) {
+	r.MemoryVPodStore.DeletePod(podKey)
+	r.markDirty(true)
+}
+
+// Restore loads the pods from the last snapshot of the vnode, the pods in the store are newer than the snapshot and kept.
+func (r *PersistentVPodStore) Restore(ctx context.Context) ([]*corev1.Pod, error) {
+	pods, err := r.persister.Load(ctx, r.nodeName)
+	if err != nil {
+		return nil, err
+	}
+	restored := make([]*corev1.Pod, 0, len(pods))
+	for _, pod := range pods {
+		if r.MemoryVPodStore.putPodIfAbsent(pod) {
+			restored = append(restored, pod)
+		}
+	}
+	return restored, nil
+}
+
+// Snapshot saves the pods if changed since the last snapshot.
+func (r *PersistentVPodStore) Snapshot(ctx context.Context) error {
+	if !r.markDirty(false) {
+		return nil
+	}
+	err := r.persister.Save(ctx, r.nodeName, r.GetPods())
+	if err != nil {
+		// retry in the next snapshot
+		r.markDirty(true)
+	}
+	return err
+}
+
+// Clear removes the snapshot of the vnode.
+func (r *PersistentVPodStore) Clear(ctx context.Context) error {
+	r.markDirty(false)
+	return r.persister.Delete(ctx, r.nodeName)
+}
+
+// markDirty sets whether the pods changed, returns the previous value.
+func (r *PersistentVPodStore) markDirty(dirty bool) bool {
+	r.dirtyLock.Lock()
+	defer r.dirtyLock.Unlock()
+	previous := r.dirty
+	r.dirty = dirty
+	return previous
+}
+
+// vPodStoreSnapshotDataKey is the key of the pods json in the snapshot ConfigMap
+const vPodStoreSnapshotDataKey = "pods.json"
+
+// ConfigMapVPodStorePersister saves the snapshot of each vnode in a ConfigMap named vpod-store-<node name>.
+// The snapshot is limited by the size of a ConfigMap, which is 1MiB.
+type ConfigMapVPodStorePersister struct {
+	client    client.Client
+	namespace string
+}
+
+// NewConfigMapVPodStorePersister creates a new ConfigMapVPodStorePersister saving the ConfigMaps in the namespace.
+func NewConfigMapVPodStorePersister(client client.Client, namespace string) *ConfigMapVPodStorePersister {
+	return &ConfigMapVPodStorePersister{
+		client:    client,
+		namespace: namespace,
+	}
+}
+
+// Load returns the pods in the ConfigMap of the vnode, nil if the ConfigMap not found.
+func (p *ConfigMapVPodStorePersister) Load(ctx context.Context, nodeName string) ([]*corev1.Pod, error) {
+	configMap := &corev1.ConfigMap{}
+	err := p.client.Get(ctx, types.NamespacedName{Namespace: p.namespace, Name: vPodStoreConfigMapName(nodeName)}, configMap)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return unmarshalPods([]byte(configMap.Data[vPodStoreSnapshotDataKey]))
+}
+
+// Save creates or updates the ConfigMap of the vnode with the pods.
+func (p *ConfigMapVPodStorePersister) Save(ctx context.Context, nodeName string, pods []*corev1.Pod) error {
+	data, err := marshalPods(pods)
+	if err != nil {
+		return err
+	}
+
+	configMap := &corev1.ConfigMap{}
+	err = p.client.Get(ctx, types.NamespacedName{Namespace: p.namespace, Name: vPodStoreConfigMapName(nodeName)}, configMap)
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+		configMap = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: p.namespace,
+				Name:      vPodStoreConfigMapName(nodeName),
+				Labels: map[string]string{
+					model.LabelKeyOfVNodeName: nodeName,
+				},
+			},
+			Data: map[string]string{
+				vPodStoreSnapshotDataKey: string(data),
+			},
+		}
+		return p.client.Create(ctx, configMap)
+	}
+
+	configMap.Data = map[string]string{
+		vPodStoreSnapshotDataKey: string(data),
+	}
+	return p.client.Update(ctx, configMap)
+}
+
+// Delete removes the ConfigMap of the vnode.
+func (p *ConfigMapVPodStorePersister) Delete(ctx context.Context, nodeName string) error {
+	err := p.client.Delete(ctx, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: p.namespace,
+			Name:      vPodStoreConfigMapName(nodeName),
+		},
+	})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// vPodStoreConfigMapName returns the name of the snapshot ConfigMap of the vnode
+func vPodStoreConfigMapName(nodeName string) string {
+	return "vpod-store-" + nodeName
+}
+
+// FileVPodStorePersister saves the snapshot of each vnode in a json file named <node name>.json in the directory.
+// The directory must be on a volume surviving the restarts of the vk.
+type FileVPodStorePersister struct {
+	dir string
+}
+
+// NewFileVPodStorePersister creates a new FileVPodStorePersister saving the files in the directory.
+func NewFileVPodStorePersister(dir string) *FileVPodStorePersister {
+	return &FileVPodStorePersister{
+		dir: dir,
+	}
+}
+
+// Load returns the pods in the file of the vnode, nil if the file not found.
+func (p *FileVPodStorePersister) Load(_ context.Context, nodeName string) ([]*corev1.Pod, error) {
+	data, err := os.ReadFile(p.filePath(nodeName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return unmarshalPods(data)
+}
+
+// Save replaces the file of the vnode with the pods, the file is written to a temp file first so a crash never leaves a partial file.
+func (p *FileVPodStorePersister) Save(_ context.Context, nodeName string, pods []*corev1.Pod) error {
+	data, err := marshalPods(pods)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(p.dir, 0o755); err != nil {
+		return err
+	}
+	tmpFile := p.filePath(nodeName) + ".tmp"
+	if err = os.WriteFile(tmpFile, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, p.filePath(nodeName))
+}
+
+// Delete removes the file of the vnode.
+func (p *FileVPodStorePersister) Delete(_ context.Context, nodeName string) error {
+	err := os.Remove(p.filePath(nodeName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// filePath returns the path of the snapshot file of the vnode
+func (p *FileVPodStorePersister) filePath(nodeName string) string {
+	return filepath.Join(p.dir, nodeName+".json")
+}
+
+// marshalPods encodes the pods without the managed fields, which are not used by the vnode
+func marshalPods(pods []*corev1.Pod) ([]byte, error) {
+	podsToSave := make([]*corev1.Pod, 0, len(pods))
+	for _, pod := range pods {
+		podCopy := pod.DeepCopy()
+		podCopy.ManagedFields = nil
+		podsToSave = append(podsToSave, podCopy)
+	}
+	data, err := json.Marshal(podsToSave)
+	if err != nil {
+		return nil, pkgerrors.Wrap(err, "failed to marshal pods")
+	}
+	return data, nil
+}
+
+// unmarshalPods decodes the pods, empty data means no pods
+func unmarshalPods(data []byte) ([]*corev1.Pod, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	pods := make([]*corev1.Pod, 0)
+	if err := json.Unmarshal(data, &pods); err != nil {
+		return nil, pkgerrors.Wrap(err, "failed to unmarshal pods")
+	}
+	return pods, nil
+}
@@ -0,0 +1,120 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/koupleless/virtual-kubelet/model"
+	"github.com/koupleless/virtual-kubelet/tunnel"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func testVPodStorePersister(t *testing.T, persister model.VPodStorePersister) {
+	pods, err := persister.Load(context.TODO(), "vnode.test")
+	assert.NoError(t, err)
+	assert.Nil(t, pods)
+
+	store := NewPersistentVPodStore("vnode.test", persister)
+	// nothing changed, nothing saved
+	assert.NoError(t, store.Snapshot(context.TODO()))
+	pods, err = persister.Load(context.TODO(), "vnode.test")
+	assert.NoError(t, err)
+	assert.Nil(t, pods)
+
+	store.PutPod(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:          "pod1",
+			Namespace:     "ns1",
+			ManagedFields: []metav1.ManagedFieldsEntry{{Manager: "test"}},
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+		},
+	})
+	store.PutPod(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pod2",
+			Namespace: "ns1",
+		},
+	})
+	store.DeletePod("ns1/pod2")
+	assert.NoError(t, store.Snapshot(context.TODO()))
+
+	restored := NewPersistentVPodStore("vnode.test", persister)
+	restoredPods, err := restored.Restore(context.TODO())
+	assert.NoError(t, err)
+	assert.Len(t, restoredPods, 1)
+	assert.Len(t, restored.GetPods(), 1)
+	pod := restored.GetPodByKey("ns1/pod1")
+	assert.NotNil(t, pod)
+	assert.Equal(t, corev1.PodRunning, pod.Status.Phase)
+	assert.Nil(t, pod.ManagedFields)
+
+	assert.NoError(t, restored.Clear(context.TODO()))
+	assert.NoError(t, restored.Clear(context.TODO()))
+	pods, err = persister.Load(context.TODO(), "vnode.test")
+	assert.NoError(t, err)
+	assert.Nil(t, pods)
+}
+
+func TestFileVPodStorePersister(t *testing.T) {
+	testVPodStorePersister(t, NewFileVPodStorePersister(t.TempDir()))
+}
+
+func TestConfigMapVPodStorePersister(t *testing.T) {
+	kubeClient := fake.NewClientBuilder().Build()
+	persister := NewConfigMapVPodStorePersister(kubeClient, "default")
+	testVPodStorePersister(t, persister)
+
+	store := NewPersistentVPodStore("vnode.test", persister)
+	store.PutPod(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pod1",
+			Namespace: "ns1",
+		},
+	})
+	assert.NoError(t, store.Snapshot(context.TODO()))
+	configMap := &corev1.ConfigMap{}
+	assert.NoError(t, kubeClient.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "vpod-store-vnode.test"}, configMap))
+	assert.Equal(t, "vnode.test", configMap.Labels[model.LabelKeyOfVNodeName])
+
+	// update the existing ConfigMap
+	store.DeletePod("ns1/pod1")
+	assert.NoError(t, store.Snapshot(context.TODO()))
+	pods, err := persister.Load(context.TODO(), "vnode.test")
+	assert.NoError(t, err)
+	assert.Empty(t, pods)
+}
+
+func TestVPodProvider_RestorePods(t *testing.T) {
+	persister := NewFileVPodStorePersister(t.TempDir())
+	store := NewPersistentVPodStore("vnode.test", persister)
+	store.PutPod(newResourcePod("pod1", "1", "1Gi"))
+	succeededPod := newResourcePod("pod2", "1", "1Gi")
+	succeededPod.Status.Phase = corev1.PodSucceeded
+	store.PutPod(succeededPod)
+	assert.NoError(t, store.Snapshot(context.TODO()))
+
+	provider := NewVPodProvider("default", "127.0.0.1", "vnode.test", nil, nil, nil, &tunnel.MockTunnel{})
+	provider.vPodStore = NewPersistentVPodStore("vnode.test", persister)
+	assert.NoError(t, provider.RestorePods(context.TODO()))
+	pods, err := provider.GetPods(context.TODO())
+	assert.NoError(t, err)
+	assert.Len(t, pods, 2)
+	// only the running pods hold resources
+	requested := provider.nodeResourceStore.GetRequested()
+	assert.Equal(t, "1", requested.Cpu().String())
+
+	// restoring over the live store keeps the live pods, e.g. when a handed off node is resumed
+	livePod := provider.vPodStore.GetPodByKey("ns/pod1").DeepCopy()
+	livePod.Labels = map[string]string{"live": "true"}
+	provider.vPodStore.PutPod(livePod)
+	assert.NoError(t, provider.RestorePods(context.TODO()))
+	assert.Equal(t, "true", provider.vPodStore.GetPodByKey("ns/pod1").Labels["live"])
+	requested = provider.nodeResourceStore.GetRequested()
+	assert.Equal(t, "1", requested.Cpu().String())
+}
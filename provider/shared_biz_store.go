@@ -0,0 +1,98 @@
+/**
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package provider
+
+import (
+	"sort"
+	"sync"
+)
+
+// Summary:
+// This file defines the SharedBizStore structure, which counts the references of the pods to the shared bizs on a vnode.
+// A shared biz is installed once on the base when the first pod references it, and uninstalled when the last pod releases it.
+
+// SharedBizStore provides the in memory references of the pods to the shared bizs, keyed by biz key.
+type SharedBizStore struct {
+	sync.Mutex
+
+	bizKeyToPodKeys map[string]map[string]bool // Maps biz key to the keys of the pods referencing it
+}
+
+// NewSharedBizStore creates a new instance of SharedBizStore.
+func NewSharedBizStore() *SharedBizStore {
+	return &SharedBizStore{
+		bizKeyToPodKeys: make(map[string]map[string]bool),
+	}
+}
+
+// Acquire adds the reference of the pod to the biz, returns true if the pod is the first one referencing the biz.
+// Acquiring a biz already referenced by the pod does nothing.
+func (r *SharedBizStore) Acquire(bizKey, podKey string) bool {
+	r.Lock()
+	defer r.Unlock()
+
+	podKeys, has := r.bizKeyToPodKeys[bizKey]
+	if !has {
+		podKeys = make(map[string]bool)
+		r.bizKeyToPodKeys[bizKey] = podKeys
+	}
+	first := len(podKeys) == 0
+	podKeys[podKey] = true
+	return first
+}
+
+// Release removes the reference of the pod to the biz, returns true if the pod is the last one referencing the biz.
+// Releasing a biz not referenced by the pod does nothing.
+func (r *SharedBizStore) Release(bizKey, podKey string) bool {
+	r.Lock()
+	defer r.Unlock()
+
+	podKeys, has := r.bizKeyToPodKeys[bizKey]
+	if !has || !podKeys[podKey] {
+		return false
+	}
+	delete(podKeys, podKey)
+	if len(podKeys) > 0 {
+		return false
+	}
+	delete(r.bizKeyToPodKeys, bizKey)
+	return true
+}
+
+// IsShared returns whether the biz is referenced by any pod as a shared biz.
+func (r *SharedBizStore) IsShared(bizKey string) bool {
+	r.Lock()
+	defer r.Unlock()
+	return len(r.bizKeyToPodKeys[bizKey]) > 0
+}
+
+// GetPodKeys returns the sorted keys of the pods referencing the biz.
+func (r *SharedBizStore) GetPodKeys(bizKey string) []string {
+	r.Lock()
+	defer r.Unlock()
+
+	ret := make([]string, 0, len(r.bizKeyToPodKeys[bizKey]))
+	for podKey := range r.bizKeyToPodKeys[bizKey] {
+		ret = append(ret, podKey)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// IsPrimary returns whether the pod is the first one of the sorted pods referencing the biz, which handles the restart of the biz.
+func (r *SharedBizStore) IsPrimary(bizKey, podKey string) bool {
+	podKeys := r.GetPodKeys(bizKey)
+	return len(podKeys) > 0 && podKeys[0] == podKey
+}
@@ -0,0 +1,31 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSharedBizStore_AcquireAndRelease(t *testing.T) {
+	store := NewSharedBizStore()
+	assert.False(t, store.IsShared("biz:1.0.0"))
+
+	assert.True(t, store.Acquire("biz:1.0.0", "ns/pod-b"))
+	assert.False(t, store.Acquire("biz:1.0.0", "ns/pod-a"))
+	assert.False(t, store.Acquire("biz:1.0.0", "ns/pod-a"))
+	assert.True(t, store.IsShared("biz:1.0.0"))
+	assert.Equal(t, []string{"ns/pod-a", "ns/pod-b"}, store.GetPodKeys("biz:1.0.0"))
+	assert.True(t, store.IsPrimary("biz:1.0.0", "ns/pod-a"))
+	assert.False(t, store.IsPrimary("biz:1.0.0", "ns/pod-b"))
+
+	assert.False(t, store.Release("biz:1.0.0", "ns/pod-c"))
+	assert.False(t, store.Release("biz:1.0.0", "ns/pod-a"))
+	assert.True(t, store.IsPrimary("biz:1.0.0", "ns/pod-b"))
+	assert.True(t, store.Release("biz:1.0.0", "ns/pod-b"))
+	assert.False(t, store.Release("biz:1.0.0", "ns/pod-b"))
+	assert.False(t, store.IsShared("biz:1.0.0"))
+	assert.Empty(t, store.GetPodKeys("biz:1.0.0"))
+
+	// installed again on the next use
+	assert.True(t, store.Acquire("biz:1.0.0", "ns/pod-a"))
+}
@@ -2,6 +2,7 @@ package provider
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/koupleless/virtual-kubelet/tunnel"
 	"github.com/koupleless/virtual-kubelet/virtual_kubelet/node"
@@ -9,17 +10,21 @@ import (
 	"k8s.io/apimachinery/pkg/api/resource"
 	"runtime"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sync/atomic"
 	"time"
 
 	"github.com/koupleless/virtual-kubelet/common/utils"
 	"github.com/koupleless/virtual-kubelet/model"
 	"github.com/pkg/errors"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"github.com/virtual-kubelet/virtual-kubelet/node/api/statsv1alpha1"
 	coordinationv1 "k8s.io/api/coordination/v1"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/ptr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -37,14 +42,24 @@ type VNode struct {
 	node         *nodeutil2.Node // Node instance for the virtual node
 	tunnel       tunnel.Tunnel
 
+	eventRecorder record.EventRecorder // Recorder of the node events
+
 	exit                           chan struct{} // Channel for signaling the node to exit
 	ready                          chan struct{} // Channel for signaling the node is ready
 	exitWhenLeaderAcquiredByOthers chan struct{} // Channel for signaling the leader has changed
 	initWhenLeaderAcquiredByMe     chan struct{}
 	done                           chan struct{} // Channel for signaling the node has exited
 
-	lease    *coordinationv1.Lease // Latest lease of the node
-	Liveness Liveness              // Liveness of the node from provider
+	draining atomic.Bool // Whether the node is draining before shutdown
+
+	deleted bool // Whether the node is deleted on exit, the pods snapshot is cleared then
+
+	handingOff atomic.Bool                        // Whether the node stops accepting new work as the leader is handed off
+	handoff    atomic.Pointer[model.LeaseHandoff] // Handoff record of the previous leader, resumed after the lease acquired
+
+	lease          atomic.Pointer[coordinationv1.Lease] // Latest lease of the node, read by the controller while renewed
+	Liveness       Liveness                             // Liveness of the node from provider
+	livenessConfig model.LivenessConfig                 // Liveness policy of the node
 
 	err error // Error that caused the node to exit
 }
@@ -54,7 +69,12 @@ func (vNode *VNode) GetNodeName() string {
 }
 
 func (vNode *VNode) GetLease() *coordinationv1.Lease {
-	return vNode.lease
+	return vNode.lease.Load()
+}
+
+// GetTunnel returns the tunnel which discovered the node
+func (vNode *VNode) GetTunnel() tunnel.Tunnel {
+	return vNode.tunnel
 }
 
 // Run is the main function for a virtual node
@@ -67,6 +87,27 @@ func (vNode *VNode) Run(ctx context.Context, initData model.NodeInfo) {
 		close(vNode.done)
 	}()
 
+	// Restore the pods before the pod controller starts, so the pods are updated instead of recreated
+	if restoreErr := vNode.podProvider.RestorePods(ctx); restoreErr != nil {
+		log.G(ctx).WithError(restoreErr).Errorf("failed to restore pods of vnode %s", vNode.name)
+	}
+	vNode.podProvider.ResumeBizUpgrades(ctx)
+	snapshotTaskCtx, cancelSnapshotTask := context.WithCancel(ctx)
+	defer cancelSnapshotTask()
+	go utils.TimedTaskWithInterval(snapshotTaskCtx, model.VPodStoreSnapshotIntervalSeconds*time.Second, vNode.snapshotPods)
+	defer func() {
+		// the context may be canceled already
+		snapshotCtx, cancel := context.WithTimeout(context.Background(), model.VPodStoreSnapshotIntervalSeconds*time.Second)
+		defer cancel()
+		if vNode.deleted {
+			if clearErr := vNode.podProvider.vPodStore.Clear(snapshotCtx); clearErr != nil {
+				log.G(ctx).WithError(clearErr).Errorf("failed to clear pods snapshot of vnode %s", vNode.name)
+			}
+			return
+		}
+		vNode.snapshotPods(snapshotCtx)
+	}()
+
 	// Start the node
 	go func() {
 		err = vNode.node.Run(ctx)
@@ -94,9 +135,12 @@ func (vNode *VNode) Run(ctx context.Context, initData model.NodeInfo) {
 			// TODO: should not exit this runnable, to recovery when leader acquired again
 			return
 		case <-vNode.initWhenLeaderAcquiredByMe:
+			vNode.resumeHandoff(ctx)
 			vNode.discoveryPreviousPods(ctx)
 		case <-vNode.exit:
 			// Node exit, process node delete and lease delete
+			vNode.deleted = true
+			vNode.RecordEvent(corev1.EventTypeNormal, model.NodeEventReasonShutdown, "vnode %s shut down by %s", vNode.name, vNode.leaseHolder())
 			node := &corev1.Node{
 				ObjectMeta: metav1.ObjectMeta{
 					Name: vNode.name,
@@ -109,17 +153,26 @@ func (vNode *VNode) Run(ctx context.Context, initData model.NodeInfo) {
 
 			err = vNode.client.Get(ctx, types.NamespacedName{
 				Name: vNode.name}, node)
-			err = vNode.client.Delete(ctx, vNode.lease)
+			if lease := vNode.lease.Load(); lease != nil {
+				err = vNode.client.Delete(ctx, lease)
+			}
 			return
 		}
 	}
 }
 
+// snapshotPods saves the pods of the node if changed
+func (vNode *VNode) snapshotPods(ctx context.Context) {
+	if err := vNode.podProvider.vPodStore.Snapshot(ctx); err != nil {
+		log.G(ctx).WithError(err).Errorf("failed to snapshot pods of vnode %s", vNode.name)
+	}
+}
+
 // StartLeaderElection renews the lease of the node
 func (vNode *VNode) StartLeaderElection(ctx context.Context, clientID string) {
 	//vNode.createOrRetryUpdateLease(ctx, clientID)
 	// Retry updating the lease
-	utils.TimedTaskWithInterval(ctx, time.Second*model.NodeLeaseUpdatePeriodSeconds, func(ctx context.Context) {
+	utils.TimedTaskWithInterval(ctx, vNode.livenessConfig.LeaseRenewPeriod, func(ctx context.Context) {
 		vNode.createOrRetryUpdateLease(ctx, clientID)
 	})
 }
@@ -176,28 +229,52 @@ func (vNode *VNode) createOrRetryUpdateLease(ctx context.Context, clientID strin
 			continue
 		}
 
+		if vNode.IsHandingOff() {
+			// the node has been handed off, never acquire the lease again
+			return
+		}
+
 		isLeaderBefore := vNode.IsLeader(clientID)
-		vNode.lease = lease
+		vNode.lease.Store(lease)
 		isLeaderNow := vNode.IsLeader(clientID)
 		// If the holder identity is not the current client id, the leader has changed
 		if isLeaderBefore && !isLeaderNow {
-			log.G(ctx).Infof("node lease %s acquired by %s", vNode.name, *vNode.lease.Spec.HolderIdentity)
-			vNode.leaderAcquiredByOthers()
+			log.G(ctx).Infof("node lease %s acquired by %s", vNode.name, vNode.leaseHolder())
+			vNode.RecordEvent(corev1.EventTypeWarning, model.NodeEventReasonLeaderLost, "lease of vnode %s lost by %s, held by %s", vNode.name, clientID, vNode.leaseHolder())
+			vNode.StepDown(ctx)
 			return
 		} else if !isLeaderBefore && isLeaderNow {
 			log.G(ctx).Infof("node lease %s acquired by %s", vNode.name, clientID)
+			vNode.RecordEvent(corev1.EventTypeNormal, model.NodeEventReasonLeaderAcquired, "lease of vnode %s acquired by %s", vNode.name, clientID)
 			vNode.leaderAcquiredByMe()
 			log.G(ctx).Infof("node %s inited after leader acquired", vNode.name)
+		} else if !isLeaderNow && utils.IsLeaseValid(lease) && *lease.Spec.HolderIdentity != "" {
+			// the lease is renewed by another leader, wait for it expired or handed off
+			return
 		}
 
 		newLease := lease.DeepCopy()
+		acquiring := !isLeaderNow
+		if acquiring {
+			// resume the work handed off by the previous leader, the record is consumed by this acquisition
+			if handoff := parseLeaseHandoff(lease); handoff != nil {
+				vNode.handoff.Store(handoff)
+			}
+			delete(newLease.Annotations, model.AnnotationKeyOfLeaseHandoff)
+		}
 		newLease.Spec.HolderIdentity = &clientID
+		newLease.Spec.LeaseDurationSeconds = ptr.To(vNode.leaseDurationSeconds())
 		newLease.Spec.RenewTime = &metav1.MicroTime{Time: time.Now()}
 
 		err = vNode.client.Patch(ctx, newLease, client.MergeFrom(lease))
 		if err == nil {
 			log.G(ctx).WithField("retries", i).Infof("Successfully updated lease for %s", vNode.name)
-			vNode.lease = newLease
+			vNode.lease.Store(newLease)
+			if acquiring {
+				log.G(ctx).Infof("node lease %s acquired by %s", vNode.name, clientID)
+				vNode.RecordEvent(corev1.EventTypeNormal, model.NodeEventReasonLeaderAcquired, "lease of vnode %s acquired by %s", vNode.name, clientID)
+				vNode.leaderAcquiredByMe()
+			}
 			return
 		}
 		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
@@ -263,7 +340,7 @@ func (vNode *VNode) newLease(holderIdentity string) *coordinationv1.Lease {
 		},
 		Spec: coordinationv1.LeaseSpec{
 			HolderIdentity:       ptr.To(holderIdentity),
-			LeaseDurationSeconds: ptr.To[int32](model.NodeLeaseDurationSeconds),
+			LeaseDurationSeconds: ptr.To(vNode.leaseDurationSeconds()),
 			RenewTime:            &metav1.MicroTime{Time: time.Now()},
 		},
 	}
@@ -271,6 +348,11 @@ func (vNode *VNode) newLease(holderIdentity string) *coordinationv1.Lease {
 	return lease
 }
 
+// leaseDurationSeconds returns the lease duration of the node in seconds
+func (vNode *VNode) leaseDurationSeconds() int32 {
+	return int32(vNode.livenessConfig.LeaseDuration / time.Second)
+}
+
 // SyncNodeStatus syncs the status of the node
 func (vNode *VNode) SyncNodeStatus(data model.NodeStatusData) {
 	if vNode.nodeProvider != nil {
@@ -278,11 +360,12 @@ func (vNode *VNode) SyncNodeStatus(data model.NodeStatusData) {
 	}
 }
 
-// SyncAllContainerInfo syncs the status of all containers
-func (vNode *VNode) SyncAllContainerInfo(ctx context.Context, infos []model.BizStatusData) {
+// SyncAllContainerInfo syncs the status of all containers, returns whether any container status changed
+func (vNode *VNode) SyncAllContainerInfo(ctx context.Context, infos []model.BizStatusData) bool {
 	if vNode.podProvider != nil {
-		vNode.podProvider.SyncAllBizStatusToKube(ctx, infos)
+		return vNode.podProvider.SyncAllBizStatusToKube(ctx, infos)
 	}
+	return false
 }
 
 // SyncOneContainerInfo syncs the status of a single container
@@ -292,6 +375,95 @@ func (vNode *VNode) SyncOneContainerInfo(ctx context.Context, bizStatusData mode
 	}
 }
 
+// SyncBizStatusDelta syncs the biz status delta of the base, returns false if a full delta is needed
+func (vNode *VNode) SyncBizStatusDelta(ctx context.Context, delta model.BizStatusDelta) bool {
+	if vNode.podProvider != nil {
+		return vNode.podProvider.SyncBizStatusDeltaToKube(ctx, delta)
+	}
+	return true
+}
+
+// SyncBizOperationResponse syncs the response of an async biz operation
+func (vNode *VNode) SyncBizOperationResponse(ctx context.Context, response model.BizOperationResponse) {
+	if vNode.podProvider != nil {
+		vNode.podProvider.SyncBizOperationResponse(ctx, response)
+	}
+}
+
+// DropBizOperation drops the async biz operation not waited for, its response is ignored
+func (vNode *VNode) DropBizOperation(operationID string) {
+	if vNode.podProvider != nil {
+		vNode.podProvider.DropBizOperation(operationID)
+	}
+}
+
+// GetStatsSummary returns the stats summary of the node and its pods
+func (vNode *VNode) GetStatsSummary(ctx context.Context) (*statsv1alpha1.Summary, error) {
+	return vNode.podProvider.GetStatsSummary(ctx)
+}
+
+// GetMetricsResource returns the resource metrics of the node and its pods
+func (vNode *VNode) GetMetricsResource(ctx context.Context) ([]*dto.MetricFamily, error) {
+	return vNode.podProvider.GetMetricsResource(ctx)
+}
+
+// MarkNotReady marks the vnode not ready and taints it unreachable, returns whether the readiness changed
+func (vNode *VNode) MarkNotReady(ctx context.Context) (bool, error) {
+	if vNode.nodeProvider == nil {
+		return false, nil
+	}
+	return vNode.nodeProvider.SetReady(ctx, false)
+}
+
+// MarkReady reverts MarkNotReady, returns whether the readiness changed
+func (vNode *VNode) MarkReady(ctx context.Context) (bool, error) {
+	if vNode.nodeProvider == nil {
+		return false, nil
+	}
+	return vNode.nodeProvider.SetReady(ctx, true)
+}
+
+// IsNotReady returns whether the vnode is marked not ready
+func (vNode *VNode) IsNotReady() bool {
+	return vNode.nodeProvider != nil && vNode.nodeProvider.IsNotReady()
+}
+
+// Drain cordons the vnode, stops all bizs and marks all pods terminated before the vnode shutdown,
+// the stop responses are waited at most timeout, the vnode is expected marked draining by StartDraining
+func (vNode *VNode) Drain(ctx context.Context, timeout time.Duration) {
+	logger := log.G(ctx).WithField("nodeName", vNode.name)
+	logger.Info("draining vnode")
+
+	if vNode.nodeProvider != nil {
+		if err := vNode.nodeProvider.Cordon(ctx); err != nil {
+			logger.WithError(err).Error("failed to cordon vnode")
+		}
+	}
+
+	if vNode.podProvider != nil {
+		vNode.podProvider.StopAllBiz(ctx)
+		utils.CheckAndFinallyCall(ctx, func() (bool, error) {
+			return !vNode.podProvider.HasPendingBizOperation(), nil
+		}, timeout, time.Millisecond*200, func() {
+			logger.Info("all bizs stopped")
+		}, func() {
+			logger.Warnf("waiting for bizs stopped timeout after %s", timeout)
+		})
+		vNode.podProvider.TerminateAllPods(ctx, model.PodReasonNodeDrained, fmt.Sprintf("base %s deactivated, pod drained", vNode.name))
+	}
+	logger.Info("vnode drained")
+}
+
+// StartDraining marks the vnode draining, returns false if it is already draining
+func (vNode *VNode) StartDraining() bool {
+	return vNode.draining.CompareAndSwap(false, true)
+}
+
+// IsDraining returns whether the vnode is draining
+func (vNode *VNode) IsDraining() bool {
+	return vNode.draining.Load()
+}
+
 // Done returns a channel that will be closed when the vnode has exited.
 func (vNode *VNode) Done() <-chan struct{} {
 	return vNode.done
@@ -302,12 +474,152 @@ func (vNode *VNode) ExitWhenLeaderChanged() <-chan struct{} {
 	return vNode.exitWhenLeaderAcquiredByOthers
 }
 
-// IsLeader returns a bool marked current vnode is leader or not
+// IsLeader returns a bool marked current vnode is leader or not, a node handing off is not leader any more
 func (vNode *VNode) IsLeader(clientId string) bool {
 	// current time is not after the lease renew time and the lease holder time
+	lease := vNode.lease.Load()
+	if lease == nil || lease.Spec.HolderIdentity == nil || vNode.IsHandingOff() {
+		return false
+	}
+
+	return *lease.Spec.HolderIdentity != "" && *lease.Spec.HolderIdentity == clientId && utils.IsLeaseValid(lease)
+}
+
+// IsHandingOff returns whether the node is handing off or handed off to another leader
+func (vNode *VNode) IsHandingOff() bool {
+	return vNode.handingOff.Load()
+}
+
+// HandOff hands off the node to the next leader cooperatively: the node stops accepting new work, waits for the in-flight pod syncs,
+// records the remaining work on the lease and releases the lease, so the next leader resumes from the record instead of starting cold.
+// The node exits even if the lease failed to be released, as it never accepts new work once handing off
+func (vNode *VNode) HandOff(ctx context.Context, clientID string) error {
+	if !vNode.IsLeader(clientID) || !vNode.handingOff.CompareAndSwap(false, true) {
+		return nil
+	}
+	log.G(ctx).Infof("handing off node %s by %s", vNode.name, clientID)
+
+	vNode.waitPodSyncsDone(ctx, model.VNodeHandoffTimeoutSeconds*time.Second)
+	vNode.snapshotPods(ctx)
+
+	handoff, err := json.Marshal(model.LeaseHandoff{
+		Holder:            clientID,
+		Time:              time.Now(),
+		PendingPodKeys:    vNode.pendingPodKeys(),
+		PendingOperations: vNode.podProvider.GetHandoffBizOperations(),
+		PendingUpgrades:   vNode.podProvider.GetHandoffBizUpgrades(),
+	})
+	if err != nil {
+		// the node stopped accepting new work, exits the same as stepping down, the next leader acquires the lease once expired
+		vNode.leaderAcquiredByOthers()
+		return err
+	}
+
+	lease := vNode.lease.Load()
+	newLease := lease.DeepCopy()
+	if newLease.Annotations == nil {
+		newLease.Annotations = make(map[string]string)
+	}
+	newLease.Annotations[model.AnnotationKeyOfLeaseHandoff] = string(handoff)
+	// release the lease, so the next leader acquires it without waiting for it expired
+	newLease.Spec.HolderIdentity = ptr.To("")
+	err = vNode.client.Patch(ctx, newLease, client.MergeFromWithOptions(lease, client.MergeFromWithOptimisticLock{}))
+	if err != nil {
+		vNode.leaderAcquiredByOthers()
+		return errors.Wrapf(err, "failed to release node lease %s", vNode.name)
+	}
+	vNode.lease.Store(newLease)
+	vNode.RecordEvent(corev1.EventTypeNormal, model.NodeEventReasonLeaderHandedOff, "lease of vnode %s handed off by %s", vNode.name, clientID)
+	vNode.leaderAcquiredByOthers()
+	return nil
+}
+
+// StepDown stops accepting new work and waits for the in-flight pod syncs before the node exits, as the lease is acquired by others
+// or the node is no longer in the shard of this vk
+func (vNode *VNode) StepDown(ctx context.Context) {
+	vNode.handingOff.Store(true)
+	vNode.waitPodSyncsDone(ctx, model.VNodeHandoffTimeoutSeconds*time.Second)
+	vNode.snapshotPods(ctx)
+	vNode.leaderAcquiredByOthers()
+}
+
+// waitPodSyncsDone stops the pod workers from starting new syncs, and waits for the in-flight pod syncs done or the timeout,
+// the pods not synced are left pending for the next leader
+func (vNode *VNode) waitPodSyncsDone(ctx context.Context, timeout time.Duration) {
+	if vNode.node == nil {
+		return
+	}
+	podController := vNode.node.PodController()
+	podController.PauseSyncPodsFromKubernetes()
+	utils.CheckAndFinallyCall(ctx, func() (bool, error) {
+		return podController.SyncPodsFromKubernetesInFlight() == 0, nil
+	}, timeout, time.Millisecond*100, func() {}, func() {
+		log.G(ctx).Warnf("pods of node %s are still syncing after %s", vNode.name, timeout)
+	})
+}
+
+// pendingPodKeys returns the keys of the pods waiting to be synced from kubernetes
+func (vNode *VNode) pendingPodKeys() []string {
+	if vNode.node == nil {
+		return nil
+	}
+	return vNode.node.PodController().SyncPodsFromKubernetesPendingKeys()
+}
+
+// resumeHandoff resumes the work recorded by the previous leader
+func (vNode *VNode) resumeHandoff(ctx context.Context) {
+	handoff := vNode.handoff.Swap(nil)
+	if handoff == nil {
+		return
+	}
+	log.G(ctx).Infof("resume node %s handed off by %s at %s", vNode.name, handoff.Holder, handoff.Time)
+
+	// the previous leader saved the pods before handing off, the pods synced since the node started are kept
+	if err := vNode.podProvider.RestorePods(ctx); err != nil {
+		log.G(ctx).WithError(err).Errorf("failed to restore pods of vnode %s", vNode.name)
+	}
+	vNode.podProvider.ResumeHandoffBizOperations(ctx, handoff.PendingOperations)
+	// the upgrades are resumed after the operations, so the old bizs waiting for the stop responses are not stopped again
+	vNode.podProvider.ResumeHandoffBizUpgrades(ctx, handoff.PendingUpgrades)
+	for _, key := range handoff.PendingPodKeys {
+		vNode.SyncPodsFromKubernetesEnqueue(ctx, key)
+	}
+}
 
-	return vNode.lease != nil && *vNode.lease.Spec.HolderIdentity != "" && *vNode.lease.Spec.HolderIdentity == clientId &&
-		!time.Now().After(vNode.lease.Spec.RenewTime.Time.Add(time.Second*model.NodeLeaseDurationSeconds))
+// parseLeaseHandoff returns the handoff record on the lease, nil if no record
+func parseLeaseHandoff(lease *coordinationv1.Lease) *model.LeaseHandoff {
+	data, has := lease.Annotations[model.AnnotationKeyOfLeaseHandoff]
+	if !has {
+		return nil
+	}
+	handoff := &model.LeaseHandoff{}
+	if err := json.Unmarshal([]byte(data), handoff); err != nil {
+		log.L.WithError(err).Errorf("failed to parse handoff of lease %s", lease.Name)
+		return nil
+	}
+	return handoff
+}
+
+// RecordEvent records an event of the vnode, which is shown by kubectl describe node
+func (vNode *VNode) RecordEvent(eventType, reason, messageFmt string, args ...interface{}) {
+	if vNode.eventRecorder == nil {
+		return
+	}
+	// the kubelet sets the uid of the node reference to the node name, kubectl describe node looks up the events by it
+	vNode.eventRecorder.Eventf(&corev1.ObjectReference{
+		Kind: "Node",
+		Name: vNode.name,
+		UID:  types.UID(vNode.name),
+	}, eventType, reason, messageFmt, args...)
+}
+
+// leaseHolder returns the holder of the latest lease of the node, empty if no lease
+func (vNode *VNode) leaseHolder() string {
+	lease := vNode.lease.Load()
+	if lease == nil || lease.Spec.HolderIdentity == nil {
+		return ""
+	}
+	return *lease.Spec.HolderIdentity
 }
 
 // Err returns err which causes vnode exit
@@ -387,6 +699,7 @@ func NewVNode(config *model.BuildVNodeConfig, tunnel tunnel.Tunnel) (kn *VNode,
 	if config.NodeName == "" {
 		return nil, errors.New("node name cannot be empty")
 	}
+	livenessConfig := utils.FillLivenessConfigDefaults(config.Liveness)
 	// Declare variables for nodeProvider and podProvider
 	var nodeProvider *VNodeProvider
 	var podProvider *VPodProvider
@@ -396,10 +709,13 @@ func NewVNode(config *model.BuildVNodeConfig, tunnel tunnel.Tunnel) (kn *VNode,
 		config.NodeName,
 		// Function to create providers and register the node
 		func(cfg nodeutil2.ProviderConfig) (nodeutil2.Provider, node.NodeProvider, error) {
-			// Create a new VirtualKubeletNode provider with configuration
-			nodeProvider = NewVNodeProvider(config)
 			// Initialize pod provider with node namespace, IP, ID, client, and tunnel
-			podProvider = NewVPodProvider(cfg.Node.Namespace, config.NodeIP, config.NodeName, config.Client, tunnel)
+			podProvider = NewVPodProvider(cfg.Node.Namespace, config.NodeIP, config.NodeName, config.Client, config.EventRecorder, config.BizClassifier, tunnel)
+			if config.VPodStorePersister != nil {
+				podProvider.vPodStore = NewPersistentVPodStore(config.NodeName, config.VPodStorePersister)
+			}
+			// Create a new VirtualKubeletNode provider sharing the resource accounting of the pod provider
+			nodeProvider = NewVNodeProvider(config, podProvider.nodeResourceStore)
 
 			if err != nil {
 				return nil, nil, err
@@ -418,11 +734,13 @@ func NewVNode(config *model.BuildVNodeConfig, tunnel tunnel.Tunnel) (kn *VNode,
 			return nil
 		},
 		func(cfg *nodeutil2.NodeConfig) error {
-			return buildNode(&cfg.Node, config)
+			return buildNode(&cfg.Node, config, tunnel.Key())
 		},
 		// Options for creating the node
 		nodeutil2.WithClient(config.Client),
 		nodeutil2.WithCache(config.KubeCache),
+		nodeutil2.WithEventRecorder(config.EventRecorder),
+		nodeutil2.WithPodStatusWriter(config.PodStatusWriter.CoalesceWindow, config.PodStatusWriter.MaxConcurrentWrites),
 	)
 	if err != nil {
 		return nil, err
@@ -437,17 +755,19 @@ func NewVNode(config *model.BuildVNodeConfig, tunnel tunnel.Tunnel) (kn *VNode,
 		podProvider:                    podProvider,
 		vpodType:                       config.VPodType,
 		tunnel:                         tunnel,
+		eventRecorder:                  config.EventRecorder,
 		node:                           cm,
 		exit:                           make(chan struct{}),
 		ready:                          make(chan struct{}),
 		done:                           make(chan struct{}),
 		initWhenLeaderAcquiredByMe:     make(chan struct{}, 1),
 		exitWhenLeaderAcquiredByOthers: make(chan struct{}),
-		Liveness:                       Liveness{}, // a very old time
+		Liveness:                       NewLiveness(livenessConfig), // a very old time
+		livenessConfig:                 livenessConfig,
 	}, nil
 }
 
-func buildNode(node *corev1.Node, config *model.BuildVNodeConfig) error {
+func buildNode(node *corev1.Node, config *model.BuildVNodeConfig, tunnelKey string) error {
 	oldLabels := node.Labels
 	if oldLabels == nil {
 		oldLabels = make(map[string]string)
@@ -461,6 +781,7 @@ func buildNode(node *corev1.Node, config *model.BuildVNodeConfig) error {
 	for k, v := range config.CustomLabels {
 		oldLabels[k] = v
 	}
+	oldLabels[model.LabelKeyOfVNodeTunnel] = tunnelKey
 	node.Labels = oldLabels
 
 	oldAnnotations := node.Annotations
@@ -470,8 +791,29 @@ func buildNode(node *corev1.Node, config *model.BuildVNodeConfig) error {
 	for k, v := range config.CustomAnnotations {
 		oldAnnotations[k] = v
 	}
+	oldAnnotations[model.AnnotationKeyOfBaseIP] = config.NodeIP
 	node.Annotations = oldAnnotations
 
+	addresses := []corev1.NodeAddress{
+		{
+			Type:    corev1.NodeInternalIP,
+			Address: config.NodeIP,
+		},
+		{
+			Type:    corev1.NodeHostName,
+			Address: config.NodeHostname,
+		},
+	}
+	if config.KubeletAddress != "" {
+		// the apiserver and the metrics-server prefer the hostname, only the kubelet api address is advertised
+		addresses = []corev1.NodeAddress{
+			{
+				Type:    corev1.NodeInternalIP,
+				Address: config.KubeletAddress,
+			},
+		}
+	}
+
 	node.Spec.Taints = append([]corev1.Taint{
 		{
 			Key:    model.TaintKeyOfVnode,
@@ -487,17 +829,8 @@ func buildNode(node *corev1.Node, config *model.BuildVNodeConfig) error {
 
 	// Set the node status.
 	node.Status = corev1.NodeStatus{
-		Phase: corev1.NodeRunning,
-		Addresses: []corev1.NodeAddress{
-			{
-				Type:    corev1.NodeInternalIP,
-				Address: config.NodeIP,
-			},
-			{
-				Type:    corev1.NodeHostName,
-				Address: config.NodeHostname,
-			},
-		},
+		Phase:     corev1.NodeRunning,
+		Addresses: addresses,
 		Conditions: []corev1.NodeCondition{
 			{
 				Type:   corev1.NodeReady,
@@ -521,10 +854,15 @@ func buildNode(node *corev1.Node, config *model.BuildVNodeConfig) error {
 			},
 		},
 		Capacity: map[corev1.ResourceName]resource.Quantity{
-			corev1.ResourcePods: resource.MustParse("65535"),
+			corev1.ResourcePods: *resource.NewQuantity(model.DefaultNodePodCapacity, resource.DecimalSI),
 		},
 		Allocatable: map[corev1.ResourceName]resource.Quantity{
-			corev1.ResourcePods: resource.MustParse("65535"),
+			corev1.ResourcePods: *resource.NewQuantity(model.DefaultNodePodCapacity, resource.DecimalSI),
+		},
+		DaemonEndpoints: corev1.NodeDaemonEndpoints{
+			KubeletEndpoint: corev1.DaemonEndpoint{
+				Port: config.KubeletPort,
+			},
 		},
 	}
 
@@ -20,10 +20,13 @@ import (
 	"github.com/koupleless/virtual-kubelet/virtual_kubelet/node"
 	"github.com/virtual-kubelet/virtual-kubelet/log"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sync"
+	"time"
 
 	"github.com/koupleless/virtual-kubelet/model"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // The following line ensures that VNodeProvider implements the NodeProvider interface.
@@ -35,6 +38,10 @@ type VNodeProvider struct {
 
 	nodeConfig *model.BuildVNodeConfig // Configuration for building a virtual node provider.
 
+	nodeResourceStore *NodeResourceStore // Resource accounting of the node shared with the pod provider.
+
+	notReady bool // Whether the node is marked not ready because the base is unreachable.
+
 	notify func(*corev1.Node) // Function to notify about node status changes.
 }
 
@@ -50,13 +57,133 @@ func (v *VNodeProvider) Notify(data model.NodeStatusData) {
 		return
 	}
 	vnodeCopy := utils.MergeNodeFromProvider(node, data)
+	if v.nodeResourceStore != nil {
+		// the allocatable of the node is what the base reports minus the requests of the running pods
+		v.nodeResourceStore.SetBaseAllocatable(getBaseAllocatable(vnodeCopy, data))
+		vnodeCopy.Status.Allocatable = v.nodeResourceStore.GetAllocatable()
+	}
+	if v.notReady {
+		// keep the node not ready until the base is reachable again
+		setNodeReadyCondition(vnodeCopy, false)
+	}
 	v.notify(vnodeCopy)
 }
 
+// IsNotReady returns whether the node is marked not ready.
+func (v *VNodeProvider) IsNotReady() bool {
+	v.Lock()
+	defer v.Unlock()
+	return v.notReady
+}
+
+// SetReady flips the NodeReady condition and the unreachable taint of the node, returns whether the readiness changed.
+func (v *VNodeProvider) SetReady(ctx context.Context, ready bool) (bool, error) {
+	v.Lock()
+	defer v.Unlock()
+	if v.notReady != ready {
+		return false, nil
+	}
+
+	node := &corev1.Node{}
+	err := v.nodeConfig.Client.Get(ctx, types.NamespacedName{Name: v.nodeConfig.NodeName}, node)
+	if err != nil {
+		return false, err
+	}
+
+	// taints are in spec, which is not updated by the node status patch
+	nodeCopy := node.DeepCopy()
+	nodeCopy.Spec.Taints = removeTaint(nodeCopy.Spec.Taints, corev1.TaintNodeUnreachable)
+	if !ready {
+		nodeCopy.Spec.Taints = append(nodeCopy.Spec.Taints, corev1.Taint{
+			Key:       corev1.TaintNodeUnreachable,
+			Effect:    corev1.TaintEffectNoExecute,
+			TimeAdded: &metav1.Time{Time: time.Now()},
+		})
+	}
+	err = v.nodeConfig.Client.Patch(ctx, nodeCopy, client.MergeFrom(node))
+	if err != nil {
+		return false, err
+	}
+
+	v.notReady = !ready
+	setNodeReadyCondition(nodeCopy, ready)
+	if v.notify != nil {
+		v.notify(nodeCopy)
+	}
+	return true, nil
+}
+
+// Cordon marks the node unschedulable.
+func (v *VNodeProvider) Cordon(ctx context.Context) error {
+	node := &corev1.Node{}
+	err := v.nodeConfig.Client.Get(ctx, types.NamespacedName{Name: v.nodeConfig.NodeName}, node)
+	if err != nil {
+		return err
+	}
+	if node.Spec.Unschedulable {
+		return nil
+	}
+
+	nodeCopy := node.DeepCopy()
+	nodeCopy.Spec.Unschedulable = true
+	return v.nodeConfig.Client.Patch(ctx, nodeCopy, client.MergeFrom(node))
+}
+
+// setNodeReadyCondition sets the NodeReady condition of the node, the status is unknown when not ready as the base can't be reached.
+func setNodeReadyCondition(node *corev1.Node, ready bool) {
+	readyCondition := corev1.NodeCondition{
+		Type:               corev1.NodeReady,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             "BaseReady",
+		Message:            "Base is posting heartbeat.",
+	}
+	if !ready {
+		readyCondition.Status = corev1.ConditionUnknown
+		readyCondition.Reason = "NodeStatusUnknown"
+		readyCondition.Message = "Base stopped posting heartbeat."
+	}
+
+	for i, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			node.Status.Conditions[i] = readyCondition
+			return
+		}
+	}
+	node.Status.Conditions = append(node.Status.Conditions, readyCondition)
+}
+
+// getBaseAllocatable returns the allocatable resources reported by the base, falls back to the capacity of the node.
+// The allocatable of the node is not used as it has been reduced by the requests of the running pods.
+func getBaseAllocatable(node *corev1.Node, data model.NodeStatusData) corev1.ResourceList {
+	allocatable := node.Status.Capacity.DeepCopy()
+	if allocatable == nil {
+		allocatable = corev1.ResourceList{}
+	}
+	for resourceName, status := range data.Resources {
+		if !status.Allocatable.IsZero() {
+			allocatable[resourceName] = status.Allocatable.DeepCopy()
+		}
+	}
+	return allocatable
+}
+
+// removeTaint returns the taints without the taint of the key.
+func removeTaint(taints []corev1.Taint, key string) []corev1.Taint {
+	ret := make([]corev1.Taint, 0, len(taints))
+	for _, taint := range taints {
+		if taint.Key != key {
+			ret = append(ret, taint)
+		}
+	}
+	return ret
+}
+
 // NewVNodeProvider creates a new VNodeProvider instance.
-func NewVNodeProvider(config *model.BuildVNodeConfig) *VNodeProvider {
+func NewVNodeProvider(config *model.BuildVNodeConfig, nodeResourceStore *NodeResourceStore) *VNodeProvider {
 	return &VNodeProvider{
-		nodeConfig: config,
+		nodeConfig:        config,
+		nodeResourceStore: nodeResourceStore,
 	}
 }
 
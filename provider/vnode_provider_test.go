@@ -0,0 +1,102 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/koupleless/virtual-kubelet/model"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/cache/informertest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// clientCache is a cache reading the objects from the client
+type clientCache struct {
+	informertest.FakeInformers
+	client client.Client
+}
+
+func (c *clientCache) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	return c.client.Get(ctx, key, obj, opts...)
+}
+
+func TestVNodeProvider_SetReady(t *testing.T) {
+	kubeClient := fake.NewClientBuilder().WithObjects(&corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "vnode.test",
+		},
+		Spec: corev1.NodeSpec{
+			Taints: []corev1.Taint{
+				{
+					Key:    model.TaintKeyOfVnode,
+					Value:  "True",
+					Effect: corev1.TaintEffectNoExecute,
+				},
+			},
+		},
+	}).Build()
+	nodeProvider := NewVNodeProvider(&model.BuildVNodeConfig{
+		Client:   kubeClient,
+		NodeName: "vnode.test",
+	}, nil)
+	notified := make([]*corev1.Node, 0)
+	nodeProvider.NotifyNodeStatus(context.TODO(), func(node *corev1.Node) {
+		notified = append(notified, node)
+	})
+
+	changed, err := nodeProvider.SetReady(context.TODO(), false)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.True(t, nodeProvider.IsNotReady())
+
+	node := &corev1.Node{}
+	assert.NoError(t, kubeClient.Get(context.TODO(), types.NamespacedName{Name: "vnode.test"}, node))
+	assert.Len(t, node.Spec.Taints, 2)
+	assert.Equal(t, corev1.TaintNodeUnreachable, node.Spec.Taints[1].Key)
+	assert.Equal(t, corev1.ConditionUnknown, notified[0].Status.Conditions[0].Status)
+
+	changed, err = nodeProvider.SetReady(context.TODO(), false)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	changed, err = nodeProvider.SetReady(context.TODO(), true)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.False(t, nodeProvider.IsNotReady())
+	assert.NoError(t, kubeClient.Get(context.TODO(), types.NamespacedName{Name: "vnode.test"}, node))
+	assert.Len(t, node.Spec.Taints, 1)
+	assert.Equal(t, corev1.ConditionTrue, notified[1].Status.Conditions[0].Status)
+}
+
+func TestVNodeProvider_NotifyKeepsAnnotations(t *testing.T) {
+	kubeClient := fake.NewClientBuilder().WithObjects(&corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "vnode.test",
+			Annotations: map[string]string{
+				model.AnnotationKeyOfUnmanagedBizs: "biz1",
+				model.AnnotationKeyOfBaseIP:        "127.0.0.1",
+			},
+		},
+	}).Build()
+	nodeProvider := NewVNodeProvider(&model.BuildVNodeConfig{
+		Client:    kubeClient,
+		KubeCache: &clientCache{client: kubeClient},
+		NodeName:  "vnode.test",
+	}, nil)
+	notified := make([]*corev1.Node, 0)
+	nodeProvider.NotifyNodeStatus(context.TODO(), func(node *corev1.Node) {
+		notified = append(notified, node)
+	})
+
+	nodeProvider.Notify(model.NodeStatusData{
+		CustomAnnotations: map[string]string{"custom": "value"},
+	})
+	assert.Len(t, notified, 1)
+	assert.Equal(t, "biz1", notified[0].Annotations[model.AnnotationKeyOfUnmanagedBizs])
+	assert.Equal(t, "127.0.0.1", notified[0].Annotations[model.AnnotationKeyOfBaseIP])
+	assert.Equal(t, "value", notified[0].Annotations["custom"])
+}
@@ -70,8 +70,8 @@ func TestGetLeaseOutdatedVNodeName(t *testing.T) {
 		Liveness: Liveness{},
 	}
 
-	vNode.lease = vNode.newLease(clientId)
-	vNode.lease.Spec.RenewTime.Time = time.Now().Add(-time.Second * model.NodeLeaseDurationSeconds)
+	vNode.lease.Store(vNode.newLease(clientId))
+	vNode.lease.Load().Spec.RenewTime.Time = time.Now().Add(-time.Second * model.NodeLeaseDurationSeconds)
 	store.AddVNode(nodeName, vNode)
 	nameList := store.GetLeaseOutdatedVNodeNames(clientId)
 	assert.Assert(t, len(nameList) == 1)
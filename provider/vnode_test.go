@@ -1,8 +1,21 @@
 package provider
 
 import (
+	"context"
+	"errors"
+	"github.com/koupleless/virtual-kubelet/model"
+	"github.com/koupleless/virtual-kubelet/tunnel"
 	"github.com/stretchr/testify/assert"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
 	"testing"
+	"time"
 )
 
 func TestVNode_ExitWhenLeaderChanged(t *testing.T) {
@@ -21,3 +34,234 @@ func TestVNode_ExitWhenLeaderChanged(t *testing.T) {
 		assert.Fail(t, "ExitWhenLeaderChanged should not called")
 	}
 }
+
+func TestVNode_Drain(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pod",
+			Namespace: "ns",
+		},
+		Spec: corev1.PodSpec{
+			NodeName: "vnode.test",
+			Containers: []corev1.Container{
+				{Name: "biz1", Image: "biz1.jar"},
+				{Name: "biz2", Image: "biz2.jar"},
+			},
+		},
+	}
+	kubeClient := fake.NewClientBuilder().WithObjects(&corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "vnode.test",
+		},
+	}, pod).WithStatusSubresource(&corev1.Pod{}).Build()
+
+	tl := &tunnel.MockTunnel{}
+	assert.NoError(t, tl.Start("test", "test"))
+	podProvider := NewVPodProvider("ns", "127.0.0.1", "vnode.test", kubeClient, nil, nil, tl)
+	stopped := make([]string, 0)
+	tl.RegisterCallback(nil, nil, nil, func(_ string, data model.BizStatusData) {
+		stopped = append(stopped, data.Name)
+	}, func(_ string, response model.BizOperationResponse) {
+		podProvider.SyncBizOperationResponse(context.TODO(), response)
+	})
+	podProvider.vPodStore.PutPod(pod)
+	for _, container := range pod.Spec.Containers {
+		tl.UpdateBizStatus("vnode.test", tl.GetBizUniqueKey(&container), model.BizStatusData{Name: container.Name})
+	}
+	stopped = stopped[:0]
+
+	vnode := VNode{
+		name: "vnode.test",
+		nodeProvider: NewVNodeProvider(&model.BuildVNodeConfig{
+			Client:   kubeClient,
+			NodeName: "vnode.test",
+		}, podProvider.nodeResourceStore),
+		podProvider: podProvider,
+	}
+	assert.True(t, vnode.StartDraining())
+	assert.False(t, vnode.StartDraining())
+	vnode.Drain(context.TODO(), time.Second)
+	assert.True(t, vnode.IsDraining())
+	assert.Equal(t, []string{"biz1", "biz2"}, stopped)
+	assert.False(t, podProvider.HasPendingBizOperation())
+
+	node := &corev1.Node{}
+	assert.NoError(t, kubeClient.Get(context.TODO(), types.NamespacedName{Name: "vnode.test"}, node))
+	assert.True(t, node.Spec.Unschedulable)
+
+	podFromKube := &corev1.Pod{}
+	assert.NoError(t, kubeClient.Get(context.TODO(), types.NamespacedName{Namespace: "ns", Name: "pod"}, podFromKube))
+	assert.Equal(t, corev1.PodFailed, podFromKube.Status.Phase)
+	assert.Equal(t, model.PodReasonNodeDrained, podFromKube.Status.Reason)
+	assert.Equal(t, model.PodReasonNodeDrained, podFromKube.Status.ContainerStatuses[0].State.Terminated.Reason)
+}
+
+func TestVNode_HandOff(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pod",
+			Namespace: "ns",
+		},
+		Spec: corev1.PodSpec{
+			NodeName:   "vnode.test",
+			Containers: []corev1.Container{{Name: "biz1", Image: "biz1.jar"}},
+		},
+	}
+	kubeClient := fake.NewClientBuilder().Build()
+	newTestVNode := func() *VNode {
+		podProvider := NewVPodProvider("ns", "127.0.0.1", "vnode.test", kubeClient, nil, nil, &tunnel.MockTunnel{})
+		podProvider.vPodStore.PutPod(pod)
+		return &VNode{
+			name:                           "vnode.test",
+			client:                         kubeClient,
+			podProvider:                    podProvider,
+			initWhenLeaderAcquiredByMe:     make(chan struct{}, 1),
+			exitWhenLeaderAcquiredByOthers: make(chan struct{}),
+		}
+	}
+
+	leader := newTestVNode()
+	recorder := record.NewFakeRecorder(10)
+	leader.eventRecorder = recorder
+	leader.createOrRetryUpdateLease(context.TODO(), "client-a")
+	leader.createOrRetryUpdateLease(context.TODO(), "client-a")
+	assert.True(t, leader.IsLeader("client-a"))
+	leader.podProvider.putBizOperation(context.TODO(), "op-1", model.BizOperationStart, pod, pod.Spec.Containers[0])
+	newContainer := corev1.Container{Name: "biz1", Image: "biz1-new.jar"}
+	leader.podProvider.bizUpgradeStore.PutUpgrades("ns/pod", []BizUpgrade{{
+		Strategy:     model.UpgradeStrategyStartThenStop,
+		OldContainer: pod.Spec.Containers[0],
+		NewContainer: newContainer,
+	}})
+	leader.podProvider.bizUpgradeStore.SetNewStarted("ns/pod")
+
+	// a valid lease held by another client is never stolen
+	follower := newTestVNode()
+	follower.createOrRetryUpdateLease(context.TODO(), "client-b")
+	assert.False(t, follower.IsLeader("client-b"))
+	assert.True(t, leader.IsLeader("client-a"))
+
+	assert.NoError(t, leader.HandOff(context.TODO(), "client-a"))
+	assert.True(t, leader.IsHandingOff())
+	assert.Equal(t, "Normal LeaderAcquired lease of vnode vnode.test acquired by client-a", <-recorder.Events)
+	assert.Equal(t, "Normal LeaderHandedOff lease of vnode vnode.test handed off by client-a", <-recorder.Events)
+	assert.False(t, leader.IsLeader("client-a"))
+	select {
+	case <-leader.ExitWhenLeaderChanged():
+	default:
+		assert.Fail(t, "node handed off should exit")
+	}
+
+	lease := &coordinationv1.Lease{}
+	assert.NoError(t, kubeClient.Get(context.TODO(), types.NamespacedName{Namespace: corev1.NamespaceNodeLease, Name: "vnode.test"}, lease))
+	assert.Equal(t, "", *lease.Spec.HolderIdentity)
+	handoff := parseLeaseHandoff(lease)
+	assert.NotNil(t, handoff)
+	assert.Equal(t, "client-a", handoff.Holder)
+	assert.Equal(t, []model.HandoffBizOperation{{
+		OperationID:   "op-1",
+		Type:          model.BizOperationStart,
+		PodKey:        "ns/pod",
+		ContainerName: "biz1",
+	}}, handoff.PendingOperations)
+	assert.Len(t, handoff.PendingUpgrades, 1)
+	assert.Equal(t, "ns/pod", handoff.PendingUpgrades[0].PodKey)
+	assert.Equal(t, newContainer, handoff.PendingUpgrades[0].Upgrades[0].NewContainer)
+
+	// the released lease is acquired at once, and the handoff is consumed
+	follower.createOrRetryUpdateLease(context.TODO(), "client-b")
+	assert.True(t, follower.IsLeader("client-b"))
+	assert.NoError(t, kubeClient.Get(context.TODO(), types.NamespacedName{Namespace: corev1.NamespaceNodeLease, Name: "vnode.test"}, lease))
+	assert.NotContains(t, lease.Annotations, model.AnnotationKeyOfLeaseHandoff)
+	select {
+	case <-follower.initWhenLeaderAcquiredByMe:
+	default:
+		assert.Fail(t, "node should init after the lease acquired")
+	}
+
+	assert.False(t, follower.podProvider.HasPendingBizOperation())
+	follower.resumeHandoff(context.TODO())
+	assert.True(t, follower.podProvider.HasPendingBizOperation())
+	upgrade, has := follower.podProvider.bizUpgradeStore.GetUpgrade("ns/pod")
+	assert.True(t, has)
+	assert.True(t, upgrade.Resumed)
+	assert.True(t, upgrade.NewStarted)
+
+	// the handed off node never acquires the lease again
+	leader.createOrRetryUpdateLease(context.TODO(), "client-a")
+	assert.True(t, follower.IsLeader("client-b"))
+}
+
+func TestVNode_HandOffFailed(t *testing.T) {
+	patchFailed := false
+	kubeClient := fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			if patchFailed {
+				return errors.New("conflict")
+			}
+			return c.Patch(ctx, obj, patch, opts...)
+		},
+	}).Build()
+	vnode := &VNode{
+		name:                           "vnode.test",
+		client:                         kubeClient,
+		podProvider:                    NewVPodProvider("ns", "127.0.0.1", "vnode.test", kubeClient, nil, nil, &tunnel.MockTunnel{}),
+		initWhenLeaderAcquiredByMe:     make(chan struct{}, 1),
+		exitWhenLeaderAcquiredByOthers: make(chan struct{}),
+	}
+	vnode.createOrRetryUpdateLease(context.TODO(), "client-a")
+	assert.True(t, vnode.IsLeader("client-a"))
+
+	// the node failed to release the lease exits instead of staying handing off, the lease is left to expire
+	patchFailed = true
+	assert.Error(t, vnode.HandOff(context.TODO(), "client-a"))
+	select {
+	case <-vnode.ExitWhenLeaderChanged():
+	default:
+		assert.Fail(t, "node failed to hand off should exit")
+	}
+	lease := &coordinationv1.Lease{}
+	assert.NoError(t, kubeClient.Get(context.TODO(), types.NamespacedName{Namespace: corev1.NamespaceNodeLease, Name: "vnode.test"}, lease))
+	assert.Equal(t, "client-a", *lease.Spec.HolderIdentity)
+	assert.NotContains(t, lease.Annotations, model.AnnotationKeyOfLeaseHandoff)
+}
+
+func TestVNode_RecordEvent(t *testing.T) {
+	vnode := VNode{name: "vnode.test"}
+	// no recorder, no event
+	vnode.RecordEvent(corev1.EventTypeNormal, model.NodeEventReasonReady, "vnode %s is ready", "vnode.test")
+
+	recorder := record.NewFakeRecorder(1)
+	recorder.IncludeObject = true
+	vnode.eventRecorder = recorder
+	vnode.RecordEvent(corev1.EventTypeWarning, model.NodeEventReasonUnreachable, "base %s missed its heartbeats", "vnode.test")
+	event := <-recorder.Events
+	assert.Contains(t, event, "Warning VNodeUnreachable base vnode.test missed its heartbeats")
+	assert.Contains(t, event, "kind=Node")
+}
+
+func TestBuildNode_KubeletAddress(t *testing.T) {
+	node := &corev1.Node{}
+	err := buildNode(node, &model.BuildVNodeConfig{
+		NodeName:     "vnode",
+		NodeIP:       "127.0.0.1",
+		NodeHostname: "base",
+	}, "tunnel")
+	assert.NoError(t, err)
+	assert.Len(t, node.Status.Addresses, 2)
+	assert.Equal(t, "127.0.0.1", node.Annotations[model.AnnotationKeyOfBaseIP])
+
+	node = &corev1.Node{}
+	err = buildNode(node, &model.BuildVNodeConfig{
+		NodeName:       "vnode",
+		NodeIP:         "127.0.0.1",
+		NodeHostname:   "base",
+		KubeletAddress: "10.0.0.1",
+		KubeletPort:    10250,
+	}, "tunnel")
+	assert.NoError(t, err)
+	assert.Equal(t, []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.0.0.1"}}, node.Status.Addresses)
+	assert.Equal(t, int32(10250), node.Status.DaemonEndpoints.KubeletEndpoint.Port)
+	assert.Equal(t, "127.0.0.1", node.Annotations[model.AnnotationKeyOfBaseIP])
+	assert.Equal(t, "base", node.Labels[corev1.LabelHostname])
+}
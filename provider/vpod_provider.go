@@ -16,15 +16,20 @@ package provider
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"github.com/koupleless/virtual-kubelet/tunnel"
 	"github.com/koupleless/virtual-kubelet/virtual_kubelet/node"
 	"github.com/koupleless/virtual-kubelet/virtual_kubelet/node/nodeutil"
-	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/record"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/koupleless/virtual-kubelet/common/metrics"
 	"github.com/koupleless/virtual-kubelet/common/tracker"
 	"github.com/koupleless/virtual-kubelet/common/utils"
 	"github.com/koupleless/virtual-kubelet/model"
@@ -40,13 +45,65 @@ import (
 var _ nodeutil.Provider = &VPodProvider{}
 var _ node.PodNotifier = &VPodProvider{}
 
+const (
+	podEventBizStartSucceeded = "BizStartSucceeded"
+	podEventBizStartFailed    = "BizStartFailed"
+	podEventBizStopSucceeded  = "BizStopSucceeded"
+	podEventBizStopFailed     = "BizStopFailed"
+	podEventBizBackOff        = "BackOff"
+	podEventBizUnhealthy      = "Unhealthy"
+	podEventOutOfResources    = "OutOfResources"
+
+	podEventInvalidBizDependencies = "InvalidBizDependencies"
+	podEventInvalidUpgradeStrategy = "InvalidUpgradeStrategy"
+	podEventBizUpgrading           = "BizUpgrading"
+	podEventBizUpgraded            = "BizUpgraded"
+	podEventBizUpgradeFailed       = "BizUpgradeFailed"
+	podEventBizReplaceSucceeded    = "BizReplaceSucceeded"
+	podEventBizReplaceFailed       = "BizReplaceFailed"
+	podEventBizChainTimeout        = "BizChainTimeout"
+
+	// containerReasonCrashLoopBackOff is the waiting reason of the biz waiting for restart
+	containerReasonCrashLoopBackOff = "CrashLoopBackOff"
+
+	// BizOperationTimeout is the max time waiting for the response of an async biz operation
+	BizOperationTimeout = 5 * time.Minute
+	// BizOperationRetention is how long the responses arrived before their operations and the completed operation ids are kept
+	BizOperationRetention = 2 * BizOperationTimeout
+	// BizChainTimeout is the max time the bizs started or stopped in dependency order wait for the previous biz
+	BizChainTimeout = 5 * time.Minute
+)
+
 // VPodProvider is a struct that implements the nodeutil.Provider and virtual_kubelet.PodNotifier interfaces
 type VPodProvider struct {
 	Namespace string
 	nodeName  string
 	localIP   string
 	client    client.Client
-	vPodStore *VPodStore // store the pod from provider
+	vPodStore VPodStore // store the pod from provider
+
+	bizOperationStore *BizOperationStore // store the pending async biz operations
+
+	bizRestartStore *BizRestartStore // store the restart states of the failed bizs
+
+	bizProbeManager *BizProbeManager // run the probes of the activated bizs
+
+	bizClassifier model.BizClassifier // decide which containers are bizs managed by the tunnel
+
+	sharedBizStore *SharedBizStore // count the references of the pods to the shared bizs
+
+	bizStartStore *BizStartStore // store the bizs waiting to be started in dependency order
+
+	bizUpgradeStore *BizUpgradeStore // store the rolling in place upgrades of the changed bizs
+
+	nodeResourceStore *NodeResourceStore // account the resource requests of the running pods
+
+	eventRecorder record.EventRecorder // recorder of the pod events
+
+	stoppingAllBiz atomic.Bool // whether all bizs are stopped before the node shutdown, no biz is restarted then
+
+	bizStatusRevisionLock sync.Mutex
+	bizStatusRevision     int64 // last applied revision of the biz status deltas, 0 before the first full delta
 
 	tunnel tunnel.Tunnel
 
@@ -61,15 +118,27 @@ func (b *VPodProvider) NotifyPods(_ context.Context, cb func(*corev1.Pod)) {
 }
 
 // NewVPodProvider is a function that creates a new VPodProvider instance
-func NewVPodProvider(namespace, localIP, nodeName string, client client.Client, tunnel tunnel.Tunnel) *VPodProvider {
+func NewVPodProvider(namespace, localIP, nodeName string, client client.Client, eventRecorder record.EventRecorder, bizClassifier model.BizClassifier, tunnel tunnel.Tunnel) *VPodProvider {
+	if bizClassifier == nil {
+		bizClassifier = utils.DefaultBizClassifier
+	}
 	provider := &VPodProvider{
-		Namespace: namespace,
-		localIP:   localIP,
-		nodeName:  nodeName,
-		client:    client,
-		tunnel:    tunnel,
-		vPodStore: NewVPodStore(),
+		Namespace:         namespace,
+		localIP:           localIP,
+		nodeName:          nodeName,
+		client:            client,
+		eventRecorder:     eventRecorder,
+		tunnel:            tunnel,
+		vPodStore:         NewVPodStore(),
+		bizOperationStore: NewBizOperationStore(BizOperationRetention),
+		bizRestartStore:   NewBizRestartStore(DefaultBizRestartBackOff, MaxBizRestartBackOff),
+		bizClassifier:     bizClassifier,
+		nodeResourceStore: NewNodeResourceStore(),
+		sharedBizStore:    NewSharedBizStore(),
+		bizUpgradeStore:   NewBizUpgradeStore(),
 	}
+	provider.bizStartStore = NewBizStartStore(BizChainTimeout, provider.onBizStartTimeout, provider.onBizStopTimeout)
+	provider.bizProbeManager = NewBizProbeManager(nodeName, localIP, tunnel, provider.onProbeResultChanged, provider.onProbeFailed)
 
 	return provider
 }
@@ -82,19 +151,118 @@ func (b *VPodProvider) syncBizStatusToKube(ctx context.Context, bizStatusData mo
 		logger.Errorf("skip updating non-exist pod status for biz %s pod %s", bizStatusData.Key, bizStatusData.PodKey)
 		return
 	}
+	if b.bizUpgradeStore.IsReplaced(bizStatusData.PodKey, bizStatusData.Key) {
+		// the old biz replaced by an upgrade is not the container of the pod any more
+		logger.Debugf("skip updating pod status for replaced biz %s pod %s", bizStatusData.Key, bizStatusData.PodKey)
+		return
+	}
+	b.checkAndRestartBiz(ctx, pod, bizStatusData)
+	b.checkAndProbeBiz(pod, bizStatusData)
 	podStatus, _ := b.GetPodStatus(ctx, pod, bizStatusData)
 
 	podCopy := pod.DeepCopy()
 	podStatus.DeepCopyInto(&podCopy.Status)
 	b.vPodStore.PutPod(podCopy)
+	if podCopy.Status.Phase == corev1.PodSucceeded || podCopy.Status.Phase == corev1.PodFailed {
+		// terminated pods release their resources
+		b.nodeResourceStore.DeletePod(bizStatusData.PodKey)
+	}
 	b.notify(podCopy)
+
+	if initContainer := getInitContainer(podCopy, bizStatusData.Name); initContainer != nil {
+		// an init biz is stopped once activated, the next bizs are started once it completed
+		if strings.EqualFold(bizStatusData.State, string(model.BizStateActivated)) && utils.GetBizUniqueKey(initContainer) == bizStatusData.Key {
+			b.handleBizBatchStop(ctx, podCopy, []corev1.Container{*initContainer})
+		}
+		if isInitBizCompleted(podCopy, bizStatusData.Name) {
+			b.startNextBiz(ctx, podCopy, bizStatusData.Name)
+		}
+	} else if strings.EqualFold(bizStatusData.State, string(model.BizStateActivated)) {
+		b.startNextBiz(ctx, podCopy, bizStatusData.Name)
+	}
+	b.checkBizUpgradeStatus(ctx, podCopy, bizStatusData)
 }
 
-// SyncAllBizStatusToKube is a method of VPodProvider that synchronizes the information of all containers
-func (b *VPodProvider) SyncAllBizStatusToKube(ctx context.Context, bizStatusDatas []model.BizStatusData) {
+// startNextBiz is a method of VPodProvider that starts the next bizs of the pod once the biz waited for is activated, or completed
+// for an init biz, which is the next init biz or biz in dependency order, or the bizs of the pod after the last init biz
+func (b *VPodProvider) startNextBiz(ctx context.Context, pod *corev1.Pod, activated string) {
+	next, has := b.bizStartStore.NextStart(utils.GetPodKey(pod), activated)
+	if !has || len(next) == 0 {
+		return
+	}
+	names := make([]string, 0, len(next))
+	for _, container := range next {
+		names = append(names, container.Name)
+	}
+	log.G(ctx).WithField("podKey", utils.GetPodKey(pod)).Infof("biz %s ready, starting the next bizs %v", activated, names)
+	b.handleBizBatchStart(ctx, pod, next)
+}
+
+// stopNextBiz is a method of VPodProvider that stops the next bizs of the pods once the biz waited for is deactivated
+func (b *VPodProvider) stopNextBiz(ctx context.Context, deactivatedBizKey string) {
+	for _, next := range b.bizStartStore.NextStop(deactivatedBizKey) {
+		log.G(ctx).WithField("podKey", utils.GetPodKey(next.Pod)).Infof("biz %s deactivated, stopping the next biz %s", deactivatedBizKey, next.Container.Name)
+		b.handleBizBatchStop(ctx, next.Pod, []corev1.Container{next.Container})
+	}
+}
+
+// onBizStartTimeout is a method of VPodProvider that reports the start chain of the pod dropped as the biz waited for not activated in time
+func (b *VPodProvider) onBizStartTimeout(podKey, waitingFor string) {
+	message := fmt.Sprintf("Biz %s not activated in %s, the bizs waiting for it are not started", waitingFor, BizChainTimeout)
+	log.G(context.Background()).WithField("podKey", podKey).Error(message)
+	if pod := b.vPodStore.GetPodByKey(podKey); pod != nil {
+		b.recordEvent(pod, corev1.EventTypeWarning, podEventBizChainTimeout, message)
+	}
+}
+
+// onBizStopTimeout is a method of VPodProvider that continues the stop chain of the pod as the biz waited for not deactivated in time
+func (b *VPodProvider) onBizStopTimeout(pod *corev1.Pod, waitingFor string, next *corev1.Container) {
+	ctx := context.Background()
+	message := fmt.Sprintf("Biz %s not deactivated in %s", waitingFor, BizChainTimeout)
+	if next != nil {
+		message = fmt.Sprintf("%s, stopping the next biz %s", message, next.Name)
+	}
+	log.G(ctx).WithField("podKey", utils.GetPodKey(pod)).Error(message)
+	b.recordEvent(pod, corev1.EventTypeWarning, podEventBizChainTimeout, message)
+	if next != nil {
+		b.handleBizBatchStop(ctx, pod, []corev1.Container{*next})
+	}
+}
+
+// sortBizContainers is a method of VPodProvider that sorts the containers in the dependency order declared by the pod,
+// returns whether the dependencies are declared, the containers keep the original order if the dependencies are invalid
+func (b *VPodProvider) sortBizContainers(ctx context.Context, pod *corev1.Pod, containers []corev1.Container) ([]corev1.Container, bool) {
+	dependencies, err := utils.GetBizDependencies(pod)
+	if err == nil && dependencies == nil {
+		return containers, false
+	}
+	var sorted []corev1.Container
+	if err == nil {
+		sorted, err = utils.SortContainersByDependencies(containers, dependencies)
+	}
+	if err != nil {
+		log.G(ctx).WithError(err).WithField("podKey", utils.GetPodKey(pod)).Error("invalid biz dependencies, ignored")
+		b.recordEvent(pod, corev1.EventTypeWarning, podEventInvalidBizDependencies, err.Error())
+		return containers, false
+	}
+	return sorted, true
+}
+
+// SyncAllBizStatusToKube is a method of VPodProvider that synchronizes the information of all containers,
+// returns whether any container status changed
+func (b *VPodProvider) SyncAllBizStatusToKube(ctx context.Context, bizStatusDatas []model.BizStatusData) bool {
 	bizKeyToBizStatusData := make(map[string]model.BizStatusData)
 	for _, bizStatusData := range bizStatusDatas {
 		bizKeyToBizStatusData[bizStatusData.Key] = bizStatusData
+		if utils.IsBizDeactivated(bizStatusData.State) {
+			b.stopNextBiz(ctx, bizStatusData.Key)
+		}
+	}
+	for _, bizKey := range b.bizStartStore.GetStopWaitingFor() {
+		if _, has := bizKeyToBizStatusData[bizKey]; !has {
+			// the biz not reported any more is uninstalled
+			b.stopNextBiz(ctx, bizKey)
+		}
 	}
 
 	pods := b.vPodStore.GetPods()
@@ -112,11 +280,15 @@ func (b *VPodProvider) SyncAllBizStatusToKube(ctx context.Context, bizStatusData
 		// Get the key of the pod
 		podKey := utils.GetPodKey(pod)
 		// Iterate through each container in the pod
-		for _, container := range pod.Spec.Containers {
+		for _, container := range b.podBizContainers(pod) {
 			// Get the unique key of the container
 			bizKey := utils.GetBizUniqueKey(&container)
 			// Check if container information exists for the container key
 			bizStatusData, has := bizKeyToBizStatusData[bizKey]
+			if has && (bizStatusData.PodKey == model.PodKeyAll || utils.IsSharedBiz(pod, container.Name)) {
+				// the status of a shared biz is fanned out to every pod referencing it
+				bizStatusData.PodKey = podKey
+			}
 			// If container information does not exist, create a new deactivated instance
 			if !has {
 				bizStatusData = model.BizStatusData{
@@ -127,14 +299,11 @@ func (b *VPodProvider) SyncAllBizStatusToKube(ctx context.Context, bizStatusData
 					ChangeTime: now,
 				}
 			}
-			// Attempt to update the container status
-			toUpdate := b.vPodStore.CheckContainerStatusNeedSync(bizStatusData)
-			// If the update was successful, add the container information to the updated list
-			if toUpdate {
+			// Only the changed container status is synced
+			if b.vPodStore.CheckContainerStatusNeedSync(bizStatusData, b.bizClassifier) {
 				toUpdateBizStatusDatas = append(toUpdateBizStatusDatas, bizStatusData)
+				log.G(ctx).Debugf("container %s/%s need update", podKey, bizKey)
 			}
-
-			log.G(ctx).Infof("container %s/%s need update: %v", podKey, bizKey, toUpdate)
 		}
 	}
 
@@ -142,86 +311,656 @@ func (b *VPodProvider) SyncAllBizStatusToKube(ctx context.Context, bizStatusData
 	for _, toUpdateBizStatus := range toUpdateBizStatusDatas {
 		b.syncBizStatusToKube(ctx, toUpdateBizStatus)
 	}
+	b.checkResumedBizUpgrades(ctx, bizKeyToBizStatusData)
+	return len(toUpdateBizStatusDatas) > 0
 }
 
-// SyncBizStatusToKube is a method of VPodProvider that synchronizes the information of a single container
+// SyncBizStatusToKube is a method of VPodProvider that synchronizes the information of a single container,
+// the status of a shared biz is fanned out to every pod referencing it
 func (b *VPodProvider) SyncBizStatusToKube(ctx context.Context, bizStatusData model.BizStatusData) {
-	needSync := b.vPodStore.CheckContainerStatusNeedSync(bizStatusData)
+	if utils.IsBizDeactivated(bizStatusData.State) {
+		b.stopNextBiz(ctx, bizStatusData.Key)
+	}
+	if bizStatusData.PodKey == model.PodKeyAll || b.sharedBizStore.IsShared(bizStatusData.Key) {
+		for _, podKey := range b.sharedBizStore.GetPodKeys(bizStatusData.Key) {
+			podBizStatusData := bizStatusData
+			podBizStatusData.PodKey = podKey
+			if b.vPodStore.CheckContainerStatusNeedSync(podBizStatusData, b.bizClassifier) {
+				b.syncBizStatusToKube(ctx, podBizStatusData)
+			}
+		}
+		return
+	}
+	needSync := b.vPodStore.CheckContainerStatusNeedSync(bizStatusData, b.bizClassifier)
 	if needSync {
 		// only when container status updated, update related pod status
 		b.syncBizStatusToKube(ctx, bizStatusData)
 	}
 }
 
-// handleBizBatchStart is a method of VPodProvider that handles the start of a container
-func (b *VPodProvider) handleBizBatchStart(ctx context.Context, pod *corev1.Pod, containers []corev1.Container) {
+// SyncBizStatusDeltaToKube applies the biz status delta of the base in the order of the revisions since the last full delta,
+// returns false if a revision gap is found, a full delta is needed to resync then
+func (b *VPodProvider) SyncBizStatusDeltaToKube(ctx context.Context, delta model.BizStatusDelta) bool {
+	b.bizStatusRevisionLock.Lock()
+	defer b.bizStatusRevisionLock.Unlock()
+
+	if delta.Full {
+		// a full delta is always applied and resets the revision, as the revision restarts when the base restarts
+		b.SyncAllBizStatusToKube(ctx, delta.Bizs)
+		b.bizStatusRevision = delta.Revision
+		return true
+	}
+
+	if b.bizStatusRevision != 0 && delta.Revision <= b.bizStatusRevision {
+		// a duplicated or stale delta
+		return true
+	}
+	if b.bizStatusRevision == 0 || delta.PreviousRevision != b.bizStatusRevision {
+		log.G(ctx).Infof("biz status revision gap of node %s, applied %d, delta from %d to %d", b.nodeName, b.bizStatusRevision, delta.PreviousRevision, delta.Revision)
+		return false
+	}
+	for _, bizStatusData := range delta.Bizs {
+		b.SyncBizStatusToKube(ctx, bizStatusData)
+	}
+	b.bizStatusRevision = delta.Revision
+	return true
+}
+
+// GetBizStatusRevision returns the last applied revision of the biz status deltas, 0 if no full delta applied
+func (b *VPodProvider) GetBizStatusRevision() int64 {
+	b.bizStatusRevisionLock.Lock()
+	defer b.bizStatusRevisionLock.Unlock()
+	return b.bizStatusRevision
+}
+
+// handleBizBatchStart is a method of VPodProvider that handles the start of a container, returns the error of the last container failed to start
+func (b *VPodProvider) handleBizBatchStart(ctx context.Context, pod *corev1.Pod, containers []corev1.Container) error {
 	podKey := utils.GetPodKey(pod)
 
 	logger := log.G(ctx).WithField("podKey", podKey)
 	logger.Info("HandleContainerStartOperation")
 
+	if containers, ordered := b.sortBizContainers(ctx, pod, containers); ordered && len(containers) > 1 {
+		// start the bizs one by one, each after the previous one activated
+		b.bizStartStore.PutPendingStart(podKey, containers[0].Name, containers[1:], nil)
+		return b.handleBizBatchStart(ctx, pod, containers[:1])
+	}
+
 	labelMap := pod.Labels
 	if labelMap == nil {
 		labelMap = make(map[string]string)
 	}
 
+	var lastErr error
 	for _, container := range containers {
 		err := tracker.G().FuncTrack(labelMap[model.LabelKeyOfTraceID], model.TrackSceneVPodDeploy, model.TrackEventContainerStart, labelMap, func() (error, model.ErrorCode) {
+			var operationID string
 			err := utils.CallWithRetry(ctx, func(_ int) (bool, error) {
-				innerErr := b.tunnel.StartBiz(b.nodeName, podKey, &container)
+				var innerErr error
+				operationID, innerErr = b.tunnel.StartBiz(b.nodeName, b.bizPodKey(pod, container), &container)
 
 				return innerErr != nil, innerErr
 			}, nil)
 			if err != nil {
 				return err, model.CodeContainerStartFailed
 			}
+			b.putBizOperation(ctx, operationID, model.BizOperationStart, pod, container)
 			return nil, model.CodeSuccess
 		})
 		if err != nil {
 			logger.WithError(err).WithField("containerKey", utils.GetContainerKey(podKey, container.Name)).Error("ContainerStartFailed")
+			lastErr = err
 		}
 	}
+	return lastErr
 }
 
-// handleBizBatchStop is a method of VPodProvider that handles the shutdown of a container
-func (b *VPodProvider) handleBizBatchStop(ctx context.Context, pod *corev1.Pod, containers []corev1.Container) {
+// handleBizBatchStop is a method of VPodProvider that handles the shutdown of a container, returns the error of the last container failed to stop
+func (b *VPodProvider) handleBizBatchStop(ctx context.Context, pod *corev1.Pod, containers []corev1.Container) error {
 	podKey := utils.GetPodKey(pod)
 
 	logger := log.G(ctx).WithField("podKey", podKey)
 	logger.Info("HandleContainerShutdownOperation")
 
+	if sorted, ordered := b.sortBizContainers(ctx, pod, containers); ordered && len(sorted) > 1 {
+		// stop the bizs one by one in the reverse order of start, each after the previous one deactivated
+		reversed := make([]corev1.Container, 0, len(sorted))
+		for i := len(sorted) - 1; i >= 0; i-- {
+			reversed = append(reversed, sorted[i])
+		}
+		first, has := b.bizStartStore.PutPendingStop(pod, reversed)
+		if !has {
+			// stopped after the pending stops of the pod
+			return nil
+		}
+		return b.handleBizBatchStop(ctx, pod, []corev1.Container{first})
+	}
+
 	labelMap := pod.Labels
 	if labelMap == nil {
 		labelMap = make(map[string]string)
 	}
 
+	var lastErr error
 	for _, container := range containers {
 		err := tracker.G().FuncTrack(labelMap[model.LabelKeyOfTraceID], model.TrackSceneVPodDeploy, model.TrackEventContainerShutdown, labelMap, func() (error, model.ErrorCode) {
+			var operationID string
 			err := utils.CallWithRetry(ctx, func(_ int) (bool, error) {
-				innerErr := b.tunnel.StopBiz(b.nodeName, podKey, &container)
+				var innerErr error
+				operationID, innerErr = b.tunnel.StopBiz(b.nodeName, b.bizPodKey(pod, container), &container)
 
 				return innerErr != nil, innerErr
 			}, nil)
 			if err != nil {
 				return err, model.CodeContainerStopFailed
 			}
+			b.putBizOperation(ctx, operationID, model.BizOperationStop, pod, container)
 			return nil, model.CodeSuccess
 		})
 		if err != nil {
 			logger.WithError(err).WithField("containerKey", utils.GetContainerKey(podKey, container.Name)).Error("ContainerShutdownFailed")
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// handleBizReplace is a method of VPodProvider that handles the hot replace of the old container with the new one by the tunnel
+func (b *VPodProvider) handleBizReplace(ctx context.Context, pod *corev1.Pod, oldContainer, newContainer corev1.Container) error {
+	podKey := utils.GetPodKey(pod)
+	replacer, ok := b.tunnel.(tunnel.BizReplacer)
+	if !ok {
+		return pkgerrors.Errorf("tunnel %s not supports hot replace", b.tunnel.Key())
+	}
+
+	labelMap := pod.Labels
+	if labelMap == nil {
+		labelMap = make(map[string]string)
+	}
+
+	err := tracker.G().FuncTrack(labelMap[model.LabelKeyOfTraceID], model.TrackSceneVPodDeploy, model.TrackEventContainerUpgrade, labelMap, func() (error, model.ErrorCode) {
+		var operationID string
+		err := utils.CallWithRetry(ctx, func(_ int) (bool, error) {
+			var innerErr error
+			operationID, innerErr = replacer.ReplaceBiz(b.nodeName, b.bizPodKey(pod, newContainer), &oldContainer, &newContainer)
+
+			return innerErr != nil, innerErr
+		}, nil)
+		if err != nil {
+			return err, model.CodeContainerUpgradeFailed
+		}
+		b.putBizOperation(ctx, operationID, model.BizOperationReplace, pod, newContainer)
+		return nil, model.CodeSuccess
+	})
+	if err != nil {
+		log.G(ctx).WithError(err).WithField("containerKey", utils.GetContainerKey(podKey, newContainer.Name)).Error("ContainerReplaceFailed")
+	}
+	return err
+}
+
+// putBizOperation records the async biz operation, and fails it if no response arrived in BizOperationTimeout
+func (b *VPodProvider) putBizOperation(ctx context.Context, operationID string, operationType model.BizOperationType, pod *corev1.Pod, container corev1.Container) {
+	operation := &BizOperation{
+		Type:      operationType,
+		Pod:       pod,
+		Container: container,
+		StartTime: time.Now(),
+	}
+	if response, arrived := b.bizOperationStore.PutOperation(operationID, operation); arrived {
+		// the response arrived before the operation recorded
+		b.handleBizOperationResponse(ctx, operation, response)
+		return
+	}
+
+	time.AfterFunc(BizOperationTimeout, func() {
+		if !b.bizOperationStore.IsPending(operationID) {
+			return
+		}
+		b.SyncBizOperationResponse(context.Background(), model.BizOperationResponse{
+			OperationID:   operationID,
+			Type:          operationType,
+			PodKey:        utils.GetPodKey(pod),
+			BizKey:        b.tunnel.GetBizUniqueKey(&container),
+			ContainerName: container.Name,
+			Success:       false,
+			Reason:        "Timeout",
+			Message:       "no response arrived from tunnel",
+			FinishTime:    time.Now(),
+		})
+	})
+}
+
+// SyncBizOperationResponse is a method of VPodProvider that completes the async biz operation with its response
+func (b *VPodProvider) SyncBizOperationResponse(ctx context.Context, response model.BizOperationResponse) {
+	operation, has := b.bizOperationStore.CompleteOperation(response)
+	if !has {
+		// the operation will be handled when recorded
+		return
+	}
+	b.handleBizOperationResponse(ctx, operation, response)
+}
+
+// DropBizOperation is a method of VPodProvider that drops the async biz operation not waited for, e.g. the stop of an orphan biz
+func (b *VPodProvider) DropBizOperation(operationID string) {
+	b.bizOperationStore.DropOperation(operationID)
+}
+
+// handleBizOperationResponse surfaces the result and latency of the biz operation to tracker, pod events and container status
+func (b *VPodProvider) handleBizOperationResponse(ctx context.Context, operation *BizOperation, response model.BizOperationResponse) {
+	podKey := utils.GetPodKey(operation.Pod)
+	finishTime := response.FinishTime
+	if finishTime.IsZero() {
+		finishTime = time.Now()
+	}
+	latency := finishTime.Sub(operation.StartTime)
+
+	logger := log.G(ctx).WithField("podKey", podKey).WithField("operationID", response.OperationID).WithField("latency", latency)
+
+	labelMap := operation.Pod.Labels
+	if labelMap == nil {
+		labelMap = make(map[string]string)
+	}
+
+	trackEvent, errorCode, successReason, failedReason := model.TrackEventContainerStart, model.CodeContainerStartFailed, podEventBizStartSucceeded, podEventBizStartFailed
+	if operation.Type == model.BizOperationStop {
+		trackEvent, errorCode, successReason, failedReason = model.TrackEventContainerShutdown, model.CodeContainerStopFailed, podEventBizStopSucceeded, podEventBizStopFailed
+	} else if operation.Type == model.BizOperationReplace {
+		trackEvent, errorCode, successReason, failedReason = model.TrackEventContainerUpgrade, model.CodeContainerUpgradeFailed, podEventBizReplaceSucceeded, podEventBizReplaceFailed
+	}
+
+	result := metrics.ResultSuccess
+	if !response.Success {
+		result = metrics.ResultFailed
+	}
+	metrics.BizOperationLatency.WithLabelValues(string(operation.Type), result).Observe(latency.Seconds())
+
+	if response.Success {
+		logger.Infof("%s biz %s succeeded", operation.Type, operation.Container.Name)
+		b.recordEvent(operation.Pod, corev1.EventTypeNormal, successReason, fmt.Sprintf("%s biz %s succeeded in %s", operation.Type, operation.Container.Name, latency))
+		b.checkBizUpgradeOperation(ctx, operation, response)
+		return
+	}
+
+	reason := response.Reason
+	if reason == "" {
+		reason = failedReason
+	}
+	message := fmt.Sprintf("%s biz %s failed in %s: %s", operation.Type, operation.Container.Name, latency, response.Message)
+	logger.Error(message)
+	tracker.G().ErrorReport(labelMap[model.LabelKeyOfTraceID], model.TrackSceneVPodDeploy, trackEvent, message, labelMap, errorCode)
+	b.recordEvent(operation.Pod, corev1.EventTypeWarning, failedReason, message)
+
+	if operation.Type == model.BizOperationStart || operation.Type == model.BizOperationReplace {
+		// the biz will not report its status when start failed, mark the container broken with the failure reason
+		b.SyncBizStatusToKube(ctx, model.BizStatusData{
+			Key:        b.tunnel.GetBizUniqueKey(&operation.Container),
+			Name:       operation.Container.Name,
+			PodKey:     podKey,
+			State:      string(model.BizStateBroken),
+			ChangeTime: finishTime,
+			Reason:     reason,
+			Message:    message,
+		})
+	}
+	b.checkBizUpgradeOperation(ctx, operation, response)
+}
+
+// recordEvent records the pod event if the event recorder is set
+func (b *VPodProvider) recordEvent(pod *corev1.Pod, eventType, reason, message string) {
+	if b.eventRecorder == nil {
+		return
+	}
+	b.eventRecorder.Event(pod, eventType, reason, message)
+}
+
+// checkAndRestartBiz is a method of VPodProvider that schedules the restart of the terminated biz with back-off according to the pod restart policy.
+func (b *VPodProvider) checkAndRestartBiz(ctx context.Context, pod *corev1.Pod, bizStatusData model.BizStatusData) {
+	if pod.DeletionTimestamp != nil || !shouldRestartBiz(pod.Spec.RestartPolicy, bizStatusData.State) {
+		return
+	}
+	podKey := utils.GetPodKey(pod)
+	if b.isSharedBizFollower(pod, bizStatusData.Name, bizStatusData.Key) || isInitBizCompleted(pod, bizStatusData.Name) || isInitBizRunning(pod, bizStatusData.Name) ||
+		b.isBizUpgrading(podKey, bizStatusData.Name) || b.isBizStartPending(podKey, bizStatusData.Name) {
+		return
+	}
+	b.scheduleBizRestart(ctx, pod, bizStatusData.Name, fmt.Sprintf("biz %s", strings.ToLower(bizStatusData.State)))
+}
+
+// isBizStartPending is a method of VPodProvider that returns whether the biz of the container is still being started, by the start
+// chain or by the start operation waiting for its response, so it is not restarted before the first start completes
+func (b *VPodProvider) isBizStartPending(podKey, containerName string) bool {
+	if b.bizStartStore.IsPendingStart(podKey, containerName) {
+		return true
+	}
+	for _, operation := range b.bizOperationStore.GetPendingOperations() {
+		if operation.Type == model.BizOperationStart && utils.GetPodKey(operation.Pod) == podKey && operation.Container.Name == containerName {
+			return true
+		}
+	}
+	return false
+}
+
+// shouldRestartBiz returns whether the biz in the state is restarted under the restart policy, the bizs of the Always pods
+// are restarted once stopped too, the bizs of the OnFailure pods only once failed. The unresolved bizs are never restarted,
+// as unresolved is also the state of the bizs installing or not reported yet
+func shouldRestartBiz(restartPolicy corev1.RestartPolicy, state string) bool {
+	switch model.BizState(strings.ToUpper(state)) {
+	case model.BizStateBroken, model.BizStateDeactivated:
+		return restartPolicy != corev1.RestartPolicyNever
+	case model.BizStateStopped:
+		return restartPolicy == corev1.RestartPolicyAlways
+	default:
+		return false
+	}
+}
+
+// scheduleBizRestart is a method of VPodProvider that restarts the biz of the container with back-off, the restart runs
+// with the latest pod as the pod may be deleted or updated during the back-off
+func (b *VPodProvider) scheduleBizRestart(ctx context.Context, pod *corev1.Pod, containerName, cause string) {
+	if b.stoppingAllBiz.Load() {
+		return
+	}
+	podKey := utils.GetPodKey(pod)
+	containerKey := utils.GetContainerKey(podKey, containerName)
+	logger := log.G(ctx).WithField("containerKey", containerKey)
+	delay, scheduled := b.bizRestartStore.ScheduleRestart(containerKey, func() {
+		latestPod := b.vPodStore.GetPodByKey(podKey)
+		if latestPod == nil || latestPod.DeletionTimestamp != nil || b.stoppingAllBiz.Load() {
+			return
+		}
+		for _, container := range utils.GetPodContainers(latestPod) {
+			if container.Name == containerName {
+				logger.Infof("restarting biz after %s", cause)
+				if err := b.handleBizBatchStart(context.Background(), latestPod, []corev1.Container{container}); err != nil {
+					logger.WithError(err).Error("failed to restart biz")
+				}
+				return
+			}
+		}
+	})
+	if scheduled {
+		logger.Infof("%s, back-off %s restarting", cause, delay)
+		b.recordEvent(pod, corev1.EventTypeWarning, podEventBizBackOff, fmt.Sprintf("Back-off %s restarting biz %s after %s", delay, containerName, cause))
+	}
+}
+
+// checkAndProbeBiz is a method of VPodProvider that starts the probes of the activated biz and stops the probes of the others
+func (b *VPodProvider) checkAndProbeBiz(pod *corev1.Pod, bizStatusData model.BizStatusData) {
+	containerKey := utils.GetContainerKey(utils.GetPodKey(pod), bizStatusData.Name)
+	if !strings.EqualFold(bizStatusData.State, string(model.BizStateActivated)) {
+		b.bizProbeManager.RemoveBiz(containerKey)
+		return
+	}
+	for _, container := range pod.Spec.Containers {
+		if container.Name == bizStatusData.Name {
+			b.bizProbeManager.AddBiz(pod, &container)
+			return
+		}
+	}
+}
+
+// onProbeResultChanged is a method of VPodProvider that refreshes the pod status when the readiness or startup of a biz changed
+func (b *VPodProvider) onProbeResultChanged(podKey string) {
+	ctx := context.Background()
+	pod := b.vPodStore.GetPodByKey(podKey)
+	if pod == nil {
+		return
+	}
+	// empty biz status data reuses the current container statuses
+	podStatus, err := b.GetPodStatus(ctx, pod, model.BizStatusData{})
+	if err != nil || podStatus == nil {
+		log.G(ctx).WithError(err).Errorf("failed to refresh pod status of %s after probe result changed", podKey)
+		return
+	}
+
+	podCopy := pod.DeepCopy()
+	podStatus.DeepCopyInto(&podCopy.Status)
+	b.vPodStore.PutPod(podCopy)
+	if b.notify != nil {
+		b.notify(podCopy)
+	}
+}
+
+// onProbeFailed is a method of VPodProvider that stops the unhealthy biz and restarts it according to the pod restart policy
+func (b *VPodProvider) onProbeFailed(podKey, containerName string, probeType ProbeType, message string) {
+	ctx := context.Background()
+	pod := b.vPodStore.GetPodByKey(podKey)
+	if pod == nil || pod.DeletionTimestamp != nil {
+		return
+	}
+	var target *corev1.Container
+	for _, container := range pod.Spec.Containers {
+		if container.Name == containerName {
+			target = container.DeepCopy()
+			break
+		}
+	}
+	if target == nil || b.isSharedBizFollower(pod, target.Name, utils.GetBizUniqueKey(target)) {
+		return
+	}
+
+	containerKey := utils.GetContainerKey(podKey, containerName)
+	log.G(ctx).WithField("containerKey", containerKey).Warnf("biz failed %s probe, stopping", probeType)
+	b.recordEvent(pod, corev1.EventTypeWarning, podEventBizUnhealthy, message)
+	b.bizProbeManager.RemoveBiz(containerKey)
+	b.handleBizBatchStop(ctx, pod, []corev1.Container{*target})
+
+	// the unhealthy biz is stopped on purpose, restarted as failed
+	if pod.Spec.RestartPolicy == corev1.RestartPolicyNever {
+		return
+	}
+	b.scheduleBizRestart(ctx, pod, containerName, fmt.Sprintf("failed %s probe", probeType))
+}
+
+// bizContainers is a method of VPodProvider that returns the containers classified as bizs, in the original order
+func (b *VPodProvider) bizContainers(containers []corev1.Container) []corev1.Container {
+	ret := make([]corev1.Container, 0, len(containers))
+	for _, container := range containers {
+		if b.bizClassifier.Classify(&container) == model.ContainerTypeBiz {
+			ret = append(ret, container)
+		}
+	}
+	return ret
+}
+
+// podBizContainers is a method of VPodProvider that returns the init containers and containers of the pod classified as bizs, in the original order
+func (b *VPodProvider) podBizContainers(pod *corev1.Pod) []corev1.Container {
+	return b.bizContainers(utils.GetPodContainers(pod))
+}
+
+// podStopBizContainers is a method of VPodProvider that returns the containers and then the init containers not completed of the pod classified as bizs,
+// the completed init bizs are stopped already
+func (b *VPodProvider) podStopBizContainers(pod *corev1.Pod) []corev1.Container {
+	return append(b.bizContainers(pod.Spec.Containers), b.pendingInitBizContainers(pod)...)
+}
+
+// pendingInitBizContainers is a method of VPodProvider that returns the init containers of the pod classified as bizs and not completed yet
+func (b *VPodProvider) pendingInitBizContainers(pod *corev1.Pod) []corev1.Container {
+	ret := make([]corev1.Container, 0, len(pod.Spec.InitContainers))
+	for _, container := range b.bizContainers(pod.Spec.InitContainers) {
+		if !isInitBizCompleted(pod, container.Name) {
+			ret = append(ret, container)
+		}
+	}
+	return ret
+}
+
+// isInitBizRunning returns whether the container is an init container of the pod and running, it is completed once deactivated
+// as it is stopped after activated
+func isInitBizRunning(pod *corev1.Pod, containerName string) bool {
+	for _, containerStatus := range pod.Status.InitContainerStatuses {
+		if containerStatus.Name == containerName {
+			return containerStatus.State.Running != nil
+		}
+	}
+	return false
+}
+
+// getInitContainer returns the init container of the pod with the name, nil if not found
+func getInitContainer(pod *corev1.Pod, containerName string) *corev1.Container {
+	for i := range pod.Spec.InitContainers {
+		if pod.Spec.InitContainers[i].Name == containerName {
+			return &pod.Spec.InitContainers[i]
+		}
+	}
+	return nil
+}
+
+// isInitBizCompleted returns whether the container is an init container of the pod and completed
+func isInitBizCompleted(pod *corev1.Pod, containerName string) bool {
+	for _, containerStatus := range pod.Status.InitContainerStatuses {
+		if containerStatus.Name == containerName {
+			return utils.IsInitContainerCompleted(&containerStatus)
+		}
+	}
+	return false
+}
+
+// acquireBizs is a method of VPodProvider that references the shared bizs of the pod, returns the containers to start,
+// a shared biz is only started by the first pod referencing it
+func (b *VPodProvider) acquireBizs(pod *corev1.Pod, containers []corev1.Container) []corev1.Container {
+	podKey := utils.GetPodKey(pod)
+	ret := make([]corev1.Container, 0, len(containers))
+	for _, container := range containers {
+		if utils.IsSharedBiz(pod, container.Name) && !b.sharedBizStore.Acquire(utils.GetBizUniqueKey(&container), podKey) {
+			continue
+		}
+		ret = append(ret, container)
+	}
+	return ret
+}
+
+// releaseBizs is a method of VPodProvider that releases the shared bizs of the pod, returns the containers to stop,
+// a shared biz is only stopped by the last pod releasing it
+func (b *VPodProvider) releaseBizs(pod *corev1.Pod, containers []corev1.Container) []corev1.Container {
+	podKey := utils.GetPodKey(pod)
+	ret := make([]corev1.Container, 0, len(containers))
+	for _, container := range containers {
+		if utils.IsSharedBiz(pod, container.Name) && !b.sharedBizStore.Release(utils.GetBizUniqueKey(&container), podKey) {
+			continue
+		}
+		ret = append(ret, container)
+	}
+	return ret
+}
+
+// bizPodKey is a method of VPodProvider that returns the pod key of the biz passed to the tunnel, model.PodKeyAll for a shared biz
+func (b *VPodProvider) bizPodKey(pod *corev1.Pod, container corev1.Container) string {
+	if utils.IsSharedBiz(pod, container.Name) {
+		return model.PodKeyAll
+	}
+	return utils.GetPodKey(pod)
+}
+
+// isSharedBizFollower is a method of VPodProvider that returns whether the biz is shared and the pod is not the primary one
+// referencing it, only the primary pod restarts a shared biz
+func (b *VPodProvider) isSharedBizFollower(pod *corev1.Pod, containerName, bizKey string) bool {
+	return utils.IsSharedBiz(pod, containerName) && !b.sharedBizStore.IsPrimary(bizKey, utils.GetPodKey(pod))
+}
+
+// StopAllBiz is a method of VPodProvider that stops the bizs of all pods, the init bizs of a pod after its bizs, no biz is restarted after
+func (b *VPodProvider) StopAllBiz(ctx context.Context) {
+	b.stoppingAllBiz.Store(true)
+	for _, pod := range b.vPodStore.GetPods() {
+		b.bizStartStore.Delete(utils.GetPodKey(pod))
+		b.handleBizBatchStop(ctx, pod, b.releaseBizs(pod, b.podStopBizContainers(pod)))
+		if retained := b.bizUpgradeStore.Delete(utils.GetPodKey(pod)); len(retained) > 0 {
+			b.handleBizBatchStop(ctx, pod, retained)
 		}
 	}
 }
 
+// HasPendingBizOperation is a method of VPodProvider that checks whether any biz operation is waiting for its response,
+// or any biz is waiting to be stopped in dependency order
+func (b *VPodProvider) HasPendingBizOperation() bool {
+	return b.bizOperationStore.PendingNum() > 0 || b.bizStartStore.HasPendingStop()
+}
+
+// TerminateAllPods is a method of VPodProvider that marks all pods failed with all containers terminated,
+// the status is patched to kube directly as the node is going to shut down
+func (b *VPodProvider) TerminateAllPods(ctx context.Context, reason, message string) {
+	now := metav1.Now()
+	for _, pod := range b.vPodStore.GetPods() {
+		logger := log.G(ctx).WithField("podKey", utils.GetPodKey(pod))
+		podFromKube := &corev1.Pod{}
+		err := b.client.Get(ctx, client.ObjectKeyFromObject(pod), podFromKube)
+		if err != nil {
+			logger.WithError(err).Error("failed to get pod when terminating")
+			continue
+		}
+
+		podCopy := podFromKube.DeepCopy()
+		podCopy.Status.Phase = corev1.PodFailed
+		podCopy.Status.Reason = reason
+		podCopy.Status.Message = message
+		podCopy.Status.Conditions = []corev1.PodCondition{
+			{
+				Type:               corev1.PodReady,
+				Status:             corev1.ConditionFalse,
+				LastTransitionTime: now,
+				Reason:             reason,
+			},
+			{
+				Type:               corev1.ContainersReady,
+				Status:             corev1.ConditionFalse,
+				LastTransitionTime: now,
+				Reason:             reason,
+			},
+		}
+		containerStatuses := make([]corev1.ContainerStatus, 0, len(podCopy.Spec.Containers))
+		for _, container := range podCopy.Spec.Containers {
+			containerStatuses = append(containerStatuses, corev1.ContainerStatus{
+				Name:  container.Name,
+				Image: container.Image,
+				State: corev1.ContainerState{
+					Terminated: &corev1.ContainerStateTerminated{
+						ExitCode:   1,
+						Reason:     reason,
+						Message:    message,
+						FinishedAt: now,
+					},
+				},
+			})
+		}
+		podCopy.Status.ContainerStatuses = containerStatuses
+
+		err = b.client.Status().Patch(ctx, podCopy, client.MergeFrom(podFromKube))
+		if err != nil {
+			logger.WithError(err).Error("failed to patch terminated pod status")
+			continue
+		}
+		logger.Infof("pod terminated: %s", reason)
+		b.vPodStore.PutPod(podCopy)
+	}
+}
+
 // CreatePod is a method of VPodProvider that creates a pod
 func (b *VPodProvider) CreatePod(ctx context.Context, pod *corev1.Pod) error {
 	logger := log.G(ctx).WithField("podKey", utils.GetPodKey(pod))
 	logger.Info("CreatePodStarted")
 
+	// pods already running are recovered from kube, only admit the new ones
+	if pod.Status.Phase != corev1.PodRunning {
+		if err := b.nodeResourceStore.CheckFits(pod); err != nil {
+			logger.WithError(err).Error("pod requests exceed the allocatable resources of node")
+			b.recordEvent(pod, corev1.EventTypeWarning, podEventOutOfResources, err.Error())
+			return pkgerrors.Wrapf(err, "pod %s can not be admitted", utils.GetPodKey(pod))
+		}
+	}
+	b.nodeResourceStore.PutPod(pod)
+
 	// update the baseline info so the async handle logic can see them first
 	podCopy := pod.DeepCopy()
 	b.vPodStore.PutPod(podCopy)
-	b.handleBizBatchStart(ctx, podCopy, podCopy.Spec.Containers)
+	containers := b.acquireBizs(podCopy, b.bizContainers(podCopy.Spec.Containers))
+	initContainers := b.acquireBizs(podCopy, b.pendingInitBizContainers(podCopy))
+	if len(initContainers) > 0 {
+		// the init bizs run one by one in order, each stopped once activated, and the bizs start after the last one completed
+		b.bizStartStore.PutPendingStart(utils.GetPodKey(podCopy), initContainers[0].Name, initContainers[1:], containers)
+		b.handleBizBatchStart(ctx, podCopy, initContainers[:1])
+	} else {
+		b.handleBizBatchStart(ctx, podCopy, containers)
+	}
 	b.notify(podCopy)
 	return nil
 }
@@ -245,77 +984,278 @@ func (b *VPodProvider) UpdatePod(ctx context.Context, pod *corev1.Pod) error {
 		return pkgerrors.Errorf("pod %s not found when updating", podKey)
 	}
 
-	newContainerMap := make(map[string]corev1.Container)
 	oldContainerMap := make(map[string]corev1.Container)
-	for _, container := range newPod.Spec.Containers {
-		newContainerMap[container.Name] = container
-	}
-	for _, container := range oldPod.Spec.Containers {
+	for _, container := range b.bizContainers(oldPod.Spec.Containers) {
 		oldContainerMap[container.Name] = container
 	}
 
+	strategy, err := utils.GetUpgradeStrategy(newPod)
+	if err != nil {
+		logger.WithError(err).Error("invalid upgrade strategy, ignored")
+		b.recordEvent(newPod, corev1.EventTypeWarning, podEventInvalidUpgradeStrategy, err.Error())
+	}
+	if _, ok := b.tunnel.(tunnel.BizReplacer); strategy == model.UpgradeStrategyHotReplace && !ok {
+		logger.Warnf("tunnel %s not supports hot replace, upgrade with %s", b.tunnel.Key(), model.UpgradeStrategyStopThenStart)
+		strategy = model.UpgradeStrategyStopThenStart
+	}
+
 	shouldStopContainers := make([]corev1.Container, 0)
 	shouldStartContainers := make([]corev1.Container, 0)
-	// find the container that updated in new pod
-	for name, oldContainer := range oldContainerMap {
-		if newContainer, has := newContainerMap[name]; has && !cmp.Equal(newContainer, oldContainer) {
-			shouldStopContainers = append(shouldStopContainers, oldContainer)
+	upgrades := make([]BizUpgrade, 0)
+	// find the changed containers and the new containers, in the start order of new pod
+	newContainers, _ := b.sortBizContainers(ctx, newPod, b.bizContainers(newPod.Spec.Containers))
+	for _, newContainer := range newContainers {
+		oldContainer, has := oldContainerMap[newContainer.Name]
+		if !has {
 			shouldStartContainers = append(shouldStartContainers, newContainer)
+			continue
 		}
-	}
-	// find the new container that not existed in old pod
-	for name, newContainer := range newContainerMap {
-		if _, has := oldContainerMap[name]; !has {
+		if cmp.Equal(newContainer, oldContainer) {
+			continue
+		}
+		b.bizRestartStore.Delete(utils.GetContainerKey(podKey, newContainer.Name))
+		b.bizProbeManager.RemoveBiz(utils.GetContainerKey(podKey, newContainer.Name))
+		if utils.IsSharedBiz(oldPod, oldContainer.Name) || utils.IsSharedBiz(newPod, newContainer.Name) {
+			// the shared bizs are upgraded by their references, the old one is stopped on last release and the new one started on first use
+			shouldStopContainers = append(shouldStopContainers, b.releaseBizs(oldPod, []corev1.Container{oldContainer})...)
 			shouldStartContainers = append(shouldStartContainers, newContainer)
+			continue
 		}
+		upgrades = append(upgrades, BizUpgrade{
+			Strategy:     strategy,
+			OldContainer: oldContainer,
+			NewContainer: newContainer,
+		})
 	}
+	shouldStartContainers = b.acquireBizs(newPod, shouldStartContainers)
+
+	keepBizUpgradeState(oldPod, newPod)
+	b.vPodStore.PutPod(newPod.DeepCopy())
+	b.nodeResourceStore.PutPod(newPod)
+
 	if len(shouldStopContainers) > 0 {
 		b.handleBizBatchStop(ctx, oldPod, shouldStopContainers)
 	}
+	if len(shouldStartContainers) > 0 {
+		b.handleBizBatchStart(ctx, newPod, shouldStartContainers)
+	}
+	// the changed bizs are upgraded one by one, after the upgrades of the previous updates
+	if upgrade, has := b.bizUpgradeStore.PutUpgrades(podKey, upgrades); has {
+		b.runBizUpgrade(ctx, newPod, upgrade)
+	} else if running, has := b.bizUpgradeStore.GetUpgrade(podKey); has && len(upgrades) > 0 {
+		// the progress counts the queued upgrades
+		b.putBizUpgradeState(podKey, corev1.ConditionFalse, podEventBizUpgrading, b.bizUpgradingMessage(podKey, running))
+	}
 
-	b.vPodStore.PutPod(newPod.DeepCopy())
+	// the upgrade progress may be updated on the vpod
+	b.notify(b.vPodStore.GetPodByKey(podKey))
+	return nil
+}
 
-	if len(shouldStartContainers) == 0 {
-		b.notify(newPod)
-		return nil
+// runBizUpgrade is a method of VPodProvider that starts the upgrade of a changed biz of the pod with its strategy
+func (b *VPodProvider) runBizUpgrade(ctx context.Context, pod *corev1.Pod, upgrade BizUpgrade) {
+	podKey := utils.GetPodKey(pod)
+	message := b.bizUpgradingMessage(podKey, upgrade)
+	log.G(ctx).WithField("podKey", podKey).Info(message)
+	b.recordEvent(pod, corev1.EventTypeNormal, podEventBizUpgrading, message)
+
+	var err error
+	switch upgrade.Strategy {
+	case model.UpgradeStrategyStartThenStop:
+		// the old biz is stopped once the new one activated
+		b.bizUpgradeStore.SetNewStarted(podKey)
+		err = b.handleBizBatchStart(ctx, pod, []corev1.Container{upgrade.NewContainer})
+	case model.UpgradeStrategyHotReplace:
+		b.bizUpgradeStore.SetNewStarted(podKey)
+		err = b.handleBizReplace(ctx, pod, upgrade.OldContainer, upgrade.NewContainer)
+	default:
+		// the new biz is started once the old one stopped
+		err = b.handleBizBatchStop(ctx, pod, []corev1.Container{upgrade.OldContainer})
+	}
+	if err != nil {
+		b.failBizUpgrade(ctx, pod, upgrade, err.Error())
+		return
 	}
+	b.putBizUpgradeState(podKey, corev1.ConditionFalse, podEventBizUpgrading, message)
+}
 
-	// only start new containers and changed containers
-	tracker.G().Eventually(pod.Labels[model.LabelKeyOfTraceID], model.TrackSceneVPodDeploy, model.TrackEventVPodUpdate, pod.Labels, model.CodeContainerStartTimeout, func() (bool, error) {
-		podFromKubernetes := &corev1.Pod{}
-		err := b.client.Get(ctx, client.ObjectKey{
-			Namespace: pod.Namespace,
-			Name:      pod.Name,
-		}, podFromKubernetes)
+// bizUpgradingMessage is a method of VPodProvider that returns the progress message of the running upgrade of the pod
+func (b *VPodProvider) bizUpgradingMessage(podKey string, upgrade BizUpgrade) string {
+	completed, total := b.bizUpgradeStore.GetProgress(podKey)
+	return fmt.Sprintf("Upgrading biz %s (%d/%d) with %s", upgrade.NewContainer.Name, completed+1, total, upgrade.Strategy)
+}
+
+// putBizUpgradeState is a method of VPodProvider that records the upgrade state of the pod on the vpod to be persisted by the snapshot,
+// and surfaces the upgrade progress by the BizUpgraded condition of the pod
+func (b *VPodProvider) putBizUpgradeState(podKey string, status corev1.ConditionStatus, reason, message string) {
+	pod := b.vPodStore.GetPodByKey(podKey)
+	if pod == nil {
+		return
+	}
+	podCopy := pod.DeepCopy()
+	if state, has := b.bizUpgradeStore.GetState(podKey); has {
+		data, err := json.Marshal(state)
 		if err != nil {
-			logger.WithError(err).Error("Failed to get pod from k8s")
-			// should failed if can't get pod from k8s
-			if errors.IsNotFound(err) {
-				// stop retry and no need to start new containers
-				return false, err
-			}
-			return false, nil
+			log.G(context.Background()).WithError(err).WithField("podKey", podKey).Error("failed to marshal biz upgrades state")
+			return
+		}
+		if podCopy.Annotations == nil {
+			podCopy.Annotations = make(map[string]string)
+		}
+		podCopy.Annotations[model.AnnotationKeyOfBizUpgradesState] = string(data)
+	} else {
+		delete(podCopy.Annotations, model.AnnotationKeyOfBizUpgradesState)
+	}
+	setPodCondition(&podCopy.Status, corev1.PodCondition{
+		Type:    model.PodConditionBizUpgraded,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	})
+	b.vPodStore.PutPod(podCopy)
+	if b.notify != nil {
+		b.notify(podCopy)
+	}
+}
+
+// setPodCondition sets the condition of the pod status, the transition time is kept if the condition status not changed
+func setPodCondition(podStatus *corev1.PodStatus, condition corev1.PodCondition) {
+	condition.LastTransitionTime = metav1.Now()
+	for i := range podStatus.Conditions {
+		if podStatus.Conditions[i].Type != condition.Type {
+			continue
 		}
+		if podStatus.Conditions[i].Status == condition.Status {
+			condition.LastTransitionTime = podStatus.Conditions[i].LastTransitionTime
+		}
+		podStatus.Conditions[i] = condition
+		return
+	}
+	podStatus.Conditions = append(podStatus.Conditions, condition)
+}
 
-		nameToContainerStatus := make(map[string]corev1.ContainerStatus)
-		for _, containerStatus := range podFromKubernetes.Status.ContainerStatuses {
-			nameToContainerStatus[containerStatus.Name] = containerStatus
+// keepBizUpgradeState keeps the upgrade state and progress recorded on the old vpod in the new one
+func keepBizUpgradeState(oldPod, newPod *corev1.Pod) {
+	if state, has := oldPod.Annotations[model.AnnotationKeyOfBizUpgradesState]; has {
+		if newPod.Annotations == nil {
+			newPod.Annotations = make(map[string]string)
 		}
+		newPod.Annotations[model.AnnotationKeyOfBizUpgradesState] = state
+	}
+	keepBizUpgradedCondition(oldPod, &newPod.Status)
+}
 
-		for _, shouldUpdateContainer := range shouldStopContainers {
-			if status, has := nameToContainerStatus[shouldUpdateContainer.Name]; has && status.State.Terminated == nil {
-				return false, nil
+// keepBizUpgradedCondition keeps the BizUpgraded condition of the pod in the new pod status, as it is not derived from the biz status
+func keepBizUpgradedCondition(pod *corev1.Pod, podStatus *corev1.PodStatus) {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type != model.PodConditionBizUpgraded {
+			continue
+		}
+		for i := range podStatus.Conditions {
+			if podStatus.Conditions[i].Type == condition.Type {
+				podStatus.Conditions[i] = condition
+				return
 			}
 		}
-		return true, nil
-	}, time.Minute, time.Second, func() {
-		b.handleBizBatchStart(ctx, newPod, shouldStopContainers)
-	}, func() {
-		logger.Error("stop old containers timeout, not start new containers")
-	})
+		podStatus.Conditions = append(podStatus.Conditions, condition)
+		return
+	}
+}
 
-	b.notify(newPod)
-	return nil
+// checkBizUpgradeOperation is a method of VPodProvider that starts the new biz of the running stop-then-start upgrade once the old one stopped
+func (b *VPodProvider) checkBizUpgradeOperation(ctx context.Context, operation *BizOperation, response model.BizOperationResponse) {
+	podKey := utils.GetPodKey(operation.Pod)
+	upgrade, has := b.bizUpgradeStore.GetUpgrade(podKey)
+	if !has || upgrade.Strategy != model.UpgradeStrategyStopThenStart || upgrade.NewStarted || operation.Type != model.BizOperationStop ||
+		!cmp.Equal(operation.Container, upgrade.OldContainer) {
+		return
+	}
+	pod := b.vPodStore.GetPodByKey(podKey)
+	if pod == nil {
+		return
+	}
+	if !response.Success {
+		b.failBizUpgrade(ctx, pod, upgrade, fmt.Sprintf("stop old biz failed: %s", response.Message))
+		return
+	}
+	b.bizUpgradeStore.SetNewStarted(podKey)
+	if err := b.handleBizBatchStart(ctx, pod, []corev1.Container{upgrade.NewContainer}); err != nil {
+		b.failBizUpgrade(ctx, pod, upgrade, err.Error())
+		return
+	}
+	b.putBizUpgradeState(podKey, corev1.ConditionFalse, podEventBizUpgrading, b.bizUpgradingMessage(podKey, upgrade))
+}
+
+// checkBizUpgradeStatus is a method of VPodProvider that completes the running upgrade of the pod once the new biz activated,
+// and fails it once the new biz broken
+func (b *VPodProvider) checkBizUpgradeStatus(ctx context.Context, pod *corev1.Pod, bizStatusData model.BizStatusData) {
+	podKey := utils.GetPodKey(pod)
+	upgrade, has := b.bizUpgradeStore.GetUpgrade(podKey)
+	if !has || !upgrade.NewStarted || upgrade.NewContainer.Name != bizStatusData.Name || utils.GetBizUniqueKey(&upgrade.NewContainer) != bizStatusData.Key {
+		return
+	}
+	if strings.EqualFold(bizStatusData.State, string(model.BizStateBroken)) {
+		b.failBizUpgrade(ctx, pod, upgrade, fmt.Sprintf("new biz broken: %s", bizStatusData.Message))
+		return
+	}
+	if !strings.EqualFold(bizStatusData.State, string(model.BizStateActivated)) {
+		return
+	}
+
+	toStopContainers := b.bizUpgradeStore.TakeRetained(podKey, upgrade.NewContainer.Name)
+	if upgrade.Strategy == model.UpgradeStrategyStartThenStop {
+		toStopContainers = append(toStopContainers, upgrade.OldContainer)
+	}
+	if len(toStopContainers) > 0 {
+		b.handleBizBatchStop(ctx, pod, toStopContainers)
+	}
+	completed, total := b.bizUpgradeStore.GetProgress(podKey)
+	message := fmt.Sprintf("Upgraded biz %s (%d/%d)", upgrade.NewContainer.Name, completed+1, total)
+	log.G(ctx).WithField("podKey", podKey).Info(message)
+	b.recordEvent(pod, corev1.EventTypeNormal, podEventBizUpgraded, message)
+
+	if next, has := b.bizUpgradeStore.CompleteUpgrade(podKey); has {
+		b.runBizUpgrade(ctx, pod, next)
+		return
+	}
+	b.putBizUpgradeState(podKey, corev1.ConditionTrue, podEventBizUpgraded, message)
+}
+
+// checkResumedBizUpgrades is a method of VPodProvider that checks the running upgrades resumed with the full biz status, as the status
+// of their new bizs may be synced before the upgrades restored and not synced again
+func (b *VPodProvider) checkResumedBizUpgrades(ctx context.Context, bizKeyToBizStatusData map[string]model.BizStatusData) {
+	for _, pod := range b.vPodStore.GetPods() {
+		podKey := utils.GetPodKey(pod)
+		upgrade, has := b.bizUpgradeStore.GetUpgrade(podKey)
+		if !has || !upgrade.Resumed || !upgrade.NewStarted {
+			continue
+		}
+		if bizStatusData, has := bizKeyToBizStatusData[utils.GetBizUniqueKey(&upgrade.NewContainer)]; has {
+			bizStatusData.PodKey = podKey
+			b.checkBizUpgradeStatus(ctx, pod, bizStatusData)
+		}
+	}
+}
+
+// failBizUpgrade is a method of VPodProvider that aborts the upgrades of the pod not completed once the running one failed
+func (b *VPodProvider) failBizUpgrade(ctx context.Context, pod *corev1.Pod, upgrade BizUpgrade, reason string) {
+	aborted := b.bizUpgradeStore.Abort(utils.GetPodKey(pod))
+	message := fmt.Sprintf("Upgrade biz %s with %s failed, %d upgrades aborted: %s", upgrade.NewContainer.Name, upgrade.Strategy, aborted, reason)
+	log.G(ctx).WithField("podKey", utils.GetPodKey(pod)).Error(message)
+
+	labelMap := pod.Labels
+	if labelMap == nil {
+		labelMap = make(map[string]string)
+	}
+	tracker.G().ErrorReport(labelMap[model.LabelKeyOfTraceID], model.TrackSceneVPodDeploy, model.TrackEventContainerUpgrade, message, labelMap, model.CodeContainerUpgradeFailed)
+	b.recordEvent(pod, corev1.EventTypeWarning, podEventBizUpgradeFailed, message)
+	b.putBizUpgradeState(utils.GetPodKey(pod), corev1.ConditionFalse, podEventBizUpgradeFailed, message)
+}
+
+// isBizUpgrading is a method of VPodProvider that returns whether the container of the pod is being upgraded
+func (b *VPodProvider) isBizUpgrading(podKey, containerName string) bool {
+	upgrade, has := b.bizUpgradeStore.GetUpgrade(podKey)
+	return has && upgrade.NewContainer.Name == containerName
 }
 
 // DeletePod is a method of VPodProvider that deletes a pod
@@ -330,7 +1270,17 @@ func (b *VPodProvider) DeletePod(ctx context.Context, pod *corev1.Pod) error {
 
 	// delete from curr provider
 	b.vPodStore.DeletePod(podKey)
-	b.handleBizBatchStop(ctx, pod, pod.Spec.Containers)
+	b.nodeResourceStore.DeletePod(podKey)
+	b.bizStartStore.Delete(podKey)
+	for _, container := range utils.GetPodContainers(pod) {
+		b.bizRestartStore.Delete(utils.GetContainerKey(podKey, container.Name))
+		b.bizProbeManager.RemoveBiz(utils.GetContainerKey(podKey, container.Name))
+	}
+	b.handleBizBatchStop(ctx, pod, b.releaseBizs(pod, b.podStopBizContainers(pod)))
+	if retained := b.bizUpgradeStore.Delete(podKey); len(retained) > 0 {
+		// the old bizs of the aborted start-then-stop upgrades are still running
+		b.handleBizBatchStop(ctx, pod, retained)
+	}
 	b.notify(pod)
 	return nil
 }
@@ -365,10 +1315,18 @@ func (b *VPodProvider) GetPodStatus(ctx context.Context, pod *corev1.Pod, bizSta
 		nameToContainerStatus[cs.Name] = &cs
 	}
 
-	// TODO: check all containers status only biz jar container
+	initialized, initFailed, err := b.getInitContainerStatuses(ctx, pod, bizStatus, podStatus)
+	if err != nil {
+		return nil, err
+	}
+
 	for _, container := range pod.Spec.Containers {
-		// only check biz jar container
-		if !strings.Contains(container.Image, ".jar") {
+		switch b.bizClassifier.Classify(&container) {
+		case model.ContainerTypeIgnored:
+			continue
+		case model.ContainerTypeSidecar:
+			// sidecars are not managed by the tunnel, report them as running with the pod
+			podStatus.ContainerStatuses = append(podStatus.ContainerStatuses, sidecarContainerStatus(pod, &container, nameToContainerStatus[container.Name]))
 			continue
 		}
 		containerStatus, err := utils.ConvertBizStatusToContainerStatus(&container, nameToContainerStatus[container.Name], &bizStatus)
@@ -376,6 +1334,25 @@ func (b *VPodProvider) GetPodStatus(ctx context.Context, pod *corev1.Pod, bizSta
 			log.G(ctx).Errorf("can't convert biz status to container status for container %s", utils.GetContainerKey(utils.GetPodKey(pod), container.Name))
 			return nil, err
 		} else {
+			containerKey := utils.GetContainerKey(utils.GetPodKey(pod), container.Name)
+			// the old status may be reused, copy it before changing
+			containerStatus = containerStatus.DeepCopy()
+			if containerStatus.State.Running != nil {
+				started := b.bizProbeManager.IsStarted(containerKey, &container)
+				containerStatus.Started = &started
+				containerStatus.Ready = started && b.bizProbeManager.IsReady(containerKey, &container)
+			}
+			containerStatus.RestartCount = b.bizRestartStore.GetRestartCount(containerKey)
+			if containerStatus.State.Waiting != nil && b.bizRestartStore.IsBackingOff(containerKey) {
+				waiting := *containerStatus.State.Waiting
+				waiting.Reason = containerReasonCrashLoopBackOff
+				containerStatus.State.Waiting = &waiting
+			}
+			if !initialized && containerStatus.State == (corev1.ContainerState{}) {
+				containerStatus.State.Waiting = &corev1.ContainerStateWaiting{
+					Reason: model.ContainerReasonPodInitializing,
+				}
+			}
 			podStatus.ContainerStatuses = append(podStatus.ContainerStatuses, *containerStatus)
 		}
 
@@ -394,7 +1371,32 @@ func (b *VPodProvider) GetPodStatus(ctx context.Context, pod *corev1.Pod, bizSta
 
 	podStatus.Phase = corev1.PodPending
 
-	if bizJarContainerCount == 0 || bizJarContainerCount == terminatedBizJarContainerCount {
+	if !initialized {
+		// the bizs are not started until all init bizs completed
+		if initFailed && pod.Spec.RestartPolicy == corev1.RestartPolicyNever {
+			podStatus.Phase = corev1.PodFailed
+		}
+		podStatus.Conditions = []corev1.PodCondition{
+			{
+				Type:          "Ready",
+				Status:        corev1.ConditionFalse,
+				LastProbeTime: metav1.NewTime(time.Now()),
+			},
+			{
+				Type:          "ContainersReady",
+				Status:        corev1.ConditionFalse,
+				LastProbeTime: metav1.NewTime(time.Now()),
+			},
+			{
+				Type:          "Initialized",
+				Status:        corev1.ConditionFalse,
+				LastProbeTime: metav1.NewTime(time.Now()),
+				Reason:        model.PodReasonContainersNotInitialized,
+			},
+		}
+		keepBizUpgradedCondition(pod, podStatus)
+		return podStatus, nil
+	} else if bizJarContainerCount == 0 || bizJarContainerCount == terminatedBizJarContainerCount {
 		// if no biz jar container or all biz jar container terminated, pod is terminated
 		podStatus.Phase = corev1.PodSucceeded
 		podStatus.Conditions = []corev1.PodCondition{
@@ -409,7 +1411,6 @@ func (b *VPodProvider) GetPodStatus(ctx context.Context, pod *corev1.Pod, bizSta
 				LastProbeTime: metav1.NewTime(time.Now()),
 			},
 		}
-		return podStatus, nil
 	} else if notInitedBizJarContainerCount == bizJarContainerCount {
 		podStatus.Phase = corev1.PodPending
 		podStatus.Conditions = []corev1.PodCondition{
@@ -468,10 +1469,193 @@ func (b *VPodProvider) GetPodStatus(ctx context.Context, pod *corev1.Pod, bizSta
 			},
 		}
 	}
+	podStatus.Conditions = append(podStatus.Conditions, corev1.PodCondition{
+		Type:          "Initialized",
+		Status:        corev1.ConditionTrue,
+		LastProbeTime: metav1.NewTime(time.Now()),
+	})
+	keepBizUpgradedCondition(pod, podStatus)
 
 	return podStatus, nil
 }
 
+// getInitContainerStatuses is a method of VPodProvider that fills the init container statuses of the pod status,
+// returns whether all init bizs completed and whether any init biz terminated with failure
+func (b *VPodProvider) getInitContainerStatuses(ctx context.Context, pod *corev1.Pod, bizStatus model.BizStatusData, podStatus *corev1.PodStatus) (initialized, failed bool, err error) {
+	podStatus.InitContainerStatuses = make([]corev1.ContainerStatus, 0, len(pod.Spec.InitContainers))
+
+	nameToInitContainerStatus := make(map[string]*corev1.ContainerStatus)
+	for _, cs := range pod.Status.InitContainerStatuses {
+		nameToInitContainerStatus[cs.Name] = &cs
+	}
+
+	initialized = true
+	for _, container := range pod.Spec.InitContainers {
+		switch b.bizClassifier.Classify(&container) {
+		case model.ContainerTypeIgnored:
+			continue
+		case model.ContainerTypeSidecar:
+			// sidecars are not managed by the tunnel, report them as running with the pod
+			podStatus.InitContainerStatuses = append(podStatus.InitContainerStatuses, sidecarContainerStatus(pod, &container, nameToInitContainerStatus[container.Name]))
+			continue
+		}
+		containerKey := utils.GetContainerKey(utils.GetPodKey(pod), container.Name)
+		containerStatus, err := utils.ConvertBizStatusToInitContainerStatus(&container, nameToInitContainerStatus[container.Name], &bizStatus, pod.Spec.RestartPolicy)
+		if err != nil || containerStatus == nil {
+			log.G(ctx).Errorf("can't convert biz status to init container status for container %s", containerKey)
+			return false, false, err
+		}
+		// the old status may be reused, copy it before changing
+		containerStatus = containerStatus.DeepCopy()
+		containerStatus.RestartCount = b.bizRestartStore.GetRestartCount(containerKey)
+		if containerStatus.State.Waiting != nil && b.bizRestartStore.IsBackingOff(containerKey) {
+			waiting := *containerStatus.State.Waiting
+			waiting.Reason = containerReasonCrashLoopBackOff
+			containerStatus.State.Waiting = &waiting
+		}
+		podStatus.InitContainerStatuses = append(podStatus.InitContainerStatuses, *containerStatus)
+
+		if !utils.IsInitContainerCompleted(containerStatus) {
+			initialized = false
+			failed = failed || containerStatus.State.Terminated != nil
+		}
+	}
+	return initialized, failed, nil
+}
+
+// sidecarContainerStatus returns the running status of the sidecar container, the old status is reused if it is running
+func sidecarContainerStatus(pod *corev1.Pod, container *corev1.Container, oldStatus *corev1.ContainerStatus) corev1.ContainerStatus {
+	if oldStatus != nil && oldStatus.State.Running != nil {
+		return *oldStatus.DeepCopy()
+	}
+	started := true
+	return corev1.ContainerStatus{
+		Name:        container.Name,
+		ContainerID: container.Name,
+		State: corev1.ContainerState{
+			Running: &corev1.ContainerStateRunning{
+				StartedAt: pod.CreationTimestamp,
+			},
+		},
+		Ready:   true,
+		Started: &started,
+		Image:   container.Image,
+		ImageID: container.Image,
+	}
+}
+
+// GetHandoffBizOperations returns the pending async biz operations to be recorded in the lease handoff
+func (b *VPodProvider) GetHandoffBizOperations() []model.HandoffBizOperation {
+	ret := make([]model.HandoffBizOperation, 0)
+	for operationID, operation := range b.bizOperationStore.GetPendingOperations() {
+		ret = append(ret, model.HandoffBizOperation{
+			OperationID:   operationID,
+			Type:          operation.Type,
+			PodKey:        utils.GetPodKey(operation.Pod),
+			ContainerName: operation.Container.Name,
+		})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].OperationID < ret[j].OperationID
+	})
+	return ret
+}
+
+// ResumeHandoffBizOperations records the pending async biz operations handed off by the previous leader,
+// so their responses are handled by this provider, the operations of the pods not found are dropped
+func (b *VPodProvider) ResumeHandoffBizOperations(ctx context.Context, operations []model.HandoffBizOperation) {
+	for _, operation := range operations {
+		pod := b.vPodStore.GetPodByKey(operation.PodKey)
+		if pod == nil {
+			log.G(ctx).Warnf("skip resuming biz operation %s of non-exist pod %s", operation.OperationID, operation.PodKey)
+			continue
+		}
+		for _, container := range utils.GetPodContainers(pod) {
+			if container.Name == operation.ContainerName {
+				b.putBizOperation(ctx, operation.OperationID, operation.Type, pod, container)
+				break
+			}
+		}
+	}
+}
+
+// RestorePods restores the pods from the last snapshot of the store, and accounts the resources of the running ones
+func (b *VPodProvider) RestorePods(ctx context.Context) error {
+	pods, err := b.vPodStore.Restore(ctx)
+	if err != nil {
+		return err
+	}
+	// the pods already in the store are accounted when put
+	for _, pod := range pods {
+		if pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed {
+			b.nodeResourceStore.PutPod(pod)
+			// the shared bizs are running already, only the references are restored
+			b.acquireBizs(pod, b.podBizContainers(pod))
+			b.restoreBizUpgrades(ctx, pod)
+		}
+	}
+	return nil
+}
+
+// restoreBizUpgrades is a method of VPodProvider that restores the upgrades of the pod from the state recorded on the vpod
+func (b *VPodProvider) restoreBizUpgrades(ctx context.Context, pod *corev1.Pod) {
+	data, has := pod.Annotations[model.AnnotationKeyOfBizUpgradesState]
+	if !has {
+		return
+	}
+	state := model.PodBizUpgradesState{}
+	if err := json.Unmarshal([]byte(data), &state); err != nil {
+		log.G(ctx).WithError(err).WithField("podKey", utils.GetPodKey(pod)).Error("invalid biz upgrades state, ignored")
+		return
+	}
+	state.PodKey = utils.GetPodKey(pod)
+	b.bizUpgradeStore.Restore(state)
+}
+
+// GetHandoffBizUpgrades returns the biz upgrades not completed to be recorded in the lease handoff
+func (b *VPodProvider) GetHandoffBizUpgrades() []model.PodBizUpgradesState {
+	return b.bizUpgradeStore.GetStates()
+}
+
+// ResumeHandoffBizUpgrades restores the biz upgrades handed off by the previous leader, the upgrades of the pods not restored
+// are skipped, the same as the biz operations
+func (b *VPodProvider) ResumeHandoffBizUpgrades(ctx context.Context, states []model.PodBizUpgradesState) {
+	for _, state := range states {
+		if b.vPodStore.GetPodByKey(state.PodKey) == nil {
+			log.G(ctx).Warnf("skip resuming biz upgrades of non-exist pod %s", state.PodKey)
+			continue
+		}
+		b.bizUpgradeStore.Restore(state)
+	}
+	b.ResumeBizUpgrades(ctx)
+}
+
+// ResumeBizUpgrades is a method of VPodProvider that resumes the running upgrades restored. The upgrade is rerun unless its new biz
+// started, which is completed by the next status of the new biz, or the stop of its old biz is waiting for the response.
+func (b *VPodProvider) ResumeBizUpgrades(ctx context.Context) {
+	for podKey, upgrade := range b.bizUpgradeStore.TakeToResume() {
+		pod := b.vPodStore.GetPodByKey(podKey)
+		if pod == nil {
+			continue
+		}
+		log.G(ctx).WithField("podKey", podKey).Infof("resuming the upgrade of biz %s with %s", upgrade.NewContainer.Name, upgrade.Strategy)
+		if upgrade.NewStarted || b.isBizOperationPending(podKey, model.BizOperationStop, upgrade.OldContainer) {
+			continue
+		}
+		b.runBizUpgrade(ctx, pod, upgrade)
+	}
+}
+
+// isBizOperationPending is a method of VPodProvider that returns whether the operation of the container of the pod is waiting for its response
+func (b *VPodProvider) isBizOperationPending(podKey string, operationType model.BizOperationType, container corev1.Container) bool {
+	for _, operation := range b.bizOperationStore.GetPendingOperations() {
+		if operation.Type == operationType && utils.GetPodKey(operation.Pod) == podKey && cmp.Equal(operation.Container, container) {
+			return true
+		}
+	}
+	return false
+}
+
 func (b *VPodProvider) GetPods(_ context.Context) ([]*corev1.Pod, error) {
 	return b.vPodStore.GetPods(), nil
 }
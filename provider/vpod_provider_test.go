@@ -2,17 +2,26 @@ package provider
 
 import (
 	"context"
+	"github.com/koupleless/virtual-kubelet/common/utils"
 	"github.com/koupleless/virtual-kubelet/model"
 	"github.com/koupleless/virtual-kubelet/tunnel"
 	"github.com/stretchr/testify/assert"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
 
 func TestSyncRelatedPodStatus(t *testing.T) {
-	provider := NewVPodProvider("default", "127.0.0.1", "123", nil, &tunnel.MockTunnel{})
+	provider := NewVPodProvider("default", "127.0.0.1", "123", nil, nil, nil, &tunnel.MockTunnel{})
 	provider.syncBizStatusToKube(context.TODO(), model.BizStatusData{
 		Key:        "test-biz-key",
 		Name:       "test-name",
@@ -26,7 +35,7 @@ func TestSyncRelatedPodStatus(t *testing.T) {
 
 func TestSyncAllContainerInfo(t *testing.T) {
 	tl := &tunnel.MockTunnel{}
-	provider := NewVPodProvider("default", "127.0.0.1", "123", nil, tl)
+	provider := NewVPodProvider("default", "127.0.0.1", "123", nil, nil, nil, tl)
 	pod := &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
 			CreationTimestamp: metav1.Time{Time: time.Now()},
@@ -40,7 +49,7 @@ func TestSyncAllContainerInfo(t *testing.T) {
 			},
 		},
 	}
-	provider.vPodStore.podKeyToPod = map[string]*corev1.Pod{
+	provider.vPodStore.(*MemoryVPodStore).podKeyToPod = map[string]*corev1.Pod{
 		"test": pod,
 		"test2": {
 			ObjectMeta: metav1.ObjectMeta{
@@ -67,7 +76,7 @@ func TestSyncAllContainerInfo(t *testing.T) {
 
 func TestUpdateDeletedPod(t *testing.T) {
 	tl := &tunnel.MockTunnel{}
-	provider := NewVPodProvider("default", "127.0.0.1", "123", nil, tl)
+	provider := NewVPodProvider("default", "127.0.0.1", "123", nil, nil, nil, tl)
 	pod := &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
 			CreationTimestamp: metav1.Time{Time: time.Now()},
@@ -85,3 +94,784 @@ func TestUpdateDeletedPod(t *testing.T) {
 	err := provider.UpdatePod(context.TODO(), pod)
 	assert.NoError(t, err)
 }
+
+func TestCreatePod_OutOfResources(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	provider := NewVPodProvider("default", "127.0.0.1", "123", nil, recorder, nil, &tunnel.MockTunnel{})
+	provider.NotifyPods(context.TODO(), func(pod *corev1.Pod) {})
+	provider.nodeResourceStore.SetBaseAllocatable(corev1.ResourceList{
+		corev1.ResourceCPU:  resource.MustParse("1"),
+		corev1.ResourcePods: resource.MustParse("10"),
+	})
+
+	pod := newResourcePod("pod1", "2", "1Gi")
+	err := provider.CreatePod(context.TODO(), pod)
+	assert.Error(t, err)
+	assert.Contains(t, <-recorder.Events, podEventOutOfResources)
+	assert.Nil(t, provider.vPodStore.GetPodByKey("ns/pod1"))
+
+	// running pods recovered from kube are always accepted
+	pod.Status.Phase = corev1.PodRunning
+	assert.NoError(t, provider.CreatePod(context.TODO(), pod))
+	assert.NotNil(t, provider.vPodStore.GetPodByKey("ns/pod1"))
+}
+
+func TestSyncBizOperationResponse(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	tl := &tunnel.MockTunnel{}
+	provider := NewVPodProvider("default", "127.0.0.1", "123", nil, recorder, nil, tl)
+	notified := make([]*corev1.Pod, 0)
+	provider.NotifyPods(context.TODO(), func(pod *corev1.Pod) {
+		notified = append(notified, pod)
+	})
+	container := corev1.Container{
+		Name:  "test-container",
+		Image: "test-image.jar",
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pod",
+			Namespace: "ns",
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy: corev1.RestartPolicyNever,
+			Containers:    []corev1.Container{container},
+		},
+	}
+	provider.vPodStore.PutPod(pod)
+
+	provider.putBizOperation(context.TODO(), "op1", model.BizOperationStart, pod, container)
+	assert.True(t, provider.bizOperationStore.IsPending("op1"))
+	provider.SyncBizOperationResponse(context.TODO(), model.BizOperationResponse{
+		OperationID: "op1",
+		Type:        model.BizOperationStart,
+		Success:     false,
+		Reason:      "InstallFailed",
+		Message:     "install failed",
+		FinishTime:  time.Now(),
+	})
+	assert.False(t, provider.bizOperationStore.IsPending("op1"))
+	assert.Contains(t, <-recorder.Events, podEventBizStartFailed)
+	assert.Len(t, notified, 1)
+	assert.Equal(t, "InstallFailed", notified[0].Status.ContainerStatuses[0].State.Waiting.Reason)
+
+	// response arrived before the operation recorded
+	provider.SyncBizOperationResponse(context.TODO(), model.BizOperationResponse{
+		OperationID: "op2",
+		Type:        model.BizOperationStop,
+		Success:     true,
+	})
+	provider.putBizOperation(context.TODO(), "op2", model.BizOperationStop, pod, container)
+	assert.False(t, provider.bizOperationStore.IsPending("op2"))
+	assert.Contains(t, <-recorder.Events, podEventBizStopSucceeded)
+}
+
+func TestRestartBrokenBiz(t *testing.T) {
+	tl := &tunnel.MockTunnel{}
+	assert.NoError(t, tl.Start("test", "test"))
+	provider := NewVPodProvider("default", "127.0.0.1", "123", nil, nil, nil, tl)
+	provider.bizRestartStore = NewBizRestartStore(10*time.Millisecond, 40*time.Millisecond)
+	started := make(chan model.BizStatusData, 1)
+	tl.RegisterCallback(nil, nil, nil, func(_ string, data model.BizStatusData) {
+		started <- data
+	}, nil)
+	notified := make(chan *corev1.Pod, 10)
+	provider.NotifyPods(context.TODO(), func(pod *corev1.Pod) {
+		notified <- pod
+	})
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pod",
+			Namespace: "ns",
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy: corev1.RestartPolicyAlways,
+			Containers: []corev1.Container{
+				{Name: "biz", Image: "biz.jar"},
+			},
+		},
+	}
+	provider.vPodStore.PutPod(pod)
+
+	provider.SyncBizStatusToKube(context.TODO(), model.BizStatusData{
+		Key:        tl.GetBizUniqueKey(&pod.Spec.Containers[0]),
+		Name:       "biz",
+		PodKey:     "ns/pod",
+		State:      string(model.BizStateBroken),
+		ChangeTime: time.Now(),
+		Reason:     "BizBroken",
+	})
+	podFromNotify := <-notified
+	assert.Equal(t, containerReasonCrashLoopBackOff, podFromNotify.Status.ContainerStatuses[0].State.Waiting.Reason)
+
+	data := <-started
+	assert.Equal(t, "biz", data.Name)
+	assert.Equal(t, int32(1), provider.bizRestartStore.GetRestartCount("ns/pod/biz"))
+
+	// never restart
+	pod.Spec.RestartPolicy = corev1.RestartPolicyNever
+	provider.vPodStore.PutPod(pod)
+	provider.SyncBizStatusToKube(context.TODO(), model.BizStatusData{
+		Key:        tl.GetBizUniqueKey(&pod.Spec.Containers[0]),
+		Name:       "biz",
+		PodKey:     "ns/pod",
+		State:      string(model.BizStateBroken),
+		ChangeTime: time.Now().Add(time.Second),
+	})
+	assert.False(t, provider.bizRestartStore.IsBackingOff("ns/pod/biz"))
+}
+
+func TestShouldRestartBiz(t *testing.T) {
+	assert.True(t, shouldRestartBiz(corev1.RestartPolicyAlways, string(model.BizStateStopped)))
+	// the bizs installing or not reported yet are unresolved too
+	assert.False(t, shouldRestartBiz(corev1.RestartPolicyAlways, string(model.BizStateUnResolved)))
+	assert.True(t, shouldRestartBiz(corev1.RestartPolicyAlways, string(model.BizStateBroken)))
+	assert.False(t, shouldRestartBiz(corev1.RestartPolicyAlways, string(model.BizStateActivated)))
+	assert.False(t, shouldRestartBiz(corev1.RestartPolicyAlways, string(model.BizStateResolved)))
+
+	assert.True(t, shouldRestartBiz(corev1.RestartPolicyOnFailure, string(model.BizStateBroken)))
+	assert.True(t, shouldRestartBiz(corev1.RestartPolicyOnFailure, "deactivated"))
+	assert.False(t, shouldRestartBiz(corev1.RestartPolicyOnFailure, string(model.BizStateStopped)))
+
+	assert.False(t, shouldRestartBiz(corev1.RestartPolicyNever, string(model.BizStateBroken)))
+}
+
+func TestBizReadinessProbe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(serverURL.Port())
+
+	tl := &tunnel.MockTunnel{}
+	provider := NewVPodProvider("default", "127.0.0.1", "123", nil, nil, nil, tl)
+	notified := make(chan *corev1.Pod, 10)
+	provider.NotifyPods(context.TODO(), func(pod *corev1.Pod) {
+		notified <- pod
+	})
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pod",
+			Namespace: "ns",
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:  "biz",
+					Image: "biz.jar",
+					ReadinessProbe: &corev1.Probe{
+						ProbeHandler: corev1.ProbeHandler{
+							HTTPGet: &corev1.HTTPGetAction{Port: intstr.FromInt32(int32(port))},
+						},
+						InitialDelaySeconds: 1,
+					},
+				},
+			},
+		},
+	}
+	provider.vPodStore.PutPod(pod)
+
+	provider.SyncBizStatusToKube(context.TODO(), model.BizStatusData{
+		Key:        tl.GetBizUniqueKey(&pod.Spec.Containers[0]),
+		Name:       "biz",
+		PodKey:     "ns/pod",
+		State:      string(model.BizStateActivated),
+		ChangeTime: time.Now(),
+	})
+	podFromNotify := <-notified
+	assert.NotNil(t, podFromNotify.Status.ContainerStatuses[0].State.Running)
+	assert.False(t, podFromNotify.Status.ContainerStatuses[0].Ready)
+
+	// ready after readiness probe succeeded
+	podFromNotify = <-notified
+	assert.True(t, podFromNotify.Status.ContainerStatuses[0].Ready)
+
+	provider.bizProbeManager.RemoveBiz("ns/pod/biz")
+}
+
+func TestSidecarContainerStatus(t *testing.T) {
+	tl := &tunnel.MockTunnel{}
+	provider := NewVPodProvider("default", "127.0.0.1", "123", nil, nil, utils.ImageSuffixBizClassifier(".jar"), tl)
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "pod",
+			Namespace:         "ns",
+			CreationTimestamp: metav1.Now(),
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{Name: "biz", Image: "biz.jar"},
+				{Name: "sidecar", Image: "sidecar:latest"},
+			},
+		},
+	}
+	assert.Len(t, provider.bizContainers(pod.Spec.Containers), 1)
+
+	podStatus, err := provider.GetPodStatus(context.TODO(), pod, model.BizStatusData{
+		Key:        tl.GetBizUniqueKey(&pod.Spec.Containers[0]),
+		Name:       "biz",
+		PodKey:     "ns/pod",
+		State:      string(model.BizStateActivated),
+		ChangeTime: time.Now(),
+	})
+	assert.NoError(t, err)
+	assert.Len(t, podStatus.ContainerStatuses, 2)
+	assert.Equal(t, "sidecar", podStatus.ContainerStatuses[1].Name)
+	assert.NotNil(t, podStatus.ContainerStatuses[1].State.Running)
+	assert.True(t, podStatus.ContainerStatuses[1].Ready)
+	assert.Equal(t, corev1.PodRunning, podStatus.Phase)
+
+	// ignored by the default classifier
+	provider = NewVPodProvider("default", "127.0.0.1", "123", nil, nil, nil, tl)
+	podStatus, err = provider.GetPodStatus(context.TODO(), pod, model.BizStatusData{})
+	assert.NoError(t, err)
+	assert.Len(t, podStatus.ContainerStatuses, 1)
+}
+
+func TestSyncBizStatusDeltaToKube(t *testing.T) {
+	tl := &tunnel.MockTunnel{}
+	provider := NewVPodProvider("default", "127.0.0.1", "vnode.test", nil, nil, nil, tl)
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "pod",
+			Namespace:         "ns",
+			CreationTimestamp: metav1.Now(),
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "biz", Image: "biz.jar"}},
+		},
+	}
+	provider.vPodStore.PutPod(pod)
+	notified := make([]*corev1.Pod, 0)
+	provider.NotifyPods(context.TODO(), func(pod *corev1.Pod) {
+		notified = append(notified, pod)
+	})
+	bizStatus := func(state model.BizState, changeTime time.Time) model.BizStatusData {
+		return model.BizStatusData{
+			Key:        tl.GetBizUniqueKey(&pod.Spec.Containers[0]),
+			Name:       "biz",
+			PodKey:     "ns/pod",
+			State:      string(state),
+			ChangeTime: changeTime,
+		}
+	}
+	now := time.Now()
+
+	// no full delta applied yet
+	assert.False(t, provider.SyncBizStatusDeltaToKube(context.TODO(), model.BizStatusDelta{
+		Revision:         2,
+		PreviousRevision: 1,
+		Bizs:             []model.BizStatusData{bizStatus(model.BizStateResolved, now)},
+	}))
+	assert.Equal(t, int64(0), provider.GetBizStatusRevision())
+	assert.Empty(t, notified)
+
+	assert.True(t, provider.SyncBizStatusDeltaToKube(context.TODO(), model.BizStatusDelta{
+		Revision: 5,
+		Full:     true,
+		Bizs:     []model.BizStatusData{bizStatus(model.BizStateResolved, now)},
+	}))
+	assert.Equal(t, int64(5), provider.GetBizStatusRevision())
+	assert.Len(t, notified, 1)
+	assert.NotNil(t, notified[0].Status.ContainerStatuses[0].State.Waiting)
+
+	assert.True(t, provider.SyncBizStatusDeltaToKube(context.TODO(), model.BizStatusDelta{
+		Revision:         6,
+		PreviousRevision: 5,
+		Bizs:             []model.BizStatusData{bizStatus(model.BizStateActivated, now.Add(time.Second))},
+	}))
+	assert.Equal(t, int64(6), provider.GetBizStatusRevision())
+	assert.Len(t, notified, 2)
+	assert.NotNil(t, notified[1].Status.ContainerStatuses[0].State.Running)
+
+	// duplicated delta is ignored
+	assert.True(t, provider.SyncBizStatusDeltaToKube(context.TODO(), model.BizStatusDelta{
+		Revision:         6,
+		PreviousRevision: 5,
+		Bizs:             []model.BizStatusData{bizStatus(model.BizStateResolved, now.Add(2*time.Second))},
+	}))
+	assert.Equal(t, int64(6), provider.GetBizStatusRevision())
+	assert.Len(t, notified, 2)
+
+	// the full delta of the restarted base resets the revision
+	assert.True(t, provider.SyncBizStatusDeltaToKube(context.TODO(), model.BizStatusDelta{
+		Revision: 1,
+		Full:     true,
+		Bizs:     []model.BizStatusData{bizStatus(model.BizStateActivated, now.Add(time.Second))},
+	}))
+	assert.Equal(t, int64(1), provider.GetBizStatusRevision())
+	assert.True(t, provider.SyncBizStatusDeltaToKube(context.TODO(), model.BizStatusDelta{
+		Revision:         2,
+		PreviousRevision: 1,
+		Bizs:             []model.BizStatusData{bizStatus(model.BizStateResolved, now.Add(2*time.Second))},
+	}))
+	assert.Equal(t, int64(2), provider.GetBizStatusRevision())
+	assert.Len(t, notified, 3)
+	assert.NotNil(t, notified[2].Status.ContainerStatuses[0].State.Waiting)
+
+	// revision gap
+	assert.False(t, provider.SyncBizStatusDeltaToKube(context.TODO(), model.BizStatusDelta{
+		Revision:         9,
+		PreviousRevision: 8,
+		Bizs:             []model.BizStatusData{bizStatus(model.BizStateDeactivated, now.Add(3*time.Second))},
+	}))
+	assert.Equal(t, int64(2), provider.GetBizStatusRevision())
+	assert.Len(t, notified, 3)
+}
+
+// sharedBizMockTunnel records the pod keys of the started and stopped bizs
+type sharedBizMockTunnel struct {
+	tunnel.MockTunnel
+
+	started []string
+	stopped []string
+}
+
+func (t *sharedBizMockTunnel) StartBiz(_, podKey string, container *corev1.Container) (string, error) {
+	t.started = append(t.started, podKey+"/"+container.Name)
+	return "start-" + strconv.Itoa(len(t.started)), nil
+}
+
+func (t *sharedBizMockTunnel) StopBiz(_, podKey string, container *corev1.Container) (string, error) {
+	t.stopped = append(t.stopped, podKey+"/"+container.Name)
+	return "stop-" + strconv.Itoa(len(t.stopped)), nil
+}
+
+func TestSharedBiz(t *testing.T) {
+	tl := &sharedBizMockTunnel{}
+	provider := NewVPodProvider("default", "127.0.0.1", "vnode.test", nil, nil, nil, tl)
+	notified := make([]*corev1.Pod, 0)
+	provider.NotifyPods(context.TODO(), func(pod *corev1.Pod) {
+		notified = append(notified, pod)
+	})
+	newSharedPod := func(name string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "ns",
+				CreationTimestamp: metav1.Now(),
+				Annotations:       map[string]string{model.AnnotationKeyOfSharedBizs: "shared"},
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{Name: "shared", Image: "shared.jar"},
+					{Name: name + "-biz", Image: "biz.jar"},
+				},
+			},
+		}
+	}
+	pod1, pod2 := newSharedPod("pod1"), newSharedPod("pod2")
+
+	// installed only on first use
+	assert.NoError(t, provider.CreatePod(context.TODO(), pod1))
+	assert.NoError(t, provider.CreatePod(context.TODO(), pod2))
+	assert.Equal(t, []string{model.PodKeyAll + "/shared", "ns/pod1/pod1-biz", "ns/pod2/pod2-biz"}, tl.started)
+	assert.Equal(t, []string{"ns/pod1", "ns/pod2"}, provider.sharedBizStore.GetPodKeys(utils.GetBizUniqueKey(&pod1.Spec.Containers[0])))
+
+	// one status update fanned out to every pod
+	notified = notified[:0]
+	provider.SyncBizStatusToKube(context.TODO(), model.BizStatusData{
+		Key:        utils.GetBizUniqueKey(&pod1.Spec.Containers[0]),
+		Name:       "shared",
+		PodKey:     model.PodKeyAll,
+		State:      string(model.BizStateActivated),
+		ChangeTime: time.Now(),
+	})
+	assert.Len(t, notified, 2)
+	for _, pod := range notified {
+		assert.NotNil(t, pod.Status.ContainerStatuses[0].State.Running)
+	}
+
+	// uninstalled only on last release
+	assert.NoError(t, provider.DeletePod(context.TODO(), pod1))
+	assert.Equal(t, []string{"ns/pod1/pod1-biz"}, tl.stopped)
+	assert.NoError(t, provider.DeletePod(context.TODO(), pod2))
+	assert.Equal(t, []string{"ns/pod1/pod1-biz", model.PodKeyAll + "/shared", "ns/pod2/pod2-biz"}, tl.stopped)
+	assert.False(t, provider.sharedBizStore.IsShared(utils.GetBizUniqueKey(&pod1.Spec.Containers[0])))
+}
+
+func TestBizDependencyOrder(t *testing.T) {
+	tl := &sharedBizMockTunnel{}
+	recorder := record.NewFakeRecorder(10)
+	provider := NewVPodProvider("default", "127.0.0.1", "vnode.test", nil, recorder, nil, tl)
+	provider.NotifyPods(context.TODO(), func(pod *corev1.Pod) {})
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "pod",
+			Namespace:         "ns",
+			CreationTimestamp: metav1.Now(),
+			Annotations:       map[string]string{model.AnnotationKeyOfBizDependencies: `{"web":["core"],"core":["base"]}`},
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy: corev1.RestartPolicyNever,
+			Containers: []corev1.Container{
+				{Name: "web", Image: "web.jar"},
+				{Name: "core", Image: "core.jar"},
+				{Name: "base", Image: "base.jar"},
+			},
+		},
+	}
+	activate := func(name string, changeTime time.Time) {
+		provider.SyncBizStatusToKube(context.TODO(), model.BizStatusData{
+			Key:        utils.GetBizIdentity(name, ""),
+			Name:       name,
+			PodKey:     "ns/pod",
+			State:      string(model.BizStateActivated),
+			ChangeTime: changeTime,
+		})
+	}
+
+	// started one by one, each after the previous one activated
+	assert.NoError(t, provider.CreatePod(context.TODO(), pod))
+	assert.Equal(t, []string{"ns/pod/base"}, tl.started)
+	// the bizs waiting in the start chain are not restarted
+	pod.Spec.RestartPolicy = corev1.RestartPolicyAlways
+	provider.checkAndRestartBiz(context.TODO(), pod, model.BizStatusData{Name: "core", State: string(model.BizStateStopped)})
+	assert.False(t, provider.bizRestartStore.IsBackingOff("ns/pod/core"))
+	pod.Spec.RestartPolicy = corev1.RestartPolicyNever
+	activate("web", time.Now())
+	assert.Equal(t, []string{"ns/pod/base"}, tl.started)
+	activate("base", time.Now().Add(time.Second))
+	assert.Equal(t, []string{"ns/pod/base", "ns/pod/core"}, tl.started)
+	activate("core", time.Now().Add(2*time.Second))
+	assert.Equal(t, []string{"ns/pod/base", "ns/pod/core", "ns/pod/web"}, tl.started)
+
+	// stopped one by one in reverse order, each after the previous one deactivated
+	assert.NoError(t, provider.DeletePod(context.TODO(), pod))
+	assert.Equal(t, []string{"ns/pod/web"}, tl.stopped)
+	assert.True(t, provider.HasPendingBizOperation())
+	provider.SyncBizStatusToKube(context.TODO(), model.BizStatusData{
+		Key:        utils.GetBizIdentity("web", ""),
+		Name:       "web",
+		PodKey:     "ns/pod",
+		State:      string(model.BizStateDeactivated),
+		ChangeTime: time.Now().Add(3 * time.Second),
+	})
+	assert.Equal(t, []string{"ns/pod/web", "ns/pod/core"}, tl.stopped)
+	// the biz not reported by the full status is uninstalled
+	provider.SyncAllBizStatusToKube(context.TODO(), []model.BizStatusData{{
+		Key:        utils.GetBizIdentity("base", ""),
+		Name:       "base",
+		PodKey:     "ns/pod",
+		State:      string(model.BizStateActivated),
+		ChangeTime: time.Now().Add(4 * time.Second),
+	}})
+	assert.Equal(t, []string{"ns/pod/web", "ns/pod/core", "ns/pod/base"}, tl.stopped)
+	assert.True(t, provider.HasPendingBizOperation())
+	provider.SyncBizStatusToKube(context.TODO(), model.BizStatusData{
+		Key:        utils.GetBizIdentity("base", ""),
+		Name:       "base",
+		PodKey:     "ns/pod",
+		State:      string(model.BizStateUnResolved),
+		ChangeTime: time.Now().Add(5 * time.Second),
+	})
+	assert.False(t, provider.bizStartStore.HasPendingStop())
+
+	// invalid dependencies are ignored
+	tl.started, tl.stopped = nil, nil
+	pod.Annotations[model.AnnotationKeyOfBizDependencies] = `{"web":["core"],"core":["web"]}`
+	assert.NoError(t, provider.CreatePod(context.TODO(), pod))
+	assert.Equal(t, []string{"ns/pod/web", "ns/pod/core", "ns/pod/base"}, tl.started)
+	assert.Contains(t, <-recorder.Events, podEventInvalidBizDependencies)
+	// and the bizs are stopped as a batch in the declared order
+	assert.NoError(t, provider.DeletePod(context.TODO(), pod))
+	assert.Equal(t, []string{"ns/pod/web", "ns/pod/core", "ns/pod/base"}, tl.stopped)
+}
+
+func TestInitBizs(t *testing.T) {
+	tl := &sharedBizMockTunnel{}
+	provider := NewVPodProvider("default", "127.0.0.1", "vnode.test", nil, nil, nil, tl)
+	provider.NotifyPods(context.TODO(), func(pod *corev1.Pod) {})
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "pod",
+			Namespace:         "ns",
+			CreationTimestamp: metav1.Now(),
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy: corev1.RestartPolicyNever,
+			InitContainers: []corev1.Container{
+				{Name: "migrate", Image: "migrate.jar"},
+				{Name: "warmup", Image: "warmup.jar"},
+			},
+			Containers: []corev1.Container{
+				{Name: "web", Image: "web.jar"},
+				{Name: "core", Image: "core.jar"},
+			},
+		},
+	}
+	changeTime := time.Now()
+	sync := func(name string, state model.BizState) *corev1.Pod {
+		changeTime = changeTime.Add(time.Second)
+		provider.SyncBizStatusToKube(context.TODO(), model.BizStatusData{
+			Key:        utils.GetBizIdentity(name, ""),
+			Name:       name,
+			PodKey:     "ns/pod",
+			State:      string(state),
+			ChangeTime: changeTime,
+		})
+		return provider.vPodStore.GetPodByKey("ns/pod")
+	}
+	getCondition := func(pod *corev1.Pod, conditionType corev1.PodConditionType) corev1.PodCondition {
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == conditionType {
+				return condition
+			}
+		}
+		return corev1.PodCondition{}
+	}
+
+	// the init bizs run one by one before the bizs, each stopped once activated
+	assert.NoError(t, provider.CreatePod(context.TODO(), pod))
+	assert.Equal(t, []string{"ns/pod/migrate"}, tl.started)
+
+	current := sync("migrate", model.BizStateActivated)
+	assert.Equal(t, []string{"ns/pod/migrate"}, tl.started)
+	assert.Equal(t, []string{"ns/pod/migrate"}, tl.stopped)
+	assert.Equal(t, corev1.PodPending, current.Status.Phase)
+	assert.Len(t, current.Status.InitContainerStatuses, 2)
+	assert.NotNil(t, current.Status.InitContainerStatuses[0].State.Running)
+	assert.False(t, utils.IsInitContainerCompleted(&current.Status.InitContainerStatuses[0]))
+
+	// and completed once deactivated
+	current = sync("migrate", model.BizStateDeactivated)
+	assert.Equal(t, []string{"ns/pod/migrate", "ns/pod/warmup"}, tl.started)
+	assert.Equal(t, corev1.PodPending, current.Status.Phase)
+	assert.Equal(t, corev1.ConditionFalse, getCondition(current, corev1.PodInitialized).Status)
+	assert.True(t, utils.IsInitContainerCompleted(&current.Status.InitContainerStatuses[0]))
+	assert.Equal(t, model.ContainerReasonPodInitializing, current.Status.ContainerStatuses[0].State.Waiting.Reason)
+
+	sync("warmup", model.BizStateActivated)
+	assert.Equal(t, []string{"ns/pod/migrate", "ns/pod/warmup"}, tl.started)
+	assert.Equal(t, []string{"ns/pod/migrate", "ns/pod/warmup"}, tl.stopped)
+	current = sync("warmup", model.BizStateUnResolved)
+	assert.Equal(t, []string{"ns/pod/migrate", "ns/pod/warmup", "ns/pod/web", "ns/pod/core"}, tl.started)
+	assert.Equal(t, corev1.ConditionTrue, getCondition(current, corev1.PodInitialized).Status)
+
+	// the completed init bizs are not restarted
+	current = sync("migrate", model.BizStateStopped)
+	assert.True(t, utils.IsInitContainerCompleted(&current.Status.InitContainerStatuses[0]))
+	assert.False(t, provider.bizRestartStore.IsBackingOff("ns/pod/migrate"))
+
+	sync("web", model.BizStateActivated)
+	current = sync("core", model.BizStateActivated)
+	assert.Equal(t, corev1.PodRunning, current.Status.Phase)
+	assert.Equal(t, corev1.ConditionTrue, getCondition(current, corev1.PodReady).Status)
+
+	// the completed init bizs are not stopped again with the pod
+	tl.stopped = nil
+	assert.NoError(t, provider.DeletePod(context.TODO(), current))
+	assert.Equal(t, []string{"ns/pod/web", "ns/pod/core"}, tl.stopped)
+
+	// the init biz stopped after activated is not restarted
+	tl.started = nil
+	pod.Spec.RestartPolicy = corev1.RestartPolicyOnFailure
+	assert.NoError(t, provider.CreatePod(context.TODO(), pod))
+	sync("migrate", model.BizStateActivated)
+	current = sync("migrate", model.BizStateDeactivated)
+	assert.True(t, utils.IsInitContainerCompleted(&current.Status.InitContainerStatuses[0]))
+	assert.False(t, provider.bizRestartStore.IsBackingOff("ns/pod/migrate"))
+	assert.NoError(t, provider.DeletePod(context.TODO(), current))
+
+	// a broken init biz fails the pod never restarted
+	tl.started = nil
+	pod.Spec.RestartPolicy = corev1.RestartPolicyNever
+	assert.NoError(t, provider.CreatePod(context.TODO(), pod))
+	current = sync("migrate", model.BizStateBroken)
+	assert.Equal(t, corev1.PodFailed, current.Status.Phase)
+	assert.Equal(t, []string{"ns/pod/migrate"}, tl.started)
+}
+
+type replaceBizMockTunnel struct {
+	sharedBizMockTunnel
+
+	replaced []string
+}
+
+func (t *replaceBizMockTunnel) ReplaceBiz(_, podKey string, oldContainer, newContainer *corev1.Container) (string, error) {
+	t.replaced = append(t.replaced, podKey+"/"+utils.GetBizUniqueKey(oldContainer)+"->"+utils.GetBizUniqueKey(newContainer))
+	return "replace-" + strconv.Itoa(len(t.replaced)), nil
+}
+
+func TestUpdatePod_Upgrade(t *testing.T) {
+	newVersionedPod := func(name string, strategy model.UpgradeStrategy, version string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         "ns",
+				CreationTimestamp: metav1.Now(),
+				Annotations:       map[string]string{model.AnnotationKeyOfUpgradeStrategy: string(strategy)},
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{Name: "core", Image: "core.jar", Env: []corev1.EnvVar{{Name: "BIZ_VERSION", Value: version}}},
+					{Name: "web", Image: "web.jar", Env: []corev1.EnvVar{{Name: "BIZ_VERSION", Value: version}}},
+				},
+			},
+		}
+	}
+	changeTime := time.Now()
+	sync := func(provider *VPodProvider, podKey, name, version string, state model.BizState) {
+		changeTime = changeTime.Add(time.Second)
+		provider.SyncBizStatusToKube(context.TODO(), model.BizStatusData{
+			Key:        utils.GetBizIdentity(name, version),
+			Name:       name,
+			PodKey:     podKey,
+			State:      string(state),
+			ChangeTime: changeTime,
+		})
+	}
+	hasEvent := func(recorder *record.FakeRecorder, reason string) bool {
+		for {
+			select {
+			case event := <-recorder.Events:
+				if strings.Contains(event, reason) {
+					return true
+				}
+			default:
+				return false
+			}
+		}
+	}
+
+	t.Run("StopThenStart", func(t *testing.T) {
+		tl := &sharedBizMockTunnel{}
+		recorder := record.NewFakeRecorder(100)
+		provider := NewVPodProvider("default", "127.0.0.1", "vnode.test", nil, recorder, nil, tl)
+		provider.NotifyPods(context.TODO(), func(pod *corev1.Pod) {})
+		assert.NoError(t, provider.CreatePod(context.TODO(), newVersionedPod("pod", "", "1")))
+		sync(provider, "ns/pod", "core", "1", model.BizStateActivated)
+		tl.started = nil
+
+		// the new biz is started once the old one stopped
+		assert.NoError(t, provider.UpdatePod(context.TODO(), newVersionedPod("pod", "", "2")))
+		assert.Equal(t, []string{"ns/pod/core"}, tl.stopped)
+		assert.Empty(t, tl.started)
+		provider.SyncBizOperationResponse(context.TODO(), model.BizOperationResponse{OperationID: "stop-1", Type: model.BizOperationStop, Success: true})
+		assert.Equal(t, []string{"ns/pod/core"}, tl.started)
+
+		// the status of the replaced biz is ignored
+		sync(provider, "ns/pod", "core", "2", model.BizStateResolved)
+		sync(provider, "ns/pod", "core", "1", model.BizStateStopped)
+		assert.Nil(t, provider.vPodStore.GetPodByKey("ns/pod").Status.ContainerStatuses[0].State.Terminated)
+
+		// the next biz is upgraded once the new one activated
+		sync(provider, "ns/pod", "core", "2", model.BizStateActivated)
+		assert.True(t, hasEvent(recorder, podEventBizUpgraded))
+		assert.Equal(t, []string{"ns/pod/core", "ns/pod/web"}, tl.stopped)
+		provider.SyncBizOperationResponse(context.TODO(), model.BizOperationResponse{OperationID: "stop-2", Type: model.BizOperationStop, Success: true})
+		sync(provider, "ns/pod", "web", "2", model.BizStateActivated)
+		assert.Equal(t, []string{"ns/pod/core", "ns/pod/web"}, tl.started)
+		_, upgrading := provider.bizUpgradeStore.GetUpgrade("ns/pod")
+		assert.False(t, upgrading)
+	})
+
+	t.Run("StartThenStop", func(t *testing.T) {
+		tl := &sharedBizMockTunnel{}
+		recorder := record.NewFakeRecorder(100)
+		provider := NewVPodProvider("default", "127.0.0.1", "vnode.test", nil, recorder, nil, tl)
+		provider.NotifyPods(context.TODO(), func(pod *corev1.Pod) {})
+		assert.NoError(t, provider.CreatePod(context.TODO(), newVersionedPod("pod", model.UpgradeStrategyStartThenStop, "1")))
+		tl.started = nil
+
+		// the old biz is stopped once the new one activated
+		assert.NoError(t, provider.UpdatePod(context.TODO(), newVersionedPod("pod", model.UpgradeStrategyStartThenStop, "2")))
+		assert.Equal(t, []string{"ns/pod/core"}, tl.started)
+		assert.Empty(t, tl.stopped)
+		sync(provider, "ns/pod", "core", "2", model.BizStateActivated)
+		assert.Equal(t, []string{"ns/pod/core"}, tl.stopped)
+		assert.Equal(t, []string{"ns/pod/core", "ns/pod/web"}, tl.started)
+
+		// the old biz keeps running when the new one broken, and is stopped with the pod
+		sync(provider, "ns/pod", "web", "2", model.BizStateBroken)
+		assert.True(t, hasEvent(recorder, podEventBizUpgradeFailed))
+		assert.Equal(t, []string{"ns/pod/core"}, tl.stopped)
+		assert.NoError(t, provider.DeletePod(context.TODO(), newVersionedPod("pod", model.UpgradeStrategyStartThenStop, "2")))
+		assert.Equal(t, []string{"ns/pod/core", "ns/pod/core", "ns/pod/web", "ns/pod/web"}, tl.stopped)
+	})
+
+	t.Run("PersistAndResume", func(t *testing.T) {
+		getUpgradedCondition := func(provider *VPodProvider) corev1.PodCondition {
+			for _, condition := range provider.vPodStore.GetPodByKey("ns/pod").Status.Conditions {
+				if condition.Type == model.PodConditionBizUpgraded {
+					return condition
+				}
+			}
+			return corev1.PodCondition{}
+		}
+		persister := NewFileVPodStorePersister(t.TempDir())
+		store := NewPersistentVPodStore("vnode.test", persister)
+		tl := &sharedBizMockTunnel{}
+		provider := NewVPodProvider("default", "127.0.0.1", "vnode.test", nil, record.NewFakeRecorder(100), nil, tl)
+		provider.vPodStore = store
+		provider.NotifyPods(context.TODO(), func(pod *corev1.Pod) {})
+		assert.NoError(t, provider.CreatePod(context.TODO(), newVersionedPod("pod", model.UpgradeStrategyStartThenStop, "1")))
+
+		// the progress is surfaced by the condition and the state is recorded on the vpod
+		assert.NoError(t, provider.UpdatePod(context.TODO(), newVersionedPod("pod", model.UpgradeStrategyStartThenStop, "2")))
+		condition := getUpgradedCondition(provider)
+		assert.Equal(t, corev1.ConditionFalse, condition.Status)
+		assert.Equal(t, podEventBizUpgrading, condition.Reason)
+		assert.Contains(t, condition.Message, "(1/2)")
+		assert.Contains(t, provider.vPodStore.GetPodByKey("ns/pod").Annotations, model.AnnotationKeyOfBizUpgradesState)
+		assert.NoError(t, store.Snapshot(context.TODO()))
+
+		// the restarted vk resumes the upgrade, the new biz started is not started again
+		resumedTl := &sharedBizMockTunnel{}
+		resumed := NewVPodProvider("default", "127.0.0.1", "vnode.test", nil, record.NewFakeRecorder(100), nil, resumedTl)
+		resumed.vPodStore = NewPersistentVPodStore("vnode.test", persister)
+		resumed.NotifyPods(context.TODO(), func(pod *corev1.Pod) {})
+		assert.NoError(t, resumed.RestorePods(context.TODO()))
+		resumed.ResumeBizUpgrades(context.TODO())
+		assert.Empty(t, resumedTl.started)
+		assert.True(t, resumed.bizUpgradeStore.IsReplaced("ns/pod", "core:1"))
+
+		// the new biz activated before the restart is checked with the full status
+		resumed.SyncAllBizStatusToKube(context.TODO(), []model.BizStatusData{
+			{Key: "core:1", Name: "core", PodKey: "ns/pod", State: string(model.BizStateActivated), ChangeTime: changeTime},
+			{Key: "core:2", Name: "core", PodKey: "ns/pod", State: string(model.BizStateActivated), ChangeTime: changeTime},
+			{Key: "web:1", Name: "web", PodKey: "ns/pod", State: string(model.BizStateActivated), ChangeTime: changeTime},
+		})
+		assert.Equal(t, []string{"ns/pod/core"}, resumedTl.stopped)
+		assert.Equal(t, []string{"ns/pod/web"}, resumedTl.started)
+		assert.Contains(t, getUpgradedCondition(resumed).Message, "(2/2)")
+
+		sync(resumed, "ns/pod", "web", "2", model.BizStateActivated)
+		condition = getUpgradedCondition(resumed)
+		assert.Equal(t, corev1.ConditionTrue, condition.Status)
+		assert.Equal(t, podEventBizUpgraded, condition.Reason)
+		state, has := resumed.bizUpgradeStore.GetState("ns/pod")
+		assert.True(t, has)
+		assert.Empty(t, state.Upgrades)
+
+		// the upgrade failed is surfaced too
+		assert.NoError(t, resumed.UpdatePod(context.TODO(), newVersionedPod("pod", model.UpgradeStrategyStartThenStop, "3")))
+		sync(resumed, "ns/pod", "core", "3", model.BizStateBroken)
+		condition = getUpgradedCondition(resumed)
+		assert.Equal(t, corev1.ConditionFalse, condition.Status)
+		assert.Equal(t, podEventBizUpgradeFailed, condition.Reason)
+	})
+
+	t.Run("HotReplace", func(t *testing.T) {
+		tl := &replaceBizMockTunnel{}
+		recorder := record.NewFakeRecorder(100)
+		provider := NewVPodProvider("default", "127.0.0.1", "vnode.test", nil, recorder, nil, tl)
+		provider.NotifyPods(context.TODO(), func(pod *corev1.Pod) {})
+		assert.NoError(t, provider.CreatePod(context.TODO(), newVersionedPod("pod", model.UpgradeStrategyHotReplace, "1")))
+
+		assert.NoError(t, provider.UpdatePod(context.TODO(), newVersionedPod("pod", model.UpgradeStrategyHotReplace, "2")))
+		assert.Equal(t, []string{"ns/pod/core:1->core:2"}, tl.replaced)
+		sync(provider, "ns/pod", "core", "2", model.BizStateActivated)
+		assert.Equal(t, []string{"ns/pod/core:1->core:2", "ns/pod/web:1->web:2"}, tl.replaced)
+
+		// the failed replacement marks the new biz broken and aborts the upgrade
+		provider.SyncBizOperationResponse(context.TODO(), model.BizOperationResponse{OperationID: "replace-2", Type: model.BizOperationReplace, Success: false, Message: "conflict"})
+		assert.True(t, hasEvent(recorder, podEventBizUpgradeFailed))
+		_, upgrading := provider.bizUpgradeStore.GetUpgrade("ns/pod")
+		assert.False(t, upgrading)
+		assert.Empty(t, tl.stopped)
+	})
+}
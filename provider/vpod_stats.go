@@ -0,0 +1,246 @@
+/**
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package provider
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/koupleless/virtual-kubelet/common/utils"
+	"github.com/koupleless/virtual-kubelet/model"
+	"github.com/koupleless/virtual-kubelet/tunnel"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"github.com/virtual-kubelet/virtual-kubelet/node/api/statsv1alpha1"
+
+	dto "github.com/prometheus/client_model/go"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+// Summary:
+// This file builds the kubelet Summary API and the resource metrics of the vpods from the biz stats reported by the tunnel,
+// so metrics-server can scrape the bizs like normal containers, which enables kubectl top and HPA of the vpods.
+// The thread count of the bizs is reported as the process count of the pods, as a biz runs in the threads of the base.
+
+const (
+	metricNodeCPUUsage              = "node_cpu_usage_seconds_total"
+	metricNodeMemoryWorkingSet      = "node_memory_working_set_bytes"
+	metricPodCPUUsage               = "pod_cpu_usage_seconds_total"
+	metricPodMemoryWorkingSet       = "pod_memory_working_set_bytes"
+	metricContainerCPUUsage         = "container_cpu_usage_seconds_total"
+	metricContainerMemoryWorkingSet = "container_memory_working_set_bytes"
+	metricContainerStartTime        = "container_start_time_seconds"
+	metricScrapeError               = "scrape_error"
+)
+
+// GetStatsSummary returns the stats summary of the vnode and its vpods, built from the biz stats reported by the tunnel
+func (b *VPodProvider) GetStatsSummary(ctx context.Context) (*statsv1alpha1.Summary, error) {
+	statsProvider, ok := b.tunnel.(tunnel.BizStatsProvider)
+	if !ok {
+		return nil, errdefs.InvalidInputf("stats are not supported by tunnel %s", b.tunnel.Key())
+	}
+	bizStats, err := statsProvider.GetBizStats(ctx, b.nodeName)
+	if err != nil {
+		return nil, err
+	}
+
+	now := metav1.Now()
+	summary := &statsv1alpha1.Summary{
+		Node: statsv1alpha1.NodeStats{
+			NodeName: b.nodeName,
+			CPU:      &statsv1alpha1.CPUStats{Time: now, UsageNanoCores: ptr.To(uint64(0)), UsageCoreNanoSeconds: ptr.To(uint64(0))},
+			Memory:   &statsv1alpha1.MemoryStats{Time: now, UsageBytes: ptr.To(uint64(0)), WorkingSetBytes: ptr.To(uint64(0))},
+		},
+		Pods: make([]statsv1alpha1.PodStats, 0),
+	}
+
+	podKeyToStats := b.groupBizStatsByPod(bizStats)
+	for _, pod := range b.vPodStore.GetPods() {
+		stats, has := podKeyToStats[utils.GetPodKey(pod)]
+		if !has {
+			continue
+		}
+		podStats := buildPodStats(pod, stats, now)
+		addCPUStats(summary.Node.CPU, podStats.CPU)
+		addMemoryStats(summary.Node.Memory, podStats.Memory)
+		summary.Pods = append(summary.Pods, podStats)
+	}
+	return summary, nil
+}
+
+// GetMetricsResource returns the resource metrics of the vnode and its vpods in the format of kubelet /metrics/resource
+func (b *VPodProvider) GetMetricsResource(ctx context.Context) ([]*dto.MetricFamily, error) {
+	summary, err := b.GetStatsSummary(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return convertSummaryToMetricFamilies(summary), nil
+}
+
+// groupBizStatsByPod groups the biz stats by the pod key, the stats without pod key are matched to the pods by the biz key
+func (b *VPodProvider) groupBizStatsByPod(bizStats []model.BizStatsData) map[string][]model.BizStatsData {
+	bizKeyToPodKey := make(map[string]string)
+	for _, pod := range b.vPodStore.GetPods() {
+		for _, container := range b.bizContainers(pod.Spec.Containers) {
+			bizKeyToPodKey[b.tunnel.GetBizUniqueKey(&container)] = utils.GetPodKey(pod)
+		}
+	}
+
+	podKeyToStats := make(map[string][]model.BizStatsData)
+	for _, stats := range bizStats {
+		podKey := stats.PodKey
+		if podKey == "" {
+			podKey = bizKeyToPodKey[stats.Key]
+		}
+		if podKey == "" {
+			continue
+		}
+		podKeyToStats[podKey] = append(podKeyToStats[podKey], stats)
+	}
+	return podKeyToStats
+}
+
+// buildPodStats builds the stats of the pod, which is the sum of the stats of its bizs
+func buildPodStats(pod *corev1.Pod, bizStats []model.BizStatsData, now metav1.Time) statsv1alpha1.PodStats {
+	podStats := statsv1alpha1.PodStats{
+		PodRef: statsv1alpha1.PodReference{
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+			UID:       string(pod.UID),
+		},
+		StartTime:    pod.CreationTimestamp,
+		Containers:   make([]statsv1alpha1.ContainerStats, 0, len(bizStats)),
+		CPU:          &statsv1alpha1.CPUStats{Time: now, UsageNanoCores: ptr.To(uint64(0)), UsageCoreNanoSeconds: ptr.To(uint64(0))},
+		Memory:       &statsv1alpha1.MemoryStats{Time: now, UsageBytes: ptr.To(uint64(0)), WorkingSetBytes: ptr.To(uint64(0))},
+		ProcessStats: &statsv1alpha1.ProcessStats{ProcessCount: ptr.To(uint64(0))},
+	}
+	if pod.Status.StartTime != nil {
+		podStats.StartTime = *pod.Status.StartTime
+	}
+
+	for _, stats := range bizStats {
+		sampleTime := now
+		if !stats.Time.IsZero() {
+			sampleTime = metav1.NewTime(stats.Time)
+		}
+		containerStats := statsv1alpha1.ContainerStats{
+			Name:      stats.Name,
+			StartTime: metav1.NewTime(stats.StartTime),
+			CPU: &statsv1alpha1.CPUStats{
+				Time:                 sampleTime,
+				UsageNanoCores:       ptr.To(stats.CPUUsageNanoCores),
+				UsageCoreNanoSeconds: ptr.To(stats.CPUUsageCoreNanoSeconds),
+			},
+			Memory: &statsv1alpha1.MemoryStats{
+				Time:            sampleTime,
+				UsageBytes:      ptr.To(stats.MemoryUsageBytes),
+				WorkingSetBytes: ptr.To(stats.MemoryWorkingSetBytes),
+			},
+		}
+		if stats.StartTime.IsZero() {
+			containerStats.StartTime = podStats.StartTime
+		}
+		addCPUStats(podStats.CPU, containerStats.CPU)
+		addMemoryStats(podStats.Memory, containerStats.Memory)
+		*podStats.ProcessStats.ProcessCount += stats.ThreadCount
+		podStats.Containers = append(podStats.Containers, containerStats)
+	}
+	sort.Slice(podStats.Containers, func(i, j int) bool {
+		return podStats.Containers[i].Name < podStats.Containers[j].Name
+	})
+	return podStats
+}
+
+// addCPUStats adds the cpu usage of src to dst
+func addCPUStats(dst, src *statsv1alpha1.CPUStats) {
+	*dst.UsageNanoCores += *src.UsageNanoCores
+	*dst.UsageCoreNanoSeconds += *src.UsageCoreNanoSeconds
+}
+
+// addMemoryStats adds the memory usage of src to dst
+func addMemoryStats(dst, src *statsv1alpha1.MemoryStats) {
+	*dst.UsageBytes += *src.UsageBytes
+	*dst.WorkingSetBytes += *src.WorkingSetBytes
+}
+
+// convertSummaryToMetricFamilies converts the stats summary to the metric families served by kubelet /metrics/resource
+func convertSummaryToMetricFamilies(summary *statsv1alpha1.Summary) []*dto.MetricFamily {
+	nodeCPUUsage := newMetricFamily(metricNodeCPUUsage, "Cumulative cpu time consumed by the node in core-seconds", dto.MetricType_COUNTER)
+	nodeMemoryWorkingSet := newMetricFamily(metricNodeMemoryWorkingSet, "Current working set of the node in bytes", dto.MetricType_GAUGE)
+	podCPUUsage := newMetricFamily(metricPodCPUUsage, "Cumulative cpu time consumed by the pod in core-seconds", dto.MetricType_COUNTER)
+	podMemoryWorkingSet := newMetricFamily(metricPodMemoryWorkingSet, "Current working set of the pod in bytes", dto.MetricType_GAUGE)
+	containerCPUUsage := newMetricFamily(metricContainerCPUUsage, "Cumulative cpu time consumed by the container in core-seconds", dto.MetricType_COUNTER)
+	containerMemoryWorkingSet := newMetricFamily(metricContainerMemoryWorkingSet, "Current working set of the container in bytes", dto.MetricType_GAUGE)
+	containerStartTime := newMetricFamily(metricContainerStartTime, "Start time of the container since unix epoch in seconds", dto.MetricType_GAUGE)
+	scrapeError := newMetricFamily(metricScrapeError, "1 if there was an error while getting container metrics, 0 otherwise", dto.MetricType_GAUGE)
+
+	addMetric(nodeCPUUsage, nil, cpuSeconds(summary.Node.CPU), summary.Node.CPU.Time.Time)
+	addMetric(nodeMemoryWorkingSet, nil, float64(*summary.Node.Memory.WorkingSetBytes), summary.Node.Memory.Time.Time)
+	for _, podStats := range summary.Pods {
+		podLabels := map[string]string{"namespace": podStats.PodRef.Namespace, "pod": podStats.PodRef.Name}
+		addMetric(podCPUUsage, podLabels, cpuSeconds(podStats.CPU), podStats.CPU.Time.Time)
+		addMetric(podMemoryWorkingSet, podLabels, float64(*podStats.Memory.WorkingSetBytes), podStats.Memory.Time.Time)
+		for _, containerStats := range podStats.Containers {
+			containerLabels := map[string]string{"container": containerStats.Name, "namespace": podStats.PodRef.Namespace, "pod": podStats.PodRef.Name}
+			addMetric(containerCPUUsage, containerLabels, cpuSeconds(containerStats.CPU), containerStats.CPU.Time.Time)
+			addMetric(containerMemoryWorkingSet, containerLabels, float64(*containerStats.Memory.WorkingSetBytes), containerStats.Memory.Time.Time)
+			addMetric(containerStartTime, containerLabels, float64(containerStats.StartTime.Unix()), time.Time{})
+		}
+	}
+	addMetric(scrapeError, nil, 0, time.Time{})
+
+	return []*dto.MetricFamily{
+		containerCPUUsage, containerMemoryWorkingSet, containerStartTime,
+		nodeCPUUsage, nodeMemoryWorkingSet, podCPUUsage, podMemoryWorkingSet, scrapeError,
+	}
+}
+
+// newMetricFamily creates an empty metric family
+func newMetricFamily(name, help string, metricType dto.MetricType) *dto.MetricFamily {
+	return &dto.MetricFamily{
+		Name: ptr.To(name),
+		Help: ptr.To(help),
+		Type: ptr.To(metricType),
+	}
+}
+
+// addMetric adds a sample to the metric family, the timestamp is omitted if zero
+func addMetric(family *dto.MetricFamily, labels map[string]string, value float64, timestamp time.Time) {
+	metric := &dto.Metric{}
+	labelNames := make([]string, 0, len(labels))
+	for name := range labels {
+		labelNames = append(labelNames, name)
+	}
+	sort.Strings(labelNames)
+	for _, name := range labelNames {
+		metric.Label = append(metric.Label, &dto.LabelPair{Name: ptr.To(name), Value: ptr.To(labels[name])})
+	}
+	if family.GetType() == dto.MetricType_COUNTER {
+		metric.Counter = &dto.Counter{Value: ptr.To(value)}
+	} else {
+		metric.Gauge = &dto.Gauge{Value: ptr.To(value)}
+	}
+	if !timestamp.IsZero() {
+		metric.TimestampMs = ptr.To(timestamp.UnixMilli())
+	}
+	family.Metric = append(family.Metric, metric)
+}
+
+// cpuSeconds returns the cumulative cpu usage in core seconds
+func cpuSeconds(cpu *statsv1alpha1.CPUStats) float64 {
+	return float64(*cpu.UsageCoreNanoSeconds) / float64(time.Second)
+}
@@ -0,0 +1,92 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/koupleless/virtual-kubelet/model"
+	"github.com/koupleless/virtual-kubelet/tunnel"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type statsMockTunnel struct {
+	tunnel.MockTunnel
+	stats []model.BizStatsData
+}
+
+func (m *statsMockTunnel) GetBizStats(_ context.Context, _ string) ([]model.BizStatsData, error) {
+	return m.stats, nil
+}
+
+func TestGetStatsSummary(t *testing.T) {
+	provider := NewVPodProvider("default", "127.0.0.1", "vnode.test", nil, nil, nil, &tunnel.MockTunnel{})
+	_, err := provider.GetStatsSummary(context.TODO())
+	assert.Error(t, err)
+
+	biz1 := corev1.Container{Name: "biz1", Image: "biz1.jar", Env: []corev1.EnvVar{{Name: "BIZ_VERSION", Value: "1.0.0"}}}
+	biz2 := corev1.Container{Name: "biz2", Image: "biz2.jar", Env: []corev1.EnvVar{{Name: "BIZ_VERSION", Value: "1.0.0"}}}
+	tl := &statsMockTunnel{}
+	tl.stats = []model.BizStatsData{
+		{
+			Key:                     tl.GetBizUniqueKey(&biz1),
+			Name:                    "biz1",
+			Time:                    time.Now(),
+			CPUUsageNanoCores:       100,
+			CPUUsageCoreNanoSeconds: uint64(2 * time.Second),
+			MemoryWorkingSetBytes:   1024,
+			ThreadCount:             10,
+		},
+		{
+			Key:                     tl.GetBizUniqueKey(&biz2),
+			Name:                    "biz2",
+			PodKey:                  "ns/pod",
+			CPUUsageNanoCores:       200,
+			CPUUsageCoreNanoSeconds: uint64(time.Second),
+			MemoryWorkingSetBytes:   2048,
+			ThreadCount:             5,
+		},
+		{
+			Key:  "unknown",
+			Name: "unknown",
+		},
+	}
+	provider = NewVPodProvider("default", "127.0.0.1", "vnode.test", nil, nil, nil, tl)
+	provider.vPodStore.PutPod(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pod",
+			Namespace: "ns",
+			UID:       "uid",
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{biz1, biz2},
+		},
+	})
+
+	summary, err := provider.GetStatsSummary(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, "vnode.test", summary.Node.NodeName)
+	assert.Equal(t, uint64(300), *summary.Node.CPU.UsageNanoCores)
+	assert.Len(t, summary.Pods, 1)
+	podStats := summary.Pods[0]
+	assert.Equal(t, "uid", podStats.PodRef.UID)
+	assert.Len(t, podStats.Containers, 2)
+	assert.Equal(t, "biz1", podStats.Containers[0].Name)
+	assert.Equal(t, uint64(3072), *podStats.Memory.WorkingSetBytes)
+	assert.Equal(t, uint64(15), *podStats.ProcessStats.ProcessCount)
+
+	metricFamilies, err := provider.GetMetricsResource(context.TODO())
+	assert.NoError(t, err)
+	buffer := &bytes.Buffer{}
+	encoder := expfmt.NewEncoder(buffer, expfmt.NewFormat(expfmt.TypeTextPlain))
+	for _, family := range metricFamilies {
+		assert.NoError(t, encoder.Encode(family))
+	}
+	assert.Contains(t, buffer.String(), `container_cpu_usage_seconds_total{container="biz1",namespace="ns",pod="pod"} 2`)
+	assert.Contains(t, buffer.String(), `pod_memory_working_set_bytes{namespace="ns",pod="pod"} 3072`)
+	assert.Contains(t, buffer.String(), "node_cpu_usage_seconds_total 3")
+}
@@ -15,7 +15,7 @@
 package provider
 
 import (
-	"strings"
+	"context"
 	"sync"
 	"time"
 
@@ -24,22 +24,46 @@ import (
 	corev1 "k8s.io/api/core/v1"
 )
 
-// VPodStore provides in-memory runtime information.
-type VPodStore struct {
+// VPodStore provides the runtime information of the vpods on a vnode.
+type VPodStore interface {
+	// PutPod updates or adds a pod to the store.
+	PutPod(pod *corev1.Pod)
+	// DeletePod removes a pod from the store.
+	DeletePod(podKey string)
+	// GetPodByKey retrieves a pod by its key.
+	GetPodByKey(podKey string) *corev1.Pod
+	// GetPods retrieves all pods in the store.
+	GetPods() []*corev1.Pod
+	// CheckContainerStatusNeedSync checks whether the biz status is newer than the container status of the pod,
+	// the status of a container not classified as biz never needs sync.
+	CheckContainerStatusNeedSync(bizStatusData model.BizStatusData, bizClassifier model.BizClassifier) bool
+	// Restore loads the pods from the last snapshot which are not in the store, returns the loaded pods.
+	Restore(ctx context.Context) ([]*corev1.Pod, error)
+	// Snapshot saves the pods if changed since the last snapshot.
+	Snapshot(ctx context.Context) error
+	// Clear removes the snapshot, called when the vnode is deleted.
+	Clear(ctx context.Context) error
+}
+
+var _ VPodStore = &MemoryVPodStore{}
+
+// MemoryVPodStore provides in-memory runtime information.
+type MemoryVPodStore struct {
 	sync.RWMutex // This mutex is used for thread-safe access to the store.
 
 	podKeyToPod map[string]*corev1.Pod // Maps pod keys to their corresponding pods from provider
 }
 
-func NewVPodStore() *VPodStore {
-	return &VPodStore{
+// NewVPodStore creates a new in-memory VPodStore.
+func NewVPodStore() *MemoryVPodStore {
+	return &MemoryVPodStore{
 		RWMutex:     sync.RWMutex{},
 		podKeyToPod: make(map[string]*corev1.Pod),
 	}
 }
 
-// PutPod function updates or adds a pod to the VPodStore.
-func (r *VPodStore) PutPod(pod *corev1.Pod) {
+// PutPod function updates or adds a pod to the MemoryVPodStore.
+func (r *MemoryVPodStore) PutPod(pod *corev1.Pod) {
 	r.Lock()
 	defer r.Unlock()
 
@@ -49,8 +73,21 @@ func (r *VPodStore) PutPod(pod *corev1.Pod) {
 	r.podKeyToPod[podKey] = pod
 }
 
-// DeletePod function removes a pod from the VPodStore.
-func (r *VPodStore) DeletePod(podKey string) {
+// putPodIfAbsent adds the pod if no pod of the key is in the store, returns whether the pod is added.
+func (r *MemoryVPodStore) putPodIfAbsent(pod *corev1.Pod) bool {
+	r.Lock()
+	defer r.Unlock()
+
+	podKey := utils.GetPodKey(pod)
+	if _, has := r.podKeyToPod[podKey]; has {
+		return false
+	}
+	r.podKeyToPod[podKey] = pod
+	return true
+}
+
+// DeletePod function removes a pod from the MemoryVPodStore.
+func (r *MemoryVPodStore) DeletePod(podKey string) {
 	r.Lock()
 	defer r.Unlock()
 
@@ -58,14 +95,14 @@ func (r *VPodStore) DeletePod(podKey string) {
 }
 
 // GetPodByKey function retrieves a pod by its key.
-func (r *VPodStore) GetPodByKey(podKey string) *corev1.Pod {
+func (r *MemoryVPodStore) GetPodByKey(podKey string) *corev1.Pod {
 	r.RLock()
 	defer r.RUnlock()
 	return r.podKeyToPod[podKey]
 }
 
-// GetPods function retrieves all pods in the VPodStore.
-func (r *VPodStore) GetPods() []*corev1.Pod {
+// GetPods function retrieves all pods in the MemoryVPodStore.
+func (r *MemoryVPodStore) GetPods() []*corev1.Pod {
 	r.RLock()
 	defer r.RUnlock()
 
@@ -76,23 +113,30 @@ func (r *VPodStore) GetPods() []*corev1.Pod {
 	return ret
 }
 
-func (r *VPodStore) CheckContainerStatusNeedSync(bizStatusData model.BizStatusData) bool {
+// CheckContainerStatusNeedSync function checks whether the biz status is newer than the container status of the pod,
+// the status of a container not classified as biz never needs sync.
+func (r *MemoryVPodStore) CheckContainerStatusNeedSync(bizStatusData model.BizStatusData, bizClassifier model.BizClassifier) bool {
 	r.Lock()
 	defer r.Unlock()
 
 	if pod, found := r.podKeyToPod[bizStatusData.PodKey]; found {
 		var matchedStatus *corev1.ContainerStatus
 		var matchedContainer *corev1.Container
-		for _, status := range pod.Status.ContainerStatuses {
-			if (status.Name == bizStatusData.Name) && strings.Contains(status.Image, ".jar") {
-				matchedStatus = &status
+		for _, statuses := range [][]corev1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+			for _, status := range statuses {
+				if status.Name == bizStatusData.Name {
+					matchedStatus = &status
+				}
 			}
 		}
-		for _, container := range pod.Spec.Containers {
+		for _, container := range utils.GetPodContainers(pod) {
 			if container.Name == bizStatusData.Name {
 				matchedContainer = &container
 			}
 		}
+		if matchedContainer != nil && bizClassifier.Classify(matchedContainer) != model.ContainerTypeBiz {
+			return false
+		}
 
 		// the earliest change time of the container status when no time
 		oldChangeTime := time.Time{}
@@ -121,3 +165,18 @@ func (r *VPodStore) CheckContainerStatusNeedSync(bizStatusData model.BizStatusDa
 	// no pod found, no need to sync
 	return false
 }
+
+// Restore does nothing as the in-memory store is not persisted.
+func (r *MemoryVPodStore) Restore(_ context.Context) ([]*corev1.Pod, error) {
+	return nil, nil
+}
+
+// Snapshot does nothing as the in-memory store is not persisted.
+func (r *MemoryVPodStore) Snapshot(_ context.Context) error {
+	return nil
+}
+
+// Clear does nothing as the in-memory store is not persisted.
+func (r *MemoryVPodStore) Clear(_ context.Context) error {
+	return nil
+}
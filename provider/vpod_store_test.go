@@ -1,10 +1,14 @@
 package provider
 
 import (
+	"testing"
+	"time"
+
+	"github.com/koupleless/virtual-kubelet/common/utils"
+	"github.com/koupleless/virtual-kubelet/model"
 	"github.com/stretchr/testify/assert"
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"testing"
 )
 
 func TestVPodStore_PutPod(t *testing.T) {
@@ -85,3 +89,29 @@ func TestVPodStore_GetPods(t *testing.T) {
 	ps := store.GetPods()
 	assert.Len(t, ps, 1)
 }
+
+func TestVPodStore_CheckContainerStatusNeedSync(t *testing.T) {
+	store := NewVPodStore()
+	store.PutPod(&corev1.Pod{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      "pod1",
+			Namespace: "ns1",
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{Name: "biz", Image: "biz.jar"},
+				{Name: "sidecar", Image: "sidecar"},
+			},
+		},
+	})
+	assert.True(t, store.CheckContainerStatusNeedSync(model.BizStatusData{
+		Name:       "biz",
+		PodKey:     "ns1/pod1",
+		ChangeTime: time.Now(),
+	}, utils.DefaultBizClassifier))
+	assert.False(t, store.CheckContainerStatusNeedSync(model.BizStatusData{
+		Name:       "sidecar",
+		PodKey:     "ns1/pod1",
+		ChangeTime: time.Now(),
+	}, utils.DefaultBizClassifier))
+}
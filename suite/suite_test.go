@@ -79,24 +79,13 @@ var _ = BeforeSuite(func() {
 		Env:        env,
 		VPodType:   vPodIdentity,
 		IsCluster:  true,
-	}, &tl)
+	}, []tunnel.Tunnel{&tl})
+	Expect(err).ToNot(HaveOccurred())
 
 	err = vnodeController.SetupWithManager(ctx, k8sManager)
 
 	Expect(err).ToNot(HaveOccurred())
 
-	tunnels := []tunnel.Tunnel{
-		&tl,
-	}
-	for _, t := range tunnels {
-		err = t.Start(clientID, env)
-		if err != nil {
-			log.G(ctx).WithError(err).Error("failed to start tunnel", t.Key())
-		} else {
-			log.G(ctx).Info("Tunnel started: ", t.Key())
-		}
-	}
-
 	k8sClient = k8sManager.GetClient()
 	Expect(k8sClient).ToNot(BeNil())
 
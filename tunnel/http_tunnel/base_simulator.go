@@ -0,0 +1,218 @@
+package http_tunnel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/koupleless/virtual-kubelet/common/utils"
+	"github.com/koupleless/virtual-kubelet/model"
+	pkgerrors "github.com/pkg/errors"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+)
+
+// Summary:
+// This file implements a local base simulator speaking the HTTPTunnel protocol.
+// It pushes heartbeats to the tunnel and serves the health, biz query and biz operation endpoints in memory,
+// so that the whole VNodeController can be run end to end without a real base.
+
+// BaseSimulatorConfig is the config of a BaseSimulator
+type BaseSimulatorConfig struct {
+	BaseID            string        // Unique id of the base
+	Name              string        // Name of the base
+	Version           string        // Version of the base
+	ClusterName       string        // ClusterName of the base
+	LocalIP           string        // IP the tunnel uses to call the base, default 127.0.0.1
+	HTTPPort          int           // Port of the base http server
+	TunnelAddress     string        // Address of the HTTPTunnel heartbeat server, e.g. http://127.0.0.1:7777
+	HeartBeatInterval time.Duration // Interval of heartbeat, default 5s
+	BizActivateDelay  time.Duration // Delay of biz state turns from RESOLVED to ACTIVATED after install, default 1s
+	CPUMilliCores     int64         // CPU capacity of the base in milli cores
+	MemoryBytes       int64         // Memory capacity of the base in bytes
+}
+
+// BaseSimulator is an in memory base which talks to the HTTPTunnel
+type BaseSimulator struct {
+	sync.Mutex
+
+	config BaseSimulatorConfig
+	client *http.Client
+
+	bizKeyToBizInfo map[string]BizInfo // Maps biz identity to biz info
+}
+
+// NewBaseSimulator creates a new BaseSimulator
+func NewBaseSimulator(config BaseSimulatorConfig) *BaseSimulator {
+	if config.LocalIP == "" {
+		config.LocalIP = "127.0.0.1"
+	}
+	if config.Name == "" {
+		config.Name = config.BaseID
+	}
+	if config.HeartBeatInterval == 0 {
+		config.HeartBeatInterval = 5 * time.Second
+	}
+	if config.BizActivateDelay == 0 {
+		config.BizActivateDelay = time.Second
+	}
+	return &BaseSimulator{
+		config: config,
+		client: &http.Client{
+			Timeout: DefaultRequestTimeout,
+		},
+		bizKeyToBizInfo: make(map[string]BizInfo),
+	}
+}
+
+// Run serves the base endpoints and pushes heartbeats until the context is done,
+// a DEACTIVATED heartbeat is sent before exit
+func (b *BaseSimulator) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", b.config.HTTPPort))
+	if err != nil {
+		return pkgerrors.Wrapf(err, "failed to listen on port %d", b.config.HTTPPort)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(PathHealth, b.healthHandler)
+	mux.HandleFunc(PathQueryAllBiz, b.queryAllBizHandler)
+	mux.HandleFunc(PathInstallBiz, b.installBizHandler)
+	mux.HandleFunc(PathUninstallBiz, b.uninstallBizHandler)
+	server := &http.Server{Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		if err := b.heartBeat(model.NodeStateDeactivated); err != nil {
+			log.G(ctx).WithError(err).Error("failed to send deactivated heartbeat")
+		}
+		server.Close()
+	}()
+
+	go utils.TimedTaskWithInterval(ctx, b.config.HeartBeatInterval, func(ctx context.Context) {
+		if err := b.heartBeat(model.NodeStateActivated); err != nil {
+			log.G(ctx).WithError(err).Error("failed to send heartbeat")
+		}
+	})
+
+	log.G(ctx).Infof("base simulator %s serving on port %d", b.config.BaseID, b.config.HTTPPort)
+	if err = server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// heartBeat pushes a heartbeat with the given state to the tunnel
+func (b *BaseSimulator) heartBeat(state model.NodeState) error {
+	body, err := json.Marshal(HeartBeatData{
+		BaseID:      b.config.BaseID,
+		Name:        b.config.Name,
+		Version:     b.config.Version,
+		ClusterName: b.config.ClusterName,
+		State:       state,
+		NetworkInfo: BaseNetworkInfo{
+			LocalIP:       b.config.LocalIP,
+			LocalHostName: b.config.Name,
+			HTTPPort:      b.config.HTTPPort,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := b.client.Post(b.config.TunnelAddress+PathHeartBeat, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return pkgerrors.Errorf("heartbeat failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// healthHandler returns the configured capacity of the base
+func (b *BaseSimulator) healthHandler(w http.ResponseWriter, _ *http.Request) {
+	writeResponse(w, http.StatusOK, Response[HealthData]{
+		Code: model.CodeSuccess,
+		Data: HealthData{
+			CPUCapacity:       b.config.CPUMilliCores,
+			CPUAllocatable:    b.config.CPUMilliCores,
+			MemoryCapacity:    b.config.MemoryBytes,
+			MemoryAllocatable: b.config.MemoryBytes,
+		},
+	})
+}
+
+// queryAllBizHandler returns all installed biz
+func (b *BaseSimulator) queryAllBizHandler(w http.ResponseWriter, _ *http.Request) {
+	b.Lock()
+	bizInfos := make([]BizInfo, 0, len(b.bizKeyToBizInfo))
+	for _, bizInfo := range b.bizKeyToBizInfo {
+		bizInfos = append(bizInfos, bizInfo)
+	}
+	b.Unlock()
+	writeResponse(w, http.StatusOK, Response[[]BizInfo]{Code: model.CodeSuccess, Data: bizInfos})
+}
+
+// installBizHandler installs the biz as RESOLVED and activates it after BizActivateDelay
+func (b *BaseSimulator) installBizHandler(w http.ResponseWriter, r *http.Request) {
+	request := BizOperationRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeResponse(w, http.StatusBadRequest, Response[any]{Code: CodeBadRequest, Message: err.Error()})
+		return
+	}
+
+	bizKey := utils.GetBizIdentity(request.BizName, request.BizVersion)
+	bizInfo := BizInfo{
+		BizName:    request.BizName,
+		BizVersion: request.BizVersion,
+		BizState:   string(model.BizStateResolved),
+		ChangeTime: time.Now(),
+		Reason:     "Installing",
+		Message:    fmt.Sprintf("installing biz from %s", request.BizURL),
+	}
+	b.Lock()
+	b.bizKeyToBizInfo[bizKey] = bizInfo
+	b.Unlock()
+
+	time.AfterFunc(b.config.BizActivateDelay, func() {
+		b.Lock()
+		defer b.Unlock()
+		if current, has := b.bizKeyToBizInfo[bizKey]; has && current.BizState == string(model.BizStateResolved) {
+			current.BizState = string(model.BizStateActivated)
+			current.ChangeTime = time.Now()
+			current.Reason = "Activated"
+			current.Message = "biz activated"
+			b.bizKeyToBizInfo[bizKey] = current
+		}
+	})
+
+	writeResponse(w, http.StatusOK, Response[BizInfo]{Code: model.CodeSuccess, Data: bizInfo})
+}
+
+// uninstallBizHandler removes the biz and returns it as STOPPED
+func (b *BaseSimulator) uninstallBizHandler(w http.ResponseWriter, r *http.Request) {
+	request := BizOperationRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeResponse(w, http.StatusBadRequest, Response[any]{Code: CodeBadRequest, Message: err.Error()})
+		return
+	}
+
+	bizKey := utils.GetBizIdentity(request.BizName, request.BizVersion)
+	b.Lock()
+	delete(b.bizKeyToBizInfo, bizKey)
+	b.Unlock()
+
+	writeResponse(w, http.StatusOK, Response[BizInfo]{Code: model.CodeSuccess, Data: BizInfo{
+		BizName:    request.BizName,
+		BizVersion: request.BizVersion,
+		BizState:   string(model.BizStateStopped),
+		ChangeTime: time.Now(),
+		Reason:     "Uninstalled",
+		Message:    "biz uninstalled",
+	}})
+}
@@ -0,0 +1,344 @@
+package http_tunnel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/koupleless/virtual-kubelet/common/utils"
+	"github.com/koupleless/virtual-kubelet/model"
+	"github.com/koupleless/virtual-kubelet/tunnel"
+	pkgerrors "github.com/pkg/errors"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/uuid"
+)
+
+// Summary:
+// This file implements a reference Tunnel over HTTP.
+// Bases push heartbeats to the tunnel http server, and the tunnel calls the base http server to fetch health data,
+// query biz status and install or uninstall biz.
+
+var _ tunnel.Tunnel = &HTTPTunnel{}
+
+// DefaultRequestTimeout is the timeout of the requests sent to bases
+const DefaultRequestTimeout = 10 * time.Second
+
+// HTTPTunnel is the Tunnel implementation based on HTTP
+type HTTPTunnel struct {
+	sync.Mutex
+
+	tunnel.OnBaseDiscovered
+	tunnel.OnBaseStatusArrived
+	tunnel.OnAllBizStatusArrived
+	tunnel.OnSingleBizStatusArrived
+	tunnel.OnBizOperationResponseArrived
+
+	port   int          // Port of the heartbeat http server
+	env    string       // Environment of the vk instance
+	client *http.Client // Client to call the base endpoints
+	server *http.Server // Heartbeat http server
+	ready  bool         // Whether the heartbeat http server is serving
+
+	nodeNameToBase map[string]BaseNetworkInfo // Maps node name to the network info of the base
+}
+
+// NewHTTPTunnel creates a new HTTPTunnel which receives heartbeats on the given port
+func NewHTTPTunnel(port int) *HTTPTunnel {
+	return &HTTPTunnel{
+		port: port,
+		client: &http.Client{
+			Timeout: DefaultRequestTimeout,
+		},
+		nodeNameToBase: make(map[string]BaseNetworkInfo),
+	}
+}
+
+// Key returns the identity of the HTTPTunnel, derived from the heartbeat port so that more than one HTTPTunnel can be registered
+func (h *HTTPTunnel) Key() string {
+	return fmt.Sprintf("http_tunnel_%d", h.port)
+}
+
+// Start starts the heartbeat http server
+func (h *HTTPTunnel) Start(clientID string, env string) error {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", h.port))
+	if err != nil {
+		return pkgerrors.Wrapf(err, "failed to listen on port %d", h.port)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(PathHeartBeat, h.heartBeatHandler)
+
+	h.Lock()
+	h.env = env
+	h.server = &http.Server{Handler: mux}
+	h.ready = true
+	h.Unlock()
+
+	go func() {
+		if err := h.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.G(context.Background()).WithError(err).Error("http tunnel server exit")
+		}
+		h.Lock()
+		h.ready = false
+		h.Unlock()
+	}()
+
+	log.G(context.Background()).Infof("http tunnel started on port %d by %s", h.port, clientID)
+	return nil
+}
+
+// Ready returns true after the heartbeat http server started
+func (h *HTTPTunnel) Ready() bool {
+	h.Lock()
+	defer h.Unlock()
+	return h.ready
+}
+
+// Stop shuts down the heartbeat http server
+func (h *HTTPTunnel) Stop() error {
+	h.Lock()
+	server := h.server
+	h.Unlock()
+	if server == nil {
+		return nil
+	}
+	return server.Shutdown(context.Background())
+}
+
+// RegisterCallback registers the callbacks of the vnode controller
+func (h *HTTPTunnel) RegisterCallback(onBaseDiscovered tunnel.OnBaseDiscovered, onBaseStatusArrived tunnel.OnBaseStatusArrived, onAllBizStatusArrived tunnel.OnAllBizStatusArrived, onSingleBizStatusArrived tunnel.OnSingleBizStatusArrived, onBizOperationResponseArrived tunnel.OnBizOperationResponseArrived) {
+	h.OnBaseDiscovered = onBaseDiscovered
+	h.OnBaseStatusArrived = onBaseStatusArrived
+	h.OnAllBizStatusArrived = onAllBizStatusArrived
+	h.OnSingleBizStatusArrived = onSingleBizStatusArrived
+	h.OnBizOperationResponseArrived = onBizOperationResponseArrived
+}
+
+// RegisterNode does nothing, the base is recorded when its heartbeat arrived
+func (h *HTTPTunnel) RegisterNode(_ model.NodeInfo) {
+}
+
+// UnRegisterNode forgets the base of the vnode
+func (h *HTTPTunnel) UnRegisterNode(nodeName string) {
+	h.Lock()
+	defer h.Unlock()
+	delete(h.nodeNameToBase, nodeName)
+}
+
+// OnNodeNotReady does nothing, the base will be discovered again when its heartbeat arrived
+func (h *HTTPTunnel) OnNodeNotReady(_ string) {
+}
+
+// FetchHealthData queries the health data of the base and calls OnBaseStatusArrived
+func (h *HTTPTunnel) FetchHealthData(nodeName string) error {
+	healthData := HealthData{}
+	if err := h.callBase(nodeName, PathHealth, nil, &healthData); err != nil {
+		return err
+	}
+	h.OnBaseStatusArrived(nodeName, convertHealthDataToNodeStatus(healthData))
+	return nil
+}
+
+// QueryAllBizStatusData queries all biz of the base and calls OnAllBizStatusArrived
+func (h *HTTPTunnel) QueryAllBizStatusData(nodeName string) error {
+	bizInfos := make([]BizInfo, 0)
+	if err := h.callBase(nodeName, PathQueryAllBiz, nil, &bizInfos); err != nil {
+		return err
+	}
+	bizStatusDatas := make([]model.BizStatusData, 0, len(bizInfos))
+	for _, bizInfo := range bizInfos {
+		bizStatusDatas = append(bizStatusDatas, convertBizInfoToBizStatus(bizInfo))
+	}
+	h.OnAllBizStatusArrived(nodeName, bizStatusDatas)
+	return nil
+}
+
+// StartBiz sends the biz install request to the base asynchronously
+func (h *HTTPTunnel) StartBiz(nodeName, podKey string, container *corev1.Container) (string, error) {
+	return h.operateBiz(nodeName, PathInstallBiz, model.BizOperationStart, podKey, container)
+}
+
+// StopBiz sends the biz uninstall request to the base asynchronously
+func (h *HTTPTunnel) StopBiz(nodeName, podKey string, container *corev1.Container) (string, error) {
+	return h.operateBiz(nodeName, PathUninstallBiz, model.BizOperationStop, podKey, container)
+}
+
+// GetBizUniqueKey returns the biz identity of the container
+func (h *HTTPTunnel) GetBizUniqueKey(container *corev1.Container) string {
+	return utils.GetBizUniqueKey(container)
+}
+
+// heartBeatHandler records the base and calls OnBaseDiscovered
+func (h *HTTPTunnel) heartBeatHandler(w http.ResponseWriter, r *http.Request) {
+	heartBeatData := HeartBeatData{}
+	if err := json.NewDecoder(r.Body).Decode(&heartBeatData); err != nil {
+		writeResponse(w, http.StatusBadRequest, Response[any]{Code: CodeBadRequest, Message: err.Error()})
+		return
+	}
+	if heartBeatData.BaseID == "" {
+		writeResponse(w, http.StatusBadRequest, Response[any]{Code: CodeBadRequest, Message: "base id must not be empty"})
+		return
+	}
+
+	h.Lock()
+	nodeName := utils.FormatNodeName(heartBeatData.BaseID, h.env)
+	if heartBeatData.State == model.NodeStateActivated {
+		h.nodeNameToBase[nodeName] = heartBeatData.NetworkInfo
+	}
+	h.Unlock()
+
+	if h.OnBaseDiscovered != nil {
+		h.OnBaseDiscovered(convertHeartBeatToNodeInfo(nodeName, heartBeatData))
+	}
+	writeResponse(w, http.StatusOK, Response[any]{Code: model.CodeSuccess})
+}
+
+// operateBiz sends the biz operation request in another goroutine and returns the operation id,
+// OnSingleBizStatusArrived and OnBizOperationResponseArrived are called when the base responds
+func (h *HTTPTunnel) operateBiz(nodeName, path string, operationType model.BizOperationType, podKey string, container *corev1.Container) (string, error) {
+	h.Lock()
+	_, has := h.nodeNameToBase[nodeName]
+	h.Unlock()
+	if !has {
+		return "", pkgerrors.Errorf("base of node %s not found", nodeName)
+	}
+
+	operationID := string(uuid.NewUUID())
+	request := newBizOperationRequest(podKey, container)
+	go func() {
+		response := model.BizOperationResponse{
+			OperationID:   operationID,
+			Type:          operationType,
+			PodKey:        podKey,
+			BizKey:        h.GetBizUniqueKey(container),
+			ContainerName: container.Name,
+			Success:       true,
+		}
+
+		bizInfo := BizInfo{}
+		if err := h.callBase(nodeName, path, request, &bizInfo); err != nil {
+			response.Success = false
+			response.Reason = "BaseRequestFailed"
+			response.Message = err.Error()
+		} else {
+			bizStatusData := convertBizInfoToBizStatus(bizInfo)
+			bizStatusData.PodKey = podKey
+			h.OnSingleBizStatusArrived(nodeName, bizStatusData)
+		}
+		response.FinishTime = time.Now()
+
+		if h.OnBizOperationResponseArrived != nil {
+			h.OnBizOperationResponseArrived(nodeName, response)
+		}
+	}()
+	return operationID, nil
+}
+
+// callBase posts the request to the base endpoint and decodes the response data into data
+func (h *HTTPTunnel) callBase(nodeName, path string, request any, data any) error {
+	h.Lock()
+	base, has := h.nodeNameToBase[nodeName]
+	h.Unlock()
+	if !has {
+		return pkgerrors.Errorf("base of node %s not found", nodeName)
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("http://%s:%d%s", base.LocalIP, base.HTTPPort, path)
+	resp, err := h.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return pkgerrors.Wrapf(err, "failed to call %s", url)
+	}
+	defer resp.Body.Close()
+
+	response := Response[json.RawMessage]{}
+	if err = json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return pkgerrors.Wrapf(err, "failed to decode response of %s", url)
+	}
+	if response.Code != model.CodeSuccess {
+		return pkgerrors.Errorf("call %s failed with code %s: %s", url, response.Code, response.Message)
+	}
+	if data == nil || len(response.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(response.Data, data)
+}
+
+// newBizOperationRequest builds the biz operation request from the container
+func newBizOperationRequest(podKey string, container *corev1.Container) BizOperationRequest {
+	return BizOperationRequest{
+		BizName:    container.Name,
+		BizVersion: utils.GetBizVersionFromContainer(container),
+		BizURL:     container.Image,
+		PodKey:     podKey,
+	}
+}
+
+// convertHeartBeatToNodeInfo converts the heartbeat of base to node info
+func convertHeartBeatToNodeInfo(nodeName string, data HeartBeatData) model.NodeInfo {
+	hostName := data.NetworkInfo.LocalHostName
+	if hostName == "" {
+		// the name of the base is the host name when the base reports no host name
+		hostName = data.Name
+	}
+	return model.NodeInfo{
+		Metadata: model.NodeMetadata{
+			Name:        nodeName,
+			Version:     data.Version,
+			ClusterName: data.ClusterName,
+		},
+		NetworkInfo: model.NetworkInfo{
+			NodeIP:   data.NetworkInfo.LocalIP,
+			HostName: hostName,
+		},
+		CustomLabels: data.CustomLabels,
+		State:        data.State,
+	}
+}
+
+// convertHealthDataToNodeStatus converts the health data of base to node status data
+func convertHealthDataToNodeStatus(data HealthData) model.NodeStatusData {
+	return model.NodeStatusData{
+		Resources: map[corev1.ResourceName]model.NodeResource{
+			corev1.ResourceCPU: {
+				Capacity:    *resource.NewMilliQuantity(data.CPUCapacity, resource.DecimalSI),
+				Allocatable: *resource.NewMilliQuantity(data.CPUAllocatable, resource.DecimalSI),
+			},
+			corev1.ResourceMemory: {
+				Capacity:    utils.ConvertByteNumToResourceQuantity(data.MemoryCapacity),
+				Allocatable: utils.ConvertByteNumToResourceQuantity(data.MemoryAllocatable),
+			},
+		},
+	}
+}
+
+// convertBizInfoToBizStatus converts the biz info of base to biz status data
+func convertBizInfoToBizStatus(bizInfo BizInfo) model.BizStatusData {
+	return model.BizStatusData{
+		Key:        utils.GetBizIdentity(bizInfo.BizName, bizInfo.BizVersion),
+		Name:       bizInfo.BizName,
+		State:      bizInfo.BizState,
+		ChangeTime: bizInfo.ChangeTime,
+		Reason:     bizInfo.Reason,
+		Message:    bizInfo.Message,
+	}
+}
+
+// writeResponse writes the response as json
+func writeResponse[T any](w http.ResponseWriter, statusCode int, response Response[T]) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(response)
+}
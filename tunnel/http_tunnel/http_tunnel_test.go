@@ -0,0 +1,181 @@
+package http_tunnel
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/koupleless/virtual-kubelet/common/utils"
+	"github.com/koupleless/virtual-kubelet/model"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func freePort(t *testing.T) int {
+	listener, err := net.Listen("tcp", ":0")
+	assert.NoError(t, err)
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+type callbackRecorder struct {
+	sync.Mutex
+	nodeInfos      []model.NodeInfo
+	nodeStatuses   []model.NodeStatusData
+	allBizStatuses [][]model.BizStatusData
+	bizStatuses    []model.BizStatusData
+	responses      []model.BizOperationResponse
+}
+
+func (c *callbackRecorder) register(h *HTTPTunnel) {
+	h.RegisterCallback(func(info model.NodeInfo) {
+		c.Lock()
+		defer c.Unlock()
+		c.nodeInfos = append(c.nodeInfos, info)
+	}, func(_ string, data model.NodeStatusData) {
+		c.Lock()
+		defer c.Unlock()
+		c.nodeStatuses = append(c.nodeStatuses, data)
+	}, func(_ string, datas []model.BizStatusData) {
+		c.Lock()
+		defer c.Unlock()
+		c.allBizStatuses = append(c.allBizStatuses, datas)
+	}, func(_ string, data model.BizStatusData) {
+		c.Lock()
+		defer c.Unlock()
+		c.bizStatuses = append(c.bizStatuses, data)
+	}, func(_ string, response model.BizOperationResponse) {
+		c.Lock()
+		defer c.Unlock()
+		c.responses = append(c.responses, response)
+	})
+}
+
+func (c *callbackRecorder) nodeInfoNum() int {
+	c.Lock()
+	defer c.Unlock()
+	return len(c.nodeInfos)
+}
+
+func (c *callbackRecorder) responseNum() int {
+	c.Lock()
+	defer c.Unlock()
+	return len(c.responses)
+}
+
+func TestHTTPTunnel_CallBaseNotFound(t *testing.T) {
+	h := NewHTTPTunnel(0)
+	assert.Error(t, h.FetchHealthData("not-exist"))
+	assert.Error(t, h.QueryAllBizStatusData("not-exist"))
+	_, err := h.StartBiz("not-exist", "ns/pod", &corev1.Container{Name: "biz"})
+	assert.Error(t, err)
+	_, err = h.StopBiz("not-exist", "ns/pod", &corev1.Container{Name: "biz"})
+	assert.Error(t, err)
+}
+
+func TestHTTPTunnel_Key(t *testing.T) {
+	assert.NotEqual(t, NewHTTPTunnel(7777).Key(), NewHTTPTunnel(7778).Key())
+}
+
+func TestConvertHeartBeatToNodeInfo_HostName(t *testing.T) {
+	nodeInfo := convertHeartBeatToNodeInfo("vnode.base", HeartBeatData{BaseID: "base", Name: "base-name"})
+	assert.Equal(t, "base-name", nodeInfo.NetworkInfo.HostName)
+
+	nodeInfo = convertHeartBeatToNodeInfo("vnode.base", HeartBeatData{
+		BaseID:      "base",
+		Name:        "base-name",
+		NetworkInfo: BaseNetworkInfo{LocalHostName: "host"},
+	})
+	assert.Equal(t, "host", nodeInfo.NetworkInfo.HostName)
+}
+
+func TestHTTPTunnel_EndToEnd(t *testing.T) {
+	tunnelPort := freePort(t)
+	h := NewHTTPTunnel(tunnelPort)
+	recorder := &callbackRecorder{}
+	recorder.register(h)
+	assert.NoError(t, h.Start("suite", "suite"))
+	defer h.Stop()
+	assert.True(t, h.Ready())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	simulator := NewBaseSimulator(BaseSimulatorConfig{
+		BaseID:            "base",
+		Version:           "1.0.0",
+		HTTPPort:          freePort(t),
+		TunnelAddress:     fmt.Sprintf("http://127.0.0.1:%d", tunnelPort),
+		HeartBeatInterval: 100 * time.Millisecond,
+		BizActivateDelay:  100 * time.Millisecond,
+		CPUMilliCores:     1000,
+		MemoryBytes:       1024 * 1024,
+	})
+	go simulator.Run(ctx)
+
+	assert.Eventually(t, func() bool {
+		return recorder.nodeInfoNum() > 0
+	}, 5*time.Second, 50*time.Millisecond)
+
+	nodeName := utils.FormatNodeName("base", "suite")
+	recorder.Lock()
+	assert.Equal(t, nodeName, recorder.nodeInfos[0].Metadata.Name)
+	assert.Equal(t, model.NodeStateActivated, recorder.nodeInfos[0].State)
+	recorder.Unlock()
+
+	assert.NoError(t, h.FetchHealthData(nodeName))
+	recorder.Lock()
+	cpu := recorder.nodeStatuses[0].Resources[corev1.ResourceCPU]
+	assert.Equal(t, int64(1000), cpu.Capacity.MilliValue())
+	recorder.Unlock()
+
+	container := &corev1.Container{
+		Name:  "biz",
+		Image: "biz.jar",
+		Env: []corev1.EnvVar{
+			{Name: "BIZ_VERSION", Value: "1.0.0"},
+		},
+	}
+	operationID, err := h.StartBiz(nodeName, "ns/pod", container)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return recorder.responseNum() == 1
+	}, 5*time.Second, 50*time.Millisecond)
+	recorder.Lock()
+	assert.Equal(t, operationID, recorder.responses[0].OperationID)
+	assert.Equal(t, model.BizOperationStart, recorder.responses[0].Type)
+	assert.True(t, recorder.responses[0].Success)
+	assert.Equal(t, h.GetBizUniqueKey(container), recorder.bizStatuses[0].Key)
+	assert.Equal(t, "ns/pod", recorder.bizStatuses[0].PodKey)
+	assert.Equal(t, string(model.BizStateResolved), recorder.bizStatuses[0].State)
+	recorder.Unlock()
+
+	assert.Eventually(t, func() bool {
+		if err := h.QueryAllBizStatusData(nodeName); err != nil {
+			return false
+		}
+		recorder.Lock()
+		defer recorder.Unlock()
+		latest := recorder.allBizStatuses[len(recorder.allBizStatuses)-1]
+		return len(latest) == 1 && latest[0].State == string(model.BizStateActivated)
+	}, 5*time.Second, 50*time.Millisecond)
+
+	operationID, err = h.StopBiz(nodeName, "ns/pod", container)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return recorder.responseNum() == 2
+	}, 5*time.Second, 50*time.Millisecond)
+	recorder.Lock()
+	assert.Equal(t, operationID, recorder.responses[1].OperationID)
+	assert.Equal(t, string(model.BizStateStopped), recorder.bizStatuses[1].State)
+	recorder.Unlock()
+
+	cancel()
+	assert.Eventually(t, func() bool {
+		recorder.Lock()
+		defer recorder.Unlock()
+		return recorder.nodeInfos[len(recorder.nodeInfos)-1].State == model.NodeStateDeactivated
+	}, 5*time.Second, 50*time.Millisecond)
+}
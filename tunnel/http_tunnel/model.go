@@ -0,0 +1,78 @@
+package http_tunnel
+
+import (
+	"time"
+
+	"github.com/koupleless/virtual-kubelet/model"
+)
+
+// Summary:
+// This file defines the payloads exchanged between the HTTPTunnel and the bases over HTTP.
+// Bases push heartbeats to the tunnel, and the tunnel calls the base endpoints for health, biz query and biz operations.
+
+const (
+	// PathHeartBeat is the tunnel endpoint the bases push heartbeats to
+	PathHeartBeat = "/heartbeat"
+	// PathHealth is the base endpoint to query the health data
+	PathHealth = "/health"
+	// PathQueryAllBiz is the base endpoint to query all biz status
+	PathQueryAllBiz = "/queryAllBiz"
+	// PathInstallBiz is the base endpoint to install a biz
+	PathInstallBiz = "/installBiz"
+	// PathUninstallBiz is the base endpoint to uninstall a biz
+	PathUninstallBiz = "/uninstallBiz"
+)
+
+// CodeBadRequest is the result code of the requests which can't be decoded
+const CodeBadRequest model.ErrorCode = "10000"
+
+// BaseNetworkInfo is the network info of a base, the tunnel calls the base with it
+type BaseNetworkInfo struct {
+	LocalIP       string `json:"localIP"`       // IP of the base
+	LocalHostName string `json:"localHostName"` // Hostname of the base
+	HTTPPort      int    `json:"httpPort"`      // Port of the base http server
+}
+
+// HeartBeatData is the heartbeat pushed by the base
+type HeartBeatData struct {
+	BaseID       string            `json:"baseID"`       // Unique id of the base
+	Name         string            `json:"name"`         // Name of the base
+	Version      string            `json:"version"`      // Version of the base
+	ClusterName  string            `json:"clusterName"`  // ClusterName of the base
+	State        model.NodeState   `json:"state"`        // State of the base, ACTIVATED or DEACTIVATED
+	NetworkInfo  BaseNetworkInfo   `json:"networkInfo"`  // Network info of the base
+	CustomLabels map[string]string `json:"customLabels"` // Custom labels of the base
+}
+
+// HealthData is the health data of the base
+type HealthData struct {
+	CPUCapacity       int64 `json:"cpuCapacity"`       // CPU capacity of the base in milli cores
+	CPUAllocatable    int64 `json:"cpuAllocatable"`    // Allocatable CPU of the base in milli cores
+	MemoryCapacity    int64 `json:"memoryCapacity"`    // Memory capacity of the base in bytes
+	MemoryAllocatable int64 `json:"memoryAllocatable"` // Allocatable memory of the base in bytes
+}
+
+// BizInfo is the status of a biz installed in the base
+type BizInfo struct {
+	BizName    string    `json:"bizName"`    // Name of the biz
+	BizVersion string    `json:"bizVersion"` // Version of the biz
+	BizState   string    `json:"bizState"`   // State of the biz
+	ChangeTime time.Time `json:"changeTime"` // Time of the latest state change
+	Reason     string    `json:"reason"`     // Reason of the latest state change
+	Message    string    `json:"message"`    // Message of the latest state change
+}
+
+// BizOperationRequest is the request of biz install and uninstall
+type BizOperationRequest struct {
+	BizName    string `json:"bizName"`    // Name of the biz
+	BizVersion string `json:"bizVersion"` // Version of the biz
+	BizURL     string `json:"bizURL"`     // URL of the biz package
+	PodKey     string `json:"podKey"`     // Key of the pod which contains the biz
+}
+
+// Response is the common response of base endpoints
+type Response[T any] struct {
+	Code    model.ErrorCode `json:"code"`    // Result code, CodeSuccess means success
+	Message string          `json:"message"` // Error message when failed
+	Data    T               `json:"data"`    // Response data
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/koupleless/virtual-kubelet/common/utils"
 	"github.com/koupleless/virtual-kubelet/model"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
 	"sync"
 	"time"
 )
@@ -22,6 +23,7 @@ type MockTunnel struct {
 	OnBaseStatusArrived
 	OnSingleBizStatusArrived
 	OnAllBizStatusArrived
+	OnBizOperationResponseArrived
 
 	bizStatusStorage map[string]map[string]model.BizStatusData
 	nodeStorage      map[string]Node
@@ -78,15 +80,21 @@ func (m *MockTunnel) Ready() bool {
 	return true
 }
 
+func (m *MockTunnel) Stop() error {
+	return nil
+}
+
 func (m *MockTunnel) RegisterCallback(
 	OnBaseDiscovered OnBaseDiscovered,
 	OnBaseStatusArrived OnBaseStatusArrived,
 	OnAllBizStatusArrived OnAllBizStatusArrived,
-	OnSingleBizStatusArrived OnSingleBizStatusArrived) {
+	OnSingleBizStatusArrived OnSingleBizStatusArrived,
+	OnBizOperationResponseArrived OnBizOperationResponseArrived) {
 	m.OnBaseStatusArrived = OnBaseStatusArrived
 	m.OnBaseDiscovered = OnBaseDiscovered
 	m.OnAllBizStatusArrived = OnAllBizStatusArrived
 	m.OnSingleBizStatusArrived = OnSingleBizStatusArrived
+	m.OnBizOperationResponseArrived = OnBizOperationResponseArrived
 }
 
 func (m *MockTunnel) RegisterNode(initData model.NodeInfo) {
@@ -113,7 +121,7 @@ func (m *MockTunnel) QueryAllBizStatusData(nodeName string) error {
 	return nil
 }
 
-func (m *MockTunnel) StartBiz(nodeName, podKey string, container *corev1.Container) error {
+func (m *MockTunnel) StartBiz(nodeName, podKey string, container *corev1.Container) (string, error) {
 	m.Lock()
 	defer m.Unlock()
 	key := utils.GetBizUniqueKey(container)
@@ -136,10 +144,10 @@ func (m *MockTunnel) StartBiz(nodeName, podKey string, container *corev1.Contain
 
 	// start to biz installation
 	m.OnSingleBizStatusArrived(nodeName, data)
-	return nil
+	return m.respondBizOperation(nodeName, model.BizOperationStart, podKey, key, container.Name), nil
 }
 
-func (m *MockTunnel) StopBiz(nodeName, podKey string, container *corev1.Container) error {
+func (m *MockTunnel) StopBiz(nodeName, podKey string, container *corev1.Container) (string, error) {
 	m.Lock()
 	defer m.Unlock()
 	containerMap := m.bizStatusStorage[nodeName]
@@ -150,7 +158,24 @@ func (m *MockTunnel) StopBiz(nodeName, podKey string, container *corev1.Containe
 	data.State = string(model.BizStateStopped)
 	data.ChangeTime = time.Now()
 	m.OnSingleBizStatusArrived(nodeName, data)
-	return nil
+	return m.respondBizOperation(nodeName, model.BizOperationStop, podKey, key, container.Name), nil
+}
+
+// respondBizOperation responds the biz operation successfully in another goroutine, the operation id is returned first
+func (m *MockTunnel) respondBizOperation(nodeName string, operationType model.BizOperationType, podKey, bizKey, containerName string) string {
+	operationID := string(uuid.NewUUID())
+	if m.OnBizOperationResponseArrived != nil {
+		go m.OnBizOperationResponseArrived(nodeName, model.BizOperationResponse{
+			OperationID:   operationID,
+			Type:          operationType,
+			PodKey:        podKey,
+			BizKey:        bizKey,
+			ContainerName: containerName,
+			Success:       true,
+			FinishTime:    time.Now(),
+		})
+	}
+	return operationID
 }
 
 func (m *MockTunnel) GetBizUniqueKey(container *corev1.Container) string {
@@ -1,7 +1,11 @@
 package tunnel
 
 import (
+	"context"
+	"io"
+
 	"github.com/koupleless/virtual-kubelet/model"
+	"github.com/koupleless/virtual-kubelet/virtual_kubelet/node/api"
 	v1 "k8s.io/api/core/v1"
 )
 
@@ -17,6 +21,12 @@ type OnAllBizStatusArrived func(string, []model.BizStatusData)
 // OnSingleBizStatusArrived is one container status data callback, will update container-vpod status to k8s
 type OnSingleBizStatusArrived func(string, model.BizStatusData)
 
+// OnBizOperationResponseArrived is the async biz operation response callback, will update operation result to k8s
+type OnBizOperationResponseArrived func(string, model.BizOperationResponse)
+
+// OnBizStatusDeltaArrived is the incremental biz status callback, will update the status of the changed vpods to k8s
+type OnBizStatusDeltaArrived func(string, model.BizStatusDelta)
+
 type Tunnel interface {
 	// Key is the identity of Tunnel, will set to node label for special usage
 	Key() string
@@ -27,8 +37,11 @@ type Tunnel interface {
 	// Ready is the func for check tunnel ready, should return true after tunnel start success
 	Ready() bool
 
+	// Stop is the func of tunnel stop, will be called when the vnode controller exits
+	Stop() error
+
 	// RegisterCallback is the init func of Tunnel, please complete callback register in this func
-	RegisterCallback(OnBaseDiscovered, OnBaseStatusArrived, OnAllBizStatusArrived, OnSingleBizStatusArrived)
+	RegisterCallback(OnBaseDiscovered, OnBaseStatusArrived, OnAllBizStatusArrived, OnSingleBizStatusArrived, OnBizOperationResponseArrived)
 
 	// RegisterNode is the func call when a vnode start successfully, you can implement it on demand
 	RegisterNode(initData model.NodeInfo)
@@ -45,12 +58,75 @@ type Tunnel interface {
 	// QueryAllBizStatusData is the func call for vnode to fetch all containers status data , you need to fetch all containers status data and call OnAllBizStatusArrived when data arrived
 	QueryAllBizStatusData(nodeName string) error
 
-	// StartBiz is the func calls for vnode to start a biz instance, you need to start container and call OnStartBizResponseArrived when start complete with a response
-	StartBiz(nodeName, podKey string, container *v1.Container) error
+	// StartBiz is the func calls for vnode to start a biz instance, you need to return an operation id, start container asynchronously and call OnBizOperationResponseArrived with the same operation id when start complete
+	StartBiz(nodeName, podKey string, container *v1.Container) (string, error)
 
-	// StopBiz is the func calls for vnode to shut down a container , you need to start to shut down container and call OnShutdownContainerResponseArrived when shut down process complete with a response
-	StopBiz(nodeName, podKey string, container *v1.Container) error
+	// StopBiz is the func calls for vnode to shut down a container, you need to return an operation id, shut down container asynchronously and call OnBizOperationResponseArrived with the same operation id when shut down process complete
+	StopBiz(nodeName, podKey string, container *v1.Container) (string, error)
 
 	// GetBizUniqueKey is the func returns a unique key of a container in a pod, vnode will use this unique key to find target Container status
 	GetBizUniqueKey(container *v1.Container) string
 }
+
+// BizReplacer is an optional interface of Tunnel, implement it to support the hot replace upgrade of biz containers
+type BizReplacer interface {
+	// ReplaceBiz replaces the running biz of the old container with the new container in place, you need to return an operation id,
+	// replace asynchronously and call OnBizOperationResponseArrived with the same operation id when the new biz is started
+	ReplaceBiz(nodeName, podKey string, oldContainer, newContainer *v1.Container) (string, error)
+}
+
+// BizExecProber is an optional interface of Tunnel, implement it to support the exec probes of biz containers
+type BizExecProber interface {
+	// ExecProbe runs the probe command in the biz, returns nil if the probe succeeded, the ctx is done once the probe timed out
+	ExecProbe(ctx context.Context, nodeName, podKey string, container *v1.Container, command []string) error
+}
+
+// LogStreamer is an optional interface of Tunnel, implement it to support kubectl logs of biz containers
+type LogStreamer interface {
+	// GetBizLogs returns the log stream of the biz, the stream is closed by the caller
+	GetBizLogs(ctx context.Context, nodeName, podKey string, container *v1.Container, opts api.ContainerLogOpts) (io.ReadCloser, error)
+}
+
+// Executor is an optional interface of Tunnel, implement it to support kubectl exec of biz containers
+type Executor interface {
+	// ExecInBiz runs the diagnostic command on the base for the biz, and blocks until the command exits
+	ExecInBiz(ctx context.Context, nodeName, podKey string, container *v1.Container, cmd []string, attach api.AttachIO) error
+}
+
+// Attacher is an optional interface of Tunnel, implement it to support kubectl attach of biz containers
+type Attacher interface {
+	// AttachToBiz attaches the streams to the biz, and blocks until the streams closed
+	AttachToBiz(ctx context.Context, nodeName, podKey string, container *v1.Container, attach api.AttachIO) error
+}
+
+// PortForwarder is an optional interface of Tunnel, implement it to support kubectl port-forward of vpods
+type PortForwarder interface {
+	// PortForward copies the data between the stream and the port of the base, and blocks until the stream closed
+	PortForward(ctx context.Context, nodeName, podKey string, port int32, stream io.ReadWriteCloser) error
+}
+
+// BizStatsProvider is an optional interface of Tunnel, implement it to support kubectl top and HPA of vpods
+type BizStatsProvider interface {
+	// GetBizStats returns the latest resource usage samples of all the bizs on the base
+	GetBizStats(ctx context.Context, nodeName string) ([]model.BizStatsData, error)
+}
+
+// BizStatusDeltaReporter is an optional interface of Tunnel, implement it to report the biz status changes as revisioned deltas
+// instead of the periodic full lists, a full delta is requested only when a revision gap is found
+type BizStatusDeltaReporter interface {
+	// RegisterBizStatusDeltaCallback registers the callback of the deltas, it is called after RegisterCallback
+	RegisterBizStatusDeltaCallback(OnBizStatusDeltaArrived)
+
+	// RequestFullBizStatus asks the base to report a full delta of its latest revision
+	RequestFullBizStatus(nodeName string) error
+}
+
+// StatusPusher is an optional interface of Tunnel, implement it when the bases push their status by themselves,
+// the polling of the pushed status is skipped then
+type StatusPusher interface {
+	// PushesHealthData returns whether the bases push the health data, FetchHealthData is not polled then
+	PushesHealthData() bool
+
+	// PushesBizStatus returns whether the bases push the biz status, QueryAllBizStatusData is not polled then
+	PushesBizStatus() bool
+}
@@ -21,6 +21,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/koupleless/virtual-kubelet/common/metrics"
 	pkgerrors "github.com/pkg/errors"
 	"github.com/virtual-kubelet/virtual-kubelet/log"
 	"github.com/virtual-kubelet/virtual-kubelet/trace"
@@ -49,6 +50,7 @@ type Queue struct {
 	lock    sync.Mutex
 	running bool
 	name    string
+	node    string
 	handler ItemHandler
 
 	ratelimiter workqueue.RateLimiter
@@ -91,12 +93,19 @@ func (item *queueItem) String() string {
 // It expects to get a item rate limiter, and a friendly name which is used in logs, and in the internal kubernetes
 // metrics. If retryFunc is nil, the default retry function.
 func New(ratelimiter workqueue.RateLimiter, name string, handler ItemHandler, retryFunc ShouldRetryFunc) *Queue {
+	return NewForNode(ratelimiter, name, "", handler, retryFunc)
+}
+
+// NewForNode creates a queue of the node, the node name labels the queue metrics so the queues of the same name of
+// different nodes are told apart.
+func NewForNode(ratelimiter workqueue.RateLimiter, name, node string, handler ItemHandler, retryFunc ShouldRetryFunc) *Queue {
 	if retryFunc == nil {
 		retryFunc = DefaultRetryFunc
 	}
 	return &Queue{
 		clock:                    clock.RealClock{},
 		name:                     name,
+		node:                     node,
 		ratelimiter:              ratelimiter,
 		items:                    list.New(),
 		itemsBeingProcessed:      make(map[string]*queueItem),
@@ -140,6 +149,7 @@ func (q *Queue) Forget(ctx context.Context, key string) {
 		span.WithField(ctx, "status", "itemInQueue")
 		delete(q.itemsInQueue, key)
 		q.items.Remove(item)
+		metrics.QueueDepth.WithLabelValues(q.name, q.node).Dec()
 		return
 	}
 
@@ -212,6 +222,7 @@ func (q *Queue) insert(ctx context.Context, key string, ratelimit bool, delay *t
 	}
 
 	span.WithField(ctx, "status", "added")
+	metrics.QueueDepth.WithLabelValues(q.name, q.node).Inc()
 	now := q.clock.Now()
 	val := &queueItem{
 		key:                  key,
@@ -306,6 +317,22 @@ func (q *Queue) ItemsBeingProcessedLen() int {
 	return len(q.itemsBeingProcessed)
 }
 
+// Keys returns the keys of the items that are in the queue, and are being processed
+func (q *Queue) Keys() []string {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	keys := make([]string, 0, q.items.Len()+len(q.itemsBeingProcessed))
+	for key := range q.itemsBeingProcessed {
+		keys = append(keys, key)
+	}
+	for key := range q.itemsInQueue {
+		if _, has := q.itemsBeingProcessed[key]; !has {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
 // Run starts the workers
 //
 // It blocks until context is cancelled, and all of the workers exit.
@@ -377,6 +404,7 @@ func (q *Queue) getNextItem(ctx context.Context) (*queueItem, error) {
 				q.itemsBeingProcessed[qi.key] = qi
 				q.items.Remove(element)
 				delete(q.itemsInQueue, qi.key)
+				metrics.QueueDepth.WithLabelValues(q.name, q.node).Dec()
 				q.lock.Unlock()
 				return qi, nil
 			}
@@ -473,6 +501,7 @@ func (q *Queue) handleQueueItemObject(ctx context.Context, qi *queueItem) error
 		if err == nil {
 			// Put the item back on the work Queue to handle any transient errors.
 			log.G(ctx).WithError(originalError).Warnf("requeuing %q due to failed sync", qi.key)
+			metrics.QueueRetryTotal.WithLabelValues(q.name, q.node).Inc()
 			newQI := q.insert(ctx, qi.key, true, delay)
 			newQI.requeues = qi.requeues + 1
 			newQI.originallyAdded = qi.originallyAdded
@@ -9,6 +9,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/koupleless/virtual-kubelet/common/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/sirupsen/logrus"
 	"github.com/virtual-kubelet/virtual-kubelet/log"
 	logruslogger "github.com/virtual-kubelet/virtual-kubelet/log/logrus"
@@ -50,6 +52,27 @@ func TestQueueMaxRetries(t *testing.T) {
 	assert.Assert(t, is.Equal(0, wq.Len()))
 }
 
+func TestQueueMetrics(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	knownErr := errors.New("Testing error")
+	handler := func(ctx context.Context, key string) error {
+		return knownErr
+	}
+	wq := New(workqueue.NewItemExponentialFailureRateLimiter(time.Millisecond, time.Millisecond), t.Name(), handler, nil)
+	wq.Enqueue(context.TODO(), "test")
+	wq.Enqueue(context.TODO(), "forget")
+	assert.Assert(t, is.Equal(float64(2), testutil.ToFloat64(metrics.QueueDepth.WithLabelValues(t.Name(), ""))))
+
+	wq.Forget(context.TODO(), "forget")
+	for i := 0; i < MaxRetries; i++ {
+		assert.Assert(t, wq.handleQueueItem(ctx))
+	}
+
+	assert.Assert(t, is.Equal(float64(0), testutil.ToFloat64(metrics.QueueDepth.WithLabelValues(t.Name(), ""))))
+	assert.Assert(t, is.Equal(float64(MaxRetries-1), testutil.ToFloat64(metrics.QueueRetryTotal.WithLabelValues(t.Name(), ""))))
+}
+
 func TestQueueCustomRetries(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -130,6 +153,29 @@ func TestQueueEmpty(t *testing.T) {
 	assert.Assert(t, is.Nil(item))
 }
 
+func TestQueueKeys(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	q := New(workqueue.DefaultItemBasedRateLimiter(), t.Name(), func(ctx context.Context, key string) error {
+		return nil
+	}, nil)
+	assert.Assert(t, is.Len(q.Keys(), 0))
+
+	q.Enqueue(ctx, "foo")
+	q.Enqueue(ctx, "bar")
+	item, err := q.getNextItem(ctx)
+	assert.NilError(t, err)
+	assert.Equal(t, item.key, "foo")
+	q.Enqueue(ctx, "foo")
+
+	keys := q.Keys()
+	assert.Assert(t, is.Len(keys, 2))
+	assert.Assert(t, is.Contains(keys, "foo"))
+	assert.Assert(t, is.Contains(keys, "bar"))
+}
+
 func TestQueueItemNoSleep(t *testing.T) {
 	t.Parallel()
 
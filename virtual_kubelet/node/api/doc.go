@@ -0,0 +1,22 @@
+// Copyright © 2017 The virtual-kubelet authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package api implements HTTP handlers for handling requests that the kubelet
+// would normally implement, such as pod logs, exec, etc.
+//
+// It adapts the handlers of the upstream virtual-kubelet node/api package to the
+// net/http path patterns. The upstream package is not imported as it does not
+// build against the prometheus/common in use, the exec, attach and port-forward
+// stream protocols are served by k8s.io/kubelet.
+package api
@@ -0,0 +1,106 @@
+// Copyright © 2017 The virtual-kubelet authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+)
+
+// ServeMux defines an interface used to attach routes to an existing http
+// serve mux.
+// It is used to enable callers creating a new server to completely manage
+// their own HTTP server while allowing us to attach the required routes to
+// satisfy the Kubelet HTTP interfaces.
+type ServeMux interface {
+	Handle(path string, h http.Handler)
+}
+
+type PodHandlerConfig struct { //nolint:golint
+	RunInContainer        ContainerExecHandlerFunc
+	AttachToContainer     ContainerAttachHandlerFunc
+	PortForward           PortForwardHandlerFunc
+	GetContainerLogs      ContainerLogsHandlerFunc
+	GetStatsSummary       PodStatsSummaryHandlerFunc
+	GetMetricsResource    PodMetricsResourceHandlerFunc
+	StreamIdleTimeout     time.Duration
+	StreamCreationTimeout time.Duration
+}
+
+// PodHandler creates an http handler for interacting with pods/containers.
+func PodHandler(p PodHandlerConfig) http.Handler {
+	r := http.NewServeMux()
+
+	r.HandleFunc("GET /containerLogs/{namespace}/{pod}/{container}", HandleContainerLogs(p.GetContainerLogs))
+	execHandler := HandleContainerExec(
+		p.RunInContainer,
+		WithExecStreamCreationTimeout(p.StreamCreationTimeout),
+		WithExecStreamIdleTimeout(p.StreamIdleTimeout),
+	)
+	r.HandleFunc("GET /exec/{namespace}/{pod}/{container}", execHandler)
+	r.HandleFunc("POST /exec/{namespace}/{pod}/{container}", execHandler)
+	attachHandler := HandleContainerAttach(
+		p.AttachToContainer,
+		WithExecStreamCreationTimeout(p.StreamCreationTimeout),
+		WithExecStreamIdleTimeout(p.StreamIdleTimeout),
+	)
+	r.HandleFunc("GET /attach/{namespace}/{pod}/{container}", attachHandler)
+	r.HandleFunc("POST /attach/{namespace}/{pod}/{container}", attachHandler)
+	portForwardHandler := HandlePortForward(
+		p.PortForward,
+		WithPortForwardStreamIdleTimeout(p.StreamIdleTimeout),
+		WithPortForwardCreationTimeout(p.StreamCreationTimeout),
+	)
+	r.HandleFunc("GET /portForward/{namespace}/{pod}", portForwardHandler)
+	r.HandleFunc("POST /portForward/{namespace}/{pod}", portForwardHandler)
+
+	r.HandleFunc("GET /stats/summary", HandlePodStatsSummary(p.GetStatsSummary))
+	r.HandleFunc("GET /stats/summary/", HandlePodStatsSummary(p.GetStatsSummary))
+	r.HandleFunc("GET /metrics/resource", HandlePodMetricsResource(p.GetMetricsResource))
+
+	r.HandleFunc("/", NotFound)
+	return r
+}
+
+// AttachPodRoutes adds the http routes for pod stuff to the passed in serve mux.
+//
+// Callers should take care to namespace the serve mux as they see fit, however
+// these routes get called by the Kubernetes API server.
+func AttachPodRoutes(p PodHandlerConfig, mux ServeMux) {
+	mux.Handle("/", InstrumentHandler(PodHandler(p)))
+}
+
+// InstrumentHandler wraps an http.Handler and injects the request logger into the request context.
+func InstrumentHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := req.Context()
+		logger := log.G(ctx).WithField("uri", req.RequestURI)
+		h.ServeHTTP(w, req.WithContext(log.WithLogger(ctx, logger)))
+	})
+}
+
+// NotFound provides a handler for cases where the requested endpoint doesn't exist
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	log.G(r.Context()).Debug("404 request not found")
+	http.Error(w, "404 request not found", http.StatusNotFound)
+}
+
+// NotImplemented provides a handler for cases where a provider does not implement a given API
+func NotImplemented(w http.ResponseWriter, r *http.Request) {
+	log.G(r.Context()).Debug("501 not implemented")
+	http.Error(w, "501 not implemented", http.StatusNotImplemented)
+}
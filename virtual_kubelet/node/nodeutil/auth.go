@@ -0,0 +1,177 @@
+package nodeutil
+
+import (
+	"crypto/tls"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	"k8s.io/apiserver/pkg/authentication/authenticatorfactory"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/authorization/authorizerfactory"
+	"k8s.io/apiserver/pkg/server/dynamiccertificates"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Auth is the authn and authz of the kubelet api requests, the same as the upstream nodeutil.Auth without the request attributes,
+// as the attributes depend on the node the request is sent to
+type Auth interface {
+	authenticator.Request
+	authorizer.Authorizer
+}
+
+type authWrapper struct {
+	authenticator.Request
+	authorizer.Authorizer
+}
+
+// webhookRetryBackoff is the backoff of the TokenReview and SubjectAccessReview requests, the same as the kubelet
+func webhookRetryBackoff() *wait.Backoff {
+	return &wait.Backoff{
+		Duration: 500 * time.Millisecond,
+		Factor:   1.5,
+		Jitter:   0.2,
+		Steps:    5,
+	}
+}
+
+// WebhookAuth creates an Auth delegating to the apiserver by TokenReview and SubjectAccessReview like the kubelet webhook auth.
+// The client certificates signed by the CA in clientCAFile are authenticated too if clientCAFile is not empty.
+func WebhookAuth(client kubernetes.Interface, clientCAFile string) (Auth, error) {
+	// the cache ttls are the defaults of k8s.io/kubernetes/pkg/kubelet/apis/config/v1beta1
+	authnConfig := authenticatorfactory.DelegatingAuthenticatorConfig{
+		TokenAccessReviewClient: client.AuthenticationV1(),
+		CacheTTL:                2 * time.Minute,
+		WebhookRetryBackoff:     webhookRetryBackoff(),
+	}
+	if clientCAFile != "" {
+		caProvider, err := dynamiccertificates.NewDynamicCAContentFromFile("client-ca", clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		authnConfig.ClientCertificateCAContentProvider = caProvider
+	}
+	authzConfig := authorizerfactory.DelegatingAuthorizerConfig{
+		SubjectAccessReviewClient: client.AuthorizationV1(),
+		AllowCacheTTL:             5 * time.Minute,
+		DenyCacheTTL:              30 * time.Second,
+		WebhookRetryBackoff:       webhookRetryBackoff(),
+	}
+
+	authn, _, err := authnConfig.New()
+	if err != nil {
+		return nil, err
+	}
+	authz, err := authzConfig.New()
+	if err != nil {
+		return nil, err
+	}
+	return &authWrapper{
+		Request:    authn,
+		Authorizer: authz,
+	}, nil
+}
+
+// WithAuth wraps the handler of the kubelet api of the node with the authn and authz of the requests.
+func WithAuth(auth Auth, nodeName string, h http.Handler) http.Handler {
+	attrs := NodeRequestAttr{NodeName: nodeName}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleAuth(auth, attrs, w, r, h)
+	})
+}
+
+func handleAuth(auth Auth, attrs NodeRequestAttr, w http.ResponseWriter, r *http.Request, next http.Handler) {
+	ctx := r.Context()
+	info, ok, err := auth.AuthenticateRequest(r)
+	if err != nil || !ok {
+		log.G(ctx).WithError(err).Error("Authorization error")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	logger := log.G(ctx).WithFields(log.Fields{
+		"user-name": info.User.GetName(),
+		"user-id":   info.User.GetUID(),
+	})
+	ctx = log.WithLogger(ctx, logger)
+	r = r.WithContext(ctx)
+
+	decision, _, err := auth.Authorize(ctx, attrs.GetRequestAttributes(info.User, r))
+	if err != nil {
+		log.G(ctx).WithError(err).Error("Authorization error")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if decision != authorizer.DecisionAllow {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	next.ServeHTTP(w, r)
+}
+
+// NodeRequestAttr is the authorizer.RequestAttributesGetter of the requests sent to the node.
+type NodeRequestAttr struct {
+	NodeName string
+}
+
+// GetRequestAttributes returns the attributes of the request on the nodes/<subresource> of the node, like the kubelet.
+func (a NodeRequestAttr) GetRequestAttributes(u user.Info, r *http.Request) authorizer.Attributes {
+	return authorizer.AttributesRecord{
+		User:            u,
+		Verb:            getAPIVerb(r),
+		Namespace:       "",
+		APIGroup:        "",
+		APIVersion:      "v1",
+		Resource:        "nodes",
+		Name:            a.NodeName,
+		ResourceRequest: true,
+		Path:            r.URL.Path,
+		Subresource:     getSubresource(r),
+	}
+}
+
+// requiresClientCert returns whether the tls config only accepts the verified client certificates.
+func requiresClientCert(tlsConfig *tls.Config) bool {
+	return tlsConfig != nil && tlsConfig.ClientAuth == tls.RequireAndVerifyClientCert && tlsConfig.ClientCAs != nil
+}
+
+func getAPIVerb(r *http.Request) string {
+	switch r.Method {
+	case http.MethodPost:
+		return "create"
+	case http.MethodGet:
+		return "get"
+	case http.MethodPut:
+		return "update"
+	case http.MethodPatch:
+		return "patch"
+	case http.MethodDelete:
+		return "delete"
+	}
+	return ""
+}
+
+func isSubpath(subpath, path string) bool {
+	// Taken from k8s.io/kubernetes/pkg/kubelet/server/auth.go
+	return subpath == path || (strings.HasPrefix(subpath, path) && subpath[len(path)] == '/')
+}
+
+func getSubresource(r *http.Request) string {
+	if isSubpath(r.URL.Path, "/stats") {
+		return "stats"
+	}
+	if isSubpath(r.URL.Path, "/metrics") {
+		return "metrics"
+	}
+	if isSubpath(r.URL.Path, "/logs") {
+		// yes, "log", not "logs"
+		// per kubelet code: "log" to match other log subresources (pods/log, etc)
+		return "log"
+	}
+	return "proxy"
+}
@@ -172,6 +172,12 @@ type NodeConfig struct {
 	// Set the number of workers to reconcile pods
 	// The default value is derived from the number of cores available.
 	NumWorkers int
+
+	// Set the window in which the status updates of a pod are merged into one write, 0 means no coalescing
+	PodStatusCoalesceWindow time.Duration
+
+	// Set the max number of concurrent pod status writes, 0 means unbounded
+	MaxConcurrentPodStatusWrites int
 }
 
 // WithClient return a NodeOpt that sets the client that will be used to create/manage the node.
@@ -190,6 +196,23 @@ func WithCache(cache cache.Cache) NodeOpt {
 	}
 }
 
+// WithEventRecorder return a NodeOpt that sets the event recorder of the pod controller, the default one is used if nil.
+func WithEventRecorder(recorder record.EventRecorder) NodeOpt {
+	return func(cfg *NodeConfig) error {
+		cfg.EventRecorder = recorder
+		return nil
+	}
+}
+
+// WithPodStatusWriter return a NodeOpt that sets the coalesce window and the max concurrent writes of the pod status.
+func WithPodStatusWriter(coalesceWindow time.Duration, maxConcurrentWrites int) NodeOpt {
+	return func(cfg *NodeConfig) error {
+		cfg.PodStatusCoalesceWindow = coalesceWindow
+		cfg.MaxConcurrentPodStatusWrites = maxConcurrentWrites
+		return nil
+	}
+}
+
 // NewNode creates a new node using the provided client and name.
 // This is intended for high-level/low boiler-plate usage.
 // Use the constructors in the `node` package for lower level configuration.
@@ -264,6 +287,9 @@ func NewNode(name string, newProvider NewProviderFunc, opts ...NodeOpt) (*Node,
 		Client:        cfg.Client,
 		Cache:         cfg.Cache,
 		Provider:      podProvider,
+
+		PodStatusCoalesceWindow:      cfg.PodStatusCoalesceWindow,
+		MaxConcurrentPodStatusWrites: cfg.MaxConcurrentPodStatusWrites,
 	})
 	if err != nil {
 		return nil, errors.Wrap(err, "error creating pod controller")
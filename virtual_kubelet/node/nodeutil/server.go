@@ -0,0 +1,76 @@
+package nodeutil
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/koupleless/virtual-kubelet/virtual_kubelet/node/api"
+	"github.com/pkg/errors"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+)
+
+// kubeletServerShutdownTimeout is the max time waiting for the in-flight requests when the kubelet api server shuts down
+const kubeletServerShutdownTimeout = 10 * time.Second
+
+// ListenKubeletAPI listens on the first free port from minPort to maxPort, the port is picked by the system if maxPort is 0.
+func ListenKubeletAPI(minPort, maxPort int32) (net.Listener, error) {
+	if maxPort == 0 {
+		return net.Listen("tcp", ":0")
+	}
+	for port := minPort; port <= maxPort; port++ {
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+		if err == nil {
+			return listener, nil
+		}
+	}
+	return nil, errors.Errorf("no free kubelet api port from %d to %d", minPort, maxPort)
+}
+
+// ServeKubeletAPI serves the kubelet api (logs, exec, attach, port-forward, stats and metrics) of the node on the listener
+// until the context is done. The requests are authenticated and authorized by auth if not nil. Without auth, exec, attach
+// and port-forward are only served if tlsConfig requires the verified client certificates, and are not implemented otherwise.
+// If tlsConfig is nil the server serves plain HTTP, which is only intended for testing.
+func ServeKubeletAPI(ctx context.Context, listener net.Listener, tlsConfig *tls.Config, auth Auth, nodeName string, podHandler api.PodHandlerConfig) error {
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	} else {
+		log.G(ctx).Warn("kubelet api is served without tls")
+	}
+	if auth == nil && !requiresClientCert(tlsConfig) {
+		log.G(ctx).Warn("kubelet api is served without auth or client certificate verification, exec, attach and port-forward are disabled")
+		podHandler.RunInContainer = nil
+		podHandler.AttachToContainer = nil
+		podHandler.PortForward = nil
+	}
+
+	mux := http.NewServeMux()
+	api.AttachPodRoutes(podHandler, mux)
+	var handler http.Handler = mux
+	if auth != nil {
+		handler = WithAuth(auth, nodeName, mux)
+	}
+	server := &http.Server{
+		Handler:   handler,
+		TLSConfig: tlsConfig,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), kubeletServerShutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.G(ctx).WithError(err).Error("failed to shut down kubelet api server")
+		}
+	}()
+
+	log.G(ctx).Infof("kubelet api is served on %s", listener.Addr())
+	err := server.Serve(listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
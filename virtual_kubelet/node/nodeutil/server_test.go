@@ -0,0 +1,174 @@
+package nodeutil
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/koupleless/virtual-kubelet/virtual_kubelet/node/api"
+	"github.com/virtual-kubelet/virtual-kubelet/node/api/statsv1alpha1"
+	"gotest.tools/assert"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+func TestServeKubeletAPI(t *testing.T) {
+	listener, err := ListenKubeletAPI(0, 0)
+	assert.NilError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- ServeKubeletAPI(ctx, listener, nil, nil, "vnode", api.PodHandlerConfig{
+			GetContainerLogs: func(ctx context.Context, namespace, podName, containerName string, opts api.ContainerLogOpts) (io.ReadCloser, error) {
+				return io.NopCloser(strings.NewReader(namespace + "/" + podName + "/" + containerName)), nil
+			},
+			RunInContainer: func(ctx context.Context, namespace, podName, containerName string, cmd []string, attach api.AttachIO) error {
+				return nil
+			},
+			GetStatsSummary: func(ctx context.Context) (*statsv1alpha1.Summary, error) {
+				return &statsv1alpha1.Summary{Node: statsv1alpha1.NodeStats{NodeName: "vnode"}}, nil
+			},
+		})
+	}()
+
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	assert.NilError(t, err)
+	baseURL := "http://127.0.0.1:" + port
+	resp, err := http.Get(baseURL + "/containerLogs/ns/pod/biz?tailLines=10")
+	assert.NilError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "ns/pod/biz", string(body))
+
+	resp, err = http.Get(baseURL + "/stats/summary")
+	assert.NilError(t, err)
+	summary := &statsv1alpha1.Summary{}
+	assert.NilError(t, json.NewDecoder(resp.Body).Decode(summary))
+	resp.Body.Close()
+	assert.Equal(t, "vnode", summary.Node.NodeName)
+
+	// exec is disabled without auth or client certificate verification
+	resp, err = http.Post(baseURL+"/exec/ns/pod/biz?command=ls", "", nil)
+	assert.NilError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+
+	resp, err = http.Get(baseURL + "/unknown")
+	assert.NilError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	cancel()
+	select {
+	case err = <-done:
+		assert.NilError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("kubelet api server not shut down")
+	}
+}
+
+func TestListenKubeletAPI(t *testing.T) {
+	listener, err := ListenKubeletAPI(0, 0)
+	assert.NilError(t, err)
+	defer listener.Close()
+	_, portStr, err := net.SplitHostPort(listener.Addr().String())
+	assert.NilError(t, err)
+	port, err := strconv.Atoi(portStr)
+	assert.NilError(t, err)
+
+	// the taken port is skipped
+	next, err := ListenKubeletAPI(int32(port), int32(port)+10)
+	assert.NilError(t, err)
+	defer next.Close()
+	assert.Assert(t, next.Addr().String() != listener.Addr().String())
+
+	_, err = ListenKubeletAPI(int32(port), int32(port))
+	assert.Assert(t, err != nil)
+}
+
+type fakeAuth struct{}
+
+func (fakeAuth) AuthenticateRequest(r *http.Request) (*authenticator.Response, bool, error) {
+	if r.Header.Get("Authorization") != "Bearer token" {
+		return nil, false, nil
+	}
+	return &authenticator.Response{User: &user.DefaultInfo{Name: "metrics-server"}}, true, nil
+}
+
+func (fakeAuth) Authorize(ctx context.Context, a authorizer.Attributes) (authorizer.Decision, string, error) {
+	if a.GetName() == "vnode" && a.GetVerb() == "get" && a.GetSubresource() == "stats" {
+		return authorizer.DecisionAllow, "", nil
+	}
+	return authorizer.DecisionDeny, "", nil
+}
+
+func TestServeKubeletAPI_Auth(t *testing.T) {
+	listener, err := ListenKubeletAPI(0, 0)
+	assert.NilError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go ServeKubeletAPI(ctx, listener, nil, fakeAuth{}, "vnode", api.PodHandlerConfig{
+		GetContainerLogs: func(ctx context.Context, namespace, podName, containerName string, opts api.ContainerLogOpts) (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader("logs")), nil
+		},
+		GetStatsSummary: func(ctx context.Context) (*statsv1alpha1.Summary, error) {
+			return &statsv1alpha1.Summary{}, nil
+		},
+	})
+
+	baseURL := "http://" + listener.Addr().String()
+	get := func(path, token string) int {
+		req, err := http.NewRequest(http.MethodGet, baseURL+path, nil)
+		assert.NilError(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.NilError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusUnauthorized, get("/stats/summary", ""))
+	assert.Equal(t, http.StatusUnauthorized, get("/stats/summary", "invalid"))
+	assert.Equal(t, http.StatusOK, get("/stats/summary", "token"))
+	assert.Equal(t, http.StatusForbidden, get("/containerLogs/ns/pod/biz", "token"))
+}
+
+func TestNodeRequestAttr(t *testing.T) {
+	attrs := NodeRequestAttr{NodeName: "vnode"}
+	u := &user.DefaultInfo{Name: "apiserver"}
+	for path, subresource := range map[string]string{
+		"/stats/summary":            "stats",
+		"/metrics/resource":         "metrics",
+		"/containerLogs/ns/pod/biz": "proxy",
+		"/exec/ns/pod/biz":          "proxy",
+		"/statsx":                   "proxy",
+	} {
+		r, err := http.NewRequest(http.MethodPost, "http://127.0.0.1"+path, nil)
+		assert.NilError(t, err)
+		a := attrs.GetRequestAttributes(u, r)
+		assert.Equal(t, "vnode", a.GetName())
+		assert.Equal(t, "nodes", a.GetResource())
+		assert.Equal(t, "create", a.GetVerb())
+		assert.Equal(t, subresource, a.GetSubresource(), path)
+	}
+}
+
+func TestRequiresClientCert(t *testing.T) {
+	assert.Assert(t, !requiresClientCert(nil))
+	assert.Assert(t, !requiresClientCert(&tls.Config{ClientAuth: tls.RequireAndVerifyClientCert}))
+	assert.Assert(t, !requiresClientCert(&tls.Config{ClientAuth: tls.VerifyClientCertIfGiven, ClientCAs: x509.NewCertPool()}))
+	assert.Assert(t, requiresClientCert(&tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: x509.NewCertPool()}))
+}
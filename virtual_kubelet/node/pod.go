@@ -17,6 +17,7 @@ package node
 import (
 	"context"
 	"fmt"
+	"github.com/koupleless/virtual-kubelet/common/metrics"
 	"github.com/koupleless/virtual-kubelet/common/utils"
 	"github.com/koupleless/virtual-kubelet/virtual_kubelet/internal/queue"
 	"k8s.io/apimachinery/pkg/types"
@@ -165,6 +166,11 @@ func (pc *PodController) updatePodStatus(ctx context.Context, podFromKubernetes
 	podFromProvider := kPod.lastPodStatusReceivedFromProvider.DeepCopy()
 	kPod.Unlock()
 
+	if err := pc.acquirePodStatusWrite(ctx); err != nil {
+		return err
+	}
+	defer pc.releasePodStatusWrite()
+
 	if podFromProvider.DeletionTimestamp != nil && podFromKubernetes.DeletionTimestamp == nil {
 		deleteOptions := &client.DeleteOptions{
 			GracePeriodSeconds: podFromProvider.DeletionGracePeriodSeconds,
@@ -190,6 +196,7 @@ func (pc *PodController) updatePodStatus(ctx context.Context, podFromKubernetes
 		span.SetStatus(err)
 		return pkgerrors.Wrap(err, "error while updating pod status in kubernetes")
 	}
+	metrics.PodStatusUpdateTotal.WithLabelValues(metrics.PodStatusUpdateWritten).Inc()
 
 	log.G(ctx).WithFields(log.Fields{
 		"new phase":  string(podFromProvider.Status.Phase),
@@ -260,6 +267,7 @@ func (pc *PodController) enqueuePodStatusUpdate(ctx context.Context, pod *corev1
 			log.G(ctx).WithError(err).Warn("Not enqueuing pod status update due to error from pod lister")
 		}
 		span.SetStatus(err)
+		metrics.PodStatusUpdateTotal.WithLabelValues(metrics.PodStatusUpdateDropped).Inc()
 		return
 	}
 
@@ -272,8 +280,40 @@ func (pc *PodController) enqueuePodStatusUpdate(ctx context.Context, pod *corev1
 	}
 	kpod.lastPodStatusUpdateSkipped = false
 	kpod.lastPodStatusReceivedFromProvider = pod
+	merged := kpod.statusUpdatePending
+	kpod.statusUpdatePending = true
 	kpod.Unlock()
-	pc.syncPodStatusFromProvider.Enqueue(ctx, key)
+
+	if merged {
+		// the pending write takes the latest status, no need to write again
+		metrics.PodStatusUpdateTotal.WithLabelValues(metrics.PodStatusUpdateMerged).Inc()
+		return
+	}
+	if pc.podStatusCoalesceWindow > 0 {
+		pc.syncPodStatusFromProvider.EnqueueWithoutRateLimitWithDelay(ctx, key, pc.podStatusCoalesceWindow)
+	} else {
+		pc.syncPodStatusFromProvider.Enqueue(ctx, key)
+	}
+}
+
+// acquirePodStatusWrite waits for a slot of the concurrent pod status writes
+func (pc *PodController) acquirePodStatusWrite(ctx context.Context) error {
+	if pc.podStatusWrites == nil {
+		return nil
+	}
+	select {
+	case pc.podStatusWrites <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return pkgerrors.Wrap(ctx.Err(), "error while waiting for pod status write")
+	}
+}
+
+// releasePodStatusWrite releases the slot acquired by acquirePodStatusWrite
+func (pc *PodController) releasePodStatusWrite() {
+	if pc.podStatusWrites != nil {
+		<-pc.podStatusWrites
+	}
 }
 
 func (pc *PodController) syncPodStatusFromProviderHandler(ctx context.Context, key string) (retErr error) {
@@ -289,6 +329,14 @@ func (pc *PodController) syncPodStatusFromProviderHandler(ctx context.Context, k
 		}
 	}()
 
+	// the status updates arriving from now on are written by the next write
+	if obj, ok := pc.knownPods.Load(key); ok {
+		kPod := obj.(*knownPod)
+		kPod.Lock()
+		kPod.statusUpdatePending = false
+		kPod.Unlock()
+	}
+
 	namespace, name, err := cache.SplitMetaNamespaceKey(key)
 	if err != nil {
 		return pkgerrors.Wrap(err, "error splitting cache key")
@@ -302,6 +350,7 @@ func (pc *PodController) syncPodStatusFromProviderHandler(ctx context.Context, k
 	if err != nil {
 		if errors.IsNotFound(err) {
 			log.G(ctx).WithError(err).Debug("Skipping pod status update for pod missing in Kubernetes")
+			metrics.PodStatusUpdateTotal.WithLabelValues(metrics.PodStatusUpdateDropped).Inc()
 			return nil
 		}
 		return pkgerrors.Wrap(err, "error looking up pod")
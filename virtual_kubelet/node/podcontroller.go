@@ -23,6 +23,7 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"slices"
 	"sync"
 	"time"
 
@@ -108,12 +109,27 @@ type PodController struct {
 
 	syncPodsFromKubernetes *queue.Queue
 
+	// syncPodsLock guards the pause and the in-flight syncs of the pods from kubernetes, so no sync starts after paused
+	syncPodsLock sync.Mutex
+	// syncPodsPaused stops the workers from syncing the pods from kubernetes, the keys skipped are kept as pending
+	syncPodsPaused bool
+	// syncPodsInFlight is the number of the pods being synced from kubernetes
+	syncPodsInFlight int
+	// syncPodsSkippedKeys is the keys of the pods skipped by the workers after paused
+	syncPodsSkippedKeys map[string]struct{}
+
 	// deletePodsFromKubernetes is a queue on which pods are reconciled, and we check if pods are in API server after
 	// the grace period
 	deletePodsFromKubernetes *queue.Queue
 
 	syncPodStatusFromProvider *queue.Queue
 
+	// podStatusCoalesceWindow is the delay of writing a pod status, the status updates of the pod arriving in the delay are
+	// merged into the write of the latest status
+	podStatusCoalesceWindow time.Duration
+	// podStatusWrites bounds the concurrent pod status writes to the API server, nil means unbounded
+	podStatusWrites chan struct{}
+
 	// From the time of creation, to termination the knownPods map will contain the pods key
 	// (derived from Kubernetes' cache library) -> a *knownPod struct.
 	knownPods sync.Map
@@ -142,6 +158,8 @@ type knownPod struct {
 	lastPodStatusReceivedFromProvider *corev1.Pod
 	lastPodUsed                       *corev1.Pod
 	lastPodStatusUpdateSkipped        bool
+	// statusUpdatePending is set once a status update is enqueued, and cleared once the status is taken for writing
+	statusUpdatePending bool
 }
 
 // PodControllerConfig is used to configure a new PodController.
@@ -168,6 +186,11 @@ type PodControllerConfig struct {
 	SyncPodStatusFromProviderRateLimiter workqueue.RateLimiter
 	// SyncPodStatusFromProviderShouldRetryFunc allows for a custom retry policy for the SyncPodStatusFromProvider queue
 	SyncPodStatusFromProviderShouldRetryFunc queue.ShouldRetryFunc
+
+	// PodStatusCoalesceWindow is the window in which the status updates of a pod from the provider are merged into one write, 0 means no coalescing
+	PodStatusCoalesceWindow time.Duration
+	// MaxConcurrentPodStatusWrites is the max number of concurrent pod status writes to the API server, 0 means unbounded
+	MaxConcurrentPodStatusWrites int
 }
 
 // NewPodController creates a new pod controller with the provided config.
@@ -201,11 +224,16 @@ func NewPodController(cfg PodControllerConfig) (*PodController, error) {
 		ready:    make(chan struct{}),
 		done:     make(chan struct{}),
 		recorder: cfg.EventRecorder,
+
+		podStatusCoalesceWindow: cfg.PodStatusCoalesceWindow,
+	}
+	if cfg.MaxConcurrentPodStatusWrites > 0 {
+		pc.podStatusWrites = make(chan struct{}, cfg.MaxConcurrentPodStatusWrites)
 	}
 
-	pc.syncPodsFromKubernetes = queue.New(cfg.SyncPodsFromKubernetesRateLimiter, "syncPodsFromKubernetes", pc.syncPodsFromKubernetesHandler, cfg.SyncPodsFromKubernetesShouldRetryFunc)
-	pc.deletePodsFromKubernetes = queue.New(cfg.DeletePodsFromKubernetesRateLimiter, "deletePodsFromKubernetes", pc.deletePodsFromKubernetesHandler, cfg.DeletePodsFromKubernetesShouldRetryFunc)
-	pc.syncPodStatusFromProvider = queue.New(cfg.SyncPodStatusFromProviderRateLimiter, "syncPodStatusFromProvider", pc.syncPodStatusFromProviderHandler, cfg.SyncPodStatusFromProviderShouldRetryFunc)
+	pc.syncPodsFromKubernetes = queue.NewForNode(cfg.SyncPodsFromKubernetesRateLimiter, "syncPodsFromKubernetes", cfg.NodeName, pc.syncPodsFromKubernetesHandler, cfg.SyncPodsFromKubernetesShouldRetryFunc)
+	pc.deletePodsFromKubernetes = queue.NewForNode(cfg.DeletePodsFromKubernetesRateLimiter, "deletePodsFromKubernetes", cfg.NodeName, pc.deletePodsFromKubernetesHandler, cfg.DeletePodsFromKubernetesShouldRetryFunc)
+	pc.syncPodStatusFromProvider = queue.NewForNode(cfg.SyncPodStatusFromProviderRateLimiter, "syncPodStatusFromProvider", cfg.NodeName, pc.syncPodStatusFromProviderHandler, cfg.SyncPodStatusFromProviderShouldRetryFunc)
 
 	pc.nodeName = cfg.NodeName
 	return pc, nil
@@ -342,6 +370,57 @@ func (pc *PodController) SyncPodsFromKubernetesEnqueue(ctx context.Context, key
 	pc.syncPodsFromKubernetes.Enqueue(ctx, key)
 }
 
+// SyncPodsFromKubernetesPendingKeys returns the keys of the pods waiting to be synced from kubernetes, or being synced,
+// including the pods skipped after the syncs paused
+func (pc *PodController) SyncPodsFromKubernetesPendingKeys() []string {
+	keys := pc.syncPodsFromKubernetes.Keys()
+	pc.syncPodsLock.Lock()
+	defer pc.syncPodsLock.Unlock()
+	for key := range pc.syncPodsSkippedKeys {
+		if !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// PauseSyncPodsFromKubernetes stops the workers from starting to sync the pods from kubernetes, the syncs already started
+// are not interrupted, see SyncPodsFromKubernetesInFlight
+func (pc *PodController) PauseSyncPodsFromKubernetes() {
+	pc.syncPodsLock.Lock()
+	defer pc.syncPodsLock.Unlock()
+	pc.syncPodsPaused = true
+}
+
+// SyncPodsFromKubernetesInFlight returns the number of the pods being synced from kubernetes
+func (pc *PodController) SyncPodsFromKubernetesInFlight() int {
+	pc.syncPodsLock.Lock()
+	defer pc.syncPodsLock.Unlock()
+	return pc.syncPodsInFlight
+}
+
+// startSyncPodFromKubernetes counts the sync of the pod in flight, returns false if the syncs are paused and the pod is skipped
+func (pc *PodController) startSyncPodFromKubernetes(key string) bool {
+	pc.syncPodsLock.Lock()
+	defer pc.syncPodsLock.Unlock()
+	if pc.syncPodsPaused {
+		if pc.syncPodsSkippedKeys == nil {
+			pc.syncPodsSkippedKeys = make(map[string]struct{})
+		}
+		pc.syncPodsSkippedKeys[key] = struct{}{}
+		return false
+	}
+	pc.syncPodsInFlight++
+	return true
+}
+
+// finishSyncPodFromKubernetes counts the sync of the pod done
+func (pc *PodController) finishSyncPodFromKubernetes() {
+	pc.syncPodsLock.Lock()
+	defer pc.syncPodsLock.Unlock()
+	pc.syncPodsInFlight--
+}
+
 func (pc *PodController) DeletePodsFromKubernetesForget(ctx context.Context, key string) {
 	pc.deletePodsFromKubernetes.Forget(ctx, key)
 }
@@ -361,6 +440,11 @@ func (pc *PodController) syncPodsFromKubernetesHandler(ctx context.Context, key
 
 	// Add the current key as an attribute to the current span.
 	ctx = span.WithField(ctx, "key", key)
+	if !pc.startSyncPodFromKubernetes(key) {
+		log.G(ctx).WithField("key", key).Info("sync paused, pod left pending")
+		return nil
+	}
+	defer pc.finishSyncPodFromKubernetes()
 	log.G(ctx).WithField("key", key).Info("start sync handling")
 
 	// Convert the namespace/name string into a distinct namespace and name.
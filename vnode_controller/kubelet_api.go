@@ -0,0 +1,239 @@
+package vnode_controller
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"os"
+
+	"github.com/koupleless/virtual-kubelet/common/utils"
+	"github.com/koupleless/virtual-kubelet/model"
+	"github.com/koupleless/virtual-kubelet/provider"
+	"github.com/koupleless/virtual-kubelet/tunnel"
+	"github.com/koupleless/virtual-kubelet/virtual_kubelet/node/api"
+	"github.com/koupleless/virtual-kubelet/virtual_kubelet/node/nodeutil"
+	errpkg "github.com/pkg/errors"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"github.com/virtual-kubelet/virtual-kubelet/node/api/statsv1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// bizTarget is the biz container which a kubelet api request is routed to
+type bizTarget struct {
+	nodeName  string
+	podKey    string
+	container *corev1.Container
+	tunnel    tunnel.Tunnel
+}
+
+// buildKubeletAuth returns the tls config verifying the client certificates by the client CA and the webhook auth of the kubelet api
+func buildKubeletAuth(config *model.KubeletServerConfig) (*tls.Config, nodeutil.Auth, error) {
+	tlsConfig := config.TLSConfig
+	if config.ClientCAFile != "" {
+		if tlsConfig == nil {
+			return nil, nil, errpkg.New("kubelet server client CA requires the tls config")
+		}
+		caPEM, err := os.ReadFile(config.ClientCAFile)
+		if err != nil {
+			return nil, nil, errpkg.Wrap(err, "failed to read kubelet server client CA")
+		}
+		clientCAs := x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(caPEM) {
+			return nil, nil, errpkg.Errorf("no certificate found in kubelet server client CA %s", config.ClientCAFile)
+		}
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.ClientCAs = clientCAs
+		// the bearer tokens are authenticated by the webhook auth without client certificates
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		if config.AuthClient != nil {
+			tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+	if config.AuthClient == nil {
+		return tlsConfig, nil, nil
+	}
+	auth, err := nodeutil.WebhookAuth(config.AuthClient, config.ClientCAFile)
+	if err != nil {
+		return nil, nil, errpkg.Wrap(err, "failed to create kubelet server webhook auth")
+	}
+	return tlsConfig, auth, nil
+}
+
+// listenKubeletAPI listens on a port for the kubelet api of the vnode, returns a nil listener if the kubelet api is not served
+func (vNodeController *VNodeController) listenKubeletAPI(nodeName string) (net.Listener, int32) {
+	if vNodeController.kubeletServer == nil {
+		return nil, 0
+	}
+	listener, err := nodeutil.ListenKubeletAPI(vNodeController.kubeletServer.MinPort, vNodeController.kubeletServer.MaxPort)
+	if err != nil {
+		log.G(context.Background()).WithError(err).Errorf("failed to listen kubelet api of vnode %s, the kubelet api is not served", nodeName)
+		return nil, 0
+	}
+	return listener, int32(listener.Addr().(*net.TCPAddr).Port)
+}
+
+// kubeletAddress returns the address advertised by the vnode, empty if the kubelet api of the vnode is not served
+func (vNodeController *VNodeController) kubeletAddress(listener net.Listener) string {
+	if listener == nil {
+		return ""
+	}
+	return vNodeController.kubeletServer.Address
+}
+
+// serveKubeletAPI serves the kubelet api of the vnode on the listener until the vnode stops
+func (vNodeController *VNodeController) serveKubeletAPI(ctx context.Context, listener net.Listener, nodeName string) {
+	err := nodeutil.ServeKubeletAPI(ctx, listener, vNodeController.kubeletTLSConfig, vNodeController.kubeletAuth, nodeName, vNodeController.podHandlerConfig(nodeName))
+	if err != nil {
+		log.G(ctx).WithError(err).Errorf("kubelet api server of vnode %s exited", nodeName)
+	}
+}
+
+// podHandlerConfig returns the handlers of the kubelet api of the vnode, the requests are delegated to the tunnel of the vnode
+func (vNodeController *VNodeController) podHandlerConfig(nodeName string) api.PodHandlerConfig {
+	config := api.PodHandlerConfig{
+		GetContainerLogs: func(ctx context.Context, namespace, podName, containerName string, opts api.ContainerLogOpts) (io.ReadCloser, error) {
+			return vNodeController.getContainerLogs(ctx, nodeName, namespace, podName, containerName, opts)
+		},
+		RunInContainer: func(ctx context.Context, namespace, podName, containerName string, cmd []string, attach api.AttachIO) error {
+			return vNodeController.runInContainer(ctx, nodeName, namespace, podName, containerName, cmd, attach)
+		},
+		AttachToContainer: func(ctx context.Context, namespace, podName, containerName string, attach api.AttachIO) error {
+			return vNodeController.attachToContainer(ctx, nodeName, namespace, podName, containerName, attach)
+		},
+		PortForward: func(ctx context.Context, namespace, podName string, port int32, stream io.ReadWriteCloser) error {
+			return vNodeController.portForward(ctx, nodeName, namespace, podName, port, stream)
+		},
+		GetStatsSummary: func(ctx context.Context) (*statsv1alpha1.Summary, error) {
+			return vNodeController.getStatsSummary(ctx, nodeName)
+		},
+		GetMetricsResource: func(ctx context.Context) ([]*dto.MetricFamily, error) {
+			return vNodeController.getMetricsResource(ctx, nodeName)
+		},
+	}
+	if vNodeController.kubeletServer != nil {
+		config.StreamIdleTimeout = vNodeController.kubeletServer.StreamIdleTimeout
+		config.StreamCreationTimeout = vNodeController.kubeletServer.StreamCreationTimeout
+	}
+	return config
+}
+
+// getVNode returns the running vnode of the kubelet api
+func (vNodeController *VNodeController) getVNode(nodeName string) (*provider.VNode, error) {
+	vNode := vNodeController.vNodeStore.GetVNode(nodeName)
+	if vNode == nil {
+		return nil, errdefs.NotFoundf("vnode %s is not running on this controller", nodeName)
+	}
+	return vNode, nil
+}
+
+// getBizTarget finds the pod on the vnode and the container, containerName is ignored if empty
+func (vNodeController *VNodeController) getBizTarget(ctx context.Context, nodeName, namespace, podName, containerName string) (*bizTarget, error) {
+	pod := &corev1.Pod{}
+	err := vNodeController.cache.Get(ctx, types.NamespacedName{Namespace: namespace, Name: podName}, pod)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, errdefs.NotFoundf("pod %s/%s not found", namespace, podName)
+		}
+		return nil, err
+	}
+
+	if pod.Spec.NodeName != nodeName {
+		return nil, errdefs.NotFoundf("pod %s/%s not found on vnode %s", namespace, podName, nodeName)
+	}
+	vNode, err := vNodeController.getVNode(nodeName)
+	if err != nil {
+		return nil, err
+	}
+
+	target := &bizTarget{
+		nodeName: pod.Spec.NodeName,
+		podKey:   utils.GetPodKey(pod),
+		tunnel:   vNode.GetTunnel(),
+	}
+	if containerName == "" {
+		return target, nil
+	}
+	for _, container := range utils.GetPodContainers(pod) {
+		if container.Name == containerName {
+			target.container = container.DeepCopy()
+			return target, nil
+		}
+	}
+	return nil, errdefs.NotFoundf("container %s not found in pod %s/%s", containerName, namespace, podName)
+}
+
+// getContainerLogs streams the biz logs by the tunnel
+func (vNodeController *VNodeController) getContainerLogs(ctx context.Context, nodeName, namespace, podName, containerName string, opts api.ContainerLogOpts) (io.ReadCloser, error) {
+	target, err := vNodeController.getBizTarget(ctx, nodeName, namespace, podName, containerName)
+	if err != nil {
+		return nil, err
+	}
+	logStreamer, ok := target.tunnel.(tunnel.LogStreamer)
+	if !ok {
+		return nil, errdefs.InvalidInputf("logs are not supported by tunnel %s", target.tunnel.Key())
+	}
+	return logStreamer.GetBizLogs(ctx, target.nodeName, target.podKey, target.container, opts)
+}
+
+// runInContainer runs the command for the biz by the tunnel
+func (vNodeController *VNodeController) runInContainer(ctx context.Context, nodeName, namespace, podName, containerName string, cmd []string, attach api.AttachIO) error {
+	target, err := vNodeController.getBizTarget(ctx, nodeName, namespace, podName, containerName)
+	if err != nil {
+		return err
+	}
+	executor, ok := target.tunnel.(tunnel.Executor)
+	if !ok {
+		return errdefs.InvalidInputf("exec is not supported by tunnel %s", target.tunnel.Key())
+	}
+	return executor.ExecInBiz(ctx, target.nodeName, target.podKey, target.container, cmd, attach)
+}
+
+// attachToContainer attaches to the biz by the tunnel
+func (vNodeController *VNodeController) attachToContainer(ctx context.Context, nodeName, namespace, podName, containerName string, attach api.AttachIO) error {
+	target, err := vNodeController.getBizTarget(ctx, nodeName, namespace, podName, containerName)
+	if err != nil {
+		return err
+	}
+	attacher, ok := target.tunnel.(tunnel.Attacher)
+	if !ok {
+		return errdefs.InvalidInputf("attach is not supported by tunnel %s", target.tunnel.Key())
+	}
+	return attacher.AttachToBiz(ctx, target.nodeName, target.podKey, target.container, attach)
+}
+
+// portForward forwards the port of the base by the tunnel
+func (vNodeController *VNodeController) portForward(ctx context.Context, nodeName, namespace, podName string, port int32, stream io.ReadWriteCloser) error {
+	target, err := vNodeController.getBizTarget(ctx, nodeName, namespace, podName, "")
+	if err != nil {
+		return err
+	}
+	portForwarder, ok := target.tunnel.(tunnel.PortForwarder)
+	if !ok {
+		return errdefs.InvalidInputf("port-forward is not supported by tunnel %s", target.tunnel.Key())
+	}
+	return portForwarder.PortForward(ctx, target.nodeName, target.podKey, port, stream)
+}
+
+// getStatsSummary returns the stats summary of the vnode
+func (vNodeController *VNodeController) getStatsSummary(ctx context.Context, nodeName string) (*statsv1alpha1.Summary, error) {
+	vNode, err := vNodeController.getVNode(nodeName)
+	if err != nil {
+		return nil, err
+	}
+	return vNode.GetStatsSummary(ctx)
+}
+
+// getMetricsResource returns the resource metrics of the vnode
+func (vNodeController *VNodeController) getMetricsResource(ctx context.Context, nodeName string) ([]*dto.MetricFamily, error) {
+	vNode, err := vNodeController.getVNode(nodeName)
+	if err != nil {
+		return nil, err
+	}
+	return vNode.GetMetricsResource(ctx)
+}
@@ -0,0 +1,72 @@
+package vnode_controller
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/koupleless/virtual-kubelet/model"
+	"github.com/stretchr/testify/assert"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+func writeTestCA(t *testing.T) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kubelet-client-ca"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	assert.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	return caFile
+}
+
+func TestBuildKubeletAuth(t *testing.T) {
+	tlsConfig, auth, err := buildKubeletAuth(&model.KubeletServerConfig{})
+	assert.NoError(t, err)
+	assert.Nil(t, tlsConfig)
+	assert.Nil(t, auth)
+
+	caFile := writeTestCA(t)
+	_, _, err = buildKubeletAuth(&model.KubeletServerConfig{ClientCAFile: caFile})
+	assert.Error(t, err)
+
+	_, _, err = buildKubeletAuth(&model.KubeletServerConfig{TLSConfig: &tls.Config{}, ClientCAFile: filepath.Join(t.TempDir(), "missing.crt")})
+	assert.Error(t, err)
+
+	serverTLSConfig := &tls.Config{}
+	tlsConfig, auth, err = buildKubeletAuth(&model.KubeletServerConfig{TLSConfig: serverTLSConfig, ClientCAFile: caFile})
+	assert.NoError(t, err)
+	assert.Nil(t, auth)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, tlsConfig.ClientAuth)
+	assert.NotNil(t, tlsConfig.ClientCAs)
+	// the configured tls config is not modified
+	assert.Nil(t, serverTLSConfig.ClientCAs)
+
+	tlsConfig, auth, err = buildKubeletAuth(&model.KubeletServerConfig{TLSConfig: serverTLSConfig, ClientCAFile: caFile, AuthClient: kubefake.NewSimpleClientset()})
+	assert.NoError(t, err)
+	assert.NotNil(t, auth)
+	assert.Equal(t, tls.VerifyClientCertIfGiven, tlsConfig.ClientAuth)
+
+	tlsConfig, auth, err = buildKubeletAuth(&model.KubeletServerConfig{TLSConfig: serverTLSConfig, AuthClient: kubefake.NewSimpleClientset()})
+	assert.NoError(t, err)
+	assert.NotNil(t, auth)
+	assert.Equal(t, serverTLSConfig, tlsConfig)
+}
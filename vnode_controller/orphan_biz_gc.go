@@ -0,0 +1,146 @@
+package vnode_controller
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/koupleless/virtual-kubelet/common/tracker"
+	"github.com/koupleless/virtual-kubelet/common/utils"
+	"github.com/koupleless/virtual-kubelet/model"
+	"github.com/koupleless/virtual-kubelet/provider"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// An orphan biz runs on a base without a pod in kubernetes, e.g. the pod was deleted while the base was unreachable, or the biz
+// was installed on the base directly. The orphan bizs found in the full biz status of a base are stopped once they stay orphan
+// for the grace period, which covers the pods not synced into the cache yet. A stopped biz still reported as orphan is stopped
+// again after another grace period.
+
+// vNodeOrphanBizs is the orphan bizs of a vnode keyed by biz key, with the time first found orphan
+type vNodeOrphanBizs struct {
+	sync.Mutex
+
+	foundTime map[string]time.Time
+}
+
+// collectOrphanBizs stops the bizs orphan for longer than the grace period, the bizs not reported orphan any more are forgotten.
+// The unmanaged bizs of the vnode are read only when some biz is due, and the round is skipped if they failed to be read.
+func (vNodeController *VNodeController) collectOrphanBizs(ctx context.Context, vNode *provider.VNode, orphanBizs []model.BizStatusData) {
+	if !vNodeController.orphanBizGC.Enabled {
+		return
+	}
+	nodeName := vNode.GetNodeName()
+	if len(orphanBizs) == 0 {
+		vNodeController.forgetOrphanBizs(nodeName)
+		return
+	}
+
+	value, _ := vNodeController.orphanBizs.LoadOrStore(nodeName, &vNodeOrphanBizs{foundTime: make(map[string]time.Time)})
+	orphans := value.(*vNodeOrphanBizs)
+	orphans.Lock()
+	now := time.Now()
+	foundTime := make(map[string]time.Time, len(orphanBizs))
+	dueBizs := make([]model.BizStatusData, 0)
+	for _, biz := range orphanBizs {
+		found, has := orphans.foundTime[biz.Key]
+		if !has {
+			found = now
+		}
+		if now.Sub(found) >= vNodeController.orphanBizGC.GracePeriod {
+			dueBizs = append(dueBizs, biz)
+		}
+		foundTime[biz.Key] = found
+	}
+
+	toCollect := make([]model.BizStatusData, 0, len(dueBizs))
+	if len(dueBizs) > 0 {
+		unmanaged, err := vNodeController.getUnmanagedBizs(ctx, nodeName)
+		if err != nil {
+			// the opted out bizs are unknown, the found times are kept for the next round
+			orphans.Unlock()
+			log.G(ctx).WithError(err).Warnf("failed to get the unmanaged bizs of %s, skip collecting orphan bizs", nodeName)
+			return
+		}
+		for _, biz := range dueBizs {
+			if !unmanaged[biz.Key] && !unmanaged[biz.Name] {
+				toCollect = append(toCollect, biz)
+			}
+			// collect or check the opt out again after another grace period if still orphan
+			foundTime[biz.Key] = now
+		}
+	}
+	orphans.foundTime = foundTime
+	orphans.Unlock()
+
+	for _, biz := range toCollect {
+		vNodeController.collectOrphanBiz(ctx, vNode, biz)
+	}
+}
+
+// collectOrphanBiz stops the orphan biz, or only reports it in dry run
+func (vNodeController *VNodeController) collectOrphanBiz(ctx context.Context, vNode *provider.VNode, biz model.BizStatusData) {
+	nodeName := vNode.GetNodeName()
+	logger := log.G(ctx).WithField("nodeName", nodeName).WithField("bizKey", biz.Key)
+	if vNodeController.orphanBizGC.DryRun {
+		logger.Infof("orphan biz %s found, not stopped in dry run", biz.Key)
+		vNode.RecordEvent(corev1.EventTypeNormal, model.NodeEventReasonOrphanBizFound, "orphan biz %s found by %s, not stopped in dry run", biz.Key, vNodeController.clientID)
+		return
+	}
+
+	labelMap := map[string]string{
+		model.LabelKeyOfVNodeName: nodeName,
+	}
+	err := tracker.G().FuncTrack("", model.TrackSceneOrphanBizGC, model.TrackEventOrphanBizStop, labelMap, func() (error, model.ErrorCode) {
+		operationID, err := vNode.GetTunnel().StopBiz(nodeName, "", orphanBizContainer(biz))
+		if err != nil {
+			return err, model.CodeContainerStopFailed
+		}
+		// no pod waits for the stop, the biz is stopped again after another grace period if it is still running
+		if operationID != "" {
+			vNode.DropBizOperation(operationID)
+		}
+		return nil, model.CodeSuccess
+	})
+	if err != nil {
+		logger.WithError(err).Errorf("failed to stop orphan biz %s", biz.Key)
+		vNode.RecordEvent(corev1.EventTypeWarning, model.NodeEventReasonOrphanBizStopFailed, "failed to stop orphan biz %s by %s: %v", biz.Key, vNodeController.clientID, err)
+		return
+	}
+	logger.Infof("orphan biz %s stopped", biz.Key)
+	vNode.RecordEvent(corev1.EventTypeNormal, model.NodeEventReasonOrphanBizStopped, "orphan biz %s stopped by %s", biz.Key, vNodeController.clientID)
+}
+
+// forgetOrphanBizs forgets the orphan bizs of the vnode
+func (vNodeController *VNodeController) forgetOrphanBizs(nodeName string) {
+	vNodeController.orphanBizs.Delete(nodeName)
+}
+
+// getUnmanagedBizs returns the names and keys of the bizs set in the unmanaged bizs annotation of the vnode
+func (vNodeController *VNodeController) getUnmanagedBizs(ctx context.Context, nodeName string) (map[string]bool, error) {
+	node := &corev1.Node{}
+	if err := vNodeController.client.Get(ctx, types.NamespacedName{Name: nodeName}, node); err != nil {
+		return nil, err
+	}
+	unmanaged := make(map[string]bool)
+	for _, biz := range strings.Split(node.Annotations[model.AnnotationKeyOfUnmanagedBizs], ",") {
+		if biz = strings.TrimSpace(biz); biz != "" {
+			unmanaged[biz] = true
+		}
+	}
+	return unmanaged, nil
+}
+
+// orphanBizContainer returns the container of the orphan biz passed to the tunnel, the version is restored from the biz key
+func orphanBizContainer(biz model.BizStatusData) *corev1.Container {
+	container := &corev1.Container{
+		Name: biz.Name,
+	}
+	if version, ok := strings.CutPrefix(biz.Key, utils.GetBizIdentity(biz.Name, "")); ok && version != "" {
+		container.Env = []corev1.EnvVar{{Name: "BIZ_VERSION", Value: version}}
+	}
+	return container
+}
@@ -0,0 +1,169 @@
+package vnode_controller
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/koupleless/virtual-kubelet/model"
+	"github.com/koupleless/virtual-kubelet/provider"
+	"github.com/koupleless/virtual-kubelet/tunnel"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/cache/informertest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+// orphanMockTunnel records the stopped bizs
+type orphanMockTunnel struct {
+	tunnel.MockTunnel
+
+	sync.Mutex
+	stopped []*corev1.Container
+}
+
+func (t *orphanMockTunnel) StopBiz(_, _ string, container *corev1.Container) (string, error) {
+	t.Lock()
+	defer t.Unlock()
+	t.stopped = append(t.stopped, container)
+	return "", nil
+}
+
+func (t *orphanMockTunnel) stoppedNum() int {
+	t.Lock()
+	defer t.Unlock()
+	return len(t.stopped)
+}
+
+func newOrphanBizGCTest(t *testing.T, gc model.OrphanBizGCConfig) (*VNodeController, *provider.VNode, *orphanMockTunnel, *record.FakeRecorder) {
+	kubeClient := fake.NewClientBuilder().WithObjects(&corev1.Node{
+		ObjectMeta: v1.ObjectMeta{
+			Name: "vnode.test",
+			Annotations: map[string]string{
+				model.AnnotationKeyOfUnmanagedBizs: "unmanaged, unmanaged-key:1.0.0",
+			},
+		},
+	}).Build()
+	tl := &orphanMockTunnel{}
+	vc, err := NewVNodeController(&model.BuildVNodeControllerConfig{
+		VPodType:    "suite",
+		KubeCache:   &informertest.FakeInformers{},
+		OrphanBizGC: gc,
+	}, []tunnel.Tunnel{tl})
+	assert.NoError(t, err)
+	vc.client = kubeClient
+
+	recorder := record.NewFakeRecorder(10)
+	vNode, err := provider.NewVNode(&model.BuildVNodeConfig{
+		Client:        kubeClient,
+		KubeCache:     &informertest.FakeInformers{},
+		NodeName:      "vnode.test",
+		EventRecorder: recorder,
+	}, tl)
+	assert.NoError(t, err)
+	return vc, vNode, tl, recorder
+}
+
+func TestCollectOrphanBizs(t *testing.T) {
+	vc, vNode, tl, recorder := newOrphanBizGCTest(t, model.OrphanBizGCConfig{Enabled: true, GracePeriod: 50 * time.Millisecond})
+	orphans := []model.BizStatusData{
+		{Key: "orphan:1.0.0", Name: "orphan"},
+		{Key: "unmanaged:1.0.0", Name: "unmanaged"},
+		{Key: "unmanaged-key:1.0.0", Name: "unmanaged-key"},
+	}
+
+	// in the grace period
+	vc.collectOrphanBizs(context.TODO(), vNode, orphans)
+	assert.Equal(t, 0, tl.stoppedNum())
+
+	time.Sleep(60 * time.Millisecond)
+	vc.collectOrphanBizs(context.TODO(), vNode, orphans)
+	assert.Equal(t, 1, tl.stoppedNum())
+	assert.Equal(t, "orphan", tl.stopped[0].Name)
+	assert.Equal(t, "1.0.0", tl.stopped[0].Env[0].Value)
+	assert.Contains(t, <-recorder.Events, model.NodeEventReasonOrphanBizStopped)
+
+	// stopped again only after another grace period
+	vc.collectOrphanBizs(context.TODO(), vNode, orphans)
+	assert.Equal(t, 1, tl.stoppedNum())
+
+	// a biz no longer orphan is forgotten
+	vc.collectOrphanBizs(context.TODO(), vNode, nil)
+	time.Sleep(60 * time.Millisecond)
+	vc.collectOrphanBizs(context.TODO(), vNode, orphans)
+	assert.Equal(t, 1, tl.stoppedNum())
+
+	vc.forgetOrphanBizs("vnode.test")
+	_, has := vc.orphanBizs.Load("vnode.test")
+	assert.False(t, has)
+}
+
+func TestCollectOrphanBizs_UnmanagedBizsNotRead(t *testing.T) {
+	vc, vNode, tl, _ := newOrphanBizGCTest(t, model.OrphanBizGCConfig{Enabled: true, GracePeriod: 50 * time.Millisecond})
+	gets := 0
+	getFailed := false
+	vc.client = interceptor.NewClient(vc.client.(client.WithWatch), interceptor.Funcs{
+		Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			gets++
+			if getFailed {
+				return errors.New("unavailable")
+			}
+			return c.Get(ctx, key, obj, opts...)
+		},
+	})
+	orphans := []model.BizStatusData{
+		{Key: "orphan:1.0.0", Name: "orphan"},
+		{Key: "unmanaged:1.0.0", Name: "unmanaged"},
+	}
+
+	// the vnode is read only when some biz is due
+	vc.collectOrphanBizs(context.TODO(), vNode, nil)
+	vc.collectOrphanBizs(context.TODO(), vNode, orphans)
+	assert.Equal(t, 0, gets)
+
+	// the round is skipped once the unmanaged bizs failed to be read, the opted out bizs are never stopped
+	time.Sleep(60 * time.Millisecond)
+	getFailed = true
+	vc.collectOrphanBizs(context.TODO(), vNode, orphans)
+	vc.collectOrphanBizs(context.TODO(), vNode, orphans)
+	assert.Equal(t, 2, gets)
+	assert.Equal(t, 0, tl.stoppedNum())
+
+	// the found times are kept, so the bizs are due at once after the read recovered
+	getFailed = false
+	vc.collectOrphanBizs(context.TODO(), vNode, orphans)
+	assert.Equal(t, 3, gets)
+	assert.Equal(t, 1, tl.stoppedNum())
+	assert.Equal(t, "orphan", tl.stopped[0].Name)
+}
+
+func TestCollectOrphanBizs_DryRunAndDisabled(t *testing.T) {
+	vc, vNode, tl, recorder := newOrphanBizGCTest(t, model.OrphanBizGCConfig{Enabled: true, DryRun: true, GracePeriod: time.Nanosecond})
+	orphans := []model.BizStatusData{{Key: "orphan:1.0.0", Name: "orphan"}}
+	vc.collectOrphanBizs(context.TODO(), vNode, orphans)
+	time.Sleep(time.Millisecond)
+	vc.collectOrphanBizs(context.TODO(), vNode, orphans)
+	assert.Equal(t, 0, tl.stoppedNum())
+	assert.Contains(t, <-recorder.Events, model.NodeEventReasonOrphanBizFound)
+
+	vc, vNode, tl, _ = newOrphanBizGCTest(t, model.OrphanBizGCConfig{GracePeriod: time.Nanosecond})
+	vc.collectOrphanBizs(context.TODO(), vNode, orphans)
+	time.Sleep(time.Millisecond)
+	vc.collectOrphanBizs(context.TODO(), vNode, orphans)
+	assert.Equal(t, 0, tl.stoppedNum())
+}
+
+func TestOrphanBizContainer(t *testing.T) {
+	container := orphanBizContainer(model.BizStatusData{Key: "biz:1.0.0", Name: "biz"})
+	assert.Equal(t, "biz", container.Name)
+	assert.Equal(t, []corev1.EnvVar{{Name: "BIZ_VERSION", Value: "1.0.0"}}, container.Env)
+
+	container = orphanBizContainer(model.BizStatusData{Key: "other", Name: "biz"})
+	assert.Empty(t, container.Env)
+}
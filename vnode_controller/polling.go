@@ -0,0 +1,103 @@
+package vnode_controller
+
+import (
+	"context"
+	"sync"
+
+	"github.com/koupleless/virtual-kubelet/common/utils"
+	"github.com/koupleless/virtual-kubelet/model"
+	"github.com/koupleless/virtual-kubelet/tunnel"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+)
+
+// vNodePollers polls the health data and the biz status of a base, a nil poller means the status is not polled
+type vNodePollers struct {
+	sync.Mutex
+
+	healthData *utils.AdaptivePoller // Poller of the health data
+	bizStatus  *utils.AdaptivePoller // Poller of all biz status
+
+	lastNodeStatus *model.NodeStatusData // Last health data, to find out whether the health data changed
+}
+
+// startPolling starts polling the base of the vnode until the context is done, the polling pushed by the tunnel is skipped
+func (vNodeController *VNodeController) startPolling(ctx context.Context, t tunnel.Tunnel, nodeName string) {
+	if vNodeController.polling.Disabled {
+		return
+	}
+	pushesHealthData, pushesBizStatus := false, false
+	if pusher, ok := t.(tunnel.StatusPusher); ok {
+		pushesHealthData, pushesBizStatus = pusher.PushesHealthData(), pusher.PushesBizStatus()
+	}
+	if _, ok := t.(tunnel.BizStatusDeltaReporter); ok {
+		// the deltas are pushed, resynced only on revision gaps
+		pushesBizStatus = true
+	}
+
+	pollers := &vNodePollers{}
+	if !pushesHealthData {
+		pollers.healthData = utils.NewAdaptivePoller(vNodeController.polling.HealthDataInterval, vNodeController.polling.MaxIntervalMultiplier, vNodeController.polling.Jitter)
+	}
+	if !pushesBizStatus {
+		pollers.bizStatus = utils.NewAdaptivePoller(vNodeController.polling.BizStatusInterval, vNodeController.polling.MaxIntervalMultiplier, vNodeController.polling.Jitter)
+	}
+	vNodeController.pollers.Store(nodeName, pollers)
+
+	if pollers.healthData != nil {
+		go pollers.healthData.Run(ctx, func(ctx context.Context) {
+			log.G(ctx).Debugf("fetch node health data for node %s", nodeName)
+			if err := t.FetchHealthData(nodeName); err != nil {
+				log.G(ctx).WithError(err).Errorf("Failed to fetch node health info from %s", nodeName)
+			}
+		})
+	}
+	if pollers.bizStatus != nil {
+		go pollers.bizStatus.Run(ctx, func(ctx context.Context) {
+			log.G(ctx).Debugf("query all container status data for node %s", nodeName)
+			if err := t.QueryAllBizStatusData(nodeName); err != nil {
+				log.G(ctx).WithError(err).Errorf("Failed to query containers info from %s", nodeName)
+			}
+		})
+	}
+}
+
+// stopPolling forgets the pollers of the vnode, the pollers stop with the context of the vnode
+func (vNodeController *VNodeController) stopPolling(nodeName string) {
+	vNodeController.pollers.Delete(nodeName)
+}
+
+// getPollers returns the pollers of the vnode, nil if the vnode is not polled
+func (vNodeController *VNodeController) getPollers(nodeName string) *vNodePollers {
+	pollers, has := vNodeController.pollers.Load(nodeName)
+	if !has {
+		return nil
+	}
+	return pollers.(*vNodePollers)
+}
+
+// speedUpPolling polls the biz status of the vnode at once after a deployment, and keeps polling fast until nothing changes
+func (vNodeController *VNodeController) speedUpPolling(nodeName string) {
+	if pollers := vNodeController.getPollers(nodeName); pollers != nil && pollers.bizStatus != nil {
+		pollers.bizStatus.SpeedUp()
+	}
+}
+
+// observeHealthData backs off the health data polling of the vnode if the health data not changed
+func (vNodeController *VNodeController) observeHealthData(nodeName string, data model.NodeStatusData) {
+	pollers := vNodeController.getPollers(nodeName)
+	if pollers == nil || pollers.healthData == nil {
+		return
+	}
+	pollers.Lock()
+	changed := pollers.lastNodeStatus == nil || !utils.NodeStatusEqual(*pollers.lastNodeStatus, data)
+	pollers.lastNodeStatus = &data
+	pollers.Unlock()
+	pollers.healthData.Observe(changed)
+}
+
+// observeBizStatus backs off the biz status polling of the vnode if no biz status changed
+func (vNodeController *VNodeController) observeBizStatus(nodeName string, changed bool) {
+	if pollers := vNodeController.getPollers(nodeName); pollers != nil && pollers.bizStatus != nil {
+		pollers.bizStatus.Observe(changed)
+	}
+}
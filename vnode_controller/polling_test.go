@@ -0,0 +1,97 @@
+package vnode_controller
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/koupleless/virtual-kubelet/model"
+	"github.com/koupleless/virtual-kubelet/tunnel"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/controller-runtime/pkg/cache/informertest"
+)
+
+// pollingMockTunnel counts the polls, and pushes the status if push is set
+type pollingMockTunnel struct {
+	tunnel.MockTunnel
+	push bool
+
+	queried atomic.Int32
+}
+
+func (t *pollingMockTunnel) PushesHealthData() bool {
+	return t.push
+}
+
+func (t *pollingMockTunnel) PushesBizStatus() bool {
+	return t.push
+}
+
+func (t *pollingMockTunnel) FetchHealthData(_ string) error {
+	return nil
+}
+
+func (t *pollingMockTunnel) QueryAllBizStatusData(_ string) error {
+	t.queried.Add(1)
+	return nil
+}
+
+func TestStartPolling(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tl := &pollingMockTunnel{}
+	vc, _ := NewVNodeController(&model.BuildVNodeControllerConfig{
+		VPodType:  "suite",
+		KubeCache: &informertest.FakeInformers{},
+		Polling:   model.PollingConfig{BizStatusInterval: time.Hour},
+	}, []tunnel.Tunnel{tl})
+	assert.Equal(t, model.HealthDataPollIntervalSeconds*time.Second, vc.polling.HealthDataInterval)
+	assert.Equal(t, model.PollMaxIntervalMultiplier, vc.polling.MaxIntervalMultiplier)
+
+	vc.startPolling(ctx, tl, "vnode.test")
+	pollers := vc.getPollers("vnode.test")
+	assert.NotNil(t, pollers.healthData)
+	assert.NotNil(t, pollers.bizStatus)
+
+	// back off while nothing changes
+	vc.observeBizStatus("vnode.test", false)
+	assert.Equal(t, 2*time.Hour, pollers.bizStatus.Interval())
+	data := model.NodeStatusData{Resources: map[corev1.ResourceName]model.NodeResource{
+		corev1.ResourceCPU: {Capacity: resource.MustParse("1")},
+	}}
+	vc.observeHealthData("vnode.test", data)
+	assert.Equal(t, 10*time.Second, pollers.healthData.Interval())
+	vc.observeHealthData("vnode.test", data)
+	assert.Equal(t, 20*time.Second, pollers.healthData.Interval())
+
+	// a deployment polls at once
+	vc.speedUpPolling("vnode.test")
+	assert.Equal(t, time.Hour, pollers.bizStatus.Interval())
+	assert.Eventually(t, func() bool {
+		return tl.queried.Load() == 1
+	}, time.Second, 10*time.Millisecond)
+
+	vc.stopPolling("vnode.test")
+	assert.Nil(t, vc.getPollers("vnode.test"))
+	vc.speedUpPolling("vnode.test")
+}
+
+func TestStartPolling_Skipped(t *testing.T) {
+	tl := &pollingMockTunnel{push: true}
+	vc, _ := NewVNodeController(&model.BuildVNodeControllerConfig{
+		VPodType:  "suite",
+		KubeCache: &informertest.FakeInformers{},
+	}, []tunnel.Tunnel{tl})
+	vc.startPolling(context.TODO(), tl, "vnode.test")
+	pollers := vc.getPollers("vnode.test")
+	assert.Nil(t, pollers.healthData)
+	assert.Nil(t, pollers.bizStatus)
+
+	vc.polling.Disabled = true
+	vc.startPolling(context.TODO(), &tunnel.MockTunnel{}, "vnode.test2")
+	assert.Nil(t, vc.getPollers("vnode.test2"))
+}
@@ -0,0 +1,191 @@
+package vnode_controller
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/koupleless/virtual-kubelet/common/utils"
+	"github.com/koupleless/virtual-kubelet/model"
+	"github.com/koupleless/virtual-kubelet/provider"
+	"github.com/koupleless/virtual-kubelet/tunnel"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// In cluster deployment, each vk replica renews a lease labelled with the component and env, so that the replicas discover each other.
+// The vnodes are sharded over the replicas by a consistent hash ring of their client ids, and each replica only starts the vnodes in
+// its shard, instead of racing for the leases of all vnodes. When replicas join or leave, only the vnodes of the changed shards move,
+// the replica losing a vnode hands it off, and the replica gaining a vnode acquires the released lease.
+
+// pendingBase is a base discovered before the replicas discovered
+type pendingBase struct {
+	tunnel   tunnel.Tunnel
+	nodeInfo model.NodeInfo
+}
+
+// isInShard returns whether the vnode is in the shard of this vk, all vnodes are in the shard when not deployed in cluster
+func (vNodeController *VNodeController) isInShard(nodeName string) bool {
+	if !vNodeController.isCluster {
+		return true
+	}
+	ring := vNodeController.shardRing.Load()
+	if ring == nil {
+		// the replicas are not discovered yet, wait for the ring rather than racing for the lease
+		return false
+	}
+	return ring.Get(nodeName) == vNodeController.clientID
+}
+
+// syncShard renews the lease of this replica, rebuilds the hash ring from the discovered replicas and rebalances the vnodes
+func (vNodeController *VNodeController) syncShard(ctx context.Context) {
+	if err := vNodeController.renewReplicaLease(ctx); err != nil {
+		log.G(ctx).WithError(err).Errorf("failed to renew the lease of vk replica %s", vNodeController.clientID)
+	}
+
+	replicas, err := vNodeController.discoverReplicas(ctx)
+	if err != nil {
+		log.G(ctx).WithError(err).Error("failed to discover vk replicas")
+		return
+	}
+	ring := utils.NewHashRing(replicas, model.ShardVirtualNodeNum)
+	previous := vNodeController.shardRing.Swap(ring)
+	if !ring.SameMembers(previous) {
+		log.G(ctx).Infof("vk replicas changed to %v", ring.Members())
+		// start the vnodes moved into this shard, the others are skipped
+		if err = vNodeController.discoverVNodesFromKube(ctx); err != nil {
+			log.G(ctx).WithError(err).Error("failed to discover vnodes of the shard")
+		}
+	}
+	vNodeController.startPendingBases()
+	vNodeController.rebalanceShard(ctx)
+}
+
+// startPendingBases starts the bases in the shard discovered before the replicas discovered
+func (vNodeController *VNodeController) startPendingBases() {
+	vNodeController.pendingBases.Range(func(key, value any) bool {
+		vNodeController.pendingBases.Delete(key)
+		base := value.(pendingBase)
+		vNodeController.startVNode(base.tunnel, base.nodeInfo)
+		return true
+	})
+}
+
+// rebalanceShard hands off the vnodes moved out of the shard, at most model.ShardRebalanceMaxVNodeNum vnodes each time,
+// so that a big move is spread over several syncs instead of stalling all of them at once
+func (vNodeController *VNodeController) rebalanceShard(ctx context.Context) {
+	toHandOff := make([]*provider.VNode, 0)
+	for _, vNode := range vNodeController.vNodeStore.GetVNodes() {
+		if vNode.IsHandingOff() || vNodeController.isInShard(vNode.GetNodeName()) {
+			continue
+		}
+		if !vNode.IsLeader(vNodeController.clientID) {
+			// the lease is not acquired yet, stop waiting for it
+			go vNode.StepDown(ctx)
+			continue
+		}
+		if len(toHandOff) < model.ShardRebalanceMaxVNodeNum {
+			toHandOff = append(toHandOff, vNode)
+		}
+	}
+	if len(toHandOff) == 0 {
+		return
+	}
+
+	nodeNames := make([]string, 0, len(toHandOff))
+	for _, vNode := range toHandOff {
+		nodeNames = append(nodeNames, vNode.GetNodeName())
+	}
+	log.G(ctx).Infof("hand off vnodes %v moved out of the shard", nodeNames)
+	vNodeController.handOffVNodes(toHandOff)
+}
+
+// discoverReplicas returns the client ids of the vk replicas of the env with valid leases, this replica is always included
+func (vNodeController *VNodeController) discoverReplicas(ctx context.Context) ([]string, error) {
+	leaseList := &coordinationv1.LeaseList{}
+	err := vNodeController.client.List(ctx, leaseList, client.InNamespace(corev1.NamespaceNodeLease), client.MatchingLabels{
+		model.LabelKeyOfComponent: model.ComponentVKReplica,
+		model.LabelKeyOfEnv:       vNodeController.env,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	replicas := []string{vNodeController.clientID}
+	for _, lease := range leaseList.Items {
+		if utils.IsLeaseValid(&lease) && *lease.Spec.HolderIdentity != "" {
+			replicas = append(replicas, *lease.Spec.HolderIdentity)
+		}
+	}
+	return replicas, nil
+}
+
+// renewReplicaLease creates or renews the lease of this replica
+func (vNodeController *VNodeController) renewReplicaLease(ctx context.Context) error {
+	lease := &coordinationv1.Lease{}
+	err := vNodeController.client.Get(ctx, types.NamespacedName{
+		Namespace: corev1.NamespaceNodeLease,
+		Name:      replicaLeaseName(vNodeController.clientID),
+	}, lease)
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+		return vNodeController.client.Create(ctx, &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: corev1.NamespaceNodeLease,
+				Name:      replicaLeaseName(vNodeController.clientID),
+				Labels: map[string]string{
+					model.LabelKeyOfComponent: model.ComponentVKReplica,
+					model.LabelKeyOfEnv:       vNodeController.env,
+				},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       ptr.To(vNodeController.clientID),
+				LeaseDurationSeconds: ptr.To(vNodeController.replicaLeaseDurationSeconds()),
+				RenewTime:            &metav1.MicroTime{Time: time.Now()},
+			},
+		})
+	}
+
+	newLease := lease.DeepCopy()
+	newLease.Spec.HolderIdentity = ptr.To(vNodeController.clientID)
+	newLease.Spec.LeaseDurationSeconds = ptr.To(vNodeController.replicaLeaseDurationSeconds())
+	newLease.Spec.RenewTime = &metav1.MicroTime{Time: time.Now()}
+	return vNodeController.client.Patch(ctx, newLease, client.MergeFrom(lease))
+}
+
+// replicaLeaseDurationSeconds returns the duration of the lease of this replica, the same as the vnode leases
+func (vNodeController *VNodeController) replicaLeaseDurationSeconds() int32 {
+	return int32(vNodeController.liveness.LeaseDuration / time.Second)
+}
+
+// deleteReplicaLease removes the lease of this replica, so that the other replicas take over its shard without waiting for the lease expired
+func (vNodeController *VNodeController) deleteReplicaLease(ctx context.Context) error {
+	err := vNodeController.client.Delete(ctx, &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: corev1.NamespaceNodeLease,
+			Name:      replicaLeaseName(vNodeController.clientID),
+		},
+	})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// replicaLeaseName returns the name of the lease of the vk replica, the characters not allowed in a name are replaced by '-'
+func replicaLeaseName(clientID string) string {
+	return "vk-replica-" + strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' || r == '.' {
+			return r
+		}
+		return '-'
+	}, strings.ToLower(clientID))
+}
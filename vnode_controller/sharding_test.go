@@ -0,0 +1,133 @@
+package vnode_controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/koupleless/virtual-kubelet/common/utils"
+	"github.com/koupleless/virtual-kubelet/model"
+	"github.com/koupleless/virtual-kubelet/tunnel"
+	"github.com/stretchr/testify/assert"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/cache/informertest"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newReplicaLease(clientID, env string, renewTime time.Time) *coordinationv1.Lease {
+	return &coordinationv1.Lease{
+		ObjectMeta: v1.ObjectMeta{
+			Namespace: corev1.NamespaceNodeLease,
+			Name:      replicaLeaseName(clientID),
+			Labels: map[string]string{
+				model.LabelKeyOfComponent: model.ComponentVKReplica,
+				model.LabelKeyOfEnv:       env,
+			},
+		},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       ptr.To(clientID),
+			LeaseDurationSeconds: ptr.To(int32(model.NodeLeaseDurationSeconds)),
+			RenewTime:            &v1.MicroTime{Time: renewTime},
+		},
+	}
+}
+
+func TestIsInShard(t *testing.T) {
+	vc, _ := NewVNodeController(&model.BuildVNodeControllerConfig{
+		ClientID:  "vk-a",
+		VPodType:  "suite",
+		KubeCache: &informertest.FakeInformers{},
+	}, []tunnel.Tunnel{&tunnel.MockTunnel{}})
+	assert.True(t, vc.isInShard("vnode.test"))
+
+	vc.isCluster = true
+	assert.False(t, vc.isInShard("vnode.test"))
+
+	ring := utils.NewHashRing([]string{"vk-a", "vk-b"}, model.ShardVirtualNodeNum)
+	vc.shardRing.Store(ring)
+	inShard := 0
+	for _, nodeName := range []string{"vnode.1", "vnode.2", "vnode.3", "vnode.4", "vnode.5", "vnode.6"} {
+		assert.Equal(t, ring.Get(nodeName) == "vk-a", vc.isInShard(nodeName))
+		if vc.isInShard(nodeName) {
+			inShard++
+		}
+	}
+	assert.Greater(t, inShard, 0)
+}
+
+func TestSyncShard(t *testing.T) {
+	kubeClient := fake.NewClientBuilder().WithObjects(
+		newReplicaLease("vk-b", "suite", time.Now()),
+		newReplicaLease("vk-c", "suite", time.Now().Add(-time.Hour)),
+		newReplicaLease("vk-d", "other", time.Now()),
+	).Build()
+	vc, _ := NewVNodeController(&model.BuildVNodeControllerConfig{
+		ClientID:  "vk-a",
+		Env:       "suite",
+		VPodType:  "suite",
+		IsCluster: true,
+		KubeCache: &informertest.FakeInformers{},
+		Liveness:  model.LivenessConfig{LeaseDuration: time.Minute},
+	}, []tunnel.Tunnel{&tunnel.MockTunnel{}})
+	vc.client = kubeClient
+
+	vc.syncShard(context.TODO())
+	assert.Equal(t, []string{"vk-a", "vk-b"}, vc.shardRing.Load().Members())
+
+	lease := &coordinationv1.Lease{}
+	assert.NoError(t, kubeClient.Get(context.TODO(), types.NamespacedName{Namespace: corev1.NamespaceNodeLease, Name: replicaLeaseName("vk-a")}, lease))
+	assert.Equal(t, "vk-a", *lease.Spec.HolderIdentity)
+	assert.Equal(t, int32(60), *lease.Spec.LeaseDurationSeconds)
+	assert.True(t, utils.IsLeaseValid(lease))
+
+	// the replica renews its own lease
+	renewTime := lease.Spec.RenewTime.Time
+	time.Sleep(10 * time.Millisecond)
+	vc.syncShard(context.TODO())
+	assert.NoError(t, kubeClient.Get(context.TODO(), types.NamespacedName{Namespace: corev1.NamespaceNodeLease, Name: replicaLeaseName("vk-a")}, lease))
+	assert.True(t, lease.Spec.RenewTime.Time.After(renewTime))
+
+	assert.NoError(t, vc.deleteReplicaLease(context.TODO()))
+	assert.NoError(t, vc.deleteReplicaLease(context.TODO()))
+}
+
+func TestReplicaLeaseName(t *testing.T) {
+	assert.Equal(t, "vk-replica-vk-0.default", replicaLeaseName("vk-0.default"))
+	assert.Equal(t, "vk-replica-vk-a-1", replicaLeaseName("VK_a:1"))
+}
+
+func TestStartVNode_BeforeShardSynced(t *testing.T) {
+	kubeClient := fake.NewClientBuilder().WithObjects(newReplicaLease("vk-b", "suite", time.Now())).Build()
+	vc, _ := NewVNodeController(&model.BuildVNodeControllerConfig{
+		ClientID:  "vk-a",
+		Env:       "suite",
+		VPodType:  "suite",
+		IsCluster: true,
+		KubeCache: &informertest.FakeInformers{},
+	}, []tunnel.Tunnel{&tunnel.MockTunnel{}})
+	vc.client = kubeClient
+
+	// a base of the shard of the other replica, so the vnode is not started by this one
+	ring := utils.NewHashRing([]string{"vk-a", "vk-b"}, model.ShardVirtualNodeNum)
+	nodeName := ""
+	for i := 0; nodeName == ""; i++ {
+		if name := fmt.Sprintf("vnode.%d", i); ring.Get(name) == "vk-b" {
+			nodeName = name
+		}
+	}
+
+	// the heartbeat before the replicas discovered is queued instead of dropped
+	vc.startVNode(&tunnel.MockTunnel{}, model.NodeInfo{Metadata: model.NodeMetadata{Name: nodeName}, State: model.NodeStateActivated})
+	_, pending := vc.pendingBases.Load(nodeName)
+	assert.True(t, pending)
+
+	vc.syncShard(context.TODO())
+	_, pending = vc.pendingBases.Load(nodeName)
+	assert.False(t, pending)
+	assert.Nil(t, vc.vNodeStore.GetVNode(nodeName))
+}
@@ -2,25 +2,32 @@ package vnode_controller
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"github.com/koupleless/virtual-kubelet/tunnel"
+	"github.com/koupleless/virtual-kubelet/virtual_kubelet/node/nodeutil"
 	"github.com/koupleless/virtual-kubelet/vnode_controller/predicates"
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/types"
+	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/koupleless/virtual-kubelet/common/metrics"
 	"github.com/koupleless/virtual-kubelet/common/utils"
 	"github.com/koupleless/virtual-kubelet/model"
 	"github.com/koupleless/virtual-kubelet/provider"
 	errpkg "github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 	"github.com/virtual-kubelet/virtual-kubelet/log"
 	"github.com/virtual-kubelet/virtual-kubelet/trace"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -52,9 +59,39 @@ type VNodeController struct {
 
 	cache cache.Cache // The cache for the controller
 
+	eventRecorder record.EventRecorder // The recorder of the pod events for the controller
+
 	ready chan struct{} // The channel for the controller to be ready
 
-	tunnel tunnel.Tunnel
+	tunnels []tunnel.Tunnel // The tunnels hosted by the controller, each vnode is bound to the tunnel which discovered it
+
+	liveness model.LivenessConfig // The default liveness policy of the vnodes
+
+	polling model.PollingConfig // The polling policy of the bases
+
+	podStatusWriter model.PodStatusWriterConfig // The policy of writing the pod status of the vnodes
+
+	pollers sync.Map // The pollers of the vnodes keyed by node name
+
+	orphanBizGC model.OrphanBizGCConfig // The policy of collecting the orphan bizs on the bases
+
+	orphanBizs sync.Map // The orphan bizs of the vnodes keyed by node name
+
+	drainTimeout time.Duration // The max time of draining a deactivated vnode, no drain if 0
+
+	bizClassifier model.BizClassifier // The configured classifier of the containers, nil means classified by the tunnel or the default
+
+	kubeletServer *model.KubeletServerConfig // The config of the kubelet api servers of the vnodes, nil means no kubelet api
+
+	kubeletTLSConfig *tls.Config // The tls config of the kubelet api servers, with the client certificate verification
+
+	kubeletAuth nodeutil.Auth // The webhook auth of the kubelet api requests, nil means no webhook auth
+
+	vPodStorePersister model.VPodStorePersister // The persister of the vpods of the vnodes, nil means the vpods are only kept in memory
+
+	shardRing atomic.Pointer[utils.HashRing] // The consistent hash ring of the vk replicas in cluster deployment, nil before the replicas discovered
+
+	pendingBases sync.Map // The bases discovered before the replicas discovered keyed by node name, started once the shard synced
 
 	vNodeStore *provider.VNodeStore // The runtime info store for the controller
 }
@@ -66,11 +103,26 @@ func (vNodeController *VNodeController) Reconcile(_ context.Context, _ reconcile
 }
 
 // NewVNodeController creates a new VNodeController
-func NewVNodeController(config *model.BuildVNodeControllerConfig, tunnel tunnel.Tunnel) (*VNodeController, error) {
+func NewVNodeController(config *model.BuildVNodeControllerConfig, tunnels []tunnel.Tunnel) (*VNodeController, error) {
 	if config == nil {
 		return nil, errors.New("config must not be nil")
 	}
 
+	if len(tunnels) == 0 {
+		return nil, errors.New("tunnels must not be empty")
+	}
+
+	tunnelKeys := make(map[string]bool)
+	for _, t := range tunnels {
+		if t == nil {
+			return nil, errors.New("tunnel must not be nil")
+		}
+		if tunnelKeys[t.Key()] {
+			return nil, fmt.Errorf("duplicate tunnel key %s", t.Key())
+		}
+		tunnelKeys[t.Key()] = true
+	}
+
 	if config.VPodType == "" {
 		return nil, errors.New("config must set vpod identity")
 	}
@@ -83,28 +135,81 @@ func NewVNodeController(config *model.BuildVNodeControllerConfig, tunnel tunnel.
 		config.VNodeWorkerNum = 1
 	}
 
+	var kubeletTLSConfig *tls.Config
+	var kubeletAuth nodeutil.Auth
+	var err error
+	if config.KubeletServer != nil {
+		if net.ParseIP(config.KubeletServer.Address) == nil {
+			return nil, errpkg.Errorf("invalid kubelet server address %q, must be the ip of the controller", config.KubeletServer.Address)
+		}
+		if config.KubeletServer.MaxPort != 0 && (config.KubeletServer.MinPort <= 0 || config.KubeletServer.MinPort > config.KubeletServer.MaxPort) {
+			return nil, errpkg.Errorf("invalid kubelet server port range %d-%d", config.KubeletServer.MinPort, config.KubeletServer.MaxPort)
+		}
+		kubeletTLSConfig, kubeletAuth, err = buildKubeletAuth(config.KubeletServer)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &VNodeController{
-		clientID:         config.ClientID,
-		env:              config.Env,
-		client:           config.KubeClient,
-		cache:            config.KubeCache,
-		vPodType:         config.VPodType,
-		isCluster:        config.IsCluster,
-		workloadMaxLevel: config.WorkloadMaxLevel,
-		vNodeWorkerNum:   config.VNodeWorkerNum,
-		vNodeStore:       provider.NewVNodeStore(),
-		ready:            make(chan struct{}),
-		tunnel:           tunnel,
+		clientID:           config.ClientID,
+		env:                config.Env,
+		client:             config.KubeClient,
+		cache:              config.KubeCache,
+		vPodType:           config.VPodType,
+		isCluster:          config.IsCluster,
+		workloadMaxLevel:   config.WorkloadMaxLevel,
+		vNodeWorkerNum:     config.VNodeWorkerNum,
+		vNodeStore:         provider.NewVNodeStore(),
+		ready:              make(chan struct{}),
+		tunnels:            tunnels,
+		liveness:           utils.FillLivenessConfigDefaults(config.Liveness),
+		polling:            utils.FillPollingConfigDefaults(config.Polling),
+		podStatusWriter:    utils.FillPodStatusWriterConfigDefaults(config.PodStatusWriter),
+		orphanBizGC:        utils.FillOrphanBizGCConfigDefaults(config.OrphanBizGC),
+		drainTimeout:       config.DrainTimeout,
+		bizClassifier:      config.BizClassifier,
+		kubeletServer:      config.KubeletServer,
+		kubeletTLSConfig:   kubeletTLSConfig,
+		kubeletAuth:        kubeletAuth,
+		vPodStorePersister: config.VPodStorePersister,
 	}, nil
 }
 
 // SetupWithManager sets up the controller with the manager
 func (vNodeController *VNodeController) SetupWithManager(ctx context.Context, mgr manager.Manager) (err error) {
-	// init  tunnel
-	vNodeController.tunnel.RegisterCallback(vNodeController.onBaseDiscovered, vNodeController.onBaseStatusArrived, vNodeController.onAllBizStatusArrived, vNodeController.onSingleBizStatusArrived)
+	// init tunnels, bind the callbacks to the tunnel so that the discovered vnode can be routed back to it
+	for _, t := range vNodeController.tunnels {
+		callbackTotal := func(callback string) prometheus.Counter {
+			return metrics.TunnelCallbackTotal.WithLabelValues(t.Key(), callback)
+		}
+		t.RegisterCallback(func(data model.NodeInfo) {
+			callbackTotal(metrics.CallbackBaseDiscovered).Inc()
+			vNodeController.onBaseDiscovered(t, data)
+		}, func(nodeName string, data model.NodeStatusData) {
+			callbackTotal(metrics.CallbackBaseStatusArrived).Inc()
+			vNodeController.onBaseStatusArrived(nodeName, data)
+		}, func(nodeName string, bizStatusDatas []model.BizStatusData) {
+			callbackTotal(metrics.CallbackAllBizStatusArrived).Inc()
+			vNodeController.onAllBizStatusArrived(nodeName, bizStatusDatas)
+		}, func(nodeName string, bizStatusData model.BizStatusData) {
+			callbackTotal(metrics.CallbackSingleBizStatusArrived).Inc()
+			vNodeController.onSingleBizStatusArrived(nodeName, bizStatusData)
+		}, func(nodeName string, response model.BizOperationResponse) {
+			callbackTotal(metrics.CallbackBizOperationResponseArrived).Inc()
+			vNodeController.onBizOperationResponseArrived(nodeName, response)
+		})
+		if reporter, ok := t.(tunnel.BizStatusDeltaReporter); ok {
+			reporter.RegisterBizStatusDeltaCallback(func(nodeName string, delta model.BizStatusDelta) {
+				callbackTotal(metrics.CallbackBizStatusDeltaArrived).Inc()
+				vNodeController.onBizStatusDeltaArrived(reporter, nodeName, delta)
+			})
+		}
+	}
 
 	vNodeController.client = mgr.GetClient()
 	vNodeController.cache = mgr.GetCache()
+	vNodeController.eventRecorder = mgr.GetEventRecorderFor("vnode-controller")
 
 	log.G(ctx).Info("Setting up register controller")
 
@@ -147,39 +252,70 @@ func (vNodeController *VNodeController) SetupWithManager(ctx context.Context, mg
 		return err
 	}
 
+	// start all tunnels
+	for _, t := range vNodeController.tunnels {
+		if err = t.Start(vNodeController.clientID, vNodeController.env); err != nil {
+			log.G(ctx).WithError(err).Errorf("failed to start tunnel %s", t.Key())
+			return err
+		}
+		log.G(ctx).Infof("tunnel %s started", t.Key())
+	}
+
+	// hand off the vnodes to other vk instances and stop all tunnels when the manager stops, the manager waits for the
+	// handoff within its graceful shutdown timeout
+	err = mgr.Add(manager.RunnableFunc(func(mgrCtx context.Context) error {
+		select {
+		case <-mgrCtx.Done():
+		case <-ctx.Done():
+		}
+		if vNodeController.isCluster {
+			if err := vNodeController.deleteReplicaLease(context.Background()); err != nil {
+				log.G(ctx).WithError(err).Errorf("failed to delete the lease of vk replica %s", vNodeController.clientID)
+			}
+		}
+		vNodeController.handOffVNodes(vNodeController.leaderVNodes())
+		for _, t := range vNodeController.tunnels {
+			if stopErr := t.Stop(); stopErr != nil {
+				log.G(ctx).WithError(stopErr).Errorf("failed to stop tunnel %s", t.Key())
+			}
+		}
+		return nil
+	}))
+	if err != nil {
+		log.G(ctx).WithError(err).Error("failed to add the vnode handoff to the manager")
+		return err
+	}
+
 	go func() {
 		// wait for all tunnel to be ready
 		utils.CheckAndFinallyCall(context.Background(), func() (bool, error) {
-			if !vNodeController.tunnel.Ready() {
-				return false, nil
+			for _, t := range vNodeController.tunnels {
+				if !t.Ready() {
+					return false, nil
+				}
 			}
 			return true, nil
 		}, time.Minute, time.Second, func() {
-			log.G(ctx).Infof("tunnel %v are ready", vNodeController.tunnel)
+			log.G(ctx).Infof("tunnels %v are ready", vNodeController.tunnelKeys())
 		}, func() {
-			log.G(ctx).Errorf("waiting for tunnel %v to be ready timeout", vNodeController.tunnel)
+			log.G(ctx).Errorf("waiting for tunnels %v to be ready timeout", vNodeController.tunnelKeys())
 		})
 
 		synced := vNodeController.cache.WaitForCacheSync(ctx)
 		if synced {
-			// This section is responsible for restarting the virtual kubelet for previous nodes.
-			componentRequirement, _ := labels.NewRequirement(model.LabelKeyOfComponent, selection.In, []string{model.ComponentVNode})
-			envRequirement, _ := labels.NewRequirement(model.LabelKeyOfEnv, selection.In, []string{vNodeController.env})
-
-			nodeList := &corev1.NodeList{}
-			err = vNodeController.client.List(ctx, nodeList, &client.ListOptions{
-				LabelSelector: labels.NewSelector().Add(*componentRequirement, *envRequirement),
-			})
-			if err != nil {
+			if vNodeController.isCluster {
+				// Periodically discover the vk replicas and rebalance the shard, the previous nodes in the shard are restarted once the replicas discovered.
+				go utils.TimedTaskWithInterval(ctx, vNodeController.liveness.LeaseRenewPeriod, vNodeController.syncShard)
+			} else if err = vNodeController.discoverVNodesFromKube(ctx); err != nil {
 				log.G(ctx).WithError(err).Error("failed to list nodes")
 				return
 			}
 
-			// Discover and process previous nodes to ensure they are properly registered.
-			vNodeController.discoverPreviousNodes(nodeList)
-
 			// Periodically check for outdated virtual nodes and wake them up if necessary.
-			go utils.TimedTaskWithInterval(ctx, 5*time.Second, func(ctx context.Context) {
+			go utils.TimedTaskWithInterval(ctx, vNodeController.liveness.LeaseOutdatedScanInterval, func(ctx context.Context) {
+				metrics.VNodeNum.WithLabelValues(metrics.VNodeStateAll).Set(float64(vNodeController.vNodeStore.AllNodeNum()))
+				metrics.VNodeLeaseNum.WithLabelValues(vNodeController.clientID).Set(float64(len(vNodeController.vNodeStore.GetLeaseOccupiedVNodes(vNodeController.clientID))))
+
 				outdatedVNodeNames := vNodeController.vNodeStore.GetLeaseOutdatedVNodeNames(vNodeController.clientID)
 				if outdatedVNodeNames != nil && len(outdatedVNodeNames) > 0 {
 					nodeNames := make([]string, 0, len(outdatedVNodeNames))
@@ -191,22 +327,29 @@ func (vNodeController *VNodeController) SetupWithManager(ctx context.Context, mg
 			})
 
 			// Periodically check for nodes that are not reachable and notify their leader virtual nodes.
-			go utils.TimedTaskWithInterval(ctx, 3*time.Second, func(ctx context.Context) {
+			go utils.TimedTaskWithInterval(ctx, vNodeController.liveness.UnReachableScanInterval, func(ctx context.Context) {
 				unReachableVNodes := vNodeController.vNodeStore.GetUnReachableVNodes()
+				metrics.VNodeNum.WithLabelValues(metrics.VNodeStateUnReachable).Set(float64(len(unReachableVNodes)))
 				if unReachableVNodes != nil && len(unReachableVNodes) > 0 {
 					nodeNames := make([]string, 0, len(unReachableVNodes))
 					for _, vNode := range unReachableVNodes {
 						nodeNames = append(nodeNames, vNode.GetNodeName())
+						if vNode.IsLeader(vNodeController.clientID) {
+							vNodeController.markVNodeNotReady(ctx, vNode)
+						}
 					}
 					log.G(ctx).Infof("check not reachable vnode %v", nodeNames)
 				}
 
 				deadVNodes := vNodeController.vNodeStore.GetDeadVNodes()
+				metrics.VNodeNum.WithLabelValues(metrics.VNodeStateDead).Set(float64(len(deadVNodes)))
 				if deadVNodes != nil && len(deadVNodes) > 0 {
 					nodeNames := make([]string, 0, len(deadVNodes))
 					for _, vNode := range deadVNodes {
 						nodeNames = append(nodeNames, vNode.GetNodeName())
-						if vNode.IsLeader(vNodeController.clientID) {
+						// the draining vnode will be shut down after drained
+						if vNode.IsLeader(vNodeController.clientID) && !vNode.IsDraining() {
+							vNode.RecordEvent(corev1.EventTypeWarning, model.NodeEventReasonDead, "base %s is dead, vnode shut down by %s", vNode.GetNodeName(), vNodeController.clientID)
 							vNodeController.shutdownVNode(vNode.GetNodeName())
 						}
 					}
@@ -226,10 +369,38 @@ func (vNodeController *VNodeController) SetupWithManager(ctx context.Context, mg
 	return nil
 }
 
+// discoverVNodesFromKube lists the vnodes of the env from kubernetes and restarts the virtual kubelet for them
+func (vNodeController *VNodeController) discoverVNodesFromKube(ctx context.Context) error {
+	componentRequirement, _ := labels.NewRequirement(model.LabelKeyOfComponent, selection.In, []string{model.ComponentVNode})
+	envRequirement, _ := labels.NewRequirement(model.LabelKeyOfEnv, selection.In, []string{vNodeController.env})
+
+	nodeList := &corev1.NodeList{}
+	err := vNodeController.client.List(ctx, nodeList, &client.ListOptions{
+		LabelSelector: labels.NewSelector().Add(*componentRequirement, *envRequirement),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Discover and process previous nodes to ensure they are properly registered.
+	vNodeController.discoverPreviousNodes(nodeList)
+	return nil
+}
+
 // This function discovers and processes previous nodes to ensure they are properly registered.
 func (vNodeController *VNodeController) discoverPreviousNodes(nodeList *corev1.NodeList) {
 	// Iterate through the list of nodes to process each node.
 	for _, node := range nodeList.Items {
+		// Find the tunnel which discovered the node, nodes created before the tunnel label exists use the first tunnel.
+		tunnelKey, has := node.Labels[model.LabelKeyOfVNodeTunnel]
+		if !has {
+			tunnelKey = vNodeController.tunnels[0].Key()
+		}
+		t := vNodeController.getTunnel(tunnelKey)
+		if t == nil {
+			log.G(context.Background()).Errorf("skip previous node %s, tunnel %s not found", node.Name, tunnelKey)
+			continue
+		}
 		// Initialize node IP and hostname with default values.
 		nodeIP := "127.0.0.1"
 		nodeHostname := "unknown"
@@ -241,8 +412,15 @@ func (vNodeController *VNodeController) discoverPreviousNodes(nodeList *corev1.N
 				nodeHostname = addr.Address
 			}
 		}
+		// the internal ip is the kubelet api address when served, the base ip is kept in the annotation
+		if baseIP, has := node.Annotations[model.AnnotationKeyOfBaseIP]; has {
+			nodeIP = baseIP
+		}
+		if hostname, has := node.Labels[corev1.LabelHostname]; has {
+			nodeHostname = hostname
+		}
 		// Start the virtual node with the extracted information.
-		vNodeController.startVNode(model.NodeInfo{
+		vNodeController.startVNode(t, model.NodeInfo{
 			Metadata: model.NodeMetadata{
 				Name:        node.Name,
 				Version:     node.Labels[model.LabelKeyOfBaseVersion],
@@ -274,15 +452,59 @@ func (vNodeController *VNodeController) discoverPreviousPods(ctx context.Context
 // The following functions are event handlers for various node and pod events.
 // They are used to manage the state of the virtual nodes and synchronize the node and pod information.
 
-// onBaseDiscovered is an event handler for when a new node is discovered.
+// onBaseDiscovered is an event handler for when a new node is discovered by the tunnel.
 // It starts a virtual node if the node's status is activated, otherwise it shuts down the virtual node.
-func (vNodeController *VNodeController) onBaseDiscovered(data model.NodeInfo) {
+func (vNodeController *VNodeController) onBaseDiscovered(t tunnel.Tunnel, data model.NodeInfo) {
 	if data.State == model.NodeStateActivated {
-		vNodeController.startVNode(data)
-	} else {
-		// TODO: update node status
+		vNodeController.startVNode(t, data)
+	} else if vNodeController.drainTimeout > 0 {
+		vNodeController.drainVNode(data.Metadata.Name)
 	}
 	vNodeController.vNodeStore.UpdateNodeStateOnProviderArrived(data.Metadata.Name, data.State)
+
+	// heartbeat resumed, revert the not ready vnode
+	vNode := vNodeController.vNodeStore.GetVNode(data.Metadata.Name)
+	if data.State == model.NodeStateActivated && vNode != nil && vNode.IsNotReady() && vNode.IsLeader(vNodeController.clientID) {
+		ctx := context.Background()
+		if _, err := vNode.MarkReady(ctx); err != nil {
+			log.G(ctx).WithError(err).Errorf("failed to mark vnode %s ready", data.Metadata.Name)
+			return
+		}
+		log.G(ctx).Infof("vnode %s is reachable again, marked ready", data.Metadata.Name)
+		vNode.RecordEvent(corev1.EventTypeNormal, model.NodeEventReasonReady, "base %s is reachable again, vnode marked ready by %s", data.Metadata.Name, vNodeController.clientID)
+	}
+}
+
+// drainVNode drains the deactivated vnode in background and shuts it down after drained
+func (vNodeController *VNodeController) drainVNode(nodeName string) {
+	vNode := vNodeController.vNodeStore.GetVNode(nodeName)
+	if vNode == nil || !vNode.IsLeader(vNodeController.clientID) || !vNode.StartDraining() {
+		return
+	}
+
+	vNode.RecordEvent(corev1.EventTypeNormal, model.NodeEventReasonDraining, "base %s deactivated, vnode drained by %s", nodeName, vNodeController.clientID)
+	go func() {
+		vNode.Drain(context.Background(), vNodeController.drainTimeout)
+		vNodeController.shutdownVNode(nodeName)
+	}()
+}
+
+// markVNodeNotReady marks the unreachable vnode not ready and notifies the tunnel
+func (vNodeController *VNodeController) markVNodeNotReady(ctx context.Context, vNode *provider.VNode) {
+	changed, err := vNode.MarkNotReady(ctx)
+	if err != nil {
+		log.G(ctx).WithError(err).Errorf("failed to mark vnode %s not ready", vNode.GetNodeName())
+		return
+	}
+	if !changed {
+		return
+	}
+	log.G(ctx).Infof("vnode %s is unreachable, marked not ready", vNode.GetNodeName())
+	vNode.RecordEvent(corev1.EventTypeWarning, model.NodeEventReasonUnreachable, "base %s missed its heartbeats, vnode marked not ready by %s", vNode.GetNodeName(), vNodeController.clientID)
+
+	if t := vNode.GetTunnel(); t != nil {
+		t.OnNodeNotReady(vNode.GetNodeName())
+	}
 }
 
 // onBaseStatusArrived is an event handler for when status data is received for a node.
@@ -297,6 +519,7 @@ func (vNodeController *VNodeController) onBaseStatusArrived(nodeName string, dat
 
 	if vNode.IsLeader(vNodeController.clientID) {
 		vNode.SyncNodeStatus(data)
+		vNodeController.observeHealthData(nodeName, data)
 	}
 }
 
@@ -312,10 +535,17 @@ func (vNodeController *VNodeController) onAllBizStatusArrived(nodeName string, b
 
 	if vNode.IsLeader(vNodeController.clientID) {
 		ctx := context.Background()
-		pods, _ := vNodeController.listPodFromKube(ctx, nodeName)
-		bizStatusDatasWithPodKey, _ := utils.FillPodKey(pods, bizStatusDatas)
+		pods, err := vNodeController.listPodFromKube(ctx, nodeName)
+		if err != nil {
+			// without the pods all bizs would be taken as orphans, wait for the next status
+			log.G(ctx).WithError(err).Errorf("failed to list pods of %s, biz status skipped", nodeName)
+			return
+		}
+		bizStatusDatasWithPodKey, orphanBizs := utils.FillPodKey(pods, bizStatusDatas, vNodeController.getBizClassifier(vNode.GetTunnel()))
 
-		vNode.SyncAllContainerInfo(ctx, bizStatusDatasWithPodKey)
+		changed := vNode.SyncAllContainerInfo(ctx, bizStatusDatasWithPodKey)
+		vNodeController.observeBizStatus(nodeName, changed)
+		vNodeController.collectOrphanBizs(ctx, vNode, orphanBizs)
 	}
 }
 
@@ -331,8 +561,12 @@ func (vNodeController *VNodeController) onSingleBizStatusArrived(nodeName string
 
 	if vNode.IsLeader(vNodeController.clientID) {
 		ctx := context.Background()
-		pods, _ := vNodeController.listPodFromKube(ctx, nodeName)
-		bizStatusDatasWithPodKey, _ := utils.FillPodKey(pods, []model.BizStatusData{bizStatusData})
+		pods, err := vNodeController.listPodFromKube(ctx, nodeName)
+		if err != nil {
+			log.G(ctx).WithError(err).Errorf("failed to list pods of %s, biz status skipped", nodeName)
+			return
+		}
+		bizStatusDatasWithPodKey, _ := utils.FillPodKey(pods, []model.BizStatusData{bizStatusData}, vNodeController.getBizClassifier(vNode.GetTunnel()))
 
 		if len(bizStatusDatasWithPodKey) == 0 {
 			return
@@ -342,6 +576,65 @@ func (vNodeController *VNodeController) onSingleBizStatusArrived(nodeName string
 	}
 }
 
+// onBizStatusDeltaArrived is an event handler for when the biz status changes of a node arrive as a delta.
+// It updates the status of the changed containers, and requests a full delta when a revision gap is found.
+func (vNodeController *VNodeController) onBizStatusDeltaArrived(reporter tunnel.BizStatusDeltaReporter, nodeName string, delta model.BizStatusDelta) {
+	vNode := vNodeController.vNodeStore.GetVNode(nodeName)
+
+	// if not exist then return
+	if vNode == nil {
+		return
+	}
+
+	if vNode.IsLeader(vNodeController.clientID) {
+		ctx := context.Background()
+		pods, err := vNodeController.listPodFromKube(ctx, nodeName)
+		if err != nil {
+			// the delta is not applied, the revision gap found by the next delta requests a full one
+			log.G(ctx).WithError(err).Errorf("failed to list pods of %s, biz status delta %d skipped", nodeName, delta.Revision)
+			return
+		}
+		var orphanBizs []model.BizStatusData
+		delta.Bizs, orphanBizs = utils.FillPodKey(pods, delta.Bizs, vNodeController.getBizClassifier(vNode.GetTunnel()))
+
+		if !vNode.SyncBizStatusDelta(ctx, delta) {
+			if err := reporter.RequestFullBizStatus(nodeName); err != nil {
+				log.G(ctx).WithError(err).Errorf("failed to request full biz status of %s", nodeName)
+			}
+		} else if delta.Full {
+			// only a full delta tells all the orphan bizs
+			vNodeController.collectOrphanBizs(ctx, vNode, orphanBizs)
+		}
+	}
+}
+
+// getBizClassifier returns the classifier of the containers on the vnodes of the tunnel,
+// the configured classifier comes first, then the tunnel if it implements model.BizClassifier, then the default one
+func (vNodeController *VNodeController) getBizClassifier(t tunnel.Tunnel) model.BizClassifier {
+	if vNodeController.bizClassifier != nil {
+		return vNodeController.bizClassifier
+	}
+	if bizClassifier, ok := t.(model.BizClassifier); ok {
+		return bizClassifier
+	}
+	return utils.DefaultBizClassifier
+}
+
+// onBizOperationResponseArrived is an event handler for when the response of an async biz operation arrives.
+// It completes the pending operation in the virtual node.
+func (vNodeController *VNodeController) onBizOperationResponseArrived(nodeName string, response model.BizOperationResponse) {
+	vNode := vNodeController.vNodeStore.GetVNode(nodeName)
+
+	// if not exist then return
+	if vNode == nil {
+		return
+	}
+
+	if vNode.IsLeader(vNodeController.clientID) {
+		vNode.SyncBizOperationResponse(context.Background(), response)
+	}
+}
+
 // podAddHandler is an event handler for when a new pod is created.
 // It syncs the pod from Kubernetes to the virtual node.
 func (vNodeController *VNodeController) podAddHandler(ctx context.Context, podFromKubernetes *corev1.Pod) {
@@ -373,6 +666,8 @@ func (vNodeController *VNodeController) podAddHandler(ctx context.Context, podFr
 	ctx = span.WithField(ctx, "key", key)
 
 	vn.SyncPodsFromKubernetesEnqueue(ctx, key)
+	// a deployment changes the biz status soon, poll fast until nothing changes
+	vNodeController.speedUpPolling(nodeName)
 }
 
 // This function handles pod updates by checking if the pod is new or if its status has changed.
@@ -406,6 +701,7 @@ func (vNodeController *VNodeController) podUpdateHandler(ctx context.Context, ol
 
 	if podShouldEnqueue(oldPodFromKubernetes, newPodFromKubernetes) {
 		vNode.SyncPodsFromKubernetesEnqueue(ctx, key)
+		vNodeController.speedUpPolling(nodeName)
 	}
 }
 
@@ -437,10 +733,11 @@ func (vNodeController *VNodeController) podDeleteHandler(ctx context.Context, po
 	// If this pod was in the deletion queue, forget about it
 	key = fmt.Sprintf("%v/%v", key, podFromKubernetes.UID)
 	vNode.DeletePodsFromKubernetesForget(ctx, key)
+	vNodeController.speedUpPolling(nodeName)
 }
 
 // This function starts a new virtual node with the given node ID, initialization data, and tunnel.
-func (vNodeController *VNodeController) startVNode(initData model.NodeInfo) {
+func (vNodeController *VNodeController) startVNode(t tunnel.Tunnel, initData model.NodeInfo) {
 	vNodeController.Lock()
 	defer vNodeController.Unlock()
 	// first apply for local lock
@@ -456,35 +753,62 @@ func (vNodeController *VNodeController) startVNode(initData model.NodeInfo) {
 		return
 	}
 
+	if vNodeController.isCluster && vNodeController.shardRing.Load() == nil {
+		// the replicas are not discovered yet, the base is started once the shard synced instead of dropping the heartbeat
+		vNodeController.pendingBases.Store(nodeName, pendingBase{tunnel: t, nodeInfo: initData})
+		return
+	}
+
+	// only the vnodes in the shard of this vk are started, the others are started by their own vk replicas
+	if !vNodeController.isInShard(nodeName) {
+		return
+	}
+
 	log.G(context.Background()).Infof("starting vnode %s", nodeName)
+	kubeletListener, kubeletPort := vNodeController.listenKubeletAPI(nodeName)
 	var err error
 	vn, err := provider.NewVNode(&model.BuildVNodeConfig{
-		Client:            vNodeController.client,
-		KubeCache:         vNodeController.cache,
-		NodeIP:            initData.NetworkInfo.NodeIP,
-		NodeHostname:      initData.NetworkInfo.HostName,
-		NodeName:          initData.Metadata.Name,
-		NodeVersion:       initData.Metadata.Version,
-		VPodType:          vNodeController.vPodType,
-		ClusterName:       initData.Metadata.ClusterName,
-		Env:               vNodeController.env,
-		CustomTaints:      initData.CustomTaints,
-		CustomLabels:      initData.CustomLabels,
-		CustomAnnotations: initData.CustomAnnotations,
-		WorkerNum:         vNodeController.vNodeWorkerNum,
-	}, vNodeController.tunnel)
+		Client:             vNodeController.client,
+		KubeCache:          vNodeController.cache,
+		NodeIP:             initData.NetworkInfo.NodeIP,
+		NodeHostname:       initData.NetworkInfo.HostName,
+		NodeName:           initData.Metadata.Name,
+		NodeVersion:        initData.Metadata.Version,
+		VPodType:           vNodeController.vPodType,
+		ClusterName:        initData.Metadata.ClusterName,
+		Env:                vNodeController.env,
+		CustomTaints:       initData.CustomTaints,
+		CustomLabels:       initData.CustomLabels,
+		CustomAnnotations:  initData.CustomAnnotations,
+		WorkerNum:          vNodeController.vNodeWorkerNum,
+		EventRecorder:      vNodeController.eventRecorder,
+		Liveness:           utils.MergeLivenessConfigFromLabels(vNodeController.liveness, initData.CustomLabels),
+		BizClassifier:      vNodeController.getBizClassifier(t),
+		KubeletAddress:     vNodeController.kubeletAddress(kubeletListener),
+		KubeletPort:        kubeletPort,
+		VPodStorePersister: vNodeController.vPodStorePersister,
+		PodStatusWriter:    vNodeController.podStatusWriter,
+	}, t)
 	if err != nil {
 		err = errpkg.Wrap(err, "Error creating vnode")
+		if kubeletListener != nil {
+			kubeletListener.Close()
+		}
 		return
 	}
 
 	vNodeController.vNodeStore.AddVNode(nodeName, vn)
+	vn.RecordEvent(corev1.EventTypeNormal, model.NodeEventReasonDiscovered, "base %s discovered by tunnel %s, vnode started by %s", nodeName, t.Key(), vNodeController.clientID)
 
 	// Create a new context with the nodeName as a value
 	vnCtx := context.WithValue(context.Background(), "nodeName", nodeName)
 	// Create a new context with a cancel function
 	vnCtx, vnCancel := context.WithCancel(vnCtx)
 
+	if kubeletListener != nil {
+		go vNodeController.serveKubeletAPI(vnCtx, kubeletListener, nodeName)
+	}
+
 	// Start a new goroutine
 	go func() {
 		// Start a select statement
@@ -498,6 +822,8 @@ func (vNodeController *VNodeController) startVNode(initData model.NodeInfo) {
 		}
 		// Cancel the context
 		vNodeController.vNodeStore.DeleteVNode(nodeName)
+		vNodeController.stopPolling(nodeName)
+		vNodeController.forgetOrphanBizs(nodeName)
 		log.G(vnCtx).Infof("node exit %s", nodeName)
 		vnCancel()
 	}()
@@ -519,28 +845,70 @@ func (vNodeController *VNodeController) startVNode(initData model.NodeInfo) {
 			return
 		} else {
 			vNodeController.vNodeStore.AddVNode(nodeName, vn)
+			vn.RecordEvent(corev1.EventTypeNormal, model.NodeEventReasonReady, "vnode %s is ready on %s", nodeName, vNodeController.clientID)
 		}
 
-		// Start a new goroutine to fetch node health data every 10 seconds
-		go utils.TimedTaskWithInterval(vnCtx, time.Second*10, func(ctx context.Context) {
-			log.G(vnCtx).Info("fetch node health data for node ", nodeName)
-			err = vNodeController.tunnel.FetchHealthData(nodeName)
-			if err != nil {
-				log.G(vnCtx).WithError(err).Errorf("Failed to fetch node health info from %s", nodeName)
+		// The tunnel reporting deltas is resynced only on revision gaps, start from a full delta
+		if reporter, ok := t.(tunnel.BizStatusDeltaReporter); ok {
+			if err = reporter.RequestFullBizStatus(nodeName); err != nil {
+				log.G(vnCtx).WithError(err).Errorf("Failed to request full biz status from %s", nodeName)
 			}
-		})
+		}
 
-		// Start a new goroutine to query all container status data every 15 seconds
-		go utils.TimedTaskWithInterval(vnCtx, time.Second*15, func(ctx context.Context) {
-			log.G(vnCtx).Info("query all container status data for node ", nodeName)
-			err = vNodeController.tunnel.QueryAllBizStatusData(nodeName)
-			if err != nil {
-				log.G(vnCtx).WithError(err).Errorf("Failed to query containers info from %s", nodeName)
-			}
-		})
+		// Poll the health data and all container status data of the base with adaptive intervals
+		vNodeController.startPolling(vnCtx, t, nodeName)
 	}()
 }
 
+// leaderVNodes returns the vnodes led by this controller
+func (vNodeController *VNodeController) leaderVNodes() []*provider.VNode {
+	ret := make([]*provider.VNode, 0)
+	for _, vNode := range vNodeController.vNodeStore.GetVNodes() {
+		if vNode.IsLeader(vNodeController.clientID) {
+			ret = append(ret, vNode)
+		}
+	}
+	return ret
+}
+
+// handOffVNodes hands off the vnodes to the other vk instances in parallel
+func (vNodeController *VNodeController) handOffVNodes(vNodes []*provider.VNode) {
+	// the controller context may be done, use a new one to finish the handoff
+	ctx, cancel := context.WithTimeout(context.Background(), (model.VNodeHandoffTimeoutSeconds+5)*time.Second)
+	defer cancel()
+
+	wg := sync.WaitGroup{}
+	for _, vNode := range vNodes {
+		wg.Add(1)
+		go func(vNode *provider.VNode) {
+			defer wg.Done()
+			if err := vNode.HandOff(ctx, vNodeController.clientID); err != nil {
+				log.G(ctx).WithError(err).Errorf("failed to hand off vnode %s", vNode.GetNodeName())
+			}
+		}(vNode)
+	}
+	wg.Wait()
+}
+
+// getTunnel returns the tunnel with the given key, nil if not found.
+func (vNodeController *VNodeController) getTunnel(tunnelKey string) tunnel.Tunnel {
+	for _, t := range vNodeController.tunnels {
+		if t.Key() == tunnelKey {
+			return t
+		}
+	}
+	return nil
+}
+
+// tunnelKeys returns the keys of all tunnels.
+func (vNodeController *VNodeController) tunnelKeys() []string {
+	keys := make([]string, 0, len(vNodeController.tunnels))
+	for _, t := range vNodeController.tunnels {
+		keys = append(keys, t.Key())
+	}
+	return keys
+}
+
 // This function calculates the workload level based on the number of running nodes and the total number of nodes.
 func (vNodeController *VNodeController) workloadLevel() int {
 	if vNodeController.vNodeStore.AllNodeNum() == 0 {
@@ -22,12 +22,21 @@ func TestNewVNodeController_NoConfig(t *testing.T) {
 }
 
 func TestNewVNodeController_ConfigNoTunnels(t *testing.T) {
-	_, err := NewVNodeController(&model.BuildVNodeControllerConfig{}, nil)
+	_, err := NewVNodeController(&model.BuildVNodeControllerConfig{
+		VPodType: "suite",
+	}, nil)
+	assert.NotNil(t, err)
+}
+
+func TestNewVNodeController_DuplicateTunnels(t *testing.T) {
+	_, err := NewVNodeController(&model.BuildVNodeControllerConfig{
+		VPodType: "suite",
+	}, []tunnel.Tunnel{&tunnel.MockTunnel{}, &tunnel.MockTunnel{}})
 	assert.NotNil(t, err)
 }
 
 func TestNewVNodeController_ConfigNoIdentity(t *testing.T) {
-	_, err := NewVNodeController(&model.BuildVNodeControllerConfig{}, &tunnel.MockTunnel{})
+	_, err := NewVNodeController(&model.BuildVNodeControllerConfig{}, []tunnel.Tunnel{&tunnel.MockTunnel{}})
 	assert.NotNil(t, err)
 }
 
@@ -36,7 +45,7 @@ func TestNewVNodeController_Success(t *testing.T) {
 		VPodType:  "suite",
 		KubeCache: &informertest.FakeInformers{},
 		IsCluster: true,
-	}, &tunnel.MockTunnel{})
+	}, []tunnel.Tunnel{&tunnel.MockTunnel{}})
 	assert.Nil(t, err)
 }
 
@@ -46,7 +55,7 @@ func TestDiscoverPreviousNode(t *testing.T) {
 	vc, _ := NewVNodeController(&model.BuildVNodeControllerConfig{
 		KubeCache: &informertest.FakeInformers{},
 		VPodType:  "suite",
-	}, &mockTunnel)
+	}, []tunnel.Tunnel{&mockTunnel})
 
 	nodeList := &corev1.NodeList{
 		Items: []corev1.Node{
@@ -94,7 +103,7 @@ func TestDiscoverPreviousPods(t *testing.T) {
 	vc, _ := NewVNodeController(&model.BuildVNodeControllerConfig{
 		KubeCache: &informertest.FakeInformers{},
 		VPodType:  "suite",
-	}, &mockTunnel)
+	}, []tunnel.Tunnel{&mockTunnel})
 	vn := &provider.VNode{
 		//tunnel: &mockTunnel,
 	}
@@ -136,12 +145,24 @@ func TestDiscoverPreviousPods(t *testing.T) {
 	})
 }
 
+func TestGetTunnel(t *testing.T) {
+	mockTunnel := tunnel.MockTunnel{}
+	vc, _ := NewVNodeController(&model.BuildVNodeControllerConfig{
+		VPodType:  "suite",
+		KubeCache: &informertest.FakeInformers{},
+	}, []tunnel.Tunnel{&mockTunnel})
+
+	assert.Equal(t, &mockTunnel, vc.getTunnel(mockTunnel.Key()))
+	assert.Nil(t, vc.getTunnel("not-exist"))
+	assert.Equal(t, []string{mockTunnel.Key()}, vc.tunnelKeys())
+}
+
 func TestReconcile(t *testing.T) {
 	mockTunnel := tunnel.MockTunnel{}
 	vc, _ := NewVNodeController(&model.BuildVNodeControllerConfig{
 		VPodType:  "suite",
 		KubeCache: &informertest.FakeInformers{},
-	}, &mockTunnel)
+	}, []tunnel.Tunnel{&mockTunnel})
 
 	result, err := vc.Reconcile(nil, reconcile.Request{})
 	assert.Nil(t, err)
@@ -153,7 +174,7 @@ func TestCallBack_NoVnode(t *testing.T) {
 	vc, _ := NewVNodeController(&model.BuildVNodeControllerConfig{
 		VPodType:  "suite",
 		KubeCache: &informertest.FakeInformers{},
-	}, &mockTunnel)
+	}, []tunnel.Tunnel{&mockTunnel})
 
 	vc.onBaseStatusArrived("test", model.NodeStatusData{})
 	vc.onAllBizStatusArrived("test", nil)
@@ -166,7 +187,7 @@ func TestPodHandler_NoVnodeOrNotLeader(t *testing.T) {
 	vc, _ := NewVNodeController(&model.BuildVNodeControllerConfig{
 		VPodType:  "suite",
 		KubeCache: &informertest.FakeInformers{},
-	}, &mockTunnel)
+	}, []tunnel.Tunnel{&mockTunnel})
 
 	ctx := context.TODO()
 
@@ -217,7 +238,7 @@ func TestWorkloadLevel(t *testing.T) {
 	vc, _ := NewVNodeController(&model.BuildVNodeControllerConfig{
 		VPodType:  "suite",
 		KubeCache: &informertest.FakeInformers{},
-	}, &mockTunnel)
+	}, []tunnel.Tunnel{&mockTunnel})
 
 	level := vc.workloadLevel()
 	assert.Equal(t, 0, level)
@@ -231,7 +252,7 @@ func TestDelayWithWorkload(t *testing.T) {
 	vc, _ := NewVNodeController(&model.BuildVNodeControllerConfig{
 		KubeCache: &informertest.FakeInformers{},
 		VPodType:  "suite",
-	}, &mockTunnel)
+	}, []tunnel.Tunnel{&mockTunnel})
 	now := time.Now()
 	vc.delayWithWorkload(context.TODO())
 	vc.isCluster = true
@@ -250,7 +271,7 @@ func TestShutdownNonExistVNode(t *testing.T) {
 	vc, _ := NewVNodeController(&model.BuildVNodeControllerConfig{
 		VPodType:  "suite",
 		KubeCache: &informertest.FakeInformers{},
-	}, &mockTunnel)
+	}, []tunnel.Tunnel{&mockTunnel})
 	vc.shutdownVNode("test-node")
 }
 
@@ -307,3 +328,34 @@ func TestPodShouldEnqueue(t *testing.T) {
 		},
 	}))
 }
+
+func TestNewVNodeController_KubeletServer(t *testing.T) {
+	vc, err := NewVNodeController(&model.BuildVNodeControllerConfig{
+		VPodType:      "suite",
+		KubeCache:     &informertest.FakeInformers{},
+		KubeletServer: &model.KubeletServerConfig{Address: "10.0.0.1", MinPort: 10250, MaxPort: 10350},
+	}, []tunnel.Tunnel{&tunnel.MockTunnel{}})
+	assert.Nil(t, err)
+	assert.NotNil(t, vc.podHandlerConfig("node").GetContainerLogs)
+
+	listener, port := vc.listenKubeletAPI("node")
+	assert.NotNil(t, listener)
+	defer listener.Close()
+	assert.True(t, port >= 10250 && port <= 10350)
+	assert.Equal(t, "10.0.0.1", vc.kubeletAddress(listener))
+	assert.Equal(t, "", vc.kubeletAddress(nil))
+
+	_, err = NewVNodeController(&model.BuildVNodeControllerConfig{
+		VPodType:      "suite",
+		KubeCache:     &informertest.FakeInformers{},
+		KubeletServer: &model.KubeletServerConfig{},
+	}, []tunnel.Tunnel{&tunnel.MockTunnel{}})
+	assert.NotNil(t, err)
+
+	_, err = NewVNodeController(&model.BuildVNodeControllerConfig{
+		VPodType:      "suite",
+		KubeCache:     &informertest.FakeInformers{},
+		KubeletServer: &model.KubeletServerConfig{Address: "10.0.0.1", MinPort: 10350, MaxPort: 10250},
+	}, []tunnel.Tunnel{&tunnel.MockTunnel{}})
+	assert.NotNil(t, err)
+}